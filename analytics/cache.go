@@ -0,0 +1,68 @@
+package analytics
+
+import (
+	"covid/series"
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+type cacheKey struct {
+	metric  series.Metric
+	model   Model
+	horizon int
+}
+
+type cacheEntry struct {
+	fingerprint uint64
+	forecast    Forecast
+}
+
+// forecastCache keeps the forecasts of every country with a fingerprint of the history they were
+// computed from. Statistics can be written by the REST and GraphQL APIs and by the fetcher, so instead
+// of being told about every write, an entry is only used while the history still has the same fingerprint.
+type forecastCache struct {
+	mu      sync.Mutex
+	entries map[int]map[cacheKey]cacheEntry
+}
+
+var forecasts = &forecastCache{entries: map[int]map[cacheKey]cacheEntry{}}
+
+func (c *forecastCache) get(countryID int, key cacheKey, fingerprint uint64) (Forecast, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[countryID][key]
+	if !ok || entry.fingerprint != fingerprint {
+		return Forecast{}, false
+	}
+	return entry.forecast, true
+}
+
+func (c *forecastCache) put(countryID int, key cacheKey, fingerprint uint64, forecast Forecast) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries := c.entries[countryID]
+	// the other forecasts of the country were computed from an older history when the fingerprint changed:
+	for k, entry := range entries {
+		if entry.fingerprint != fingerprint {
+			delete(entries, k)
+		}
+	}
+	if entries == nil {
+		entries = map[cacheKey]cacheEntry{}
+		c.entries[countryID] = entries
+	}
+	entries[key] = cacheEntry{fingerprint: fingerprint, forecast: forecast}
+}
+
+func fingerprintOf(points []series.Point) uint64 {
+	h := fnv.New64a()
+	var value [8]byte
+	for _, point := range points {
+		h.Write([]byte(point.Date))
+		binary.LittleEndian.PutUint64(value[:], math.Float64bits(point.Value))
+		h.Write(value[:])
+	}
+	return h.Sum64()
+}
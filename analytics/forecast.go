@@ -0,0 +1,176 @@
+package analytics
+
+import (
+	"context"
+	"covid/database"
+	"covid/series"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+type Model string
+
+const (
+	ModelHoltWinters Model = "holt_winters"
+	ModelSIR         Model = "sir"
+)
+
+const (
+	// MaxHorizon is the number of days a forecast can project, they are meaningless much further.
+	MaxHorizon = 60
+	// Confidence is the coverage of the intervals of a forecast.
+	Confidence = 0.95
+	// z-score of Confidence.
+	confidenceZ = 1.96
+
+	dateLayout = "2006-01-02"
+)
+
+var ErrNotEnoughData = errors.New("not enough statistics to forecast")
+
+// Point is the projected value of one day, and its confidence interval.
+type Point struct {
+	Date  string
+	Value float64
+	Lower float64
+	Upper float64
+}
+
+// Parameter is a parameter fitted by a model, such as a smoothing factor or R0.
+type Parameter struct {
+	Name  string
+	Value float64
+}
+
+type Forecast struct {
+	Country    database.Country
+	Metric     series.Metric
+	Model      Model
+	Confidence float64
+	Parameters []Parameter
+	Points     []Point
+}
+
+// fit is what a model returns: projected daily values, the half width of their confidence
+// intervals, and the fitted parameters.
+type fit struct {
+	values     []float64
+	halfWidths []float64
+	parameters []Parameter
+}
+
+// ForecastCountry projects a metric of a country horizon days after its last statistic. Forecasts are
+// cached per country until its statistics change.
+func ForecastCountry(ctx context.Context, d database.Store, countryID int, metric series.Metric, horizon int, model Model) (Forecast, error) {
+	if horizon < 1 || horizon > MaxHorizon {
+		return Forecast{}, fmt.Errorf("the horizon must be between 1 and %d days", MaxHorizon)
+	}
+
+	// models work on daily values, they are computed from the cumulative series:
+	history, err := series.Load(ctx, d, countryID, cumulative(metric), nil, nil)
+	if err != nil {
+		return Forecast{}, err
+	}
+
+	key := cacheKey{metric: metric, model: model, horizon: horizon}
+	fingerprint := fingerprintOf(history.Points)
+	if forecast, ok := forecasts.get(countryID, key, fingerprint); ok {
+		return forecast, nil
+	}
+
+	forecast, err := Project(history, metric, horizon, model)
+	if err != nil {
+		return Forecast{}, err
+	}
+	forecasts.put(countryID, key, fingerprint, forecast)
+	return forecast, nil
+}
+
+// Project forecasts metric from history, the cumulative series the metric is computed from.
+func Project(history series.Series, metric series.Metric, horizon int, model Model) (Forecast, error) {
+	if len(history.Points) < 2 {
+		return Forecast{}, ErrNotEnoughData
+	}
+	daily := dailyValues(history.Points)
+
+	var f fit
+	var err error
+	switch model {
+	case ModelHoltWinters:
+		f, err = holtWinters(daily, horizon)
+	case ModelSIR:
+		f, err = sir(history.Points, daily, horizon)
+	default:
+		return Forecast{}, fmt.Errorf("unknown forecast model %q", model)
+	}
+	if err != nil {
+		return Forecast{}, err
+	}
+
+	last, err := time.Parse(dateLayout, history.Points[len(history.Points)-1].Date)
+	if err != nil {
+		return Forecast{}, fmt.Errorf("invalid statistic date: %w", err)
+	}
+
+	forecast := Forecast{
+		Country:    history.Country,
+		Metric:     metric,
+		Model:      model,
+		Confidence: Confidence,
+		Parameters: f.parameters,
+		Points:     make([]Point, horizon),
+	}
+	// cumulative metrics add the daily values up; their intervals add up too, as if every day were off the same way:
+	total := history.Points[len(history.Points)-1].Value
+	halfWidth := 0.0
+	for h := 0; h < horizon; h++ {
+		value := math.Max(f.values[h], 0)
+		point := Point{Date: last.AddDate(0, 0, h+1).Format(dateLayout)}
+		if metric.IsDelta() {
+			point.Value = value
+			point.Lower = math.Max(value-f.halfWidths[h], 0)
+			point.Upper = value + f.halfWidths[h]
+		} else {
+			total += value
+			halfWidth += f.halfWidths[h]
+			point.Value = total
+			point.Lower = math.Max(total-halfWidth, history.Points[len(history.Points)-1].Value)
+			point.Upper = total + halfWidth
+		}
+		forecast.Points[h] = point
+	}
+	return forecast, nil
+}
+
+// cumulative returns the cumulative metric a daily delta is computed from.
+func cumulative(metric series.Metric) series.Metric {
+	switch metric {
+	case series.MetricNewConfirmed:
+		return series.MetricConfirmed
+	case series.MetricNewRecovered:
+		return series.MetricRecovered
+	case series.MetricNewDeaths:
+		return series.MetricDeaths
+	}
+	return metric
+}
+
+// dailyValues returns the daily increases of a cumulative series. Decreases are corrections of
+// earlier reports rather than negative cases, they count as no new cases.
+func dailyValues(points []series.Point) []float64 {
+	daily := make([]float64, len(points)-1)
+	for i := 1; i < len(points); i++ {
+		daily[i-1] = math.Max(points[i].Value-points[i-1].Value, 0)
+	}
+	return daily
+}
+
+// residualDeviation is the standard deviation of one-step errors.
+func residualDeviation(sse float64, n int) float64 {
+	if n < 2 {
+		return 0
+	}
+	return math.Sqrt(sse / float64(n-1))
+}
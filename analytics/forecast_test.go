@@ -0,0 +1,194 @@
+package analytics
+
+import (
+	"covid/series"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+var historyStart = time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+
+// history returns the cumulative series of days days starting from 1000 cases, daily(t) being the
+// increase of day t.
+func history(daily func(t int) float64, days int) series.Series {
+	s := series.Series{Points: []series.Point{{Date: historyStart.Format(dateLayout), Value: 1000}}}
+	total := 1000.0
+	for t := 0; t < days; t++ {
+		total += daily(t)
+		s.Points = append(s.Points, series.Point{Date: historyStart.AddDate(0, 0, t+1).Format(dateLayout), Value: total})
+	}
+	return s
+}
+
+func constant(value float64) func(int) float64 {
+	return func(int) float64 { return value }
+}
+
+func linear(first float64, slope float64) func(int) float64 {
+	return func(t int) float64 { return first + slope*float64(t) }
+}
+
+func exponential(first float64, rate float64) func(int) float64 {
+	return func(t int) float64 { return first * math.Pow(1+rate, float64(t)) }
+}
+
+// weekly adds a weekly reporting pattern to base, fewer cases on weekends and a catch up on Mondays.
+func weekly(base func(int) float64) func(int) float64 {
+	pattern := []float64{30, 10, 0, 0, -10, -40, -50}
+	return func(t int) float64 { return base(t) + pattern[t%seasonLength] }
+}
+
+func TestProjectDaily(t *testing.T) {
+	tests := []struct {
+		name    string
+		model   Model
+		daily   func(int) float64
+		days    int
+		horizon int
+		// largest error of the forecast relative to the extrapolated series:
+		tolerance float64
+		// daily growth rate implied by the fitted SIR parameters, 0 to skip:
+		rate float64
+	}{
+		{"holt-winters constant", ModelHoltWinters, constant(100), 35, 14, 1e-9, 0},
+		{"holt-winters linear growth without season", ModelHoltWinters, linear(10, 5), 10, 14, 0.01, 0},
+		{"holt-winters linear growth", ModelHoltWinters, linear(10, 5), 35, 14, 0.01, 0},
+		{"holt-winters weekly season", ModelHoltWinters, weekly(constant(100)), 35, 14, 0.01, 0},
+		{"holt-winters linear growth with weekly season", ModelHoltWinters, weekly(linear(100, 5)), 35, 14, 0.02, 0},
+		// an additive trend lags behind exponential growth, only the next days are close:
+		{"holt-winters exponential", ModelHoltWinters, exponential(10, 0.1), 35, 1, 0.06, 0},
+		{"sir constant", ModelSIR, constant(100), 70, 14, 0.01, 0},
+		{"sir exponential 10%", ModelSIR, exponential(10, 0.1), 70, 14, 0.01, 0.1},
+		{"sir exponential 5%", ModelSIR, exponential(50, 0.05), 70, 14, 0.02, 0.05},
+		// the window starts a week after the first statistic, the cases of that week seed the model:
+		{"sir exponential 5% short history", ModelSIR, exponential(50, 0.05), 35, 7, 0.02, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			forecast, err := Project(history(test.daily, test.days), series.MetricNewConfirmed, test.horizon, test.model)
+			if err != nil {
+				t.Fatalf("Project: %v", err)
+			}
+			if len(forecast.Points) != test.horizon {
+				t.Fatalf("got %d points, want %d", len(forecast.Points), test.horizon)
+			}
+
+			previousHalfWidth := 0.0
+			for h, point := range forecast.Points {
+				if want := historyStart.AddDate(0, 0, test.days+h+1).Format(dateLayout); point.Date != want {
+					t.Errorf("day %d: date %s, want %s", h+1, point.Date, want)
+				}
+				want := test.daily(test.days + h)
+				if math.Abs(point.Value-want) > test.tolerance*want {
+					t.Errorf("day %d: forecast %.2f, want %.2f ± %g%%", h+1, point.Value, want, test.tolerance*100)
+				}
+				if point.Lower > point.Value || point.Value > point.Upper {
+					t.Errorf("day %d: forecast %.2f outside of its interval [%.2f, %.2f]", h+1, point.Value, point.Lower, point.Upper)
+				}
+				// the uncertainty only grows with the horizon:
+				halfWidth := point.Upper - point.Value
+				if halfWidth < previousHalfWidth {
+					t.Errorf("day %d: the interval narrows from ±%.2f to ±%.2f", h+1, previousHalfWidth, halfWidth)
+				}
+				previousHalfWidth = halfWidth
+			}
+
+			if test.rate > 0 {
+				// early on, SIR infections grow by gamma*(R0-1) a day:
+				parameters := map[string]float64{}
+				for _, parameter := range forecast.Parameters {
+					parameters[parameter.Name] = parameter.Value
+				}
+				rate := (parameters["r0"] - 1) / parameters["infectiousDays"]
+				if math.Abs(rate-test.rate) > 0.05*test.rate {
+					t.Errorf("the fitted parameters %v grow by %.3f a day, want %.3f", forecast.Parameters, rate, test.rate)
+				}
+			}
+		})
+	}
+}
+
+func TestProjectConstantHasNoUncertainty(t *testing.T) {
+	forecast, err := Project(history(constant(100), 35), series.MetricNewConfirmed, 14, ModelHoltWinters)
+	if err != nil {
+		t.Fatalf("Project: %v", err)
+	}
+	for h, point := range forecast.Points {
+		if point.Lower != point.Value || point.Upper != point.Value {
+			t.Errorf("day %d: interval [%.2f, %.2f] around %.2f, a series without errors should have none", h+1, point.Lower, point.Upper, point.Value)
+		}
+	}
+}
+
+func TestProjectCumulative(t *testing.T) {
+	tests := []struct {
+		name  string
+		model Model
+		daily func(int) float64
+		days  int
+	}{
+		{"holt-winters linear growth", ModelHoltWinters, linear(10, 5), 35},
+		{"sir exponential", ModelSIR, exponential(10, 0.1), 70},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := history(test.daily, test.days)
+			last := h.Points[len(h.Points)-1].Value
+			forecast, err := Project(h, series.MetricConfirmed, 14, test.model)
+			if err != nil {
+				t.Fatalf("Project: %v", err)
+			}
+			daily, err := Project(h, series.MetricNewConfirmed, 14, test.model)
+			if err != nil {
+				t.Fatalf("Project: %v", err)
+			}
+
+			// a cumulative forecast adds the daily one up, and its interval never goes below the last total:
+			total := last
+			previousHalfWidth := 0.0
+			for i, point := range forecast.Points {
+				total += daily.Points[i].Value
+				if math.Abs(point.Value-total) > 1e-6*total {
+					t.Errorf("day %d: forecast %.2f, want the sum of the daily forecasts %.2f", i+1, point.Value, total)
+				}
+				if point.Lower < last || point.Lower > point.Value || point.Value > point.Upper {
+					t.Errorf("day %d: interval [%.2f, %.2f] around %.2f, the last total is %.2f", i+1, point.Lower, point.Upper, point.Value, last)
+				}
+				halfWidth := point.Upper - point.Value
+				if halfWidth < previousHalfWidth {
+					t.Errorf("day %d: the interval narrows from ±%.2f to ±%.2f", i+1, previousHalfWidth, halfWidth)
+				}
+				previousHalfWidth = halfWidth
+			}
+		})
+	}
+}
+
+func TestProjectNotEnoughData(t *testing.T) {
+	tests := []struct {
+		name  string
+		model Model
+		days  int
+	}{
+		{"single statistic", ModelHoltWinters, 0},
+		{"holt-winters", ModelHoltWinters, 2},
+		{"sir", ModelSIR, sirMinDays - 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Project(history(constant(100), test.days), series.MetricNewConfirmed, 7, test.model)
+			if !errors.Is(err, ErrNotEnoughData) {
+				t.Errorf("got %v, want %v", err, ErrNotEnoughData)
+			}
+		})
+	}
+}
+
+func TestProjectUnknownModel(t *testing.T) {
+	if _, err := Project(history(constant(100), 35), series.MetricNewConfirmed, 7, "arima"); err == nil {
+		t.Error("no error")
+	}
+}
@@ -0,0 +1,76 @@
+package analytics
+
+import (
+	"math"
+)
+
+const (
+	gammaEpsilon       = 1e-12
+	gammaMaxIterations = 500
+)
+
+// regularizedGammaP is the CDF of a gamma distribution with the given shape and a scale of 1, computed
+// with its series below shape+1 and its continued fraction above, as in Numerical Recipes.
+func regularizedGammaP(shape float64, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	lgamma, _ := math.Lgamma(shape)
+	prefix := math.Exp(shape*math.Log(x) - x - lgamma)
+
+	if x < shape+1 {
+		term := 1 / shape
+		sum := term
+		for n := 1; n < gammaMaxIterations; n++ {
+			term *= x / (shape + float64(n))
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*gammaEpsilon {
+				break
+			}
+		}
+		return sum * prefix
+	}
+
+	// modified Lentz's method for the continued fraction of the upper function:
+	tiny := 1e-300
+	b := x + 1 - shape
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for n := 1; n < gammaMaxIterations; n++ {
+		an := -float64(n) * (float64(n) - shape)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < gammaEpsilon {
+			break
+		}
+	}
+	return 1 - prefix*h
+}
+
+// gammaQuantile returns the value below which a share p of a gamma distribution lies, by bisection of its CDF.
+func gammaQuantile(p float64, shape float64, scale float64) float64 {
+	low, high := 0.0, shape+1
+	for regularizedGammaP(shape, high) < p {
+		high *= 2
+	}
+	for i := 0; i < 100; i++ {
+		mid := (low + high) / 2
+		if regularizedGammaP(shape, mid) < p {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return (low + high) / 2 * scale
+}
@@ -0,0 +1,127 @@
+package analytics
+
+import (
+	"math"
+)
+
+// seasonLength is a week: reports drop on weekends and catch up after.
+const seasonLength = 7
+
+// the smoothing factors tried when fitting, the ones with the smallest one-step error are kept.
+var (
+	alphas = []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9}
+	betas  = []float64{0.01, 0.05, 0.1, 0.2, 0.3}
+	gammas = []float64{0.05, 0.1, 0.2, 0.3, 0.5}
+)
+
+type smoothing struct {
+	alpha, beta, gamma float64
+	seasonal           bool
+}
+
+type smoothingState struct {
+	level, trend float64
+	seasons      []float64
+	sse          float64
+}
+
+// holtWinters fits additive Holt-Winters exponential smoothing with a weekly season. Series shorter
+// than two weeks have no season to learn from, they get Holt's linear trend method.
+func holtWinters(daily []float64, horizon int) (fit, error) {
+	if len(daily) < 3 {
+		return fit{}, ErrNotEnoughData
+	}
+	seasonal := len(daily) >= 2*seasonLength
+	seasonFactors := gammas
+	if !seasonal {
+		seasonFactors = []float64{0}
+	}
+
+	var best smoothing
+	var bestState smoothingState
+	first := true
+	for _, alpha := range alphas {
+		for _, beta := range betas {
+			for _, gamma := range seasonFactors {
+				params := smoothing{alpha: alpha, beta: beta, gamma: gamma, seasonal: seasonal}
+				state := params.run(daily)
+				if first || state.sse < bestState.sse {
+					best, bestState, first = params, state, false
+				}
+			}
+		}
+	}
+
+	sigma := residualDeviation(bestState.sse, len(daily))
+	f := fit{
+		values:     make([]float64, horizon),
+		halfWidths: make([]float64, horizon),
+		parameters: []Parameter{{Name: "alpha", Value: best.alpha}, {Name: "beta", Value: best.beta}},
+	}
+	if seasonal {
+		f.parameters = append(f.parameters, Parameter{Name: "gamma", Value: best.gamma})
+	}
+
+	// the variance of an h-step forecast of additive Holt-Winters grows with the errors carried by
+	// the level, the trend and, every season, the seasonal component:
+	variance := 0.0
+	for h := 1; h <= horizon; h++ {
+		c := 1.0
+		if h > 1 {
+			j := float64(h - 1)
+			c = best.alpha + j*best.alpha*best.beta
+			if seasonal && (h-1)%seasonLength == 0 {
+				c += best.gamma
+			}
+		}
+		variance += c * c
+
+		value := bestState.level + float64(h)*bestState.trend
+		if seasonal {
+			value += bestState.seasons[(len(daily)+h-1)%seasonLength]
+		}
+		f.values[h-1] = value
+		f.halfWidths[h-1] = confidenceZ * sigma * math.Sqrt(variance)
+	}
+	return f, nil
+}
+
+// run smooths the series and sums the squared one-step errors.
+func (s smoothing) run(y []float64) smoothingState {
+	state := smoothingState{seasons: make([]float64, seasonLength)}
+	if s.seasonal {
+		firstSeason := mean(y[:seasonLength])
+		state.level = firstSeason
+		state.trend = (mean(y[seasonLength:2*seasonLength]) - firstSeason) / seasonLength
+		// the mean of the first season is its value in the middle of the week, the trend is taken out of
+		// the seasonal components:
+		for i := 0; i < seasonLength; i++ {
+			state.seasons[i] = y[i] - (firstSeason + (float64(i)-(seasonLength-1)/2.0)*state.trend)
+		}
+	} else {
+		state.level = y[0]
+		state.trend = y[1] - y[0]
+	}
+
+	for t, value := range y {
+		season := state.seasons[t%seasonLength]
+		errorTerm := value - (state.level + state.trend + season)
+		state.sse += errorTerm * errorTerm
+
+		level := s.alpha*(value-season) + (1-s.alpha)*(state.level+state.trend)
+		state.trend = s.beta*(level-state.level) + (1-s.beta)*state.trend
+		state.level = level
+		if s.seasonal {
+			state.seasons[t%seasonLength] = s.gamma*(value-level) + (1-s.gamma)*season
+		}
+	}
+	return state
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values))
+}
@@ -0,0 +1,198 @@
+package analytics
+
+import (
+	"context"
+	"covid/database"
+	"covid/series"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// MetricRt is the effective reproduction number, for the features that rank or compare countries by a metric.
+const MetricRt series.Metric = "rt"
+
+// SerialInterval is the gamma distribution of the days between the symptoms of a case and of the people
+// it infects, given by its mean and standard deviation.
+type SerialInterval struct {
+	Mean float64
+	SD   float64
+}
+
+const (
+	// CredibleInterval is the coverage of the intervals of the Rt estimates.
+	CredibleInterval = 0.95
+	// longest serial interval kept when it is discretised, and largest mean and standard deviation accepted.
+	maxSerialIntervalDays = 30
+	// gamma prior of Rt with a mean of 5 and a standard deviation of 5, the default of Cori et al.
+	rtPriorShape = 1
+	rtPriorScale = 5
+)
+
+// ErrNonFiniteRt is returned when the statistics are so large that an estimate overflows.
+var ErrNonFiniteRt = errors.New("the Rt estimate is not finite")
+
+// RtEstimator estimates the Rt of countries with the settings of the server.
+type RtEstimator struct {
+	// SerialInterval is used when a request does not give its own.
+	SerialInterval SerialInterval
+	// Window is the number of days every estimate is smoothed over.
+	Window int
+}
+
+func NewRtEstimator(si SerialInterval, window int) (*RtEstimator, error) {
+	if err := si.validate(); err != nil {
+		return nil, err
+	}
+	if window < 1 {
+		return nil, fmt.Errorf("the Rt window must be at least a day")
+	}
+	return &RtEstimator{SerialInterval: si, Window: window}, nil
+}
+
+type RtEstimate struct {
+	Date  string
+	Mean  float64
+	Lower float64
+	Upper float64
+}
+
+type ReproductionNumber struct {
+	Country        database.Country
+	SerialInterval SerialInterval
+	WindowDays     int
+	Estimates      []RtEstimate
+}
+
+func (si SerialInterval) validate() error {
+	// written so that NaN fails too:
+	if !(si.Mean > 0 && si.Mean <= maxSerialIntervalDays) || !(si.SD > 0 && si.SD <= maxSerialIntervalDays) {
+		return fmt.Errorf("the serial interval mean and standard deviation must be positive and at most %d days", maxSerialIntervalDays)
+	}
+	return nil
+}
+
+// CountryReproductionNumber estimates the daily Rt of a country from its confirmed cases, between from and to
+// which are inclusive and may be nil.
+func (e *RtEstimator) CountryReproductionNumber(ctx context.Context, d database.Store, countryID int, from *string, to *string, si SerialInterval) (ReproductionNumber, error) {
+	if err := si.validate(); err != nil {
+		return ReproductionNumber{}, err
+	}
+	// the estimate of a day depends on the cases of the days before it, so the history is read from its start:
+	history, err := series.Load(ctx, d, countryID, series.MetricConfirmed, nil, to)
+	if err != nil {
+		return ReproductionNumber{}, err
+	}
+
+	rt := ReproductionNumber{
+		Country:        history.Country,
+		SerialInterval: si,
+		WindowDays:     e.Window,
+		Estimates:      []RtEstimate{},
+	}
+	estimates, err := EstimateRt(history.Points, si, e.Window)
+	if err != nil {
+		return ReproductionNumber{}, err
+	}
+	for _, estimate := range estimates {
+		if from != nil && estimate.Date < *from {
+			continue
+		}
+		rt.Estimates = append(rt.Estimates, estimate)
+	}
+	return rt, nil
+}
+
+// LatestRt returns the last Rt estimate of a country, false when there is not enough data for one.
+func (e *RtEstimator) LatestRt(ctx context.Context, d database.Store, countryID int) (RtEstimate, bool, error) {
+	rt, err := e.CountryReproductionNumber(ctx, d, countryID, nil, nil, e.SerialInterval)
+	if err != nil {
+		return RtEstimate{}, false, err
+	}
+	if len(rt.Estimates) == 0 {
+		return RtEstimate{}, false, nil
+	}
+	return rt.Estimates[len(rt.Estimates)-1], true, nil
+}
+
+// EstimateRt applies the method of Cori et al. (2013) to a cumulative series of cases. The incidence of
+// every day is compared to the infectiousness of the earlier cases, weighted by the serial interval, over
+// a sliding window; with a gamma prior the posterior of Rt is a gamma distribution. Days before the
+// window is full, or without any earlier case, have no estimate. An estimate that is not finite is an
+// error, it cannot be serialised.
+func EstimateRt(cumulative []series.Point, si SerialInterval, window int) ([]RtEstimate, error) {
+	if err := si.validate(); err != nil {
+		return nil, err
+	}
+	if len(cumulative) < 2 {
+		return nil, nil
+	}
+	incidence := dailyValues(cumulative)
+	weights := discretiseSerialInterval(si)
+
+	// infectiousness[t] is how many infections the earlier cases are expected to cause on day t if Rt is 1:
+	infectiousness := make([]float64, len(incidence))
+	for t := range incidence {
+		for s := 1; s < len(weights) && s <= t; s++ {
+			infectiousness[t] += incidence[t-s] * weights[s]
+		}
+	}
+
+	var estimates []RtEstimate
+	for t := window; t < len(incidence); t++ {
+		cases, pressure := 0.0, 0.0
+		for s := t - window + 1; s <= t; s++ {
+			cases += incidence[s]
+			pressure += infectiousness[s]
+		}
+		if pressure == 0 {
+			continue
+		}
+
+		// incidence[t] is the increase of cumulative[t+1]:
+		date := cumulative[t+1].Date
+		shape := rtPriorShape + cases
+		scale := 1 / (1/rtPriorScale + pressure)
+		// the quantiles are not searched for when the posterior already overflows:
+		if !finite(shape) || !finite(shape*scale) {
+			return nil, fmt.Errorf("%w on %s", ErrNonFiniteRt, date)
+		}
+		tail := (1 - CredibleInterval) / 2
+		estimate := RtEstimate{
+			Date:  date,
+			Mean:  shape * scale,
+			Lower: gammaQuantile(tail, shape, scale),
+			Upper: gammaQuantile(1-tail, shape, scale),
+		}
+		if !finite(estimate.Lower) || !finite(estimate.Upper) {
+			return nil, fmt.Errorf("%w on %s", ErrNonFiniteRt, date)
+		}
+		estimates = append(estimates, estimate)
+	}
+	return estimates, nil
+}
+
+func finite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// discretiseSerialInterval returns the probability of a serial interval of s days at index s. Day 0 has
+// none, a case cannot infect someone who falls ill the same day; the mass below 1.5 days goes to day 1.
+func discretiseSerialInterval(si SerialInterval) []float64 {
+	shape := si.Mean * si.Mean / (si.SD * si.SD)
+	scale := si.SD * si.SD / si.Mean
+
+	weights := make([]float64, maxSerialIntervalDays+1)
+	total := 0.0
+	previous := 0.0
+	for s := 1; s <= maxSerialIntervalDays; s++ {
+		cdf := regularizedGammaP(shape, (float64(s)+0.5)/scale)
+		weights[s] = cdf - previous
+		total += weights[s]
+		previous = cdf
+	}
+	for s := range weights {
+		weights[s] /= total
+	}
+	return weights
+}
@@ -0,0 +1,89 @@
+package analytics
+
+import (
+	"covid/series"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestSerialIntervalValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		si    SerialInterval
+		valid bool
+	}{
+		{"default", SerialInterval{Mean: 4.7, SD: 2.9}, true},
+		{"longest", SerialInterval{Mean: maxSerialIntervalDays, SD: maxSerialIntervalDays}, true},
+		{"zero mean", SerialInterval{Mean: 0, SD: 2.9}, false},
+		{"negative sd", SerialInterval{Mean: 4.7, SD: -1}, false},
+		{"mean too long", SerialInterval{Mean: maxSerialIntervalDays + 1, SD: 2.9}, false},
+		{"sd too large", SerialInterval{Mean: 4.7, SD: 1e6}, false},
+		{"infinite mean", SerialInterval{Mean: math.Inf(1), SD: 2.9}, false},
+		{"NaN sd", SerialInterval{Mean: 4.7, SD: math.NaN()}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.si.validate()
+			if test.valid && err != nil {
+				t.Errorf("got %v, want no error", err)
+			}
+			if !test.valid && err == nil {
+				t.Error("no error")
+			}
+		})
+	}
+}
+
+func TestEstimateRt(t *testing.T) {
+	si := SerialInterval{Mean: 4.7, SD: 2.9}
+	tests := []struct {
+		name  string
+		daily func(int) float64
+		// bounds of the last estimate:
+		low, high float64
+	}{
+		{"constant", constant(100), 0.95, 1.05},
+		// a growth of 5% a day with a mean serial interval of 4.7 days gives an Rt near 1.05^4.7:
+		{"exponential growth", exponential(50, 0.05), 1.2, 1.3},
+		{"exponential decline", exponential(1000, -0.05), 0.75, 0.85},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			estimates, err := EstimateRt(history(test.daily, 60).Points, si, 7)
+			if err != nil {
+				t.Fatalf("EstimateRt: %v", err)
+			}
+			if len(estimates) == 0 {
+				t.Fatal("no estimate")
+			}
+			for _, estimate := range estimates {
+				if estimate.Lower > estimate.Mean || estimate.Mean > estimate.Upper {
+					t.Errorf("%s: Rt %.3f outside of its interval [%.3f, %.3f]", estimate.Date, estimate.Mean, estimate.Lower, estimate.Upper)
+				}
+			}
+			last := estimates[len(estimates)-1]
+			if last.Mean < test.low || last.Mean > test.high {
+				t.Errorf("Rt %.3f on %s, want between %g and %g", last.Mean, last.Date, test.low, test.high)
+			}
+		})
+	}
+}
+
+func TestEstimateRtNotFinite(t *testing.T) {
+	// statistics this large are corrupted, the cases of a window add up to more than a float64:
+	cumulative := history(constant(100), 20).Points
+	for i := 10; i < len(cumulative); i++ {
+		cumulative[i].Value = math.MaxFloat64 / 2 * float64(i%2)
+	}
+	_, err := EstimateRt(cumulative, SerialInterval{Mean: 4.7, SD: 2.9}, 7)
+	if !errors.Is(err, ErrNonFiniteRt) {
+		t.Errorf("got %v, want %v", err, ErrNonFiniteRt)
+	}
+}
+
+func TestEstimateRtInvalidSerialInterval(t *testing.T) {
+	if _, err := EstimateRt([]series.Point{{Date: "2021-03-01", Value: 1}}, SerialInterval{Mean: 45, SD: 2.9}, 7); err == nil {
+		t.Error("no error")
+	}
+}
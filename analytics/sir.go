@@ -0,0 +1,147 @@
+package analytics
+
+import (
+	"covid/series"
+	"math"
+)
+
+const (
+	// the SIR model is fitted to the last weeks only, the epidemic changes too much over longer periods.
+	sirWindow   = 42
+	sirMinDays  = 7
+	sirSeedDays = 7
+	// rounds of the pattern search refining the fit of the grid.
+	sirRefinements = 60
+)
+
+var (
+	// infectious periods tried, in days.
+	infectiousPeriods = []float64{5, 7, 10, 14}
+	// effective populations tried, as multiples of the cases reported so far. Only part of a population
+	// is ever reached by an epidemic, so it is fitted rather than taken from census data.
+	populationFactors = logSpace(1.05, 1000, 30)
+)
+
+type sirParams struct {
+	r0, gamma, population float64
+}
+
+// sir fits a SIR compartmental model to the daily values of the last weeks, treating them as new
+// infections. Deaths and recoveries follow the infections with a delay, so they are fitted the same way.
+func sir(cumulative []series.Point, daily []float64, horizon int) (fit, error) {
+	if len(daily) < sirMinDays {
+		return fit{}, ErrNotEnoughData
+	}
+	// the days before the window seed the infected compartment, short series keep a few of them:
+	start := max(len(daily)-sirWindow, min(sirSeedDays, len(daily)-sirMinDays))
+	observed := daily[start:]
+	// cumulative[start] is the total the day before observed[0]:
+	casesBefore := cumulative[start].Value
+	casesAfter := cumulative[len(cumulative)-1].Value
+
+	sse := func(params sirParams) float64 {
+		total := 0.0
+		params.simulate(daily[:start], casesBefore, len(observed), func(t int, infections float64) {
+			e := observed[t] - infections
+			total += e * e
+		})
+		return total
+	}
+
+	// a coarse grid finds the region of the best fit, a pattern search then refines it:
+	var best sirParams
+	bestSSE := math.Inf(1)
+	for _, period := range infectiousPeriods {
+		for r0 := 0.5; r0 <= 4.0001; r0 += 0.1 {
+			for _, factor := range populationFactors {
+				params := sirParams{r0: r0, gamma: 1 / period, population: math.Max(casesAfter, 1) * factor}
+				if e := sse(params); e < bestSSE {
+					best, bestSSE = params, e
+				}
+			}
+		}
+	}
+	steps := sirParams{r0: 0.05, gamma: 0.02, population: best.population * 0.1}
+	for i := 0; i < sirRefinements; i++ {
+		improved := false
+		for _, candidate := range best.neighbours(steps) {
+			if candidate.r0 <= 0 || candidate.gamma <= 0 || candidate.gamma > 1 || candidate.population <= casesAfter {
+				continue
+			}
+			if e := sse(candidate); e < bestSSE {
+				best, bestSSE, improved = candidate, e, true
+			}
+		}
+		if !improved {
+			steps = sirParams{r0: steps.r0 / 2, gamma: steps.gamma / 2, population: steps.population / 2}
+		}
+	}
+
+	sigma := residualDeviation(bestSSE, len(observed))
+	f := fit{
+		values:     make([]float64, horizon),
+		halfWidths: make([]float64, horizon),
+		parameters: []Parameter{
+			{Name: "r0", Value: round(best.r0, 2)},
+			{Name: "infectiousDays", Value: round(1/best.gamma, 1)},
+			{Name: "population", Value: math.Round(best.population)},
+		},
+	}
+	best.simulate(daily[:start], casesBefore, len(observed)+horizon, func(t int, infections float64) {
+		if h := t - len(observed); h >= 0 {
+			f.values[h] = infections
+			// the errors of the fit compound like a random walk:
+			f.halfWidths[h] = confidenceZ * sigma * math.Sqrt(float64(h+1))
+		}
+	})
+	return f, nil
+}
+
+func (p sirParams) neighbours(steps sirParams) []sirParams {
+	return []sirParams{
+		{r0: p.r0 + steps.r0, gamma: p.gamma, population: p.population},
+		{r0: p.r0 - steps.r0, gamma: p.gamma, population: p.population},
+		{r0: p.r0, gamma: p.gamma + steps.gamma, population: p.population},
+		{r0: p.r0, gamma: p.gamma - steps.gamma, population: p.population},
+		{r0: p.r0, gamma: p.gamma, population: p.population + steps.population},
+		{r0: p.r0, gamma: p.gamma, population: p.population - steps.population},
+	}
+}
+
+// simulate runs the model for days days from the end of before, calling fn with the new infections of
+// every day. The infected compartment starts with the earlier cases that have not recovered yet
+// according to the model, a share 1-gamma of them recovering every day.
+func (p sirParams) simulate(before []float64, casesBefore float64, days int, fn func(t int, infections float64)) {
+	beta := p.r0 * p.gamma
+	infected := 0.0
+	remaining := 1.0
+	for i := len(before) - 1; i >= 0 && remaining > 1e-6; i-- {
+		infected += before[i] * remaining
+		remaining *= 1 - p.gamma
+	}
+	if infected == 0 {
+		infected = 1
+	}
+	susceptible := math.Max(p.population-casesBefore, 0)
+
+	for t := 0; t < days; t++ {
+		infections := math.Min(beta*susceptible*infected/p.population, susceptible)
+		susceptible -= infections
+		infected += infections - p.gamma*infected
+		fn(t, infections)
+	}
+}
+
+// logSpace returns n values from min to max, evenly spaced on a log scale.
+func logSpace(min float64, max float64, n int) []float64 {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = min * math.Pow(max/min, float64(i)/float64(n-1))
+	}
+	return values
+}
+
+func round(v float64, decimals int) float64 {
+	p := math.Pow(10, float64(decimals))
+	return math.Round(v*p) / p
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"covid/graph"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// RequestPasswordResetHandler answers with a 202 whether the email is registered or not.
+func RequestPasswordResetHandler(accounts *graph.Accounts) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input EmailInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Email == "" {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid request body")
+			return
+		}
+
+		if err := accounts.RequestPasswordReset(r.Context(), input.Email); err != nil {
+			writeAccountError(w, err, "Failed to request a password reset")
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func ResetPasswordHandler(auth *graph.Auth, accounts *graph.Accounts) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input ResetPasswordInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Token == "" {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid request body")
+			return
+		}
+		if err := auth.ValidatePassword(input.Password); err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+			return
+		}
+
+		if err := accounts.ResetPassword(r.Context(), input.Token, input.Password); err != nil {
+			writeAccountError(w, err, "Failed to reset password")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func VerifyEmailHandler(accounts *graph.Accounts) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input TokenInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Token == "" {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid request body")
+			return
+		}
+
+		if err := accounts.VerifyEmail(r.Context(), input.Token); err != nil {
+			writeAccountError(w, err, "Failed to verify email")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ResendVerificationHandler answers with a 202 whether the email is registered or not.
+func ResendVerificationHandler(accounts *graph.Accounts) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input EmailInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Email == "" {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid request body")
+			return
+		}
+
+		if err := accounts.ResendVerification(r.Context(), input.Email); err != nil {
+			writeAccountError(w, err, "Failed to send verification email")
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// writeAccountError answers with a 400 for unknown, used or expired tokens, a 503 when emails are not
+// configured, and as writeDatabaseError otherwise.
+func writeAccountError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, graph.ErrInvalidAccountToken) {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, graph.ErrMailDisabled) {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeUnavailable, err.Error())
+		return
+	}
+	writeDatabaseError(w, err, message)
+}
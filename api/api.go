@@ -1,12 +1,15 @@
 package api
 
 import (
+	"context"
 	"covid/database"
 	"covid/fetcher"
 	"covid/graph"
 	"covid/graph/model"
+	"covid/quality"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -17,523 +20,661 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-func UserHandler(db *sql.DB) http.HandlerFunc {
+func UserHandler(store database.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		username := r.URL.Query().Get("username")
 		if username == "" {
-			http.Error(w, "username parameter is required", http.StatusBadRequest)
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "username parameter is required")
 			return
 		}
 
 		var user database.User
-		d := database.NewDB(db)
-		user, err := d.GetUserByUsername(username)
+		user, err := store.GetUserByUsername(r.Context(), username)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeDatabaseError(w, err, "Failed to get user")
 			return
 		}
 
 		user.Salt = ""
 		user.Password = ""
 
-		user.MonitoredCountries, err = d.GetUserMonitoredCountries(user.ID)
+		user.MonitoredCountries, err = store.GetUserMonitoredCountries(r.Context(), user.ID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeDatabaseError(w, err, "Failed to get monitored countries")
 			return
 		}
 
 		apiUser := MapDatabaseUserToAPIModel(&user)
 
 		// Encode the user object as JSON and return it in the response
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(apiUser)
+		writeJSON(w, http.StatusOK, apiUser)
 	}
 }
 
-func CountryByIDHandler(db *sql.DB) http.HandlerFunc {
+func CountryByIDHandler(store database.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		idStr := chi.URLParam(r, "id")
 		id, err := strconv.Atoi(idStr)
 		if err != nil {
-			http.Error(w, "Invalid country ID", http.StatusBadRequest)
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid country ID")
 			return
 		}
 
-		d := database.NewDB(db)
-		country, err := d.GetCountryByID(id)
+		v, ok, err := countriesVersion(r.Context(), store, id)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeDatabaseError(w, err, "Failed to get country")
+			return
+		}
+		if ok && notModified(w, r, v) {
+			return
+		}
+
+		country, err := store.GetCountryByID(r.Context(), id)
+		if err != nil {
+			writeDatabaseError(w, err, "Failed to get country")
 			return
 		}
 
 		apiCountry := MapDatabaseCountryToAPIModel(&country)
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(apiCountry)
+		latest, err := store.GetCountryLatestStatistics(r.Context(), id)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			writeDatabaseError(w, err, "Failed to get country")
+			return
+		}
+		if err == nil {
+			apiCountry.Latest = MapDatabaseCountryLatestStatisticsToAPIModel(&latest)
+		}
+
+		writeJSON(w, http.StatusOK, apiCountry)
 	}
 }
 
-func CountriesHandler(db *sql.DB) http.HandlerFunc {
+func CountriesHandler(store database.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		filterNameContains := r.URL.Query().Get("filterNameContains")
-		filterCodeEquals := r.URL.Query().Get("filterCodeEquals")
-
-		filter := CountryFilterInput{}
-		if filterNameContains != "" {
-			filter.NameContains = &filterNameContains
+		query := r.URL.Query()
+		limit, err := pageLimit(query)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+			return
 		}
-		if filterCodeEquals != "" {
-			filter.CodeEquals = &filterCodeEquals
+
+		filter := database.CountryFilter{
+			CodeEquals:   optionalParam(query, "filterCodeEquals"),
+			NameContains: optionalParam(query, "filterNameContains"),
+			SortBy:       query.Get("sort"),
+			SortOrder:    query.Get("order"),
+			First:        &limit,
+			After:        optionalParam(query, "cursor"),
 		}
 
-		d := database.NewDB(db)
-		countries, err := d.GetCountries(nil, nil, filter.CodeEquals, filter.NameContains)
+		var v version
+		v.updatedAt, v.count, err = store.GetCountriesUpdatedAt(r.Context())
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeDatabaseError(w, err, "Failed to get countries")
+			return
+		}
+		if notModified(w, r, v) {
 			return
 		}
 
-		var apiCountries []*Country
-		for _, country := range countries {
-			apiCountries = append(apiCountries, MapDatabaseCountryToAPIModel(&country))
+		countries, nextCursor, err := store.GetCountries(r.Context(), filter)
+		if err != nil {
+			writeDatabaseError(w, err, "Failed to get countries")
+			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(apiCountries)
+		setNextLink(w, r, nextCursor)
+		writeJSON(w, http.StatusOK, CountryList{
+			Data:       MapDatabaseCountriesToAPIModels(countries),
+			NextCursor: nextCursor,
+		})
 	}
 }
 
-func AddCountryHandler(db *sql.DB) http.HandlerFunc {
+func AddCountryHandler(store database.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodPost:
-			var input CountryInput
-			err := json.NewDecoder(r.Body).Decode(&input)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			if len(input.Code) != 2 {
-				http.Error(w, "country code must be 2 characters long", http.StatusBadRequest)
-				return
-			}
-
-			d := database.NewDB(db)
-			country, ifExists, err := d.CreateCountry(input.Name, input.Code)
-			if err != nil {
-				http.Error(w, fmt.Sprintf("failed to insert new country: %v", err), http.StatusInternalServerError)
-				return
-			}
+		var input CountryInput
+		err := json.NewDecoder(r.Body).Decode(&input)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+			return
+		}
 
-			if ifExists {
-				http.Error(w, "country already exists", http.StatusBadRequest)
-				return
-			}
+		if len(input.Code) != 2 {
+			WriteError(w, http.StatusBadRequest, ErrCodeValidation, "country code must be 2 characters long")
+			return
+		}
 
-			url := fmt.Sprintf("/api/countries/%d", country.ID)
-			w.Header().Set("Location", url)
-			w.WriteHeader(http.StatusCreated)
+		country, ifExists, err := store.CreateCountry(r.Context(), input.Name, input.Code)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("failed to insert new country: %v", err))
+			return
+		}
 
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		if ifExists {
+			WriteError(w, http.StatusConflict, ErrCodeConflict, "country already exists")
+			return
 		}
+
+		url := fmt.Sprintf("/api/v1/countries/%d", country.ID)
+		w.Header().Set("Location", url)
+		writeJSON(w, http.StatusCreated, MapDatabaseCountryToAPIModel(&country))
 	}
 }
 
-func UpdateCountryHandler(db *sql.DB) http.HandlerFunc {
+func UpdateCountryHandler(store database.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodPut:
-			idStr := chi.URLParam(r, "id")
-			id, err := strconv.Atoi(idStr)
-			if err != nil {
-				http.Error(w, "Invalid country ID", http.StatusBadRequest)
-				return
-			}
+		idStr := chi.URLParam(r, "id")
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid country ID")
+			return
+		}
 
-			var input CountryInput
-			err = json.NewDecoder(r.Body).Decode(&input)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
+		var input CountryInput
+		err = json.NewDecoder(r.Body).Decode(&input)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+			return
+		}
 
-			if len(input.Code) != 2 {
-				http.Error(w, "country code must be 2 characters long", http.StatusBadRequest)
-				return
-			}
+		updateCountry(w, r, store, id, input)
+	}
+}
 
-			d := database.NewDB(db)
-			country, err := d.UpdateCountry(id, input.Name, input.Code)
-			if err != nil {
-				http.Error(w, fmt.Sprintf("failed to update country: %v", err), http.StatusInternalServerError)
-				return
-			}
+// PatchCountryHandler only changes the fields present in the request body.
+func PatchCountryHandler(store database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idStr := chi.URLParam(r, "id")
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid country ID")
+			return
+		}
 
-			url := fmt.Sprintf("/api/countries/%d", country.ID)
-			w.Header().Set("Location", url)
-			w.WriteHeader(http.StatusCreated)
+		var patch CountryPatchInput
+		err = json.NewDecoder(r.Body).Decode(&patch)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+			return
+		}
+
+		country, err := store.GetCountryByID(r.Context(), id)
+		if err != nil {
+			writeDatabaseError(w, err, "Failed to get country")
+			return
+		}
 
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		input := CountryInput{Name: country.Name, Code: country.Code}
+		if patch.Name != nil {
+			input.Name = *patch.Name
+		}
+		if patch.Code != nil {
+			input.Code = *patch.Code
 		}
+
+		updateCountry(w, r, store, id, input)
 	}
 }
 
-func DeleteCountryHandler(db *sql.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodDelete:
-			idStr := chi.URLParam(r, "id")
-			id, err := strconv.Atoi(idStr)
-			if err != nil {
-				http.Error(w, "Invalid country ID", http.StatusBadRequest)
-				return
-			}
+func updateCountry(w http.ResponseWriter, r *http.Request, store database.Store, id int, input CountryInput) {
+	if len(input.Code) != 2 {
+		WriteError(w, http.StatusBadRequest, ErrCodeValidation, "country code must be 2 characters long")
+		return
+	}
 
-			d := database.NewDB(db)
-			err = d.DeleteCountry(id)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
+	country, err := store.UpdateCountry(r.Context(), id, input.Name, input.Code)
+	if err != nil {
+		writeDatabaseError(w, err, fmt.Sprintf("failed to update country: %v", err))
+		return
+	}
+
+	url := fmt.Sprintf("/api/v1/countries/%d", country.ID)
+	w.Header().Set("Location", url)
+	writeJSON(w, http.StatusOK, MapDatabaseCountryToAPIModel(&country))
+}
 
-			w.WriteHeader(http.StatusOK)
+func DeleteCountryHandler(store database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idStr := chi.URLParam(r, "id")
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid country ID")
+			return
+		}
 
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		err = store.DeleteCountry(r.Context(), id)
+		if err != nil {
+			writeDatabaseError(w, err, "Failed to delete country")
+			return
 		}
+
+		w.WriteHeader(http.StatusNoContent)
 	}
 }
 
-func CovidStatisticByIDHandler(db *sql.DB) http.HandlerFunc {
+func CovidStatisticByIDHandler(store database.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		idStr := chi.URLParam(r, "id")
 		id, err := strconv.Atoi(idStr)
 		if err != nil {
-			http.Error(w, "Invalid CovidStatistic ID", http.StatusBadRequest)
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid CovidStatistic ID")
 			return
 		}
 
-		d := database.NewDB(db)
-		covidStat, err := d.GetCovidStatistic(id)
+		countryID, err := store.GetCountryIDByCovidStatisticID(r.Context(), id)
+		if err != nil {
+			writeDatabaseError(w, err, "Failed to get covid statistic")
+			return
+		}
+		v, ok, err := countriesVersion(r.Context(), store, countryID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeDatabaseError(w, err, "Failed to get covid statistic")
+			return
+		}
+		if ok && notModified(w, r, v) {
+			return
+		}
+
+		covidStat, err := store.GetCovidStatistic(r.Context(), id)
+		if err != nil {
+			writeDatabaseError(w, err, "Failed to get covid statistic")
 			return
 		}
 
 		apiCovidStat := MapDatabaseCovidStatisticToAPIModel(&covidStat)
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(apiCovidStat)
+		writeJSON(w, http.StatusOK, apiCovidStat)
 	}
 }
 
-func CovidStatisticsHandler(db *sql.DB) http.HandlerFunc {
+func CovidStatisticsHandler(store database.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		query := r.URL.Query()
+		countryID := query.Get("country_id")
+
+		countryIDInt, err := strconv.Atoi(countryID)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid country ID")
 			return
 		}
 
-		queryParams := r.URL.Query()
-		countryID := queryParams.Get("country_id")
+		limit, err := pageLimit(query)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+			return
+		}
 
-		countryIDInt, err := strconv.Atoi(countryID)
+		filter := database.CovidStatisticFilter{
+			CountryID: countryIDInt,
+			DateFrom:  optionalParam(query, "date_from"),
+			DateTo:    optionalParam(query, "date_to"),
+			SortBy:    query.Get("sort"),
+			SortOrder: query.Get("order"),
+			First:     &limit,
+			After:     optionalParam(query, "cursor"),
+		}
+
+		v, ok, err := countriesVersion(r.Context(), store, countryIDInt)
 		if err != nil {
-			http.Error(w, "Invalid country ID", http.StatusBadRequest)
+			writeDatabaseError(w, err, "Failed to get covid statistics")
+			return
+		}
+		if ok && notModified(w, r, v) {
 			return
 		}
 
-		d := database.NewDB(db)
-		covidStats, err := d.GetCovidStatistics(countryIDInt, nil, nil)
+		covidStats, nextCursor, err := store.ListCovidStatistics(r.Context(), filter)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeDatabaseError(w, err, "Failed to get covid statistics")
 			return
 		}
 
-		var apiCovidStats []*CovidStatistic
+		apiCovidStats := []*CovidStatistic{}
 		for i := range covidStats {
 			apiCovidStats = append(apiCovidStats, MapDatabaseCovidStatisticToAPIModel(&covidStats[i]))
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(apiCovidStats)
+		setNextLink(w, r, nextCursor)
+		writeJSON(w, http.StatusOK, CovidStatisticList{
+			Data:       apiCovidStats,
+			NextCursor: nextCursor,
+		})
 	}
 }
 
-func AddCovidStatisticHandler(db *sql.DB) http.HandlerFunc {
+func AddCovidStatisticHandler(store database.Store, checker *quality.Checker) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodPost:
-			var input CovidStatisticInput
-			err := json.NewDecoder(r.Body).Decode(&input)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			countryID, err := strconv.Atoi(input.CountryID)
-			if err != nil {
-				http.Error(w, fmt.Sprintf("invalid country ID: %v", err), http.StatusBadRequest)
-				return
-			}
+		var input CovidStatisticInput
+		err := json.NewDecoder(r.Body).Decode(&input)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+			return
+		}
 
-			date, err := time.Parse("2006-01-02", input.Date)
-			if err != nil {
-				http.Error(w, fmt.Sprintf("invalid date: %v", err), http.StatusBadRequest)
-				return
-			}
+		countryID, err := strconv.Atoi(input.CountryID)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, fmt.Sprintf("invalid country ID: %v", err))
+			return
+		}
 
-			d := database.NewDB(db)
-			covidStatisticID, err := d.AddCovidStatistic(countryID, date.Format("2006-01-02"), input.Confirmed, input.Recovered, input.Deaths)
-			if err != nil {
-				http.Error(w, fmt.Sprintf("failed to insert new covid statistic: %v", err), http.StatusInternalServerError)
-				return
-			}
+		date, err := time.Parse("2006-01-02", input.Date)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, fmt.Sprintf("invalid date: %v", err))
+			return
+		}
 
-			url := fmt.Sprintf("/covid-stats/%d", covidStatisticID)
-			w.Header().Set("Location", url)
-			w.WriteHeader(http.StatusCreated)
+		covidStatisticID, _, err := checker.AddCovidStatistic(r.Context(), store, countryID, date.Format("2006-01-02"), input.Confirmed, input.Recovered, input.Deaths)
+		var rejected *quality.RejectedError
+		if errors.As(err, &rejected) {
+			WriteError(w, http.StatusUnprocessableEntity, ErrCodeValidation, err.Error())
+			return
+		}
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("failed to insert new covid statistic: %v", err))
+			return
+		}
 
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		covidStat, err := store.GetCovidStatistic(r.Context(), covidStatisticID)
+		if err != nil {
+			writeDatabaseError(w, err, "Failed to get covid statistic")
+			return
 		}
+
+		url := fmt.Sprintf("/api/v1/covid-stats/%d", covidStatisticID)
+		w.Header().Set("Location", url)
+		writeJSON(w, http.StatusCreated, MapDatabaseCovidStatisticToAPIModel(&covidStat))
 	}
 }
 
-func UpdateCovidStatisticHandler(db *sql.DB) http.HandlerFunc {
+func UpdateCovidStatisticHandler(store database.Store, checker *quality.Checker) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := chi.URLParam(r, "id")
 		covidStatisticID, err := strconv.Atoi(id)
 		if err != nil {
-			http.Error(w, "Invalid covid statistic ID", http.StatusBadRequest)
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid covid statistic ID")
 			return
 		}
 
 		var input CovidStatisticInput
 		err = json.NewDecoder(r.Body).Decode(&input)
 		if err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid request body")
 			return
 		}
 
-		dateTime, err := time.Parse("2006-01-02", input.Date)
+		updateCovidStatistic(w, r, store, checker, covidStatisticID, input)
+	}
+}
+
+// PatchCovidStatisticHandler only changes the fields present in the request body.
+func PatchCovidStatisticHandler(store database.Store, checker *quality.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		covidStatisticID, err := strconv.Atoi(id)
 		if err != nil {
-			http.Error(w, "Invalid date", http.StatusBadRequest)
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid covid statistic ID")
 			return
 		}
 
-		d := database.NewDB(db)
-		_, err = d.UpdateCovidStatistic(covidStatisticID, dateTime.Format("2006-01-02"), input.Confirmed, input.Recovered, input.Deaths)
+		var patch CovidStatisticPatchInput
+		err = json.NewDecoder(r.Body).Decode(&patch)
 		if err != nil {
-			http.Error(w, "Failed to update covid statistic", http.StatusInternalServerError)
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid request body")
 			return
 		}
 
-		w.Header().Set("Location", fmt.Sprintf("/covid-stats/%s", id))
-		w.WriteHeader(http.StatusNoContent)
+		covidStat, err := store.GetCovidStatistic(r.Context(), covidStatisticID)
+		if err != nil {
+			writeDatabaseError(w, err, "Failed to get covid statistic")
+			return
+		}
+
+		input := CovidStatisticInput{
+			Date:      covidStat.Date,
+			Confirmed: covidStat.Confirmed,
+			Recovered: covidStat.Recovered,
+			Deaths:    covidStat.Deaths,
+		}
+		if patch.Date != nil {
+			input.Date = *patch.Date
+		}
+		if patch.Confirmed != nil {
+			input.Confirmed = *patch.Confirmed
+		}
+		if patch.Recovered != nil {
+			input.Recovered = *patch.Recovered
+		}
+		if patch.Deaths != nil {
+			input.Deaths = *patch.Deaths
+		}
+
+		updateCovidStatistic(w, r, store, checker, covidStatisticID, input)
 	}
 }
 
-func DeleteCovidStatisticHandler(db *sql.DB) http.HandlerFunc {
+func updateCovidStatistic(w http.ResponseWriter, r *http.Request, store database.Store, checker *quality.Checker, covidStatisticID int, input CovidStatisticInput) {
+	dateTime, err := time.Parse("2006-01-02", input.Date)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid date")
+		return
+	}
+
+	covidStat, _, err := checker.UpdateCovidStatistic(r.Context(), store, covidStatisticID, dateTime.Format("2006-01-02"), input.Confirmed, input.Recovered, input.Deaths)
+	var rejected *quality.RejectedError
+	if errors.As(err, &rejected) {
+		WriteError(w, http.StatusUnprocessableEntity, ErrCodeValidation, err.Error())
+		return
+	}
+	if err != nil {
+		writeDatabaseError(w, err, "Failed to update covid statistic")
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/covid-stats/%d", covidStatisticID))
+	writeJSON(w, http.StatusOK, MapDatabaseCovidStatisticToAPIModel(&covidStat))
+}
+
+func DeleteCovidStatisticHandler(store database.Store, checker *quality.Checker) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := chi.URLParam(r, "id")
 		covidStatisticID, err := strconv.Atoi(id)
 		if err != nil {
-			http.Error(w, "Invalid covid statistic ID", http.StatusBadRequest)
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid covid statistic ID")
 			return
 		}
 
-		d := database.NewDB(db)
-		err = d.DeleteCovidStatistic(covidStatisticID)
+		err = checker.DeleteCovidStatistic(r.Context(), store, covidStatisticID)
 		if err != nil {
-			http.Error(w, "Failed to delete covid statistic", http.StatusInternalServerError)
+			writeDatabaseError(w, err, "Failed to delete covid statistic")
 			return
 		}
 
-		w.Header().Set("Location", fmt.Sprintf("/api/covid-stats/%s", id))
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
 
-func GetMonitoredCountriesHandler(db *sql.DB) http.HandlerFunc {
+func GetMonitoredCountriesHandler(store database.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID := chi.URLParam(r, "userid")
 		id, err := strconv.Atoi(userID)
 		if err != nil {
-			fmt.Println("ID: ", id)
-			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid user ID")
 			return
 		}
 
-		d := database.NewDB(db)
-		monitoredCountries, err := d.GetUserMonitoredCountries(id)
+		monitoredCountries, err := store.GetUserMonitoredCountries(r.Context(), id)
 		if err != nil {
-			http.Error(w, "Failed to get monitored countries", http.StatusInternalServerError)
+			writeDatabaseError(w, err, "Failed to get monitored countries")
 			return
 		}
 
 		apiMonitoredCountries := MapDatabaseCountriesToAPIModels(monitoredCountries)
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(apiMonitoredCountries)
+		writeJSON(w, http.StatusOK, apiMonitoredCountries)
 	}
 }
 
-func AddUserMonitoredCountryHandler(db *sql.DB) http.HandlerFunc {
+func AddUserMonitoredCountryHandler(store database.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID := chi.URLParam(r, "userid")
 		userIDInt, err := strconv.Atoi(userID)
 		if err != nil {
-			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid user ID")
 			return
 		}
 
-		var input struct {
-			CountryID int `json:"countryId"`
-		}
+		var input MonitoredCountryInput
 		err = json.NewDecoder(r.Body).Decode(&input)
 		if err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid request body")
 			return
 		}
 
-		d := database.NewDB(db)
-		if err := d.AddUserMonitoredCountry(userIDInt, input.CountryID); err != nil {
-			http.Error(w, "Failed to add monitored country", http.StatusInternalServerError)
+		if err := store.AddUserMonitoredCountry(r.Context(), userIDInt, input.CountryID); err != nil {
+			WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to add monitored country")
 			return
 		}
 
-		location := fmt.Sprintf("/users/%s/monitored-countries", userID)
+		location := fmt.Sprintf("/api/v1/users/%s/monitored-countries", userID)
 		w.Header().Set("Location", location)
 		w.WriteHeader(http.StatusCreated)
 	}
 }
 
-func DeleteUserMonitoredCountryHandler(db *sql.DB) http.HandlerFunc {
+func DeleteUserMonitoredCountryHandler(store database.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID := chi.URLParam(r, "userid")
 		countryID := chi.URLParam(r, "countryid")
 		userIDInt, err := strconv.Atoi(userID)
 		if err != nil {
-			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid user ID")
 			return
 		}
 		countryIDInt, err := strconv.Atoi(countryID)
 		if err != nil {
-			http.Error(w, "Invalid country ID", http.StatusBadRequest)
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid country ID")
 			return
 		}
 
-		d := database.NewDB(db)
-		if err := d.RemoveUserMonitoredCountry(userIDInt, countryIDInt); err != nil {
-			http.Error(w, "Failed to remove monitored country", http.StatusInternalServerError)
+		if err := store.RemoveUserMonitoredCountry(r.Context(), userIDInt, countryIDInt); err != nil {
+			writeDatabaseError(w, err, "Failed to remove monitored country")
 			return
 		}
-		w.WriteHeader(http.StatusOK)
+		w.WriteHeader(http.StatusNoContent)
 	}
 }
 
-func GetTopCountriesByCaseTypeForUserHandler(db *sql.DB) http.HandlerFunc {
+// GetTopCountriesByCaseTypeForUserHandler reads the case type and limit from the path on the legacy route,
+// and from the case_type and limit query parameters on /api/v1/users/{userid}/top-countries.
+func GetTopCountriesByCaseTypeForUserHandler(store database.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Parse user ID from URL parameter
 		userID := chi.URLParam(r, "userid")
 		userIDInt, err := strconv.Atoi(userID)
 		if err != nil {
-			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid user ID")
 			return
 		}
 
 		caseTypeString := chi.URLParam(r, "caseType")
+		if caseTypeString == "" {
+			caseTypeString = r.URL.Query().Get("case_type")
+		}
 		caseType := model.CaseType(strings.ToUpper(caseTypeString))
 		if !caseType.IsValid() {
-			http.Error(w, "Invalid case type", http.StatusBadRequest)
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid case type")
 			return
 		}
 
 		limitString := chi.URLParam(r, "limit")
+		if limitString == "" {
+			limitString = r.URL.Query().Get("limit")
+		}
 		limit, err := strconv.Atoi(limitString)
 		if err != nil {
-			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid limit")
 			return
 		}
 
-		d := database.NewDB(db)
-		countries, err := d.GetTopCountriesByCaseTypeForUser(userIDInt, caseType.String(), limit)
+		countries, err := store.GetTopCountriesByCaseTypeForUser(r.Context(), userIDInt, caseType.String(), limit)
 		if err != nil {
-			http.Error(w, "Failed to get top countries by case type", http.StatusInternalServerError)
+			writeDatabaseError(w, err, "Failed to get top countries by case type")
 			return
 		}
 
 		apiCountries := MapDatabaseCountriesToAPIModels(countries)
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(apiCountries)
+		writeJSON(w, http.StatusOK, apiCountries)
 	}
 }
 
-func GetDeathPercentageHandler(db *sql.DB) http.HandlerFunc {
+func GetDeathPercentageHandler(store database.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Parse country ID from URL parameter
 		countryID := chi.URLParam(r, "countryId")
 		countryIDInt, err := strconv.Atoi(countryID)
 		if err != nil {
-			http.Error(w, "Invalid country ID", http.StatusBadRequest)
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid country ID")
+			return
+		}
+
+		v, ok, err := countriesVersion(r.Context(), store, countryIDInt)
+		if err != nil {
+			writeDatabaseError(w, err, "Failed to get death percentage")
+			return
+		}
+		if ok && notModified(w, r, v) {
 			return
 		}
 
-		d := database.NewDB(db)
-		deathPercentage, err := d.GetDeathPercentage(countryIDInt)
+		deathPercentage, err := store.GetDeathPercentage(r.Context(), countryIDInt)
 		if err != nil {
-			http.Error(w, "Failed to get death percentage", http.StatusInternalServerError)
+			writeDatabaseError(w, err, "Failed to get death percentage")
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]float64{"deathPercentage": deathPercentage})
+		writeJSON(w, http.StatusOK, DeathPercentage{DeathPercentage: deathPercentage})
 	}
 }
 
-func RegisterHandler(db *sql.DB) http.HandlerFunc {
+func RegisterHandler(store database.Store, auth *graph.Auth, accounts *graph.Accounts) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		input := UserInput{}
 
 		err := json.NewDecoder(r.Body).Decode(&input)
 		if err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid request body")
 			return
 		}
-		d := database.NewDB(db)
-		err = validation(input, w, d)
+		err = validation(r.Context(), input, w, store, auth)
 		if err != nil {
 			return
 		}
 
 		hashedPassword, salt, err := graph.HashPassword(input.Password)
 		if err != nil {
-			http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+			WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to hash password")
 			return
 		}
 
-		userID, err := d.RegisterUser(input.Username, input.Email, hashedPassword, salt)
+		userID, err := store.RegisterUser(r.Context(), input.Username, input.Email, hashedPassword, salt)
 		if err != nil {
-			http.Error(w, "Failed to register user", http.StatusInternalServerError)
+			WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to register user")
 			return
 		}
+		accounts.SendVerificationAfterRegistration(r.Context(), database.User{ID: int(userID), Username: input.Username, Email: input.Email})
 
 		// Generate a JWT token
-		token, err := graph.GenerateToken(input.Username)
+		token, err := auth.GenerateToken(database.User{ID: int(userID), Username: input.Username, Role: database.RoleUser})
 		if err != nil {
-			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to generate token")
 			return
 		}
 
 		// Return the response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(LoginResponse{
+		writeJSON(w, http.StatusCreated, LoginResponse{
 			Token: token,
 			User: MapDatabaseUserToAPIModel(&database.User{
 				ID:       int(userID),
@@ -544,105 +685,143 @@ func RegisterHandler(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-func validation(input UserInput, w http.ResponseWriter, d *database.DB) error {
+// validation writes the error response itself, callers only have to stop when it returns an error.
+func validation(ctx context.Context, input UserInput, w http.ResponseWriter, store database.Store, auth *graph.Auth) error {
 	if input.Username == "" || input.Email == "" || input.Password == "" {
-		http.Error(w, "Username, email, and password are required", http.StatusBadRequest)
+		WriteError(w, http.StatusBadRequest, ErrCodeValidation, "Username, email, and password are required")
 		return fmt.Errorf("username, email, and password are required")
 	}
 
 	if err := graph.ValidateUsername(input.Username); err != nil {
+		WriteError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
 		return err
 	}
 
 	if err := graph.ValidateEmail(input.Email); err != nil {
+		WriteError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
 		return err
 	}
 
-	if err := graph.ValidatePassword(input.Password); err != nil {
+	if err := auth.ValidatePassword(input.Password); err != nil {
+		WriteError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
 		return err
 	}
 
-	if err := d.CheckIfUserExists(input.Username); err != nil {
+	if err := store.CheckIfUserExists(ctx, input.Username); err != nil {
+		WriteError(w, http.StatusConflict, ErrCodeConflict, err.Error())
 		return err
 	}
 
-	if err := d.CheckIfEmailExists(input.Email); err != nil {
+	if err := store.CheckIfEmailExists(ctx, input.Email); err != nil {
+		WriteError(w, http.StatusConflict, ErrCodeConflict, err.Error())
 		return err
 	}
 
 	return nil
 }
 
-func LoginHandler(db *sql.DB) http.HandlerFunc {
+func LoginHandler(store database.Store, auth *graph.Auth) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var input UserInput
+		var input LoginInput
 
 		err := json.NewDecoder(r.Body).Decode(&input)
 		if err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid request body")
 			return
 		}
 
 		if input.Username == "" || input.Password == "" {
-			http.Error(w, "Username and password are required", http.StatusBadRequest)
+			WriteError(w, http.StatusBadRequest, ErrCodeValidation, "Username and password are required")
 			return
 		}
 
-		d := database.NewDB(db)
-		user, err := d.GetUserByUsername(input.Username)
+		user, err := store.GetUserByUsername(r.Context(), input.Username)
 		if err != nil {
-			http.Error(w, "Invalid username or password", http.StatusBadRequest)
+			WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "Invalid username or password")
 			return
 		}
 
 		err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password+user.Salt))
 		if err != nil {
-			http.Error(w, "Invalid username or password", http.StatusBadRequest)
+			WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "Invalid username or password")
 			return
 		}
 
-		token, err := graph.GenerateToken(input.Username)
+		token, err := auth.GenerateToken(user)
 		if err != nil {
-			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to generate token")
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(LoginResponse{
+		writeJSON(w, http.StatusOK, LoginResponse{
 			Token: token,
 			User:  MapDatabaseUserToAPIModel(&user),
 		})
 	}
 }
 
-func DeleteUserHandler(db *sql.DB) http.HandlerFunc {
+func DeleteUserHandler(store database.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID := chi.URLParam(r, "userid")
 		userIDInt, err := strconv.Atoi(userID)
 		if err != nil {
-			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid user ID")
 			return
 		}
 
-		d := database.NewDB(db)
-		if err := d.DeleteUser(userIDInt); err != nil {
-			http.Error(w, "Failed to delete user", http.StatusInternalServerError)
+		if err := store.DeleteUser(r.Context(), userIDInt); err != nil {
+			writeDatabaseError(w, err, "Failed to delete user")
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
+		w.WriteHeader(http.StatusNoContent)
 	}
 }
 
-func RefreshCovidDataForAllCountriesHandler(db *sql.DB) http.HandlerFunc {
+// RefreshCovidDataForAllCountriesHandler answers with a 202 once the refresh is started, it runs in the
+// background as it takes longer than the requests may.
+func RefreshCovidDataForAllCountriesHandler(f *fetcher.Fetcher) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		if err := fetcher.FetchAndUpdateData(db); err != nil {
-			http.Error(w, "Failed to refresh COVID data", http.StatusInternalServerError)
+		if err := f.Refresh(r.Context()); err != nil {
+			switch {
+			case errors.Is(err, fetcher.ErrRefreshRunning):
+				WriteError(w, http.StatusConflict, ErrCodeConflict, err.Error())
+			case errors.Is(err, fetcher.ErrStopped):
+				WriteError(w, http.StatusServiceUnavailable, ErrCodeUnavailable, err.Error())
+			default:
+				WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to refresh COVID data")
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func DataQualityReportHandler(store database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		countryID := chi.URLParam(r, "countryId")
+		countryIDInt, err := strconv.Atoi(countryID)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid country ID")
+			return
+		}
+
+		v, ok, err := countriesVersion(r.Context(), store, countryIDInt)
+		if err != nil {
+			writeDatabaseError(w, err, "Failed to build data quality report")
+			return
+		}
+		if ok && notModified(w, r, v) {
+			return
+		}
+
+		report, err := quality.BuildReport(r.Context(), store, countryIDInt)
+		if err != nil {
+			writeDatabaseError(w, err, "Failed to build data quality report")
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
+		writeJSON(w, http.StatusOK, MapQualityReportToAPIModel(&report))
 	}
 }
@@ -2,41 +2,90 @@ package api
 
 import (
 	"covid/database"
+	"covid/groups"
+	"covid/quality"
+	"covid/rankings"
+	"covid/status"
 	"fmt"
 	"strconv"
+	"time"
 )
 
 type UserInput struct {
 	Username string `json:"username"`
-	Email    string `json:"email"`
+	Email    string `json:"email" format:"email"`
 	Password string `json:"password"`
 }
 
+type LoginInput struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type EmailInput struct {
+	Email string `json:"email" format:"email"`
+}
+
+type ResetPasswordInput struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type TokenInput struct {
+	Token string `json:"token"`
+}
+
 type User struct {
 	ID                 string     `json:"id"`
 	Username           string     `json:"username"`
-	Email              string     `json:"email"`
+	Email              string     `json:"email" format:"email"`
+	EmailVerified      bool       `json:"email_verified"`
 	MonitoredCountries []*Country `json:"monitored_countries"`
 }
 
+// Country has its latest statistic only when a single country is returned, and when it has statistics.
 type Country struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
-	Code string `json:"code"`
+	ID     string         `json:"id"`
+	Name   string         `json:"name"`
+	Code   string         `json:"code"`
+	Latest *CountryLatest `json:"latest,omitempty"`
+}
+
+// CountryLatest compares the latest statistic of a country to the last ones at least 1 and 7 days older,
+// the changes are left out when there is none.
+type CountryLatest struct {
+	Date        string           `json:"date" format:"date"`
+	Confirmed   int              `json:"confirmed"`
+	Recovered   int              `json:"recovered"`
+	Deaths      int              `json:"deaths"`
+	Change1Day  *StatisticChange `json:"change_1_day,omitempty"`
+	Change7Days *StatisticChange `json:"change_7_days,omitempty"`
+}
+
+type StatisticChange struct {
+	Confirmed int `json:"confirmed"`
+	Recovered int `json:"recovered"`
+	Deaths    int `json:"deaths"`
 }
 
 type CovidStatistic struct {
 	ID        string `json:"id"`
 	CountryID string `json:"country_id"`
-	Date      string `json:"date"`
+	Date      string `json:"date" format:"date"`
 	Confirmed int    `json:"confirmed"`
 	Recovered int    `json:"recovered"`
 	Deaths    int    `json:"deaths"`
 }
 
-type CountryFilterInput struct {
-	NameContains *string `json:"nameContains,omitempty"`
-	CodeEquals   *string `json:"codeEquals,omitempty"`
+// CountryList and CovidStatisticList are pages of a list, NextCursor is null on the last page.
+type CountryList struct {
+	Data       []*Country `json:"data"`
+	NextCursor *string    `json:"next_cursor"`
+}
+
+type CovidStatisticList struct {
+	Data       []*CovidStatistic `json:"data"`
+	NextCursor *string           `json:"next_cursor"`
 }
 
 type CountryInput struct {
@@ -46,17 +95,149 @@ type CountryInput struct {
 
 type CovidStatisticInput struct {
 	CountryID string `json:"countryID"`
-	Date      string `json:"date"`
+	Date      string `json:"date" format:"date"`
 	Confirmed int    `json:"confirmed"`
 	Recovered int    `json:"recovered"`
 	Deaths    int    `json:"deaths"`
 }
 
+// CountryPatchInput and CovidStatisticPatchInput are the bodies of PATCH requests, fields left out are not changed.
+type CountryPatchInput struct {
+	Name *string `json:"name,omitempty"`
+	Code *string `json:"code,omitempty"`
+}
+
+type CovidStatisticPatchInput struct {
+	Date      *string `json:"date,omitempty" format:"date"`
+	Confirmed *int    `json:"confirmed,omitempty"`
+	Recovered *int    `json:"recovered,omitempty"`
+	Deaths    *int    `json:"deaths,omitempty"`
+}
+
+type DataQualityIssue struct {
+	ID               string `json:"id"`
+	CovidStatisticID string `json:"covid_statistic_id"`
+	Date             string `json:"date" format:"date"`
+	Code             string `json:"code"`
+	Severity         string `json:"severity"`
+	Message          string `json:"message"`
+	CreatedAt        string `json:"created_at" format:"date-time"`
+}
+
+type DataQualityReport struct {
+	Country      *Country            `json:"country"`
+	TotalIssues  int                 `json:"total_issues"`
+	Errors       int                 `json:"errors"`
+	Warnings     int                 `json:"warnings"`
+	CountsByCode map[string]int      `json:"counts_by_code"`
+	Issues       []*DataQualityIssue `json:"issues"`
+}
+
+type MonitoredCountryInput struct {
+	CountryID int `json:"countryId"`
+}
+
+type DeathPercentage struct {
+	DeathPercentage float64 `json:"deathPercentage"`
+}
+
 type LoginResponse struct {
 	Token string `json:"token"`
 	User  *User  `json:"user"`
 }
 
+// CountryGroup lists its members only when a single group is returned.
+type CountryGroup struct {
+	ID      string     `json:"id"`
+	Name    string     `json:"name"`
+	Kind    string     `json:"kind"`
+	Members []*Country `json:"members,omitempty"`
+}
+
+type CountryGroupInput struct {
+	Name       string `json:"name"`
+	CountryIDs []int  `json:"country_ids,omitempty"`
+}
+
+type CountryGroupMemberInput struct {
+	CountryID int `json:"countryId"`
+}
+
+// GroupStatistic sums the last statistics of the members of a group on a day, ReportingMembers is the
+// number of members that had reported by then.
+type GroupStatistic struct {
+	Date             string `json:"date" format:"date"`
+	Confirmed        int    `json:"confirmed"`
+	Recovered        int    `json:"recovered"`
+	Deaths           int    `json:"deaths"`
+	ReportingMembers int    `json:"reporting_members"`
+}
+
+type GroupMemberRanking struct {
+	Rank    int      `json:"rank"`
+	Country *Country `json:"country"`
+	Value   float64  `json:"value"`
+	Date    string   `json:"date" format:"date"`
+}
+
+// Ranking is a page of the countries ranked by a metric, Total counts every ranked country.
+type Ranking struct {
+	Metric     string          `json:"metric"`
+	Date       *string         `json:"date" format:"date"`
+	ChangeDays int             `json:"change_days"`
+	Total      int             `json:"total"`
+	Data       []*RankingEntry `json:"data"`
+}
+
+// RankingEntry compares the rank of a country to its rank change_days earlier, PreviousRank and RankChange
+// are null when it was not ranked then.
+type RankingEntry struct {
+	Rank         int      `json:"rank"`
+	Country      *Country `json:"country"`
+	Value        float64  `json:"value"`
+	Date         string   `json:"date" format:"date"`
+	Percentile   float64  `json:"percentile"`
+	PreviousRank *int     `json:"previous_rank"`
+	RankChange   *int     `json:"rank_change"`
+}
+
+// SystemStatus is the state of the server, the times of the fetches are null until a fetch finished.
+type SystemStatus struct {
+	Version       string         `json:"version"`
+	Revision      *string        `json:"revision"`
+	StartedAt     string         `json:"started_at" format:"date-time"`
+	UptimeSeconds float64        `json:"uptime_seconds"`
+	Database      DatabaseStatus `json:"database"`
+	Fetcher       FetcherStatus  `json:"fetcher"`
+	Subscriptions int            `json:"subscriptions"`
+}
+
+type DatabaseStatus struct {
+	SizeBytes     int64            `json:"size_bytes"`
+	SchemaVersion int              `json:"schema_version"`
+	Tables        []*TableRowCount `json:"tables"`
+}
+
+type TableRowCount struct {
+	Table string `json:"table"`
+	Rows  int    `json:"rows"`
+}
+
+type FetcherStatus struct {
+	Running bool           `json:"running"`
+	Backlog int            `json:"backlog"`
+	Sources []*FetchSource `json:"sources"`
+}
+
+type FetchSource struct {
+	Name            string  `json:"name"`
+	URL             string  `json:"url"`
+	LastFetchAt     *string `json:"last_fetch_at" format:"date-time"`
+	LastSuccessAt   *string `json:"last_success_at" format:"date-time"`
+	LastError       *string `json:"last_error"`
+	FailedCountries int     `json:"failed_countries"`
+}
+
 func MapDatabaseCovidStatisticsToAPIModels(covidStatistics []*database.CovidStatistic) []*CovidStatistic {
 	var apiModels []*CovidStatistic
 	for _, cs := range covidStatistics {
@@ -84,8 +265,30 @@ func MapDatabaseCountryToAPIModel(country *database.Country) *Country {
 	}
 }
 
+func MapDatabaseCountryLatestStatisticsToAPIModel(latest *database.CountryLatestStatistics) *CountryLatest {
+	return &CountryLatest{
+		Date:        latest.Date,
+		Confirmed:   latest.Confirmed,
+		Recovered:   latest.Recovered,
+		Deaths:      latest.Deaths,
+		Change1Day:  mapDatabaseStatisticChangeToAPIModel(latest.Change1Day),
+		Change7Days: mapDatabaseStatisticChangeToAPIModel(latest.Change7Days),
+	}
+}
+
+func mapDatabaseStatisticChangeToAPIModel(change *database.StatisticChange) *StatisticChange {
+	if change == nil {
+		return nil
+	}
+	return &StatisticChange{
+		Confirmed: change.Confirmed,
+		Recovered: change.Recovered,
+		Deaths:    change.Deaths,
+	}
+}
+
 func MapDatabaseCountriesToAPIModels(countries []database.Country) []*Country {
-	var apiModels []*Country
+	apiModels := []*Country{}
 	for _, country := range countries {
 		apiModels = append(apiModels, MapDatabaseCountryToAPIModel(&country))
 	}
@@ -97,6 +300,7 @@ func MapDatabaseUserToAPIModel(user *database.User) *User {
 		ID:                 fmt.Sprint(user.ID),
 		Email:              user.Email,
 		Username:           user.Username,
+		EmailVerified:      user.EmailVerified,
 		MonitoredCountries: MapDatabaseCountriesToAPIModels(user.MonitoredCountries),
 	}
 }
@@ -136,6 +340,143 @@ func MapAPICovidStatisticToDatabaseModel(covidStat *CovidStatistic) *database.Co
 	}
 }
 
+func MapDatabaseDataQualityIssueToAPIModel(issue *database.DataQualityIssue) *DataQualityIssue {
+	return &DataQualityIssue{
+		ID:               fmt.Sprint(issue.ID),
+		CovidStatisticID: fmt.Sprint(issue.CovidStatisticID),
+		Date:             issue.Date,
+		Code:             issue.Code,
+		Severity:         issue.Severity,
+		Message:          issue.Message,
+		CreatedAt:        issue.CreatedAt,
+	}
+}
+
+func MapQualityReportToAPIModel(report *quality.Report) *DataQualityReport {
+	countsByCode := map[string]int{}
+	for _, codeCount := range report.CountsByCode {
+		countsByCode[string(codeCount.Code)] = codeCount.Count
+	}
+
+	apiIssues := []*DataQualityIssue{}
+	for i := range report.Issues {
+		apiIssues = append(apiIssues, MapDatabaseDataQualityIssueToAPIModel(&report.Issues[i]))
+	}
+
+	return &DataQualityReport{
+		Country:      MapDatabaseCountryToAPIModel(&report.Country),
+		TotalIssues:  report.TotalIssues,
+		Errors:       report.Errors,
+		Warnings:     report.Warnings,
+		CountsByCode: countsByCode,
+		Issues:       apiIssues,
+	}
+}
+
+func MapDatabaseCountryGroupToAPIModel(group *database.CountryGroup) *CountryGroup {
+	apiGroup := &CountryGroup{
+		ID:   fmt.Sprint(group.ID),
+		Name: group.Name,
+		Kind: group.Kind,
+	}
+	for i := range group.Members {
+		apiGroup.Members = append(apiGroup.Members, MapDatabaseCountryToAPIModel(&group.Members[i]))
+	}
+	return apiGroup
+}
+
+func MapGroupStatisticToAPIModel(statistic groups.Statistic) *GroupStatistic {
+	return &GroupStatistic{
+		Date:             statistic.Date,
+		Confirmed:        statistic.Confirmed,
+		Recovered:        statistic.Recovered,
+		Deaths:           statistic.Deaths,
+		ReportingMembers: statistic.ReportingMembers,
+	}
+}
+
+func MapRankingEntryToGroupMemberRankingAPIModel(entry rankings.Entry) *GroupMemberRanking {
+	return &GroupMemberRanking{
+		Rank:    entry.Rank,
+		Country: MapDatabaseCountryToAPIModel(&entry.Country),
+		Value:   entry.Value,
+		Date:    entry.Date,
+	}
+}
+
+func MapRankingToAPIModel(ranking *rankings.Ranking) *Ranking {
+	apiRanking := &Ranking{
+		Metric:     string(ranking.Metric),
+		ChangeDays: ranking.ChangeDays,
+		Total:      ranking.Total,
+		Data:       []*RankingEntry{},
+	}
+	if ranking.Date != "" {
+		apiRanking.Date = &ranking.Date
+	}
+	for i := range ranking.Entries {
+		entry := &ranking.Entries[i]
+		apiRanking.Data = append(apiRanking.Data, &RankingEntry{
+			Rank:         entry.Rank,
+			Country:      MapDatabaseCountryToAPIModel(&entry.Country),
+			Value:        entry.Value,
+			Date:         entry.Date,
+			Percentile:   entry.Percentile,
+			PreviousRank: entry.PreviousRank,
+			RankChange:   entry.RankChange,
+		})
+	}
+	return apiRanking
+}
+
+func MapStatusToAPIModel(systemStatus *status.Status) *SystemStatus {
+	apiStatus := &SystemStatus{
+		Version:       systemStatus.Version,
+		StartedAt:     systemStatus.StartedAt.Format(time.RFC3339),
+		UptimeSeconds: systemStatus.Uptime.Seconds(),
+		Database: DatabaseStatus{
+			SizeBytes:     systemStatus.Database.SizeBytes,
+			SchemaVersion: systemStatus.Database.SchemaVersion,
+			Tables:        []*TableRowCount{},
+		},
+		Fetcher: FetcherStatus{
+			Running: systemStatus.Fetcher.Running,
+			Backlog: systemStatus.Fetcher.Backlog,
+			Sources: []*FetchSource{},
+		},
+		Subscriptions: systemStatus.Subscriptions,
+	}
+	if systemStatus.Revision != "" {
+		apiStatus.Revision = &systemStatus.Revision
+	}
+	for _, table := range systemStatus.Database.Tables {
+		apiStatus.Database.Tables = append(apiStatus.Database.Tables, &TableRowCount{Table: table.Table, Rows: table.Rows})
+	}
+	for _, source := range systemStatus.Fetcher.Sources {
+		apiSource := &FetchSource{
+			Name:            source.Name,
+			URL:             source.URL,
+			LastFetchAt:     optionalTime(source.LastFetchAt),
+			LastSuccessAt:   optionalTime(source.LastSuccessAt),
+			FailedCountries: source.FailedCountries,
+		}
+		if source.LastError != "" {
+			apiSource.LastError = &source.LastError
+		}
+		apiStatus.Fetcher.Sources = append(apiStatus.Fetcher.Sources, apiSource)
+	}
+	return apiStatus
+}
+
+// optionalTime formats t as RFC 3339, nil for the zero time.
+func optionalTime(t time.Time) *string {
+	if t.IsZero() {
+		return nil
+	}
+	formatted := t.Format(time.RFC3339)
+	return &formatted
+}
+
 func mustParseInt(str string) int {
 	i, err := strconv.Atoi(str)
 	if err != nil {
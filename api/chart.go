@@ -0,0 +1,83 @@
+package api
+
+import (
+	"bytes"
+	"covid/chart"
+	"covid/database"
+	"covid/export"
+	"covid/series"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func CountryChartHandler(store database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		countryID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid country ID")
+			return
+		}
+		compare, err := export.ParseCountryIDs(query.Get("compare"))
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+			return
+		}
+		countryIDs := append([]int{countryID}, compare...)
+		if len(countryIDs) > chart.MaxSeries {
+			WriteError(w, http.StatusBadRequest, ErrCodeValidation, fmt.Sprintf("a chart shows at most %d countries", chart.MaxSeries))
+			return
+		}
+
+		metric := series.MetricConfirmed
+		if query.Has("metric") {
+			if metric, err = series.ParseMetric(query.Get("metric")); err != nil {
+				WriteError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+				return
+			}
+		}
+
+		// the parameters were checked against the route's parameters, only their ranges are left:
+		smoothing, _ := strconv.Atoi(query.Get("smoothing"))
+		if smoothing < 0 {
+			WriteError(w, http.StatusBadRequest, ErrCodeValidation, "smoothing must not be negative")
+			return
+		}
+		opts := chart.Options{
+			Kind:  chart.Kind(query.Get("type")),
+			Theme: chart.Theme(query.Get("theme")),
+		}
+		opts.Width, _ = strconv.Atoi(query.Get("width"))
+		opts.Height, _ = strconv.Atoi(query.Get("height"))
+		opts.LogScale, _ = strconv.ParseBool(query.Get("log"))
+
+		v, ok, err := countriesVersion(r.Context(), store, countryIDs...)
+		if err != nil {
+			writeDatabaseError(w, err, "Failed to get covid statistics")
+			return
+		}
+		if ok && notModified(w, r, v) {
+			return
+		}
+
+		data, err := series.LoadCountries(r.Context(), store, countryIDs, metric, optionalParam(query, "from"), optionalParam(query, "to"), smoothing)
+		if err != nil {
+			writeDatabaseError(w, err, "Failed to get covid statistics")
+			return
+		}
+
+		// rendered to a buffer first, so that invalid options are still answered with an error:
+		var svg bytes.Buffer
+		if err := chart.Render(&svg, data, opts); err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write(svg.Bytes())
+	}
+}
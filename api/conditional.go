@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"covid/database"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// version identifies the data a read is answered from, for the clients polling it to be answered with a
+// 304 Not Modified until it changes. count tells lists apart after a deletion, which leaves no change behind.
+type version struct {
+	updatedAt time.Time
+	count     int
+}
+
+// etag is weak, the response being the same data whether it is compressed or not.
+func (v version) etag() string {
+	var updatedAt int64
+	if !v.updatedAt.IsZero() {
+		updatedAt = v.updatedAt.UnixNano()
+	}
+	return fmt.Sprintf(`W/"%x-%x"`, updatedAt, v.count)
+}
+
+// countriesVersion returns the version of the data of the countries, the latest change of any of them. ok is
+// false when one of them does not exist, the read then answers as it would without validators.
+func countriesVersion(ctx context.Context, store database.Store, countryIDs ...int) (v version, ok bool, err error) {
+	for _, countryID := range countryIDs {
+		updatedAt, err := store.GetCountryUpdatedAt(ctx, countryID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return version{}, false, nil
+		}
+		if err != nil {
+			return version{}, false, err
+		}
+		if updatedAt.After(v.updatedAt) {
+			v.updatedAt = updatedAt
+		}
+	}
+	v.count = len(countryIDs)
+	return v, true, nil
+}
+
+// notModified sets the ETag and Last-Modified headers of a read answered from data of version v, and answers
+// with a 304 Not Modified when the request shows the client has it already. It returns true when it answered.
+func notModified(w http.ResponseWriter, r *http.Request, v version) bool {
+	etag := v.etag()
+	w.Header().Set("ETag", etag)
+	if !v.updatedAt.IsZero() {
+		w.Header().Set("Last-Modified", v.updatedAt.UTC().Format(http.TimeFormat))
+	}
+	if !fresh(r, etag, v.updatedAt) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// fresh evaluates If-None-Match, and If-Modified-Since when there is none, as RFC 9110 orders them.
+func fresh(r *http.Request, etag string, updatedAt time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if values := r.Header.Values("If-None-Match"); len(values) > 0 {
+		return etagMatches(strings.Join(values, ","), etag)
+	}
+	if updatedAt.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	// Last-Modified is sent to the second:
+	return !updatedAt.Truncate(time.Second).After(since)
+}
+
+// etagMatches compares the tags of If-None-Match to etag weakly, as the header is compared.
+func etagMatches(header string, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// CachePolicy is the Cache-Control header of the successful reads, the one of their route pattern, such as
+// /api/v1/countries/{id}, in Routes, or Default. No header is sent when it is empty.
+type CachePolicy struct {
+	Default string
+	Routes  map[string]string
+}
+
+// Middleware sets the Cache-Control header of the GET requests it routes. It has to run once the request is
+// routed, from chi.Router.With or a group, for the route pattern to be known. The errors replace it with
+// no-store.
+func (p CachePolicy) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			value, ok := p.Routes[chi.RouteContext(r.Context()).RoutePattern()]
+			if !ok {
+				value = p.Default
+			}
+			if value != "" {
+				w.Header().Set("Cache-Control", value)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
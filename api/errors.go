@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"covid/database"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Error codes returned in the error envelope, clients should switch on these rather than on messages.
+const (
+	ErrCodeBadRequest       = "BAD_REQUEST"
+	ErrCodeUnauthorized     = "UNAUTHORIZED"
+	ErrCodeForbidden        = "FORBIDDEN"
+	ErrCodeNotFound         = "NOT_FOUND"
+	ErrCodeMethodNotAllowed = "METHOD_NOT_ALLOWED"
+	ErrCodeConflict         = "CONFLICT"
+	ErrCodePayloadTooLarge  = "PAYLOAD_TOO_LARGE"
+	ErrCodeValidation       = "VALIDATION_FAILED"
+	ErrCodeRateLimited      = "RATE_LIMITED"
+	ErrCodeTimeout          = "TIMEOUT"
+	ErrCodeUnavailable      = "UNAVAILABLE"
+	ErrCodeInternal         = "INTERNAL_ERROR"
+)
+
+// ErrorResponse is the envelope of every REST error:
+//
+//	{"error": {"code": "NOT_FOUND", "message": "country not found"}}
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+type ErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func WriteError(w http.ResponseWriter, status int, code string, message string) {
+	// in place of the validators and the Cache-Control of the successful reads:
+	w.Header().Del("ETag")
+	w.Header().Del("Last-Modified")
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, ErrorResponse{Error: ErrorBody{Code: code, Message: message}})
+}
+
+// writeDatabaseError answers with a 404 when err comes from a missing row, a 400 for invalid filters, a 409 for
+// changes to continent groups, a 504 when the request timed out, and with a 500 otherwise.
+func writeDatabaseError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		WriteError(w, http.StatusGatewayTimeout, ErrCodeTimeout, "the request took too long")
+		return
+	}
+	if errors.Is(err, database.ErrInvalidFilter) {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, database.ErrContinentGroup) {
+		WriteError(w, http.StatusConflict, ErrCodeConflict, err.Error())
+		return
+	}
+	if errors.Is(err, database.ErrNotFound) {
+		WriteError(w, http.StatusNotFound, ErrCodeNotFound, err.Error())
+		return
+	}
+	// the reads wrap sql.ErrNoRows in messages that are not meant for clients:
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteError(w, http.StatusNotFound, ErrCodeNotFound, "resource not found")
+		return
+	}
+	WriteError(w, http.StatusInternalServerError, ErrCodeInternal, message)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// NotFoundHandler answers unknown routes with the error envelope.
+func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, http.StatusNotFound, ErrCodeNotFound, "no route for "+r.URL.Path)
+}
+
+// MethodNotAllowedHandler answers known routes called with the wrong method with the error envelope.
+func MethodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"covid/database"
+	"covid/export"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+func ExportCovidStatisticsHandler(store database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		format, err := exportFormat(r)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+			return
+		}
+		countryIDs, err := export.ParseCountryIDs(query.Get("country_ids"))
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+			return
+		}
+		metrics, err := export.ParseMetrics(query.Get("metrics"))
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", export.Formats[format])
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "covid-stats." + string(format)}))
+
+		opts := export.Options{
+			CountryIDs: countryIDs,
+			DateFrom:   optionalParam(query, "date_from"),
+			DateTo:     optionalParam(query, "date_to"),
+			Metrics:    metrics,
+		}
+		// the status is sent with the first rows, an error after that can only cut the download short:
+		if err := export.CovidStatistics(r.Context(), store, w, format, opts); err != nil {
+			slog.ErrorContext(r.Context(), "failed to export covid statistics", "error", err)
+		}
+	}
+}
+
+// exportFormat reads the format parameter, or the Accept header when it is missing. CSV is the default.
+func exportFormat(r *http.Request) (export.Format, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return export.ParseFormat(format)
+	}
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		if format, ok := export.FormatForContentType(mediaType); ok {
+			return format, nil
+		}
+	}
+	return export.FormatCSV, nil
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"covid/analytics"
+	"covid/database"
+	"covid/graph"
+	"covid/groups"
+	"covid/rankings"
+	"covid/series"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// requireAdmin answers with a 403 unless the request was authenticated by an admin.
+func requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := graph.ClaimsFromContext(r.Context())
+		if !ok || claims.Role != database.RoleAdmin {
+			WriteError(w, http.StatusForbidden, ErrCodeForbidden, "only admins can do this")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func CountryGroupsHandler(store database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		countryGroups, err := store.GetCountryGroups(r.Context())
+		if err != nil {
+			writeDatabaseError(w, err, "Failed to get country groups")
+			return
+		}
+
+		apiGroups := []*CountryGroup{}
+		for i := range countryGroups {
+			apiGroups = append(apiGroups, MapDatabaseCountryGroupToAPIModel(&countryGroups[i]))
+		}
+		writeJSON(w, http.StatusOK, apiGroups)
+	}
+}
+
+func AddCountryGroupHandler(store database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input CountryGroupInput
+		err := json.NewDecoder(r.Body).Decode(&input)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+			return
+		}
+
+		input.Name = strings.TrimSpace(input.Name)
+		if input.Name == "" {
+			WriteError(w, http.StatusBadRequest, ErrCodeValidation, "group name must not be empty")
+			return
+		}
+
+		group, exists, err := store.CreateCountryGroup(r.Context(), input.Name, input.CountryIDs)
+		if err != nil {
+			writeDatabaseError(w, err, "Failed to create country group")
+			return
+		}
+
+		if exists {
+			WriteError(w, http.StatusConflict, ErrCodeConflict, "country group already exists")
+			return
+		}
+
+		url := fmt.Sprintf("/api/v1/groups/%d", group.ID)
+		w.Header().Set("Location", url)
+		writeJSON(w, http.StatusCreated, MapDatabaseCountryGroupToAPIModel(&group))
+	}
+}
+
+func CountryGroupByIDHandler(store database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		group, ok := countryGroupFromRequest(w, r, store)
+		if !ok {
+			return
+		}
+		writeJSON(w, http.StatusOK, MapDatabaseCountryGroupToAPIModel(&group))
+	}
+}
+
+func DeleteCountryGroupHandler(store database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid group ID")
+			return
+		}
+
+		if err := store.DeleteCountryGroup(r.Context(), id); err != nil {
+			writeDatabaseError(w, err, "Failed to delete country group")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func AddCountryGroupMemberHandler(store database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid group ID")
+			return
+		}
+
+		var input CountryGroupMemberInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+			return
+		}
+
+		if err := store.AddCountryGroupMember(r.Context(), id, input.CountryID); err != nil {
+			writeDatabaseError(w, err, "Failed to add country to group")
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func DeleteCountryGroupMemberHandler(store database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid group ID")
+			return
+		}
+		countryID, err := strconv.Atoi(chi.URLParam(r, "countryid"))
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid country ID")
+			return
+		}
+
+		if err := store.RemoveCountryGroupMember(r.Context(), id, countryID); err != nil {
+			writeDatabaseError(w, err, "Failed to remove country from group")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func CountryGroupStatisticsHandler(store database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		group, ok := countryGroupFromRequest(w, r, store)
+		if !ok {
+			return
+		}
+
+		query := r.URL.Query()
+		statistics, err := groups.Statistics(r.Context(), store, group, optionalParam(query, "from"), optionalParam(query, "to"))
+		if err != nil {
+			writeDatabaseError(w, err, "Failed to get group statistics")
+			return
+		}
+
+		apiStatistics := []*GroupStatistic{}
+		for _, statistic := range statistics {
+			apiStatistics = append(apiStatistics, MapGroupStatisticToAPIModel(statistic))
+		}
+		writeJSON(w, http.StatusOK, apiStatistics)
+	}
+}
+
+func CountryGroupLatestHandler(store database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		group, ok := countryGroupFromRequest(w, r, store)
+		if !ok {
+			return
+		}
+
+		latest, found, err := groups.Latest(r.Context(), store, group)
+		if err != nil {
+			writeDatabaseError(w, err, "Failed to get group statistics")
+			return
+		}
+		if !found {
+			WriteError(w, http.StatusNotFound, ErrCodeNotFound, "no member of the group has statistics")
+			return
+		}
+		writeJSON(w, http.StatusOK, MapGroupStatisticToAPIModel(latest))
+	}
+}
+
+func CountryGroupRankingsHandler(store database.Store, rt *analytics.RtEstimator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		group, ok := countryGroupFromRequest(w, r, store)
+		if !ok {
+			return
+		}
+
+		metric := series.MetricConfirmed
+		if query := r.URL.Query(); query.Has("metric") {
+			metric = series.Metric(query.Get("metric"))
+		}
+
+		ranking, err := rankings.Rank(r.Context(), store, rt, rankings.Options{Metric: metric, GroupID: &group.ID})
+		if err != nil {
+			writeRankingError(w, err)
+			return
+		}
+
+		apiRankings := []*GroupMemberRanking{}
+		for _, entry := range ranking.Entries {
+			apiRankings = append(apiRankings, MapRankingEntryToGroupMemberRankingAPIModel(entry))
+		}
+		writeJSON(w, http.StatusOK, apiRankings)
+	}
+}
+
+// countryGroupFromRequest reads the group of the id path parameter with its members, answering with an
+// error and returning false when it cannot.
+func countryGroupFromRequest(w http.ResponseWriter, r *http.Request, store database.Store) (database.CountryGroup, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid group ID")
+		return database.CountryGroup{}, false
+	}
+
+	group, err := store.GetCountryGroupByID(r.Context(), id)
+	if err != nil {
+		writeDatabaseError(w, err, "Failed to get country group")
+		return database.CountryGroup{}, false
+	}
+	return group, true
+}
@@ -0,0 +1,295 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	openAPIVersion = "3.0.3"
+	apiVersion     = "1.0.0"
+	apiBasePath    = "/api/v1"
+	schemaRefPath  = "#/components/schemas/"
+	bearerAuth     = "bearerAuth"
+)
+
+// Document is the subset of an OpenAPI 3 document used to describe the REST API.
+type Document struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       Info                                    `json:"info"`
+	Servers    []Server                                `json:"servers"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components Components                              `json:"components"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+type OpenAPIOperation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Tags        []string              `json:"tags"`
+	Parameters  []OpenAPIParameter    `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security"`
+}
+
+type OpenAPIParameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is the subset of JSON schema needed by the api models. AdditionalProperties is either
+// false or the *Schema of the values of a map.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+}
+
+//go:embed docs.html
+var docsPage []byte
+
+// openAPIDocument is built once from Operations and the api models.
+var openAPIDocument = BuildOpenAPIDocument(Operations)
+
+var pathParamPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+// BuildOpenAPIDocument describes operations, with the schemas of their models found by reflection.
+// Fields are required unless their json tag has omitempty, and the format struct tag sets the format of strings.
+func BuildOpenAPIDocument(operations []Operation) *Document {
+	doc := &Document{
+		OpenAPI: openAPIVersion,
+		Info:    Info{Title: "COVID statistics REST API", Version: apiVersion},
+		Servers: []Server{{URL: apiBasePath}},
+		Paths:   map[string]map[string]*OpenAPIOperation{},
+		Components: Components{
+			Schemas: map[string]*Schema{},
+			SecuritySchemes: map[string]SecurityScheme{
+				bearerAuth: {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			},
+		},
+	}
+	errorSchema := schemaOf(reflect.TypeOf(ErrorResponse{}), doc.Components.Schemas)
+
+	for _, op := range operations {
+		operation := &OpenAPIOperation{
+			OperationID: operationID(op),
+			Summary:     op.Summary,
+			Tags:        []string{op.Tag},
+			Responses: map[string]Response{
+				"default": {
+					Description: "error",
+					Content:     map[string]MediaType{"application/json": {Schema: errorSchema}},
+				},
+			},
+			Security: []map[string][]string{{bearerAuth: {}}},
+		}
+		if op.Public {
+			operation.Security = []map[string][]string{}
+		}
+
+		for _, match := range pathParamPattern.FindAllStringSubmatch(op.Path, -1) {
+			operation.Parameters = append(operation.Parameters, OpenAPIParameter{
+				Name:     match[1],
+				In:       "path",
+				Required: true,
+				Schema:   &Schema{Type: "integer"},
+			})
+		}
+		for _, param := range op.QueryParams {
+			operation.Parameters = append(operation.Parameters, OpenAPIParameter{
+				Name:        param.Name,
+				In:          "query",
+				Description: param.Description,
+				Required:    param.Required,
+				Schema:      &Schema{Type: param.Type, Format: param.Format, Enum: param.Enum},
+			})
+		}
+
+		if op.Body != nil {
+			operation.RequestBody = &RequestBody{
+				Required: true,
+				Content:  map[string]MediaType{"application/json": {Schema: schemaOf(reflect.TypeOf(op.Body), doc.Components.Schemas)}},
+			}
+		}
+
+		response := Response{Description: http.StatusText(op.Status)}
+		if op.Response != nil {
+			response.Content = map[string]MediaType{"application/json": {Schema: schemaOf(reflect.TypeOf(op.Response), doc.Components.Schemas)}}
+		}
+		for _, contentType := range op.ContentTypes {
+			if response.Content == nil {
+				response.Content = map[string]MediaType{}
+			}
+			response.Content[contentType] = MediaType{Schema: &Schema{Type: "string", Format: "binary"}}
+		}
+		operation.Responses[strconv.Itoa(op.Status)] = response
+
+		if doc.Paths[op.Path] == nil {
+			doc.Paths[op.Path] = map[string]*OpenAPIOperation{}
+		}
+		doc.Paths[op.Path][strings.ToLower(op.Method)] = operation
+	}
+
+	return doc
+}
+
+// operationID names an operation after its method and the static segments of its path, e.g. getCountriesDeathPercentage.
+func operationID(op Operation) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(op.Method))
+	for _, segment := range strings.Split(op.Path, "/") {
+		if segment == "" || strings.HasPrefix(segment, "{") {
+			continue
+		}
+		for _, word := range strings.FieldsFunc(segment, func(r rune) bool { return r == '-' || r == '_' }) {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	if strings.HasSuffix(op.Path, "}") {
+		b.WriteString("ByID")
+	}
+	return b.String()
+}
+
+// schemaOf returns the schema of t, structs are added to schemas and referenced.
+// Pointers to anything but a struct are nullable.
+func schemaOf(t reflect.Type, schemas map[string]*Schema) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		nullable = t.Kind() != reflect.Struct
+	}
+
+	schema := baseSchemaOf(t, schemas)
+	schema.Nullable = nullable
+	return schema
+}
+
+func baseSchemaOf(t reflect.Type, schemas map[string]*Schema) *Schema {
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: schemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+		if _, ok := schemas[t.Name()]; !ok {
+			// registered before the fields so that recursive models terminate:
+			schema := &Schema{Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: false}
+			schemas[t.Name()] = schema
+			for i := 0; i < t.NumField(); i++ {
+				field := t.Field(i)
+				name, omitempty, ok := jsonField(field)
+				if !ok {
+					continue
+				}
+				property := schemaOf(field.Type, schemas)
+				if format := field.Tag.Get("format"); format != "" {
+					property.Format = format
+				}
+				schema.Properties[name] = property
+				if !omitempty {
+					schema.Required = append(schema.Required, name)
+				}
+			}
+			sort.Strings(schema.Required)
+		}
+		return &Schema{Ref: schemaRefPath + t.Name()}
+	default:
+		return &Schema{}
+	}
+}
+
+// jsonField returns the name a field is encoded with, and whether it is omitted when empty.
+func jsonField(field reflect.StructField) (string, bool, bool) {
+	if !field.IsExported() {
+		return "", false, false
+	}
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false, false
+	}
+	parts := strings.Split(tag, ",")
+	name := parts[0]
+	if name == "" {
+		name = field.Name
+	}
+	omitempty := false
+	for _, option := range parts[1:] {
+		if option == "omitempty" {
+			omitempty = true
+		}
+	}
+	return name, omitempty, true
+}
+
+// OpenAPIHandler serves the OpenAPI document of the REST API.
+func OpenAPIHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, openAPIDocument)
+	}
+}
+
+// DocsHandler serves a page rendering the OpenAPI document, it needs nothing but /api/openapi.json.
+func DocsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(docsPage)
+	}
+}
@@ -0,0 +1,363 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"covid/analytics"
+	"covid/database"
+	"covid/fetcher"
+	"covid/graph"
+	"covid/mail"
+	"covid/quality"
+	"covid/ratelimit"
+	"covid/status"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// recordingSender keeps the emails of the account flows, for their tokens to be used.
+type recordingSender struct {
+	messages chan mail.Message
+}
+
+func (s recordingSender) Send(ctx context.Context, msg mail.Message) error {
+	s.messages <- msg
+	return nil
+}
+
+var emailedToken = regexp.MustCompile(`Use this token to [^:]*:\n\n(\S+)`)
+
+// token waits for the next email and returns its token.
+func (s recordingSender) token(t *testing.T) string {
+	t.Helper()
+	select {
+	case msg := <-s.messages:
+		match := emailedToken.FindStringSubmatch(msg.Body)
+		if match == nil {
+			t.Fatalf("no token in email %q", msg.Body)
+		}
+		return match[1]
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email was sent")
+		return ""
+	}
+}
+
+// openAPITestServer serves the Operations the way the server does, on a new SQLite database.
+type openAPITestServer struct {
+	t      *testing.T
+	doc    *Document
+	router chi.Router
+	sender recordingSender
+	// tokens of a user and of an admin, by role.
+	tokens map[string]string
+}
+
+func newOpenAPITestServer(t *testing.T) *openAPITestServer {
+	ctx := context.Background()
+	db, err := database.ConnectDB(ctx, filepath.Join(t.TempDir(), "covid.db"), database.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	}))
+	t.Cleanup(upstream.Close)
+	checker := quality.NewChecker(false)
+	f := fetcher.New(db, checker, upstream.URL)
+	t.Cleanup(func() { f.Stop(ctx) })
+
+	rt, err := analytics.NewRtEstimator(analytics.SerialInterval{Mean: 4.7, SD: 2.9}, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := graph.NewAuth("secret", time.Hour, graph.PasswordPolicy{}, false)
+	sender := recordingSender{messages: make(chan mail.Message, 10)}
+	accounts := graph.NewAccounts(db, auth, sender, graph.AccountOptions{ResetTokenTTL: time.Hour, VerificationTokenTTL: time.Hour})
+
+	// the limits are high enough for no request of the test to be rejected:
+	policies := map[string]ratelimit.Policy{}
+	for _, group := range ratelimit.Groups {
+		policies[group] = ratelimit.Policy{Default: ratelimit.Limit{Requests: 1000, Window: time.Minute}}
+	}
+	authenticate := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, err := auth.ParseToken(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+			if err != nil {
+				WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "Invalid token")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(graph.WithClaims(r.Context(), claims)))
+		})
+	}
+
+	router := chi.NewRouter()
+	deps := Dependencies{Store: db, Auth: auth, Fetcher: f, Status: status.NewReporter(db, f), Accounts: accounts, Quality: checker, Rt: rt}
+	RegisterRoutes(router, deps, ratelimit.New(policies), authenticate)
+
+	tokens := map[string]string{}
+	for _, role := range []string{database.RoleUser, database.RoleAdmin} {
+		token, err := auth.GenerateToken(database.User{Username: role, Role: role, EmailVerified: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens[role] = token
+	}
+	return &openAPITestServer{t: t, doc: BuildOpenAPIDocument(Operations), router: router, sender: sender, tokens: tokens}
+}
+
+// sample is a request to an operation, op being its method and path pattern.
+type sample struct {
+	op   string
+	path string
+	body any
+	// role is the role of the token sent, none for anonymous requests.
+	role string
+}
+
+// do sends a sample, checks that it and its response match the document and returns the decoded response.
+func (s *openAPITestServer) do(sample sample) any {
+	t := s.t
+	t.Helper()
+	method, pattern, _ := strings.Cut(sample.op, " ")
+	operation := s.doc.Paths[pattern][strings.ToLower(method)]
+	if operation == nil {
+		t.Fatalf("%s: not in the OpenAPI document", sample.op)
+	}
+
+	var body io.Reader
+	if sample.body != nil {
+		encoded, err := json.Marshal(sample.body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := validateJSON(operation.RequestBody.Content["application/json"].Schema, encoded, s.doc); err != nil {
+			t.Fatalf("%s: the sample request does not match the document: %v", sample.op, err)
+		}
+		body = bytes.NewReader(encoded)
+	} else if operation.RequestBody != nil {
+		t.Fatalf("%s: the document requires a body", sample.op)
+	}
+
+	r := httptest.NewRequest(method, apiBasePath+sample.path, body)
+	r.Header.Set("Content-Type", "application/json")
+	if sample.role != "" {
+		r.Header.Set("Authorization", "Bearer "+s.tokens[sample.role])
+	}
+	// the router is mounted on /api/v1 in the server:
+	r.URL.Path = strings.TrimPrefix(r.URL.Path, apiBasePath)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+
+	response, ok := operation.Responses[strconv.Itoa(w.Code)]
+	if !ok {
+		t.Fatalf("%s %s: status %d is not documented, body %s", method, sample.path, w.Code, w.Body)
+	}
+	if response.Content == nil {
+		if w.Body.Len() > 0 {
+			t.Fatalf("%s %s: the document has no response body, got %s", method, sample.path, w.Body)
+		}
+		return nil
+	}
+
+	contentType, _, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("%s %s: invalid Content-Type: %v", method, sample.path, err)
+	}
+	mediaType, ok := response.Content[contentType]
+	if !ok {
+		t.Fatalf("%s %s: Content-Type %s is not documented", method, sample.path, contentType)
+	}
+	if contentType != "application/json" {
+		return nil
+	}
+	if err := validateJSON(mediaType.Schema, w.Body.Bytes(), s.doc); err != nil {
+		t.Fatalf("%s %s: the response does not match the document: %v\n%s", method, sample.path, err, w.Body)
+	}
+	var decoded any
+	json.Unmarshal(w.Body.Bytes(), &decoded)
+	return decoded
+}
+
+func validateJSON(schema *Schema, data []byte, doc *Document) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return err
+	}
+	return validateValue(schema, value, "body", doc.Components.Schemas)
+}
+
+// field reads a field of a decoded response, such as "user.id".
+func field(t *testing.T, value any, path string) string {
+	t.Helper()
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			t.Fatalf("no field %s in %v", path, value)
+		}
+		value = object[name]
+	}
+	return fmt.Sprint(value)
+}
+
+// TestOperationsMatchOpenAPIDocument sends sample requests to every route and checks them and their responses
+// against the OpenAPI document built from Operations.
+func TestOperationsMatchOpenAPIDocument(t *testing.T) {
+	s := newOpenAPITestServer(t)
+	covered := map[string]bool{}
+	do := func(sample sample) any {
+		t.Helper()
+		covered[sample.op] = true
+		return s.do(sample)
+	}
+
+	registered := do(sample{op: "POST /register", path: "/register", body: UserInput{Username: "alice", Email: "alice@example.com", Password: "Passw0rd!"}})
+	userID := field(t, registered, "user.id")
+	s.sender.token(t)
+	do(sample{op: "POST /email-verification/resend", path: "/email-verification/resend", body: EmailInput{Email: "alice@example.com"}})
+	do(sample{op: "POST /email-verification", path: "/email-verification", body: TokenInput{Token: s.sender.token(t)}})
+	do(sample{op: "POST /password-reset/request", path: "/password-reset/request", body: EmailInput{Email: "alice@example.com"}})
+	do(sample{op: "POST /password-reset", path: "/password-reset", body: ResetPasswordInput{Token: s.sender.token(t), Password: "N3wPassw0rd!"}})
+	do(sample{op: "POST /login", path: "/login", body: LoginInput{Username: "alice", Password: "N3wPassw0rd!"}})
+	do(sample{op: "GET /user", path: "/user?username=alice", role: database.RoleUser})
+
+	country := do(sample{op: "POST /countries", path: "/countries", body: CountryInput{Name: "Belgium", Code: "BE"}, role: database.RoleUser})
+	countryID := field(t, country, "id")
+	other := do(sample{op: "POST /countries", path: "/countries", body: CountryInput{Name: "France", Code: "FR"}, role: database.RoleUser})
+	otherID := field(t, other, "id")
+	name := "Kingdom of Belgium"
+	do(sample{op: "GET /countries", path: "/countries?limit=1&sort=name&order=desc", role: database.RoleUser})
+	do(sample{op: "PUT /countries/{id}", path: "/countries/" + countryID, body: CountryInput{Name: "Belgium", Code: "BE"}, role: database.RoleUser})
+	do(sample{op: "PATCH /countries/{id}", path: "/countries/" + countryID, body: CountryPatchInput{Name: &name}, role: database.RoleUser})
+
+	var statisticID string
+	for day := 1; day <= 20; day++ {
+		statistic := do(sample{op: "POST /covid-stats", path: "/covid-stats", role: database.RoleUser, body: CovidStatisticInput{
+			CountryID: countryID, Date: fmt.Sprintf("2021-01-%02d", day), Confirmed: 100 * day * day, Recovered: 10 * day, Deaths: day,
+		}})
+		statisticID = field(t, statistic, "id")
+		do(sample{op: "POST /covid-stats", path: "/covid-stats", role: database.RoleUser, body: CovidStatisticInput{
+			CountryID: otherID, Date: fmt.Sprintf("2021-01-%02d", day), Confirmed: 50 * day, Recovered: day, Deaths: day / 2,
+		}})
+	}
+	deaths := 25
+	do(sample{op: "GET /covid-stats", path: "/covid-stats?country_id=" + countryID + "&date_from=2021-01-05&limit=5", role: database.RoleUser})
+	do(sample{op: "GET /covid-stats/{id}", path: "/covid-stats/" + statisticID, role: database.RoleUser})
+	do(sample{op: "PUT /covid-stats/{id}", path: "/covid-stats/" + statisticID, role: database.RoleUser, body: CovidStatisticInput{
+		CountryID: countryID, Date: "2021-01-20", Confirmed: 40000, Recovered: 200, Deaths: 20,
+	}})
+	do(sample{op: "PATCH /covid-stats/{id}", path: "/covid-stats/" + statisticID, body: CovidStatisticPatchInput{Deaths: &deaths}, role: database.RoleUser})
+	do(sample{op: "GET /countries/{id}", path: "/countries/" + countryID, role: database.RoleUser})
+	do(sample{op: "GET /countries/{id}/chart.svg", path: "/countries/" + countryID + "/chart.svg?metric=new_confirmed&compare=" + otherID, role: database.RoleUser})
+	do(sample{op: "GET /countries/{countryId}/death-percentage", path: "/countries/" + countryID + "/death-percentage", role: database.RoleUser})
+	do(sample{op: "GET /countries/{countryId}/data-quality", path: "/countries/" + countryID + "/data-quality", role: database.RoleUser})
+
+	monitored := "/users/" + userID + "/monitored-countries"
+	do(sample{op: "POST /users/{userid}/monitored-countries", path: monitored, body: MonitoredCountryInput{CountryID: mustAtoi(t, countryID)}, role: database.RoleUser})
+	do(sample{op: "POST /users/{userid}/monitored-countries", path: monitored, body: MonitoredCountryInput{CountryID: mustAtoi(t, otherID)}, role: database.RoleUser})
+	do(sample{op: "GET /users/{userid}/monitored-countries", path: monitored, role: database.RoleUser})
+	do(sample{op: "GET /users/{userid}/top-countries", path: "/users/" + userID + "/top-countries?case_type=confirmed&limit=1", role: database.RoleUser})
+	do(sample{op: "DELETE /users/{userid}/monitored-countries/{countryid}", path: monitored + "/" + otherID, role: database.RoleUser})
+
+	do(sample{op: "GET /groups", path: "/groups", role: database.RoleUser})
+	group := do(sample{op: "POST /groups", path: "/groups", body: CountryGroupInput{Name: "Neighbours", CountryIDs: []int{mustAtoi(t, countryID)}}, role: database.RoleAdmin})
+	groupPath := "/groups/" + field(t, group, "id")
+	do(sample{op: "POST /groups/{id}/members", path: groupPath + "/members", body: CountryGroupMemberInput{CountryID: mustAtoi(t, otherID)}, role: database.RoleAdmin})
+	do(sample{op: "GET /groups/{id}", path: groupPath, role: database.RoleUser})
+	do(sample{op: "GET /groups/{id}/statistics", path: groupPath + "/statistics?from=2021-01-10", role: database.RoleUser})
+	do(sample{op: "GET /groups/{id}/latest", path: groupPath + "/latest", role: database.RoleUser})
+	do(sample{op: "GET /groups/{id}/rankings", path: groupPath + "/rankings?metric=rt", role: database.RoleUser})
+	do(sample{op: "DELETE /groups/{id}/members/{countryid}", path: groupPath + "/members/" + otherID, role: database.RoleAdmin})
+	do(sample{op: "GET /rankings", path: "/rankings?metric=new_confirmed&limit=5", role: database.RoleUser})
+	do(sample{op: "DELETE /groups/{id}", path: groupPath, role: database.RoleAdmin})
+
+	do(sample{op: "GET /export/covid-stats", path: "/export/covid-stats?format=ndjson&country_ids=" + countryID, role: database.RoleUser})
+	do(sample{op: "GET /status", path: "/status", role: database.RoleAdmin})
+	do(sample{op: "POST /refresh-covid-data", path: "/refresh-covid-data", role: database.RoleAdmin})
+
+	do(sample{op: "DELETE /covid-stats/{id}", path: "/covid-stats/" + statisticID, role: database.RoleUser})
+	do(sample{op: "DELETE /countries/{id}", path: "/countries/" + otherID, role: database.RoleUser})
+	do(sample{op: "DELETE /users/{userid}", path: "/users/" + userID, role: database.RoleUser})
+
+	for _, op := range Operations {
+		if key := op.Method + " " + op.Path; !covered[key] {
+			t.Errorf("%s: no sample request, add one", key)
+		}
+	}
+}
+
+// TestInvalidBodiesMatchOpenAPIDocument sends a body with an unknown field to every operation taking one, the
+// error must be a validation error as documented.
+func TestInvalidBodiesMatchOpenAPIDocument(t *testing.T) {
+	s := newOpenAPITestServer(t)
+	for _, op := range Operations {
+		if op.Body == nil {
+			continue
+		}
+		path := pathParamPattern.ReplaceAllString(op.Path, "1")
+		r := httptest.NewRequest(op.Method, path, strings.NewReader(`{"unknown": 1}`))
+		r.Header.Set("Authorization", "Bearer "+s.tokens[database.RoleAdmin])
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, r)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s %s: got status %d, want %d", op.Method, op.Path, w.Code, http.StatusBadRequest)
+			continue
+		}
+		schema := s.doc.Paths[op.Path][strings.ToLower(op.Method)].Responses["default"].Content["application/json"].Schema
+		if err := validateJSON(schema, w.Body.Bytes(), s.doc); err != nil {
+			t.Errorf("%s %s: the error does not match the document: %v", op.Method, op.Path, err)
+		}
+	}
+}
+
+// TestOversizedBodiesRejected sends a body over maxRequestBodyBytes to every operation taking one, it must be
+// rejected before it is read whole.
+func TestOversizedBodiesRejected(t *testing.T) {
+	s := newOpenAPITestServer(t)
+	body := `{"name": "` + strings.Repeat("a", maxRequestBodyBytes) + `"}`
+	for _, op := range Operations {
+		if op.Body == nil {
+			continue
+		}
+		path := pathParamPattern.ReplaceAllString(op.Path, "1")
+		r := httptest.NewRequest(op.Method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+s.tokens[database.RoleAdmin])
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, r)
+
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s %s: got status %d, want %d", op.Method, op.Path, w.Code, http.StatusRequestEntityTooLarge)
+			continue
+		}
+		var response ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.Error.Code != ErrCodePayloadTooLarge {
+			t.Errorf("%s %s: got %s, want a %s error", op.Method, op.Path, w.Body, ErrCodePayloadTooLarge)
+		}
+	}
+}
+
+func mustAtoi(t *testing.T, s string) int {
+	t.Helper()
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
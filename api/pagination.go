@@ -0,0 +1,45 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+var (
+	// number of items of a list page when the limit parameter is not given.
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// pageLimit reads the limit parameter of a list.
+func pageLimit(query url.Values) (int, error) {
+	if !query.Has("limit") {
+		return defaultPageSize, nil
+	}
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit < 1 || limit > maxPageSize {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+	}
+	return limit, nil
+}
+
+func optionalParam(query url.Values, name string) *string {
+	if !query.Has(name) {
+		return nil
+	}
+	value := query.Get(name)
+	return &value
+}
+
+// setNextLink points the Link header at the next page, with the same filters as the current one.
+func setNextLink(w http.ResponseWriter, r *http.Request, nextCursor *string) {
+	if nextCursor == nil {
+		return
+	}
+	query := r.URL.Query()
+	query.Set("cursor", *nextCursor)
+	next := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+}
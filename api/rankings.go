@@ -0,0 +1,60 @@
+package api
+
+import (
+	"covid/analytics"
+	"covid/database"
+	"covid/rankings"
+	"covid/series"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+func RankingsHandler(store database.Store, rt *analytics.RtEstimator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		// the parameters were checked against the route's parameters, only their ranges are left:
+		opts := rankings.Options{
+			Metric:     series.MetricConfirmed,
+			Date:       optionalParam(query, "date"),
+			Limit:      rankings.DefaultLimit,
+			ChangeDays: rankings.DefaultChangeDays,
+		}
+		if query.Has("metric") {
+			opts.Metric = series.Metric(query.Get("metric"))
+		}
+		if query.Has("limit") {
+			opts.Limit, _ = strconv.Atoi(query.Get("limit"))
+			if opts.Limit < 1 {
+				WriteError(w, http.StatusBadRequest, ErrCodeValidation, fmt.Sprintf("limit must be between 1 and %d", rankings.MaxLimit))
+				return
+			}
+		}
+		opts.Offset, _ = strconv.Atoi(query.Get("offset"))
+		if query.Has("change_days") {
+			opts.ChangeDays, _ = strconv.Atoi(query.Get("change_days"))
+		}
+		if query.Has("group_id") {
+			groupID, _ := strconv.Atoi(query.Get("group_id"))
+			opts.GroupID = &groupID
+		}
+
+		ranking, err := rankings.Rank(r.Context(), store, rt, opts)
+		if err != nil {
+			writeRankingError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, MapRankingToAPIModel(&ranking))
+	}
+}
+
+// writeRankingError answers with a 400 for options out of range, and as writeDatabaseError otherwise.
+func writeRankingError(w http.ResponseWriter, err error) {
+	if errors.Is(err, rankings.ErrInvalidOptions) {
+		WriteError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+		return
+	}
+	writeDatabaseError(w, err, "Failed to rank countries")
+}
@@ -0,0 +1,389 @@
+package api
+
+import (
+	"covid/analytics"
+	"covid/chart"
+	"covid/database"
+	"covid/export"
+	"covid/fetcher"
+	"covid/graph"
+	"covid/quality"
+	"covid/ratelimit"
+	"covid/series"
+	"covid/status"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Operation is one route of the REST API. The routes and the OpenAPI document are both built from
+// Operations, so that the document cannot drift from what is served.
+type Operation struct {
+	Method  string
+	Path    string
+	Summary string
+	Tag     string
+	// Public operations can be called without a token.
+	Public bool
+	// Admin operations can only be called by admins.
+	Admin bool
+	// RateLimitGroup is the rate limit applied to the operation, the REST read and write limits when empty.
+	RateLimitGroup string
+	QueryParams    []Parameter
+	// Body and Response are zero values of the models sent and returned, nil when there is none.
+	Body     any
+	Status   int
+	Response any
+	// ContentTypes are the media types of a response that is not JSON, such as a file download.
+	ContentTypes []string
+	// Streaming operations write their response while they read it, the request timeout is not applied to them
+	// as it would cut the response off after its status was sent.
+	Streaming bool
+	Handler   func(deps Dependencies) http.HandlerFunc
+}
+
+// Dependencies are what the handlers of the operations are built with.
+type Dependencies struct {
+	Store   database.Store
+	Auth    *graph.Auth
+	Fetcher *fetcher.Fetcher
+	Status  *status.Reporter
+	// Accounts runs the password resets and the email verifications.
+	Accounts *graph.Accounts
+	// Quality checks the statistics written, Rt estimates the reproduction numbers countries are ranked by.
+	Quality *quality.Checker
+	Rt      *analytics.RtEstimator
+	// CachePolicy sets the Cache-Control header of the reads.
+	CachePolicy CachePolicy
+}
+
+// withStore adapts the handlers that only need the store.
+func withStore(handler func(store database.Store) http.HandlerFunc) func(deps Dependencies) http.HandlerFunc {
+	return func(deps Dependencies) http.HandlerFunc {
+		return handler(deps.Store)
+	}
+}
+
+// Parameter is a query parameter. Path parameters are read from the path, they are all integer IDs.
+type Parameter struct {
+	Name        string
+	Type        string
+	Format      string
+	Description string
+	Required    bool
+	Enum        []string
+}
+
+// pageParams are the parameters of every paginated list.
+func pageParams(sortFields []string) []Parameter {
+	return []Parameter{
+		{Name: "limit", Type: "integer", Description: "size of the page, 100 by default and at most 1000"},
+		{Name: "cursor", Type: "string", Description: "next_cursor of the previous page"},
+		{Name: "sort", Type: "string", Description: "field to sort by, id by default", Enum: sortFields},
+		{Name: "order", Type: "string", Description: "sort order, asc by default", Enum: []string{database.SortAsc, database.SortDesc}},
+	}
+}
+
+func seriesMetrics() []string {
+	metrics := make([]string, len(series.Metrics))
+	for i, metric := range series.Metrics {
+		metrics[i] = string(metric)
+	}
+	return metrics
+}
+
+// rankingMetrics are the metrics countries can be ranked by.
+func rankingMetrics() []string {
+	return append(seriesMetrics(), string(analytics.MetricRt))
+}
+
+// Operations are the routes served under /api/v1.
+var Operations = []Operation{
+	{
+		Method: http.MethodPost, Path: "/register", Summary: "Register a new user", Tag: "users",
+		Public: true, RateLimitGroup: ratelimit.GroupLogin,
+		Body: UserInput{}, Status: http.StatusCreated, Response: LoginResponse{},
+		Handler: func(deps Dependencies) http.HandlerFunc { return RegisterHandler(deps.Store, deps.Auth, deps.Accounts) },
+	},
+	{
+		Method: http.MethodPost, Path: "/login", Summary: "Log in and get a token", Tag: "users",
+		Public: true, RateLimitGroup: ratelimit.GroupLogin,
+		Body: LoginInput{}, Status: http.StatusOK, Response: LoginResponse{},
+		Handler: func(deps Dependencies) http.HandlerFunc { return LoginHandler(deps.Store, deps.Auth) },
+	},
+	{
+		Method: http.MethodPost, Path: "/password-reset/request", Summary: "Email a password reset token", Tag: "users",
+		Public: true, RateLimitGroup: ratelimit.GroupLogin,
+		Body: EmailInput{}, Status: http.StatusAccepted,
+		Handler: func(deps Dependencies) http.HandlerFunc { return RequestPasswordResetHandler(deps.Accounts) },
+	},
+	{
+		Method: http.MethodPost, Path: "/password-reset", Summary: "Set a new password with a reset token", Tag: "users",
+		Public: true, RateLimitGroup: ratelimit.GroupLogin,
+		Body: ResetPasswordInput{}, Status: http.StatusNoContent,
+		Handler: func(deps Dependencies) http.HandlerFunc { return ResetPasswordHandler(deps.Auth, deps.Accounts) },
+	},
+	{
+		Method: http.MethodPost, Path: "/email-verification", Summary: "Verify an email with a verification token", Tag: "users",
+		Public: true, RateLimitGroup: ratelimit.GroupLogin,
+		Body: TokenInput{}, Status: http.StatusNoContent,
+		Handler: func(deps Dependencies) http.HandlerFunc { return VerifyEmailHandler(deps.Accounts) },
+	},
+	{
+		Method: http.MethodPost, Path: "/email-verification/resend", Summary: "Email a new verification token", Tag: "users",
+		Public: true, RateLimitGroup: ratelimit.GroupLogin,
+		Body: EmailInput{}, Status: http.StatusAccepted,
+		Handler: func(deps Dependencies) http.HandlerFunc { return ResendVerificationHandler(deps.Accounts) },
+	},
+	{
+		Method: http.MethodPost, Path: "/refresh-covid-data", Summary: "Fetch the latest statistics of every country", Tag: "covid-stats",
+		RateLimitGroup: ratelimit.GroupRefresh, Status: http.StatusAccepted,
+		Handler: func(deps Dependencies) http.HandlerFunc { return RefreshCovidDataForAllCountriesHandler(deps.Fetcher) },
+	},
+	{
+		Method: http.MethodGet, Path: "/user", Summary: "Get a user by username", Tag: "users",
+		QueryParams: []Parameter{{Name: "username", Type: "string", Required: true}},
+		Status:      http.StatusOK, Response: User{}, Handler: withStore(UserHandler),
+	},
+	{
+		Method: http.MethodDelete, Path: "/users/{userid}", Summary: "Delete a user", Tag: "users",
+		Status: http.StatusNoContent, Handler: withStore(DeleteUserHandler),
+	},
+	{
+		Method: http.MethodGet, Path: "/users/{userid}/monitored-countries", Summary: "List the countries monitored by a user", Tag: "users",
+		Status: http.StatusOK, Response: []Country{}, Handler: withStore(GetMonitoredCountriesHandler),
+	},
+	{
+		Method: http.MethodPost, Path: "/users/{userid}/monitored-countries", Summary: "Monitor a country", Tag: "users",
+		Body: MonitoredCountryInput{}, Status: http.StatusCreated, Handler: withStore(AddUserMonitoredCountryHandler),
+	},
+	{
+		Method: http.MethodDelete, Path: "/users/{userid}/monitored-countries/{countryid}", Summary: "Stop monitoring a country", Tag: "users",
+		Status: http.StatusNoContent, Handler: withStore(DeleteUserMonitoredCountryHandler),
+	},
+	{
+		Method: http.MethodGet, Path: "/users/{userid}/top-countries", Summary: "List the monitored countries with the most cases", Tag: "users",
+		QueryParams: []Parameter{
+			{Name: "case_type", Type: "string", Required: true, Enum: []string{"confirmed", "deaths"}},
+			{Name: "limit", Type: "integer", Required: true},
+		},
+		Status: http.StatusOK, Response: []Country{}, Handler: withStore(GetTopCountriesByCaseTypeForUserHandler),
+	},
+	{
+		Method: http.MethodGet, Path: "/countries", Summary: "List countries", Tag: "countries",
+		QueryParams: append([]Parameter{
+			{Name: "filterNameContains", Type: "string", Description: "only countries whose name contains this text"},
+			{Name: "filterCodeEquals", Type: "string", Description: "only the country with this code"},
+		}, pageParams(database.CountrySortFields)...),
+		Status: http.StatusOK, Response: CountryList{}, Handler: withStore(CountriesHandler),
+	},
+	{
+		Method: http.MethodPost, Path: "/countries", Summary: "Create a country", Tag: "countries",
+		Body: CountryInput{}, Status: http.StatusCreated, Response: Country{}, Handler: withStore(AddCountryHandler),
+	},
+	{
+		Method: http.MethodGet, Path: "/countries/{id}", Summary: "Get a country", Tag: "countries",
+		Status: http.StatusOK, Response: Country{}, Handler: withStore(CountryByIDHandler),
+	},
+	{
+		Method: http.MethodPut, Path: "/countries/{id}", Summary: "Replace a country", Tag: "countries",
+		Body: CountryInput{}, Status: http.StatusOK, Response: Country{}, Handler: withStore(UpdateCountryHandler),
+	},
+	{
+		Method: http.MethodPatch, Path: "/countries/{id}", Summary: "Update some fields of a country", Tag: "countries",
+		Body: CountryPatchInput{}, Status: http.StatusOK, Response: Country{}, Handler: withStore(PatchCountryHandler),
+	},
+	{
+		Method: http.MethodDelete, Path: "/countries/{id}", Summary: "Delete a country", Tag: "countries",
+		Status: http.StatusNoContent, Handler: withStore(DeleteCountryHandler),
+	},
+	{
+		Method: http.MethodGet, Path: "/countries/{id}/chart.svg", Summary: "Draw a chart of the statistics of a country", Tag: "countries",
+		QueryParams: []Parameter{
+			{Name: "metric", Type: "string", Description: "series drawn, confirmed by default", Enum: seriesMetrics()},
+			{Name: "from", Type: "string", Format: "date", Description: "first day drawn"},
+			{Name: "to", Type: "string", Format: "date", Description: "last day drawn"},
+			{Name: "smoothing", Type: "integer", Description: "number of days of the trailing moving average, none by default"},
+			{Name: "compare", Type: "string", Description: "comma separated IDs of other countries drawn on the same chart"},
+			{Name: "type", Type: "string", Description: "line by default", Enum: []string{string(chart.KindLine), string(chart.KindBar)}},
+			{Name: "theme", Type: "string", Description: "light by default", Enum: []string{string(chart.ThemeLight), string(chart.ThemeDark)}},
+			{Name: "width", Type: "integer", Description: "width in pixels, 800 by default"},
+			{Name: "height", Type: "integer", Description: "height in pixels, 400 by default"},
+			{Name: "log", Type: "boolean", Description: "use a logarithmic scale"},
+		},
+		Status: http.StatusOK, ContentTypes: []string{"image/svg+xml"}, Handler: withStore(CountryChartHandler),
+	},
+	{
+		Method: http.MethodGet, Path: "/countries/{countryId}/death-percentage", Summary: "Get the share of confirmed cases that died", Tag: "countries",
+		Status: http.StatusOK, Response: DeathPercentage{}, Handler: withStore(GetDeathPercentageHandler),
+	},
+	{
+		Method: http.MethodGet, Path: "/countries/{countryId}/data-quality", Summary: "Get the data quality report of a country", Tag: "countries",
+		Status: http.StatusOK, Response: DataQualityReport{}, Handler: withStore(DataQualityReportHandler),
+	},
+	{
+		Method: http.MethodGet, Path: "/covid-stats", Summary: "List the statistics of a country", Tag: "covid-stats",
+		QueryParams: append([]Parameter{
+			{Name: "country_id", Type: "integer", Required: true},
+			{Name: "date_from", Type: "string", Format: "date", Description: "only statistics of this day or later"},
+			{Name: "date_to", Type: "string", Format: "date", Description: "only statistics of this day or earlier"},
+		}, pageParams(database.CovidStatisticSortFields)...),
+		Status: http.StatusOK, Response: CovidStatisticList{}, Handler: withStore(CovidStatisticsHandler),
+	},
+	{
+		Method: http.MethodPost, Path: "/covid-stats", Summary: "Add a statistic", Tag: "covid-stats",
+		Body: CovidStatisticInput{}, Status: http.StatusCreated, Response: CovidStatistic{}, Handler: func(deps Dependencies) http.HandlerFunc { return AddCovidStatisticHandler(deps.Store, deps.Quality) },
+	},
+	{
+		Method: http.MethodGet, Path: "/covid-stats/{id}", Summary: "Get a statistic", Tag: "covid-stats",
+		Status: http.StatusOK, Response: CovidStatistic{}, Handler: withStore(CovidStatisticByIDHandler),
+	},
+	{
+		Method: http.MethodPut, Path: "/covid-stats/{id}", Summary: "Replace a statistic", Tag: "covid-stats",
+		Body: CovidStatisticInput{}, Status: http.StatusOK, Response: CovidStatistic{}, Handler: func(deps Dependencies) http.HandlerFunc { return UpdateCovidStatisticHandler(deps.Store, deps.Quality) },
+	},
+	{
+		Method: http.MethodPatch, Path: "/covid-stats/{id}", Summary: "Update some fields of a statistic", Tag: "covid-stats",
+		Body: CovidStatisticPatchInput{}, Status: http.StatusOK, Response: CovidStatistic{}, Handler: func(deps Dependencies) http.HandlerFunc { return PatchCovidStatisticHandler(deps.Store, deps.Quality) },
+	},
+	{
+		Method: http.MethodDelete, Path: "/covid-stats/{id}", Summary: "Delete a statistic", Tag: "covid-stats",
+		Status: http.StatusNoContent, Handler: func(deps Dependencies) http.HandlerFunc { return DeleteCovidStatisticHandler(deps.Store, deps.Quality) },
+	},
+	{
+		Method: http.MethodGet, Path: "/groups", Summary: "List the continents and custom country groups", Tag: "groups",
+		Status: http.StatusOK, Response: []CountryGroup{}, Handler: withStore(CountryGroupsHandler),
+	},
+	{
+		Method: http.MethodPost, Path: "/groups", Summary: "Create a custom country group, admins only", Tag: "groups",
+		Admin: true,
+		Body:  CountryGroupInput{}, Status: http.StatusCreated, Response: CountryGroup{}, Handler: withStore(AddCountryGroupHandler),
+	},
+	{
+		Method: http.MethodGet, Path: "/groups/{id}", Summary: "Get a country group with its members", Tag: "groups",
+		Status: http.StatusOK, Response: CountryGroup{}, Handler: withStore(CountryGroupByIDHandler),
+	},
+	{
+		Method: http.MethodDelete, Path: "/groups/{id}", Summary: "Delete a custom country group, admins only", Tag: "groups",
+		Admin:  true,
+		Status: http.StatusNoContent, Handler: withStore(DeleteCountryGroupHandler),
+	},
+	{
+		Method: http.MethodPost, Path: "/groups/{id}/members", Summary: "Add a country to a custom group, admins only", Tag: "groups",
+		Admin: true,
+		Body:  CountryGroupMemberInput{}, Status: http.StatusCreated, Handler: withStore(AddCountryGroupMemberHandler),
+	},
+	{
+		Method: http.MethodDelete, Path: "/groups/{id}/members/{countryid}", Summary: "Remove a country from a custom group, admins only", Tag: "groups",
+		Admin:  true,
+		Status: http.StatusNoContent, Handler: withStore(DeleteCountryGroupMemberHandler),
+	},
+	{
+		Method: http.MethodGet, Path: "/groups/{id}/statistics", Summary: "Get the daily totals of the members of a group", Tag: "groups",
+		QueryParams: []Parameter{
+			{Name: "from", Type: "string", Format: "date", Description: "first day returned"},
+			{Name: "to", Type: "string", Format: "date", Description: "last day returned"},
+		},
+		Status: http.StatusOK, Response: []GroupStatistic{}, Handler: withStore(CountryGroupStatisticsHandler),
+	},
+	{
+		Method: http.MethodGet, Path: "/groups/{id}/latest", Summary: "Get the latest totals of the members of a group", Tag: "groups",
+		Status: http.StatusOK, Response: GroupStatistic{}, Handler: withStore(CountryGroupLatestHandler),
+	},
+	{
+		Method: http.MethodGet, Path: "/groups/{id}/rankings", Summary: "Rank the members of a group by their latest value of a metric", Tag: "groups",
+		QueryParams: []Parameter{
+			{Name: "metric", Type: "string", Description: "confirmed by default, rt is the effective reproduction number", Enum: rankingMetrics()},
+		},
+		Status: http.StatusOK, Response: []GroupMemberRanking{}, Handler: func(deps Dependencies) http.HandlerFunc { return CountryGroupRankingsHandler(deps.Store, deps.Rt) },
+	},
+	{
+		Method: http.MethodGet, Path: "/rankings", Summary: "Rank every country, or the members of a group, by a metric", Tag: "countries",
+		QueryParams: []Parameter{
+			{Name: "metric", Type: "string", Description: "confirmed by default, rt is the effective reproduction number", Enum: rankingMetrics()},
+			{Name: "date", Type: "string", Format: "date", Description: "day ranked, the latest values by default"},
+			{Name: "limit", Type: "integer", Description: "size of the page, 20 by default and at most 250"},
+			{Name: "offset", Type: "integer", Description: "number of ranked countries skipped"},
+			{Name: "group_id", Type: "integer", Description: "only rank the members of this group"},
+			{Name: "change_days", Type: "integer", Description: "compare the ranks to those of as many days earlier, 7 by default, 0 for none"},
+		},
+		Status: http.StatusOK, Response: Ranking{}, Handler: func(deps Dependencies) http.HandlerFunc { return RankingsHandler(deps.Store, deps.Rt) },
+	},
+	{
+		Method: http.MethodGet, Path: "/export/covid-stats", Summary: "Export statistics as CSV, NDJSON, XLSX or InfluxDB line protocol", Tag: "covid-stats",
+		QueryParams: []Parameter{
+			{Name: "format", Type: "string", Description: "format of the export, read from the Accept header when missing, csv by default", Enum: []string{string(export.FormatCSV), string(export.FormatNDJSON), string(export.FormatXLSX), string(export.FormatInflux)}},
+			{Name: "country_ids", Type: "string", Description: "comma separated IDs of the countries exported, every country by default"},
+			{Name: "date_from", Type: "string", Format: "date", Description: "only statistics of this day or later"},
+			{Name: "date_to", Type: "string", Format: "date", Description: "only statistics of this day or earlier"},
+			{Name: "metrics", Type: "string", Description: "comma separated metrics exported, confirmed,recovered,deaths by default; new_confirmed, new_recovered and new_deaths are daily deltas"},
+		},
+		Status:       http.StatusOK,
+		ContentTypes: []string{export.Formats[export.FormatCSV], export.Formats[export.FormatNDJSON], export.Formats[export.FormatXLSX], export.Formats[export.FormatInflux]},
+		Streaming:    true,
+		Handler:      withStore(ExportCovidStatisticsHandler),
+	},
+	{
+		Method: http.MethodGet, Path: "/status", Summary: "Get the version, uptime, database and fetcher state of the server, admins only", Tag: "status",
+		Admin:  true,
+		Status: http.StatusOK, Response: SystemStatus{},
+		Handler: func(deps Dependencies) http.HandlerFunc { return StatusHandler(deps.Status) },
+	},
+}
+
+// IsStreaming reports whether a request goes to a Streaming operation, the request timeout leaves them alone.
+func IsStreaming(r *http.Request) bool {
+	path, ok := strings.CutPrefix(r.URL.Path, apiBasePath)
+	if !ok {
+		return false
+	}
+	for _, op := range Operations {
+		if op.Streaming && op.Method == r.Method && matchPath(op.Path, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath reports whether path matches the path of an operation, whose {parameters} match any segment.
+func matchPath(pattern string, path string) bool {
+	patternSegments := strings.Split(pattern, "/")
+	pathSegments := strings.Split(path, "/")
+	if len(patternSegments) != len(pathSegments) {
+		return false
+	}
+	for i, segment := range patternSegments {
+		if !strings.HasPrefix(segment, "{") && segment != pathSegments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// RegisterRoutes registers the Operations on r, which is expected to be mounted on /api/v1. Every request is
+// validated against the OpenAPI document before reaching its handler.
+func RegisterRoutes(r chi.Router, deps Dependencies, limiter *ratelimit.Limiter, authenticate func(http.Handler) http.Handler) {
+	r.NotFound(NotFoundHandler)
+	r.MethodNotAllowed(MethodNotAllowedHandler)
+
+	for i := range Operations {
+		op := &Operations[i]
+
+		var middlewares []func(http.Handler) http.Handler
+		if !op.Public {
+			middlewares = append(middlewares, authenticate)
+		}
+		if op.Admin {
+			middlewares = append(middlewares, requireAdmin)
+		}
+		if op.RateLimitGroup != "" {
+			middlewares = append(middlewares, limiter.Middleware(op.RateLimitGroup))
+		} else {
+			middlewares = append(middlewares, limiter.RESTMiddleware())
+		}
+		middlewares = append(middlewares, deps.CachePolicy.Middleware)
+
+		r.With(middlewares...).Method(op.Method, op.Path, validateRequest(op, op.Handler(deps)))
+	}
+}
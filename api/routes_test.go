@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsStreaming(t *testing.T) {
+	tests := []struct {
+		method string
+		target string
+		want   bool
+	}{
+		{"GET", "/api/v1/export/covid-stats", true},
+		{"GET", "/api/v1/export/covid-stats?format=xlsx", true},
+		{"POST", "/api/v1/export/covid-stats", false},
+		{"GET", "/api/v1/covid-stats", false},
+		{"GET", "/api/v1/countries/1", false},
+		{"GET", "/export/covid-stats", false},
+	}
+	for _, test := range tests {
+		t.Run(test.method+" "+test.target, func(t *testing.T) {
+			if got := IsStreaming(httptest.NewRequest(test.method, test.target, nil)); got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/countries/{id}", "/countries/1", true},
+		{"/countries/{id}", "/countries", false},
+		{"/countries/{id}", "/countries/1/statistics", false},
+		{"/groups/{id}/members/{countryId}", "/groups/2/members/3", true},
+		{"/groups/{id}/members/{countryId}", "/groups/2/statistics/3", false},
+	}
+	for _, test := range tests {
+		if got := matchPath(test.pattern, test.path); got != test.want {
+			t.Errorf("matchPath(%q, %q) = %t, want %t", test.pattern, test.path, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"covid/status"
+	"log/slog"
+	"net/http"
+)
+
+// Probe is the answer to the liveness and readiness probes, Checks maps every readiness check to ok or to
+// the reason it failed.
+type Probe struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// HealthzHandler answers the liveness probe: the server runs and serves requests, whatever its dependencies.
+func HealthzHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, Probe{Status: "ok"})
+	}
+}
+
+// ReadyzHandler answers the readiness probe with a 200 when the server can serve requests, and a 503 while
+// the database is unreachable, its schema is not up to date or the server shuts down.
+func ReadyzHandler(reporter *status.Reporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		checks := reporter.Checks(r.Context())
+		probe := Probe{Status: "ok", Checks: map[string]string{}}
+		code := http.StatusOK
+		for _, check := range checks {
+			probe.Checks[check.Name] = "ok"
+			if check.Err != nil {
+				probe.Checks[check.Name] = check.Err.Error()
+			}
+		}
+		if !status.Ready(checks) {
+			probe.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, probe)
+	}
+}
+
+// StatusHandler reports the state of the server to the admins.
+func StatusHandler(reporter *status.Reporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		systemStatus, err := reporter.Status(r.Context())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "could not get the status of the server", "error", err)
+			writeDatabaseError(w, err, "could not get the status of the server")
+			return
+		}
+		writeJSON(w, http.StatusOK, MapStatusToAPIModel(&systemStatus))
+	}
+}
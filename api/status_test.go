@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+	"covid/database"
+	"covid/status"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadyzHandler(t *testing.T) {
+	db, err := database.ConnectDB(context.Background(), filepath.Join(t.TempDir(), "covid.db"), database.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	reporter := status.NewReporter(db, nil)
+
+	probe := func() (int, Probe) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		ReadyzHandler(reporter)(w, httptest.NewRequest("GET", "/readyz", nil))
+		var probe Probe
+		if err := json.Unmarshal(w.Body.Bytes(), &probe); err != nil {
+			t.Fatalf("decoding %q: %v", w.Body.String(), err)
+		}
+		return w.Code, probe
+	}
+
+	code, ready := probe()
+	if code != http.StatusOK || ready.Status != "ok" || ready.Checks["shutdown"] != "ok" {
+		t.Errorf("before draining: %d %+v", code, ready)
+	}
+
+	reporter.Drain()
+	code, draining := probe()
+	if code != http.StatusServiceUnavailable || draining.Status != "unavailable" {
+		t.Errorf("draining: %d %+v, want 503 unavailable", code, draining)
+	}
+	if draining.Checks["shutdown"] == "ok" || draining.Checks["database"] != "ok" || draining.Checks["migrations"] != "ok" {
+		t.Errorf("draining checks: %v, want only shutdown failing", draining.Checks)
+	}
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxRequestBodyBytes bounds the bodies read for validation, larger ones are answered with a 413.
+const maxRequestBodyBytes = 1 << 20
+
+// validateRequest rejects requests that do not match the OpenAPI document of op before they reach next:
+// path and query parameters must have the right type, and the body must match the schema of its model,
+// without unknown fields.
+func validateRequest(op *Operation, next http.HandlerFunc) http.HandlerFunc {
+	operation := openAPIDocument.Paths[op.Path][strings.ToLower(op.Method)]
+	schemas := openAPIDocument.Components.Schemas
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, param := range operation.Parameters {
+			var value string
+			var present bool
+			switch param.In {
+			case "path":
+				value = chi.URLParam(r, param.Name)
+				present = value != ""
+			case "query":
+				present = r.URL.Query().Has(param.Name)
+				value = r.URL.Query().Get(param.Name)
+			}
+
+			if !present {
+				if param.Required {
+					WriteError(w, http.StatusBadRequest, ErrCodeValidation, fmt.Sprintf("%s parameter %s is required", param.In, param.Name))
+					return
+				}
+				continue
+			}
+			if err := validateParameter(param.Schema, value); err != nil {
+				WriteError(w, http.StatusBadRequest, ErrCodeValidation, fmt.Sprintf("%s parameter %s %v", param.In, param.Name, err))
+				return
+			}
+		}
+
+		if operation.RequestBody == nil {
+			next(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			WriteError(w, http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge, fmt.Sprintf("request body must not exceed %d bytes", tooLarge.Limit))
+			return
+		}
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "could not read request body")
+			return
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		var value any
+		if err := decoder.Decode(&value); err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, fmt.Sprintf("request body is not valid JSON: %v", err))
+			return
+		}
+
+		schema := operation.RequestBody.Content["application/json"].Schema
+		if err := validateValue(schema, value, "body", schemas); err != nil {
+			WriteError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next(w, r)
+	}
+}
+
+func validateParameter(schema *Schema, value string) error {
+	switch schema.Type {
+	case "integer":
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+	case "number":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("must be a number")
+		}
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("must be true or false")
+		}
+	}
+	if err := validateFormat(schema.Format, value); err != nil {
+		return err
+	}
+	if len(schema.Enum) > 0 && !contains(schema.Enum, value) {
+		return fmt.Errorf("must be one of %s", strings.Join(schema.Enum, ", "))
+	}
+	return nil
+}
+
+// validateValue checks a decoded JSON value against schema, path is used to point at the invalid field.
+func validateValue(schema *Schema, value any, path string, schemas map[string]*Schema) error {
+	if schema.Ref != "" {
+		return validateValue(schemas[strings.TrimPrefix(schema.Ref, schemaRefPath)], value, path, schemas)
+	}
+
+	if value == nil {
+		if schema.Nullable {
+			return nil
+		}
+		return fmt.Errorf("%s must not be null", path)
+	}
+
+	switch schema.Type {
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s must be a string", path)
+		}
+		if err := validateFormat(schema.Format, s); err != nil {
+			return fmt.Errorf("%s %v", path, err)
+		}
+		if len(schema.Enum) > 0 && !contains(schema.Enum, s) {
+			return fmt.Errorf("%s must be one of %s", path, strings.Join(schema.Enum, ", "))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s must be a boolean", path)
+		}
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s must be an integer", path)
+		}
+		f, err := n.Float64()
+		if err != nil || f != math.Trunc(f) {
+			return fmt.Errorf("%s must be an integer", path)
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			return fmt.Errorf("%s must be a number", path)
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s must be an array", path)
+		}
+		for i, item := range items {
+			if err := validateValue(schema.Items, item, fmt.Sprintf("%s[%d]", path, i), schemas); err != nil {
+				return err
+			}
+		}
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s must be an object", path)
+		}
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s.%s is required", path, name)
+			}
+		}
+
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := schema.Properties[name]
+			if !ok {
+				additional, isSchema := schema.AdditionalProperties.(*Schema)
+				if !isSchema {
+					return fmt.Errorf("%s.%s is not a known field", path, name)
+				}
+				property = additional
+			}
+			if err := validateValue(property, object[name], path+"."+name, schemas); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateFormat(format string, value string) error {
+	switch format {
+	case "date":
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			return fmt.Errorf("must be a date formatted as YYYY-MM-DD")
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			return fmt.Errorf("must be an RFC 3339 date-time")
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
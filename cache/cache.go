@@ -0,0 +1,202 @@
+// Package cache keeps the results of expensive reads until the statistics they were computed from change. The
+// results are kept in memory, the least recently used dropped first, and optionally in a SQLite file so that
+// they survive restarts.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Hook is called on every lookup with the query looked up and whether a result was found.
+type Hook func(query string, hit bool)
+
+type Options struct {
+	// Size is the number of results kept in memory.
+	Size int
+	// TTL drops the results older, 0 keeps them until they are invalidated.
+	TTL time.Duration
+	// Path is the SQLite file the results are written to as well, none when empty.
+	Path string
+}
+
+// Cache holds encoded results by key, with the countries they depend on so that the writes to the statistics
+// of a country invalidate them. It satisfies database.Cache.
+type Cache struct {
+	size int
+	ttl  time.Duration
+	disk *diskStore
+	hook Hook
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// recent orders the entries from the most recently used.
+	recent *list.List
+	// invalidations tells the results read from the file while they were invalidated, they are not kept in memory.
+	invalidations uint64
+}
+
+type entry struct {
+	key string
+	// countryIDs are the countries the result depends on, nil when it depends on every country.
+	countryIDs []int
+	value      []byte
+	// expiresAt is zero for the results kept until they are invalidated.
+	expiresAt time.Time
+}
+
+// New opens the cache, and the file of its results when there is one.
+func New(ctx context.Context, opts Options) (*Cache, error) {
+	if opts.Size <= 0 {
+		return nil, errors.New("the cache must hold at least one result")
+	}
+	c := &Cache{size: opts.Size, ttl: opts.TTL, now: time.Now, entries: map[string]*list.Element{}, recent: list.New()}
+	if opts.Path != "" {
+		disk, err := openDiskStore(ctx, opts.Path)
+		if err != nil {
+			return nil, err
+		}
+		c.disk = disk
+	}
+	return c, nil
+}
+
+// SetHook sets the function called on every lookup, to monitor the cache.
+func (c *Cache) SetHook(hook Hook) {
+	c.hook = hook
+}
+
+// Get returns the result cached for key, query names the read it comes from.
+func (c *Cache) Get(ctx context.Context, query string, key string) ([]byte, bool) {
+	value, ok := c.get(ctx, key)
+	if c.hook != nil {
+		c.hook(query, ok)
+	}
+	return value, ok
+}
+
+func (c *Cache) get(ctx context.Context, key string) ([]byte, bool) {
+	now := c.now()
+	c.mu.Lock()
+	if element, ok := c.entries[key]; ok {
+		e := element.Value.(*entry)
+		if e.expiresAt.IsZero() || now.Before(e.expiresAt) {
+			c.recent.MoveToFront(element)
+			c.mu.Unlock()
+			return e.value, true
+		}
+		c.remove(element)
+	}
+	invalidations := c.invalidations
+	c.mu.Unlock()
+
+	if c.disk == nil {
+		return nil, false
+	}
+	e, ok, err := c.disk.get(ctx, key, now)
+	if err != nil {
+		slog.WarnContext(ctx, "could not read the cache file", "error", err)
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+	c.mu.Lock()
+	if c.invalidations == invalidations {
+		c.add(e)
+	}
+	c.mu.Unlock()
+	return e.value, true
+}
+
+// Set caches the result of key, countryIDs are the countries it depends on, nil when it depends on every country.
+func (c *Cache) Set(ctx context.Context, key string, countryIDs []int, value []byte) {
+	e := &entry{key: key, countryIDs: countryIDs, value: value}
+	if c.ttl > 0 {
+		e.expiresAt = c.now().Add(c.ttl)
+	}
+	c.mu.Lock()
+	c.add(e)
+	c.mu.Unlock()
+
+	if c.disk != nil {
+		if err := c.disk.set(ctx, e); err != nil {
+			slog.WarnContext(ctx, "could not write the cache file", "error", err)
+		}
+	}
+}
+
+// Invalidate drops the results depending on any of the countries, and those depending on every country.
+// Every result is dropped when countryIDs is empty.
+func (c *Cache) Invalidate(ctx context.Context, countryIDs []int) {
+	// the file goes first, for the results read from it meanwhile to be dropped from memory as well:
+	if c.disk != nil {
+		// the statistics are written by then, a cancelled request must not leave stale results behind:
+		if err := c.disk.invalidate(context.WithoutCancel(ctx), countryIDs); err != nil {
+			slog.ErrorContext(ctx, "could not invalidate the cache file", "error", err)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidations++
+	for element := c.recent.Front(); element != nil; {
+		next := element.Next()
+		if len(countryIDs) == 0 || dependsOn(element.Value.(*entry), countryIDs) {
+			c.remove(element)
+		}
+		element = next
+	}
+}
+
+// Len returns the number of results held in memory.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.recent.Len()
+}
+
+// Close closes the file of the results.
+func (c *Cache) Close() error {
+	if c.disk == nil {
+		return nil
+	}
+	return c.disk.close()
+}
+
+// add caches an entry in memory, in place of the one with the same key, and evicts the least recently used.
+func (c *Cache) add(e *entry) {
+	if element, ok := c.entries[e.key]; ok {
+		element.Value = e
+		c.recent.MoveToFront(element)
+		return
+	}
+	c.entries[e.key] = c.recent.PushFront(e)
+	for c.recent.Len() > c.size {
+		c.remove(c.recent.Back())
+	}
+}
+
+func (c *Cache) remove(element *list.Element) {
+	c.recent.Remove(element)
+	delete(c.entries, element.Value.(*entry).key)
+}
+
+func dependsOn(e *entry, countryIDs []int) bool {
+	if e.countryIDs == nil {
+		return true
+	}
+	for _, id := range e.countryIDs {
+		for _, countryID := range countryIDs {
+			if id == countryID {
+				return true
+			}
+		}
+	}
+	return false
+}
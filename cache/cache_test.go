@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newCache returns a cache whose clock only moves with the returned function.
+func newCache(t *testing.T, opts Options) (*Cache, func(time.Duration)) {
+	t.Helper()
+	c, err := New(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	return c, func(d time.Duration) { now = now.Add(d) }
+}
+
+// cached returns the keys among keys that c holds a result for.
+func cached(c *Cache, keys ...string) []string {
+	found := []string{}
+	for _, key := range keys {
+		if _, ok := c.Get(context.Background(), "test", key); ok {
+			found = append(found, key)
+		}
+	}
+	return found
+}
+
+func TestLeastRecentlyUsedEvicted(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newCache(t, Options{Size: 2})
+	c.Set(ctx, "a", []int{1}, []byte("a"))
+	c.Set(ctx, "b", []int{1}, []byte("b"))
+	// a is used after b, b goes first:
+	if _, ok := c.Get(ctx, "test", "a"); !ok {
+		t.Fatal("a was not cached")
+	}
+	c.Set(ctx, "c", []int{1}, []byte("c"))
+
+	if got, want := cached(c, "a", "b", "c"), []string{"a", "c"}; !slices.Equal(got, want) {
+		t.Errorf("cached %v, want %v", got, want)
+	}
+	if c.Len() != 2 {
+		t.Errorf("%d results held, want 2", c.Len())
+	}
+
+	// setting a key again replaces its result without evicting another:
+	c.Set(ctx, "c", []int{1}, []byte("c2"))
+	if value, _ := c.Get(ctx, "test", "c"); string(value) != "c2" {
+		t.Errorf("c is %q, want c2", value)
+	}
+	if got, want := cached(c, "a", "c"), []string{"a", "c"}; !slices.Equal(got, want) {
+		t.Errorf("cached %v, want %v", got, want)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	ctx := context.Background()
+	c, advance := newCache(t, Options{Size: 10, TTL: time.Minute})
+	c.Set(ctx, "a", nil, []byte("a"))
+	advance(59 * time.Second)
+	if got := cached(c, "a"); !slices.Equal(got, []string{"a"}) {
+		t.Errorf("before the TTL: cached %v, want a", got)
+	}
+	advance(time.Second)
+	if got := cached(c, "a"); !slices.Equal(got, []string{}) {
+		t.Errorf("after the TTL: cached %v, want none", got)
+	}
+	if c.Len() != 0 {
+		t.Errorf("%d results held after they expired, want 0", c.Len())
+	}
+
+	// without a TTL the results are kept until they are invalidated:
+	c, advance = newCache(t, Options{Size: 10})
+	c.Set(ctx, "a", nil, []byte("a"))
+	advance(365 * 24 * time.Hour)
+	if got := cached(c, "a"); !slices.Equal(got, []string{"a"}) {
+		t.Errorf("without a TTL: cached %v, want a", got)
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		countryIDs []int
+		want       []string
+	}{
+		{"one country", []int{1}, []string{"two", "three"}},
+		{"shared country", []int{2}, []string{"one"}},
+		{"several countries", []int{1, 3}, []string{"two"}},
+		// the results depending on every country depend on it too:
+		{"unknown country", []int{4}, []string{"one", "two", "three"}},
+		{"every country", nil, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			path := filepath.Join(t.TempDir(), "cache.db")
+			c, _ := newCache(t, Options{Size: 10, Path: path})
+			c.Set(ctx, "one", []int{1}, []byte("one"))
+			c.Set(ctx, "two", []int{2}, []byte("two"))
+			c.Set(ctx, "three", []int{2, 3}, []byte("three"))
+			c.Set(ctx, "all", nil, []byte("all"))
+
+			c.Invalidate(ctx, test.countryIDs)
+			if got := cached(c, "one", "two", "three", "all"); !slices.Equal(got, test.want) {
+				t.Errorf("cached %v, want %v", got, test.want)
+			}
+			// the file is invalidated as well:
+			reopened, _ := newCache(t, Options{Size: 10, Path: path})
+			if got := cached(reopened, "one", "two", "three", "all"); !slices.Equal(got, test.want) {
+				t.Errorf("cached in the file %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDisk(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cache.db")
+	c, _ := newCache(t, Options{Size: 1, TTL: time.Hour, Path: path})
+	c.Set(ctx, "a", []int{1}, []byte("a"))
+	c.Set(ctx, "b", []int{1}, []byte("b"))
+	if c.Len() != 1 {
+		t.Fatalf("%d results held in memory, want 1", c.Len())
+	}
+	// a was evicted from memory, not from the file:
+	if value, ok := c.Get(ctx, "test", "a"); !ok || string(value) != "a" {
+		t.Errorf("a evicted from memory: %q, %t, want it read from the file", value, ok)
+	}
+	c.Close()
+
+	// the results survive a restart, until they expire:
+	reopened, advance := newCache(t, Options{Size: 10, TTL: time.Hour, Path: path})
+	if got := cached(reopened, "a", "b"); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("after a restart: cached %v, want a and b", got)
+	}
+	if reopened.Len() != 2 {
+		t.Errorf("%d results held in memory once read from the file, want 2", reopened.Len())
+	}
+	advance(time.Hour)
+	if got := cached(reopened, "a", "b"); !slices.Equal(got, []string{}) {
+		t.Errorf("after the TTL: cached %v, want none", got)
+	}
+}
+
+func TestHook(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newCache(t, Options{Size: 10})
+	var lookups []string
+	c.SetHook(func(query string, hit bool) {
+		result := "miss"
+		if hit {
+			result = "hit"
+		}
+		lookups = append(lookups, query+" "+result)
+	})
+	c.Get(ctx, "GetCountryByID", "a")
+	c.Set(ctx, "a", []int{1}, []byte("a"))
+	c.Get(ctx, "GetCountryByID", "a")
+	if want := []string{"GetCountryByID miss", "GetCountryByID hit"}; !slices.Equal(lookups, want) {
+		t.Errorf("lookups %v, want %v", lookups, want)
+	}
+}
@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// diskStore keeps the results in a SQLite file of their own, with the countries they depend on indexed for the
+// invalidations.
+type diskStore struct {
+	db *sql.DB
+}
+
+func openDiskStore(ctx context.Context, path string) (*diskStore, error) {
+	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=5000&_txlock=immediate")
+	if err != nil {
+		return nil, fmt.Errorf("could not open cache file: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	// countries is the JSON array of the countries of a result, null when it depends on every country:
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS entries (
+			key TEXT PRIMARY KEY,
+			countries TEXT NOT NULL,
+			value BLOB NOT NULL,
+			expires_at INTEGER NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS entry_countries (
+			country_id INTEGER NOT NULL,
+			key TEXT NOT NULL,
+			PRIMARY KEY (country_id, key)
+		) WITHOUT ROWID;
+		CREATE INDEX IF NOT EXISTS entry_countries_key ON entry_countries (key);`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not create cache tables: %w", err)
+	}
+
+	store := &diskStore{db: db}
+	if err := store.deleteExpired(ctx, time.Now()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *diskStore) get(ctx context.Context, key string, now time.Time) (*entry, bool, error) {
+	var countries string
+	var expiresAt int64
+	e := &entry{key: key}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT countries, value, expires_at
+		FROM entries
+		WHERE key = ? AND (expires_at = 0 OR expires_at > ?)`, key, now.UnixNano()).Scan(&countries, &e.value, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("could not read cached result: %w", err)
+	}
+	if err := json.Unmarshal([]byte(countries), &e.countryIDs); err != nil {
+		return nil, false, fmt.Errorf("could not read countries of cached result: %w", err)
+	}
+	if expiresAt != 0 {
+		e.expiresAt = time.Unix(0, expiresAt)
+	}
+	return e, true, nil
+}
+
+func (s *diskStore) set(ctx context.Context, e *entry) error {
+	countries, err := json.Marshal(e.countryIDs)
+	if err != nil {
+		return err
+	}
+	var expiresAt int64
+	if !e.expiresAt.IsZero() {
+		expiresAt = e.expiresAt.UnixNano()
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO entries (key, countries, value, expires_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET countries = excluded.countries, value = excluded.value, expires_at = excluded.expires_at`,
+		e.key, string(countries), e.value, expiresAt)
+	if err != nil {
+		return fmt.Errorf("could not write cached result: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM entry_countries WHERE key = ?", e.key); err != nil {
+		return fmt.Errorf("could not write countries of cached result: %w", err)
+	}
+	for _, countryID := range e.countryIDs {
+		if _, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO entry_countries (country_id, key) VALUES (?, ?)", countryID, e.key); err != nil {
+			return fmt.Errorf("could not write countries of cached result: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// invalidate deletes the results depending on any of the countries and on every country, or every result when
+// countryIDs is empty.
+func (s *diskStore) invalidate(ctx context.Context, countryIDs []int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if len(countryIDs) == 0 {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM entries"); err != nil {
+			return fmt.Errorf("could not delete cached results: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM entry_countries"); err != nil {
+			return fmt.Errorf("could not delete cached results: %w", err)
+		}
+		return tx.Commit()
+	}
+
+	placeholders := "?" + strings.Repeat(", ?", len(countryIDs)-1)
+	args := make([]any, len(countryIDs))
+	for i, countryID := range countryIDs {
+		args[i] = countryID
+	}
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM entries
+		WHERE countries = 'null' OR key IN (SELECT key FROM entry_countries WHERE country_id IN (`+placeholders+`))`, args...)
+	if err != nil {
+		return fmt.Errorf("could not delete cached results: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM entry_countries WHERE key NOT IN (SELECT key FROM entries)")
+	if err != nil {
+		return fmt.Errorf("could not delete cached results: %w", err)
+	}
+	return tx.Commit()
+}
+
+func (s *diskStore) deleteExpired(ctx context.Context, now time.Time) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM entries WHERE expires_at != 0 AND expires_at <= ?", now.UnixNano())
+	if err != nil {
+		return fmt.Errorf("could not delete expired cached results: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx, "DELETE FROM entry_countries WHERE key NOT IN (SELECT key FROM entries)")
+	if err != nil {
+		return fmt.Errorf("could not delete expired cached results: %w", err)
+	}
+	return nil
+}
+
+func (s *diskStore) close() error {
+	return s.db.Close()
+}
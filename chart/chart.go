@@ -0,0 +1,322 @@
+package chart
+
+import (
+	"bytes"
+	"covid/series"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Kind string
+
+const (
+	KindLine Kind = "line"
+	KindBar  Kind = "bar"
+)
+
+type Theme string
+
+const (
+	ThemeLight Theme = "light"
+	ThemeDark  Theme = "dark"
+)
+
+const (
+	DefaultWidth  = 800
+	DefaultHeight = 400
+	MinSize       = 100
+	MaxSize       = 4000
+	// MaxSeries is the number of series a chart can overlay, one per color of the palettes.
+	MaxSeries = 8
+
+	marginLeft   = 70
+	marginRight  = 20
+	marginTop    = 40
+	marginBottom = 40
+	// number of dates written under the x axis at most.
+	maxDateLabels = 6
+	// number of intervals between the ticks of a linear y axis, roughly.
+	yTicks = 5
+)
+
+// Options are the look of a chart, zero values are replaced by the defaults.
+type Options struct {
+	Kind     Kind
+	Width    int
+	Height   int
+	LogScale bool
+	Theme    Theme
+}
+
+type palette struct {
+	background string
+	text       string
+	grid       string
+	axis       string
+	series     []string
+}
+
+var palettes = map[Theme]palette{
+	ThemeLight: {
+		background: "#ffffff",
+		text:       "#333333",
+		grid:       "#e5e5e5",
+		axis:       "#999999",
+		series:     []string{"#1f77b4", "#d62728", "#2ca02c", "#ff7f0e", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f"},
+	},
+	ThemeDark: {
+		background: "#1e1e1e",
+		text:       "#dddddd",
+		grid:       "#383838",
+		axis:       "#777777",
+		series:     []string{"#4ea8de", "#f25f5c", "#6fcf97", "#ffb454", "#c39bd3", "#d7a77a", "#f4a3d0", "#b0b0b0"},
+	},
+}
+
+func (o *Options) validate() error {
+	if o.Kind == "" {
+		o.Kind = KindLine
+	}
+	if o.Theme == "" {
+		o.Theme = ThemeLight
+	}
+	if o.Width == 0 {
+		o.Width = DefaultWidth
+	}
+	if o.Height == 0 {
+		o.Height = DefaultHeight
+	}
+
+	if o.Kind != KindLine && o.Kind != KindBar {
+		return fmt.Errorf("unknown chart type %q, expected line or bar", o.Kind)
+	}
+	if _, ok := palettes[o.Theme]; !ok {
+		return fmt.Errorf("unknown theme %q, expected light or dark", o.Theme)
+	}
+	if o.Width < MinSize || o.Width > MaxSize || o.Height < MinSize || o.Height > MaxSize {
+		return fmt.Errorf("width and height must be between %d and %d", MinSize, MaxSize)
+	}
+	return nil
+}
+
+// Render writes an SVG chart of the series to w. The same series and options always give the same bytes,
+// so charts can be compared with golden files.
+func Render(w io.Writer, data []series.Series, opts Options) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	colors := palettes[opts.Theme]
+
+	c := &canvas{
+		opts:   opts,
+		dates:  dates(data),
+		left:   marginLeft,
+		top:    marginTop,
+		width:  float64(opts.Width - marginLeft - marginRight),
+		height: float64(opts.Height - marginTop - marginBottom),
+	}
+	c.scale = newScale(data, opts.LogScale)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`+"\n",
+		opts.Width, opts.Height, opts.Width, opts.Height)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", colors.background)
+
+	c.writeLegend(&b, data, colors)
+	if len(c.dates) == 0 {
+		fmt.Fprintf(&b, `<text x="%s" y="%s" fill="%s" text-anchor="middle">no data</text>`+"\n",
+			num(c.left+c.width/2), num(c.top+c.height/2), colors.text)
+		b.WriteString("</svg>\n")
+		_, err := w.Write(b.Bytes())
+		return err
+	}
+
+	c.writeAxes(&b, colors)
+	for i, s := range data {
+		color := colors.series[i%len(colors.series)]
+		if opts.Kind == KindBar {
+			c.writeBars(&b, s, i, len(data), color)
+		} else {
+			c.writeLine(&b, s, color)
+		}
+	}
+	b.WriteString("</svg>\n")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// dates returns every date of the series, sorted. Series of different countries do not always
+// have the same days, they are drawn on this common axis.
+func dates(data []series.Series) []string {
+	seen := map[string]bool{}
+	var dates []string
+	for _, s := range data {
+		for _, point := range s.Points {
+			if !seen[point.Date] {
+				seen[point.Date] = true
+				dates = append(dates, point.Date)
+			}
+		}
+	}
+	sort.Strings(dates)
+	return dates
+}
+
+type canvas struct {
+	opts   Options
+	dates  []string
+	scale  scale
+	left   float64
+	top    float64
+	width  float64
+	height float64
+}
+
+// x returns the position of the i-th date, the middle of its slot for bar charts.
+func (c *canvas) x(i int) float64 {
+	n := len(c.dates)
+	if c.opts.Kind == KindBar {
+		return c.left + c.width*(float64(i)+0.5)/float64(n)
+	}
+	if n == 1 {
+		return c.left + c.width/2
+	}
+	return c.left + c.width*float64(i)/float64(n-1)
+}
+
+func (c *canvas) y(value float64) float64 {
+	return c.top + c.height*(1-c.scale.position(value))
+}
+
+func (c *canvas) writeLegend(b *bytes.Buffer, data []series.Series, colors palette) {
+	x := float64(marginLeft)
+	for i, s := range data {
+		label := fmt.Sprintf("%s (%s)", s.Country.Name, s.Metric)
+		fmt.Fprintf(b, `<rect x="%s" y="14" width="10" height="10" fill="%s"/>`+"\n", num(x), colors.series[i%len(colors.series)])
+		fmt.Fprintf(b, `<text x="%s" y="23" fill="%s">%s</text>`+"\n", num(x+14), colors.text, escape(label))
+		// text width is not known without the font, this is a fair guess for the default sans-serif:
+		x += 14 + float64(len(label))*6.5 + 16
+	}
+}
+
+func (c *canvas) writeAxes(b *bytes.Buffer, colors palette) {
+	for _, tick := range c.scale.ticks() {
+		y := c.y(tick)
+		fmt.Fprintf(b, `<line x1="%s" y1="%s" x2="%s" y2="%s" stroke="%s"/>`+"\n", num(c.left), num(y), num(c.left+c.width), num(y), colors.grid)
+		fmt.Fprintf(b, `<text x="%s" y="%s" fill="%s" text-anchor="end">%s</text>`+"\n", num(c.left-6), num(y+4), colors.text, formatValue(tick))
+	}
+	bottom := c.top + c.height
+	fmt.Fprintf(b, `<line x1="%s" y1="%s" x2="%s" y2="%s" stroke="%s"/>`+"\n", num(c.left), num(c.top), num(c.left), num(bottom), colors.axis)
+	fmt.Fprintf(b, `<line x1="%s" y1="%s" x2="%s" y2="%s" stroke="%s"/>`+"\n", num(c.left), num(bottom), num(c.left+c.width), num(bottom), colors.axis)
+
+	for _, i := range labelIndexes(len(c.dates), maxDateLabels) {
+		fmt.Fprintf(b, `<text x="%s" y="%s" fill="%s" text-anchor="middle">%s</text>`+"\n", num(c.x(i)), num(bottom+18), colors.text, c.dates[i])
+	}
+}
+
+// writeLine draws a series as a polyline. Values that cannot be drawn on a log scale break the line.
+func (c *canvas) writeLine(b *bytes.Buffer, s series.Series, color string) {
+	index := c.dateIndexes()
+	var segment []string
+	flush := func() {
+		if len(segment) == 1 {
+			// a point alone would be invisible as a polyline:
+			xy := strings.Split(segment[0], ",")
+			fmt.Fprintf(b, `<circle cx="%s" cy="%s" r="2" fill="%s"/>`+"\n", xy[0], xy[1], color)
+		} else if len(segment) > 1 {
+			fmt.Fprintf(b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="2" stroke-linejoin="round"/>`+"\n", strings.Join(segment, " "), color)
+		}
+		segment = segment[:0]
+	}
+	for _, point := range s.Points {
+		if !c.scale.drawable(point.Value) {
+			flush()
+			continue
+		}
+		segment = append(segment, num(c.x(index[point.Date]))+","+num(c.y(point.Value)))
+	}
+	flush()
+}
+
+// writeBars draws the n-th of count series as bars, side by side with the bars of the other series.
+func (c *canvas) writeBars(b *bytes.Buffer, s series.Series, n int, count int, color string) {
+	index := c.dateIndexes()
+	slot := c.width / float64(len(c.dates))
+	barWidth := slot * 0.8 / float64(count)
+	base := c.y(c.scale.base())
+	for _, point := range s.Points {
+		if !c.scale.drawable(point.Value) {
+			continue
+		}
+		x := c.x(index[point.Date]) - slot*0.4 + float64(n)*barWidth
+		y := c.y(point.Value)
+		top, height := y, base-y
+		if height < 0 {
+			top, height = base, -height
+		}
+		fmt.Fprintf(b, `<rect x="%s" y="%s" width="%s" height="%s" fill="%s"><title>%s: %s</title></rect>`+"\n",
+			num(x), num(top), num(barWidth), num(height), color, point.Date, formatValue(point.Value))
+	}
+}
+
+func (c *canvas) dateIndexes() map[string]int {
+	index := make(map[string]int, len(c.dates))
+	for i, date := range c.dates {
+		index[date] = i
+	}
+	return index
+}
+
+// labelIndexes returns at most max indexes spread evenly from 0 to n-1.
+func labelIndexes(n int, max int) []int {
+	if n <= max {
+		indexes := make([]int, n)
+		for i := range indexes {
+			indexes[i] = i
+		}
+		return indexes
+	}
+	indexes := make([]int, max)
+	for k := range indexes {
+		indexes[k] = int(math.Round(float64(k*(n-1)) / float64(max-1)))
+	}
+	return indexes
+}
+
+// num formats a coordinate with at most two decimals, so that the output does not depend on float noise.
+func num(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 2, 64)
+	s = strings.TrimRight(s, "0")
+	s = strings.TrimSuffix(s, ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// formatValue writes axis values as 950, 1.5k, 2M or 3B.
+func formatValue(v float64) string {
+	abs := math.Abs(v)
+	switch {
+	case abs >= 1e9:
+		return num(v/1e9) + "B"
+	case abs >= 1e6:
+		return num(v/1e6) + "M"
+	case abs >= 1e3:
+		return num(v/1e3) + "k"
+	default:
+		return num(v)
+	}
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
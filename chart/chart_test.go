@@ -0,0 +1,133 @@
+package chart
+
+import (
+	"bytes"
+	"covid/database"
+	"covid/series"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of testdata with the charts rendered")
+
+// daily returns a series of a country starting on 2021-03-01, with a value per day.
+func daily(country string, metric series.Metric, values ...float64) series.Series {
+	s := series.Series{Country: database.Country{Name: country}, Metric: metric}
+	for i, value := range values {
+		s.Points = append(s.Points, series.Point{Date: fmt.Sprintf("2021-03-%02d", i+1), Value: value})
+	}
+	return s
+}
+
+func TestRenderGolden(t *testing.T) {
+	growth := daily("Belgium", series.MetricConfirmed, 120, 180, 260, 410, 530, 790, 1020, 1380, 1800, 2450)
+	tests := []struct {
+		name string
+		data []series.Series
+		opts Options
+	}{
+		{"line", []series.Series{growth}, Options{}},
+		{"line-dark-compare", []series.Series{growth, daily("France", series.MetricConfirmed, 300, 350, 420, 500, 610, 700, 820, 940)}, Options{Theme: ThemeDark}},
+		{"line-log", []series.Series{growth}, Options{LogScale: true, Width: 600, Height: 300}},
+		// zero cannot be drawn on a log scale, it breaks the line and leaves a point alone:
+		{"line-log-gaps", []series.Series{daily("Belgium", series.MetricNewDeaths, 4, 0, 6, 0, 0, 9, 12)}, Options{LogScale: true}},
+		{"bar", []series.Series{daily("Belgium", series.MetricNewConfirmed, 60, 80, 150, 120, 260, 230)}, Options{Kind: KindBar}},
+		// corrections make daily deltas negative:
+		{"bar-negative-compare", []series.Series{
+			daily("Belgium", series.MetricNewConfirmed, 60, -20, 150, 120),
+			daily("France", series.MetricNewConfirmed, 40, 90, -35, 70),
+		}, Options{Kind: KindBar, Theme: ThemeDark}},
+		{"single-point", []series.Series{daily("Belgium", series.MetricDeaths, 42)}, Options{}},
+		{"escaped-name", []series.Series{daily(`Trinidad & "Tobago" <TT>`, series.MetricConfirmed, 1, 2, 3)}, Options{}},
+		{"no-data", []series.Series{daily("Belgium", series.MetricConfirmed)}, Options{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := Render(&b, test.data, test.opts); err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			checkWellFormed(t, b.Bytes())
+
+			golden := filepath.Join("testdata", test.name+".svg")
+			if *update {
+				if err := os.WriteFile(golden, b.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v, run go test ./chart -update to write it", err)
+			}
+			if !bytes.Equal(b.Bytes(), want) {
+				t.Errorf("the chart differs from %s, run go test ./chart -update if the change is intended\n%s", golden, firstDifference(b.String(), string(want)))
+			}
+
+			// the same series and options always give the same bytes:
+			var again bytes.Buffer
+			if err := Render(&again, test.data, test.opts); err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if !bytes.Equal(again.Bytes(), b.Bytes()) {
+				t.Error("rendering the chart twice gave different bytes")
+			}
+		})
+	}
+}
+
+func TestRenderInvalidOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"unknown kind", Options{Kind: "pie"}},
+		{"unknown theme", Options{Theme: "blue"}},
+		{"too narrow", Options{Width: MinSize - 1}},
+		{"too high", Options{Height: MaxSize + 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := Render(&b, nil, test.opts); err == nil {
+				t.Error("no error")
+			}
+			if b.Len() > 0 {
+				t.Errorf("wrote %d bytes", b.Len())
+			}
+		})
+	}
+}
+
+// checkWellFormed parses an SVG document to its end.
+func checkWellFormed(t *testing.T, svg []byte) {
+	t.Helper()
+	decoder := xml.NewDecoder(bytes.NewReader(svg))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatalf("the chart is not well-formed XML: %v", err)
+		}
+	}
+}
+
+// firstDifference shows the first line where got and want differ.
+func firstDifference(got string, want string) string {
+	gotLines, wantLines := strings.Split(got, "\n"), strings.Split(want, "\n")
+	for i := 0; i < len(gotLines) && i < len(wantLines); i++ {
+		if gotLines[i] != wantLines[i] {
+			return fmt.Sprintf("line %d:\ngot  %s\nwant %s", i+1, gotLines[i], wantLines[i])
+		}
+	}
+	return fmt.Sprintf("got %d lines, want %d", len(gotLines), len(wantLines))
+}
@@ -0,0 +1,101 @@
+package chart
+
+import (
+	"covid/series"
+	"math"
+)
+
+// scale maps values to a position between 0, the bottom of the plot, and 1, its top.
+type scale struct {
+	log bool
+	min float64
+	max float64
+	// step is the interval between the ticks of a linear scale.
+	step float64
+}
+
+// newScale fits the values of every series. A linear scale always shows 0, and its bounds are rounded
+// to its ticks. A log scale spans whole powers of ten and ignores the values that are not positive.
+func newScale(data []series.Series, log bool) scale {
+	s := scale{log: log, min: math.Inf(1), max: math.Inf(-1)}
+	for _, d := range data {
+		for _, point := range d.Points {
+			if !s.drawable(point.Value) {
+				continue
+			}
+			s.min = math.Min(s.min, point.Value)
+			s.max = math.Max(s.max, point.Value)
+		}
+	}
+
+	if log {
+		if math.IsInf(s.min, 1) {
+			s.min, s.max = 1, 10
+		}
+		s.min = math.Pow(10, math.Floor(math.Log10(s.min)))
+		s.max = math.Pow(10, math.Ceil(math.Log10(s.max)))
+		if s.max <= s.min {
+			s.max = s.min * 10
+		}
+		return s
+	}
+
+	if math.IsInf(s.min, 1) {
+		s.min, s.max = 0, 1
+	}
+	s.min = math.Min(s.min, 0)
+	s.max = math.Max(s.max, 0)
+	if s.max == s.min {
+		s.max = s.min + 1
+	}
+	s.step = niceStep((s.max - s.min) / yTicks)
+	s.min = math.Floor(s.min/s.step) * s.step
+	s.max = math.Ceil(s.max/s.step) * s.step
+	return s
+}
+
+func (s scale) drawable(value float64) bool {
+	return !s.log || value > 0
+}
+
+// base is the value bars start from.
+func (s scale) base() float64 {
+	if s.log {
+		return s.min
+	}
+	return 0
+}
+
+func (s scale) position(value float64) float64 {
+	if s.log {
+		return (math.Log10(value) - math.Log10(s.min)) / (math.Log10(s.max) - math.Log10(s.min))
+	}
+	return (value - s.min) / (s.max - s.min)
+}
+
+func (s scale) ticks() []float64 {
+	var ticks []float64
+	if s.log {
+		for v := s.min; v <= s.max*1.000001; v *= 10 {
+			ticks = append(ticks, v)
+		}
+		return ticks
+	}
+	// counting steps rather than adding them keeps float errors from piling up:
+	n := int(math.Round((s.max - s.min) / s.step))
+	for i := 0; i <= n; i++ {
+		ticks = append(ticks, s.min+float64(i)*s.step)
+	}
+	return ticks
+}
+
+// niceStep rounds raw up to 1, 2 or 5 times a power of ten.
+func niceStep(raw float64) float64 {
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, factor := range []float64{1, 2, 5} {
+		if raw <= factor*magnitude {
+			return factor * magnitude
+		}
+	}
+	return 10 * magnitude
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"covid/api"
+	"covid/cache"
+	"covid/config"
+	"covid/database"
+	"covid/database/storetest"
+	"covid/export"
+	"covid/graph"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const usage = `usage: covid [-config <file>] [settings flags] [command]
+
+Without a command the server is started. The settings are read from the YAML file given by -config or
+COVID_CONFIG, then from the environment and the flags, see covid -h for the settings flags.
+
+commands:
+  check-stores
+        run the storage conformance checks against a temporary SQLite database and the in-memory store
+  config print
+        print the effective settings, secrets redacted
+  export [-format csv|ndjson|xlsx|influx] [-countries 1,2] [-from YYYY-MM-DD] [-to YYYY-MM-DD] [-metrics confirmed,new_deaths] -o <file>
+        export covid statistics to a file, the format defaults to the extension of the file
+  openapi
+        print the OpenAPI document of the REST API
+  persisted-queries load [-replace] <manifest.json>
+        register the operations of a manifest as allowed
+  users grant-admin <email>
+        make the registered user of an email an admin, they get the role when they log in again`
+
+// runCommand runs one of the maintenance commands instead of the server.
+func runCommand(ctx context.Context, cfg config.Config, args []string) error {
+	switch args[0] {
+	case "check-stores":
+		return runCheckStoresCommand(ctx)
+	case "config":
+		return runConfigCommand(cfg, args[1:])
+	case "export":
+		return runExportCommand(ctx, cfg, args[1:])
+	case "openapi":
+		return printOpenAPIDocument()
+	case "persisted-queries":
+		return runPersistedQueriesCommand(ctx, cfg, args[1:])
+	case "users":
+		return runUsersCommand(ctx, cfg, args[1:])
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+	}
+}
+
+func runConfigCommand(cfg config.Config, args []string) error {
+	if len(args) != 1 || args[0] != "print" {
+		return errors.New(usage)
+	}
+	return cfg.Redacted().WriteYAML(os.Stdout)
+}
+
+// runCheckStoresCommand runs the storetest checks on every implementation of database.Store.
+func runCheckStoresCommand(ctx context.Context) error {
+	dir, err := os.MkdirTemp("", "covid-check-stores")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	// every check gets a new database file:
+	databases := 0
+	newSQLiteStore := func(ctx context.Context) (database.Store, func() error, error) {
+		databases++
+		db, err := database.ConnectDB(ctx, filepath.Join(dir, fmt.Sprintf("check-%d.db", databases)), database.Options{})
+		if err != nil {
+			return nil, nil, fmt.Errorf("error connecting to database: %w", err)
+		}
+		return db, db.Close, nil
+	}
+	newMemoryStore := func(ctx context.Context) (database.Store, func() error, error) {
+		return database.NewMemoryStore(), func() error { return nil }, nil
+	}
+
+	stores := []struct {
+		name     string
+		newStore storetest.NewStore
+	}{
+		{"sqlite", newSQLiteStore},
+		{"memory", newMemoryStore},
+	}
+	failed := false
+	for _, store := range stores {
+		if err := storetest.TestStore(ctx, store.newStore); err != nil {
+			fmt.Printf("%s: FAIL\n%v\n", store.name, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s: ok\n", store.name)
+	}
+	if failed {
+		return errors.New("the stores do not pass the conformance checks")
+	}
+	return nil
+}
+
+func runPersistedQueriesCommand(ctx context.Context, cfg config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "load" {
+		return errors.New(usage)
+	}
+
+	flags := flag.NewFlagSet("persisted-queries load", flag.ContinueOnError)
+	replace := flags.Bool("replace", false, "revoke allowed operations missing from the manifest")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New(usage)
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	queries, err := graph.ParsePersistedQueryManifest(file)
+	if err != nil {
+		return err
+	}
+
+	// the cache file is shared with the server, the allow-list it holds is dropped with the manifest loaded:
+	var resultCache *cache.Cache
+	if cfg.Cache.Size > 0 && cfg.Cache.Path != "" {
+		resultCache, err = cache.New(ctx, cache.Options{Size: cfg.Cache.Size, TTL: cfg.Cache.TTL, Path: cfg.Cache.Path})
+		if err != nil {
+			return fmt.Errorf("error opening the cache: %w", err)
+		}
+		defer resultCache.Close()
+	}
+
+	db, err := connectDB(ctx, cfg.Database, nil, resultCache)
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %w", err)
+	}
+	defer db.Close()
+
+	if err := db.AllowPersistedQueries(ctx, queries, *replace); err != nil {
+		return err
+	}
+
+	fmt.Printf("loaded %d persisted queries\n", len(queries))
+	return nil
+}
+
+func runUsersCommand(ctx context.Context, cfg config.Config, args []string) error {
+	if len(args) != 2 || args[0] != "grant-admin" {
+		return errors.New(usage)
+	}
+
+	db, err := connectDB(ctx, cfg.Database, nil, nil)
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %w", err)
+	}
+	defer db.Close()
+
+	user, granted, err := graph.GrantAdmin(ctx, db, args[1])
+	if err != nil {
+		return err
+	}
+	if !granted {
+		fmt.Printf("%s is already an admin\n", user.Username)
+		return nil
+	}
+	fmt.Printf("%s is now an admin\n", user.Username)
+	return nil
+}
+
+func runExportCommand(ctx context.Context, cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	formatName := flags.String("format", "", "csv, ndjson, xlsx or influx, read from the extension of the output file when empty")
+	countries := flags.String("countries", "", "comma separated IDs of the countries exported, every country when empty")
+	from := flags.String("from", "", "first day exported, YYYY-MM-DD")
+	to := flags.String("to", "", "last day exported, YYYY-MM-DD")
+	metricNames := flags.String("metrics", "", "comma separated metrics exported, confirmed,recovered,deaths when empty")
+	output := flags.String("o", "", "file written")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *output == "" || flags.NArg() != 0 {
+		return errors.New(usage)
+	}
+
+	var format export.Format
+	var err error
+	if *formatName != "" {
+		format, err = export.ParseFormat(*formatName)
+	} else {
+		format, err = export.FormatFromFileName(*output)
+	}
+	if err != nil {
+		return err
+	}
+
+	opts := export.Options{}
+	if opts.CountryIDs, err = export.ParseCountryIDs(*countries); err != nil {
+		return err
+	}
+	if opts.Metrics, err = export.ParseMetrics(*metricNames); err != nil {
+		return err
+	}
+	for _, date := range []*string{from, to} {
+		if *date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", *date); err != nil {
+			return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", *date)
+		}
+	}
+	if *from != "" {
+		opts.DateFrom = from
+	}
+	if *to != "" {
+		opts.DateTo = to
+	}
+
+	db, err := connectDB(ctx, cfg.Database, nil, nil)
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %w", err)
+	}
+	defer db.Close()
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := export.CovidStatistics(ctx, db, file, format, opts); err != nil {
+		file.Close()
+		return fmt.Errorf("error exporting covid statistics: %w", err)
+	}
+	return file.Close()
+}
+
+func printOpenAPIDocument() error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(api.BuildOpenAPIDocument(api.Operations))
+}
@@ -0,0 +1,382 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultJWTSecret is the secret used when none is configured, it is public and only fit for development.
+const DefaultJWTSecret = "1234"
+
+// Config holds every setting of the server and of the commands.
+type Config struct {
+	Server    Server    `yaml:"server"`
+	Database  Database  `yaml:"database"`
+	Auth      Auth      `yaml:"auth"`
+	Fetcher   Fetcher   `yaml:"fetcher"`
+	GraphQL   GraphQL   `yaml:"graphql"`
+	Quality   Quality   `yaml:"quality"`
+	Analytics Analytics `yaml:"analytics"`
+	Log       Log       `yaml:"log"`
+	Cache     Cache     `yaml:"cache"`
+	Mail      Mail      `yaml:"mail"`
+	RateLimit RateLimit `yaml:"rate_limit"`
+}
+
+type Server struct {
+	Port int `yaml:"port"`
+	// RequestTimeout cancels the requests running longer, websocket connections and exports excepted, 0 disables it.
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+	// ShutdownTimeout is how long the server waits for requests and the fetcher to finish when stopping.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// Compression is the gzip and brotli level of the responses, 0 disables it.
+	Compression  int          `yaml:"compression"`
+	CacheControl CacheControl `yaml:"cache_control"`
+}
+
+// CacheControl is the Cache-Control header of the successful REST reads, empty to send none.
+type CacheControl struct {
+	Default string `yaml:"default"`
+	// Routes overrides Default by route pattern, such as /api/v1/countries/{id}.
+	Routes map[string]string `yaml:"routes"`
+}
+
+type Database struct {
+	// Path is the SQLite database file, created when missing.
+	Path string `yaml:"path"`
+	// ReadConnections is the number of connections serving reads, the writes share a single one.
+	ReadConnections int `yaml:"read_connections"`
+	// BusyTimeout is how long a statement waits for a lock held by another connection before failing.
+	BusyTimeout time.Duration `yaml:"busy_timeout"`
+}
+
+type Auth struct {
+	JWTSecret string        `yaml:"jwt_secret"`
+	TokenTTL  time.Duration `yaml:"token_ttl"`
+	Password  Password      `yaml:"password"`
+	// ResetTokenTTL and VerificationTokenTTL are how long the tokens emailed to users stay valid.
+	ResetTokenTTL        time.Duration `yaml:"reset_token_ttl"`
+	VerificationTokenTTL time.Duration `yaml:"verification_token_ttl"`
+	// RequireVerifiedEmail refuses the requests of the users who have not verified their email.
+	RequireVerifiedEmail bool `yaml:"require_verified_email"`
+	// AdminEmail is the email of a registered user made an admin when the server starts once they verified it,
+	// to set up the first admin. Needs an SMTP server, empty by default.
+	AdminEmail string `yaml:"admin_email"`
+}
+
+// Password are the rules the passwords of new users must follow.
+type Password struct {
+	MinLength        int  `yaml:"min_length"`
+	RequireLowercase bool `yaml:"require_lowercase"`
+	RequireUppercase bool `yaml:"require_uppercase"`
+	RequireDigit     bool `yaml:"require_digit"`
+	RequireSpecial   bool `yaml:"require_special"`
+}
+
+type Fetcher struct {
+	// Interval is the time between two fetches of the statistics of every country.
+	Interval    time.Duration `yaml:"interval"`
+	UpstreamURL string        `yaml:"upstream_url"`
+}
+
+type GraphQL struct {
+	// PageSize is the number of statistics returned with a country, 0 returns them all.
+	PageSize int `yaml:"page_size"`
+	// MaxQueryDepth and MaxQueryComplexity reject larger operations, 0 disables the limit.
+	MaxQueryDepth          int  `yaml:"max_query_depth"`
+	MaxQueryComplexity     int  `yaml:"max_query_complexity"`
+	PersistedQueriesStrict bool `yaml:"persisted_queries_strict"`
+	// APQStore is where automatic persisted queries are kept, database or memory.
+	APQStore string `yaml:"apq_store"`
+	// APQMaxStored is the number of queries registered by clients kept in the database, the oldest are
+	// deleted beyond it. 0 keeps them all.
+	APQMaxStored int `yaml:"apq_max_stored"`
+}
+
+type Quality struct {
+	// Strict rejects the writes that break an error rule instead of only flagging them.
+	Strict bool `yaml:"strict"`
+}
+
+type Analytics struct {
+	SerialIntervalMean float64 `yaml:"serial_interval_mean"`
+	SerialIntervalSD   float64 `yaml:"serial_interval_sd"`
+	RtWindowDays       int     `yaml:"rt_window_days"`
+}
+
+type Log struct {
+	// Level is the lowest level logged: debug, info, warn or error.
+	Level string `yaml:"level"`
+	// Format is text or json.
+	Format string `yaml:"format"`
+}
+
+type Cache struct {
+	// Size is the number of read results kept in memory, 0 disables the cache.
+	Size int `yaml:"size"`
+	// TTL drops the results older, for the writes of other processes to show, 0 keeps them until invalidated.
+	TTL time.Duration `yaml:"ttl"`
+	// Path is the SQLite file the results are kept in as well, to survive restarts, none when empty.
+	Path string `yaml:"path"`
+}
+
+// RateLimitGroups are the route groups the requests are limited by.
+var RateLimitGroups = []string{"login", "graphql", "rest-read", "rest-write", "refresh"}
+
+// RateLimitRoles are the roles a group can give other limits, anonymous for the requests without a token.
+var RateLimitRoles = []string{"anonymous", "user", "admin"}
+
+type RateLimit struct {
+	// Enabled limits the requests of every client, keyed by user or by IP for anonymous requests.
+	Enabled bool `yaml:"enabled"`
+	// Groups are the limits of the route groups, a group without one is not limited. A group set in the file
+	// replaces its default as a whole, roles included.
+	Groups map[string]RateLimitPolicy `yaml:"groups"`
+}
+
+// RateLimitPolicy is the limit of a route group, and of the roles given another one.
+type RateLimitPolicy struct {
+	Limit `yaml:",inline"`
+	Roles map[string]Limit `yaml:"roles,omitempty"`
+}
+
+// Limit allows Requests requests per Window, refilled continuously.
+type Limit struct {
+	Requests int           `yaml:"requests"`
+	Window   time.Duration `yaml:"window"`
+}
+
+type Mail struct {
+	// SMTPHost is the server the emails are sent through, no email is sent when it is empty.
+	SMTPHost     string `yaml:"smtp_host"`
+	SMTPPort     int    `yaml:"smtp_port"`
+	SMTPUsername string `yaml:"smtp_username"`
+	SMTPPassword string `yaml:"smtp_password"`
+	From         string `yaml:"from"`
+	// AppURL is the address of the client the links of the emails lead to, the emails only carry the tokens
+	// when it is empty.
+	AppURL string `yaml:"app_url"`
+}
+
+// Default returns the settings used when nothing else is configured.
+func Default() Config {
+	return Config{
+		Server: Server{
+			Port:            8080,
+			RequestTimeout:  time.Minute,
+			ShutdownTimeout: 30 * time.Second,
+			Compression:     5,
+			CacheControl:    CacheControl{Default: "private, no-cache"},
+		},
+		Database: Database{
+			Path:            "covid.db",
+			ReadConnections: 4,
+			BusyTimeout:     5 * time.Second,
+		},
+		Auth: Auth{
+			JWTSecret: DefaultJWTSecret,
+			TokenTTL:  24 * time.Hour,
+			Password: Password{
+				MinLength:        8,
+				RequireLowercase: true,
+				RequireUppercase: true,
+				RequireDigit:     true,
+				RequireSpecial:   true,
+			},
+			ResetTokenTTL:        time.Hour,
+			VerificationTokenTTL: 48 * time.Hour,
+		},
+		Fetcher: Fetcher{
+			Interval:    24 * time.Hour,
+			UpstreamURL: "https://api.covid19api.com",
+		},
+		GraphQL: GraphQL{
+			PageSize:           2,
+			MaxQueryDepth:      10,
+			MaxQueryComplexity: 1000,
+			APQStore:           "database",
+			APQMaxStored:       10000,
+		},
+		Analytics: Analytics{
+			SerialIntervalMean: 4.7,
+			SerialIntervalSD:   2.9,
+			RtWindowDays:       7,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: "text",
+		},
+		Cache: Cache{
+			Size: 1000,
+			TTL:  time.Hour,
+		},
+		Mail: Mail{
+			SMTPPort: 587,
+		},
+		RateLimit: RateLimit{
+			Enabled: true,
+			Groups: map[string]RateLimitPolicy{
+				"login": {Limit: Limit{Requests: 10, Window: time.Minute}},
+				"graphql": {Limit: Limit{Requests: 120, Window: time.Minute}, Roles: map[string]Limit{
+					"anonymous": {Requests: 30, Window: time.Minute},
+					"admin":     {Requests: 600, Window: time.Minute},
+				}},
+				"rest-read": {Limit: Limit{Requests: 120, Window: time.Minute}, Roles: map[string]Limit{
+					"admin": {Requests: 600, Window: time.Minute},
+				}},
+				"rest-write": {Limit: Limit{Requests: 30, Window: time.Minute}, Roles: map[string]Limit{
+					"admin": {Requests: 300, Window: time.Minute},
+				}},
+				"refresh": {Limit: Limit{Requests: 1, Window: 10 * time.Minute}, Roles: map[string]Limit{
+					"admin": {Requests: 10, Window: 10 * time.Minute},
+				}},
+			},
+		},
+	}
+}
+
+// Load reads the settings from, by increasing precedence, the defaults, the YAML file given by the -config flag
+// or the COVID_CONFIG variable, the environment and the flags in args. It returns the arguments left after the
+// flags, such as the name of a command.
+func Load(args []string) (Config, []string, error) {
+	flags, configPath, flagged := newFlagSet()
+	if err := flags.Parse(args); err != nil {
+		return Config{}, nil, err
+	}
+
+	cfg := Default()
+	if *configPath != "" {
+		if err := readFile(&cfg, *configPath); err != nil {
+			return Config{}, nil, err
+		}
+	}
+
+	for _, s := range settings {
+		value, ok := os.LookupEnv(s.env)
+		if !ok {
+			continue
+		}
+		if err := s.set(&cfg, value); err != nil {
+			return Config{}, nil, fmt.Errorf("invalid %s: %w", s.env, err)
+		}
+	}
+
+	for _, s := range settings {
+		value, ok := flagged[s.flag]
+		if !ok {
+			continue
+		}
+		if err := s.set(&cfg, value); err != nil {
+			return Config{}, nil, fmt.Errorf("invalid -%s: %w", s.flag, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, nil, err
+	}
+	return cfg, flags.Args(), nil
+}
+
+// readFile overrides the settings of cfg found in a YAML file, unknown settings are rejected to catch typos.
+func readFile(cfg *Config, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("error reading config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate returns every invalid setting at once.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port must be between 1 and 65535")
+	check(c.Server.RequestTimeout >= 0, "server.request_timeout must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	check(c.Server.Compression >= 0 && c.Server.Compression <= 9, "server.compression must be between 0 and 9")
+	check(c.Database.Path != "", "database.path must not be empty")
+	check(c.Database.ReadConnections > 0, "database.read_connections must be positive")
+	check(c.Database.BusyTimeout > 0, "database.busy_timeout must be positive")
+	check(c.Auth.JWTSecret != "", "auth.jwt_secret must not be empty")
+	check(c.Auth.TokenTTL > 0, "auth.token_ttl must be positive")
+	check(c.Auth.Password.MinLength > 0, "auth.password.min_length must be positive")
+	check(c.Auth.ResetTokenTTL > 0, "auth.reset_token_ttl must be positive")
+	check(c.Auth.VerificationTokenTTL > 0, "auth.verification_token_ttl must be positive")
+	check(!c.Auth.RequireVerifiedEmail || c.Mail.SMTPHost != "", "auth.require_verified_email needs mail.smtp_host")
+	check(c.Fetcher.Interval > 0, "fetcher.interval must be positive")
+	upstream, err := url.Parse(c.Fetcher.UpstreamURL)
+	check(err == nil && (upstream.Scheme == "http" || upstream.Scheme == "https") && upstream.Host != "",
+		"fetcher.upstream_url must be an http or https URL")
+	check(c.GraphQL.PageSize >= 0, "graphql.page_size must not be negative")
+	check(c.GraphQL.MaxQueryDepth >= 0, "graphql.max_query_depth must not be negative")
+	check(c.GraphQL.MaxQueryComplexity >= 0, "graphql.max_query_complexity must not be negative")
+	check(c.GraphQL.APQStore == "database" || c.GraphQL.APQStore == "memory", "graphql.apq_store must be database or memory")
+	check(c.GraphQL.APQMaxStored >= 0, "graphql.apq_max_stored must not be negative")
+	check(c.Analytics.SerialIntervalMean > 0 && c.Analytics.SerialIntervalMean <= 30, "analytics.serial_interval_mean must be between 0 and 30 days")
+	check(c.Analytics.SerialIntervalSD > 0 && c.Analytics.SerialIntervalSD <= 30, "analytics.serial_interval_sd must be between 0 and 30 days")
+	check(c.Analytics.RtWindowDays > 0, "analytics.rt_window_days must be positive")
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Log.Level)) == nil, "log.level must be debug, info, warn or error")
+	check(c.Log.Format == "text" || c.Log.Format == "json", "log.format must be text or json")
+	check(c.Cache.Size >= 0, "cache.size must not be negative")
+	check(c.Cache.TTL >= 0, "cache.ttl must not be negative")
+	check(c.Mail.SMTPPort > 0 && c.Mail.SMTPPort <= 65535, "mail.smtp_port must be between 1 and 65535")
+	check(c.Mail.SMTPHost == "" || c.Mail.From != "", "mail.from must be set to send emails")
+	for group, policy := range c.RateLimit.Groups {
+		check(slices.Contains(RateLimitGroups, group), "rate_limit.groups.%s is not a route group, one of %s", group, strings.Join(RateLimitGroups, ", "))
+		check(policy.Requests > 0 && policy.Window > 0, "rate_limit.groups.%s must allow requests over a positive window", group)
+		for role, limit := range policy.Roles {
+			check(slices.Contains(RateLimitRoles, role), "rate_limit.groups.%s.roles.%s is not a role, one of %s", group, role, strings.Join(RateLimitRoles, ", "))
+			check(limit.Requests > 0 && limit.Window > 0, "rate_limit.groups.%s.roles.%s must allow requests over a positive window", group, role)
+		}
+	}
+	if c.Mail.AppURL != "" {
+		app, err := url.Parse(c.Mail.AppURL)
+		check(err == nil && (app.Scheme == "http" || app.Scheme == "https") && app.Host != "",
+			"mail.app_url must be an http or https URL")
+	}
+
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy of the settings with the secrets hidden, to be printed or logged.
+func (c Config) Redacted() Config {
+	if c.Auth.JWTSecret != "" {
+		c.Auth.JWTSecret = "[redacted]"
+	}
+	if c.Mail.SMTPPassword != "" {
+		c.Mail.SMTPPassword = "[redacted]"
+	}
+	return c
+}
+
+// WriteYAML writes the settings in the format of the config file.
+func (c Config) WriteYAML(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
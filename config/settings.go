@@ -0,0 +1,189 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"strconv"
+	"time"
+)
+
+// setting is a value that can be set from the environment and from a flag.
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	set   func(c *Config, value string) error
+	// boolean settings can be given as a flag without value.
+	boolean bool
+}
+
+var settings = []setting{
+	intSetting("port", "PORT", "port the server listens on", func(c *Config) *int { return &c.Server.Port }),
+	durationSetting("request-timeout", "REQUEST_TIMEOUT", "time after which requests are cancelled, 0 for none",
+		func(c *Config) *time.Duration { return &c.Server.RequestTimeout }),
+	durationSetting("shutdown-timeout", "SHUTDOWN_TIMEOUT", "time given to requests and the fetcher to finish when stopping",
+		func(c *Config) *time.Duration { return &c.Server.ShutdownTimeout }),
+	intSetting("compression", "COMPRESSION", "gzip and brotli level of the responses, 0 disables compression",
+		func(c *Config) *int { return &c.Server.Compression }),
+	stringSetting("cache-control", "CACHE_CONTROL", "Cache-Control header of the REST reads, empty for none",
+		func(c *Config) *string { return &c.Server.CacheControl.Default }),
+	stringSetting("database-path", "DATABASE_PATH", "SQLite database file", func(c *Config) *string { return &c.Database.Path }),
+	intSetting("database-read-connections", "DATABASE_READ_CONNECTIONS", "connections serving database reads",
+		func(c *Config) *int { return &c.Database.ReadConnections }),
+	durationSetting("database-busy-timeout", "DATABASE_BUSY_TIMEOUT", "time a database statement waits for a lock",
+		func(c *Config) *time.Duration { return &c.Database.BusyTimeout }),
+	stringSetting("jwt-secret", "JWT_SECRET", "secret signing the tokens", func(c *Config) *string { return &c.Auth.JWTSecret }),
+	durationSetting("token-ttl", "TOKEN_TTL", "time a token stays valid", func(c *Config) *time.Duration { return &c.Auth.TokenTTL }),
+	intSetting("password-min-length", "PASSWORD_MIN_LENGTH", "minimum length of passwords",
+		func(c *Config) *int { return &c.Auth.Password.MinLength }),
+	boolSetting("password-require-lowercase", "PASSWORD_REQUIRE_LOWERCASE", "require a lowercase letter in passwords",
+		func(c *Config) *bool { return &c.Auth.Password.RequireLowercase }),
+	boolSetting("password-require-uppercase", "PASSWORD_REQUIRE_UPPERCASE", "require an uppercase letter in passwords",
+		func(c *Config) *bool { return &c.Auth.Password.RequireUppercase }),
+	boolSetting("password-require-digit", "PASSWORD_REQUIRE_DIGIT", "require a digit in passwords",
+		func(c *Config) *bool { return &c.Auth.Password.RequireDigit }),
+	boolSetting("password-require-special", "PASSWORD_REQUIRE_SPECIAL", "require one of @$!%*#?& in passwords",
+		func(c *Config) *bool { return &c.Auth.Password.RequireSpecial }),
+	durationSetting("reset-token-ttl", "RESET_TOKEN_TTL", "time a password reset token stays valid",
+		func(c *Config) *time.Duration { return &c.Auth.ResetTokenTTL }),
+	durationSetting("verification-token-ttl", "VERIFICATION_TOKEN_TTL", "time an email verification token stays valid",
+		func(c *Config) *time.Duration { return &c.Auth.VerificationTokenTTL }),
+	boolSetting("require-verified-email", "REQUIRE_VERIFIED_EMAIL", "refuse the requests of users without a verified email",
+		func(c *Config) *bool { return &c.Auth.RequireVerifiedEmail }),
+	stringSetting("admin-email", "ADMIN_EMAIL", "registered user made an admin when the server starts",
+		func(c *Config) *string { return &c.Auth.AdminEmail }),
+	durationSetting("fetch-interval", "FETCH_INTERVAL", "time between two fetches of the statistics",
+		func(c *Config) *time.Duration { return &c.Fetcher.Interval }),
+	stringSetting("upstream-url", "UPSTREAM_URL", "base URL of the API the statistics are fetched from",
+		func(c *Config) *string { return &c.Fetcher.UpstreamURL }),
+	intSetting("page-size", "PAGE_SIZE", "statistics returned with a country by GraphQL, 0 for all",
+		func(c *Config) *int { return &c.GraphQL.PageSize }),
+	intSetting("max-query-depth", "MAX_QUERY_DEPTH", "maximum depth of GraphQL operations, 0 for no limit",
+		func(c *Config) *int { return &c.GraphQL.MaxQueryDepth }),
+	intSetting("max-query-complexity", "MAX_QUERY_COMPLEXITY", "maximum complexity of GraphQL operations, 0 for no limit",
+		func(c *Config) *int { return &c.GraphQL.MaxQueryComplexity }),
+	boolSetting("persisted-queries-strict", "PERSISTED_QUERIES_STRICT", "only run the loaded persisted queries",
+		func(c *Config) *bool { return &c.GraphQL.PersistedQueriesStrict }),
+	stringSetting("apq-store", "APQ_STORE", "where automatic persisted queries are kept, database or memory",
+		func(c *Config) *string { return &c.GraphQL.APQStore }),
+	intSetting("apq-max-stored", "APQ_MAX_STORED", "queries registered by clients kept in the database, 0 for all",
+		func(c *Config) *int { return &c.GraphQL.APQMaxStored }),
+	boolSetting("rate-limit", "RATE_LIMIT", "limit the requests of every client per route group",
+		func(c *Config) *bool { return &c.RateLimit.Enabled }),
+	boolSetting("strict-data-quality", "STRICT_DATA_QUALITY", "reject the writes that break an error rule",
+		func(c *Config) *bool { return &c.Quality.Strict }),
+	floatSetting("serial-interval-mean", "SERIAL_INTERVAL_MEAN", "mean of the serial interval of Rt estimates, in days",
+		func(c *Config) *float64 { return &c.Analytics.SerialIntervalMean }),
+	floatSetting("serial-interval-sd", "SERIAL_INTERVAL_SD", "standard deviation of the serial interval, in days",
+		func(c *Config) *float64 { return &c.Analytics.SerialIntervalSD }),
+	intSetting("rt-window-days", "RT_WINDOW_DAYS", "days every Rt estimate is smoothed over",
+		func(c *Config) *int { return &c.Analytics.RtWindowDays }),
+	stringSetting("log-level", "LOG_LEVEL", "lowest level logged: debug, info, warn or error",
+		func(c *Config) *string { return &c.Log.Level }),
+	stringSetting("log-format", "LOG_FORMAT", "format of the logs, text or json", func(c *Config) *string { return &c.Log.Format }),
+	intSetting("cache-size", "CACHE_SIZE", "read results kept in memory, 0 disables the cache",
+		func(c *Config) *int { return &c.Cache.Size }),
+	durationSetting("cache-ttl", "CACHE_TTL", "time read results are cached for, 0 until the statistics change",
+		func(c *Config) *time.Duration { return &c.Cache.TTL }),
+	stringSetting("cache-path", "CACHE_PATH", "SQLite file the read results are kept in as well, none when empty",
+		func(c *Config) *string { return &c.Cache.Path }),
+	stringSetting("smtp-host", "SMTP_HOST", "SMTP server the emails are sent through, none are sent when empty",
+		func(c *Config) *string { return &c.Mail.SMTPHost }),
+	intSetting("smtp-port", "SMTP_PORT", "port of the SMTP server", func(c *Config) *int { return &c.Mail.SMTPPort }),
+	stringSetting("smtp-username", "SMTP_USERNAME", "username authenticating with the SMTP server, none when empty",
+		func(c *Config) *string { return &c.Mail.SMTPUsername }),
+	stringSetting("smtp-password", "SMTP_PASSWORD", "password authenticating with the SMTP server",
+		func(c *Config) *string { return &c.Mail.SMTPPassword }),
+	stringSetting("mail-from", "MAIL_FROM", "address the emails are sent from", func(c *Config) *string { return &c.Mail.From }),
+	stringSetting("app-url", "APP_URL", "address of the client the links of the emails lead to",
+		func(c *Config) *string { return &c.Mail.AppURL }),
+}
+
+// newFlagSet declares the -config flag and a flag for every setting. The values of the settings flags are
+// collected by name, to be applied over the file and the environment once they are read.
+func newFlagSet() (*flag.FlagSet, *string, map[string]string) {
+	flags := flag.NewFlagSet("covid", flag.ContinueOnError)
+	configPath := flags.String("config", os.Getenv("COVID_CONFIG"), "YAML config file, also read from COVID_CONFIG")
+
+	flagged := map[string]string{}
+	for _, s := range settings {
+		flags.Var(&settingFlag{setting: s, flagged: flagged}, s.flag, s.usage+", also read from "+s.env)
+	}
+	return flags, configPath, flagged
+}
+
+type settingFlag struct {
+	setting setting
+	flagged map[string]string
+}
+
+func (f *settingFlag) String() string {
+	if f == nil || f.flagged == nil {
+		return ""
+	}
+	return f.flagged[f.setting.flag]
+}
+
+func (f *settingFlag) Set(value string) error {
+	// checked on a scratch config so that invalid values are reported with the flag usage:
+	if err := f.setting.set(&Config{}, value); err != nil {
+		return err
+	}
+	f.flagged[f.setting.flag] = value
+	return nil
+}
+
+func (f *settingFlag) IsBoolFlag() bool {
+	return f.setting.boolean
+}
+
+func stringSetting(flag string, env string, usage string, field func(c *Config) *string) setting {
+	return setting{flag: flag, env: env, usage: usage, set: func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}}
+}
+
+func intSetting(flag string, env string, usage string, field func(c *Config) *int) setting {
+	return setting{flag: flag, env: env, usage: usage, set: func(c *Config, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}}
+}
+
+func floatSetting(flag string, env string, usage string, field func(c *Config) *float64) setting {
+	return setting{flag: flag, env: env, usage: usage, set: func(c *Config, value string) error {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = f
+		return nil
+	}}
+}
+
+func boolSetting(flag string, env string, usage string, field func(c *Config) *bool) setting {
+	return setting{flag: flag, env: env, usage: usage, boolean: true, set: func(c *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = b
+		return nil
+	}}
+}
+
+func durationSetting(flag string, env string, usage string, field func(c *Config) *time.Duration) setting {
+	return setting{flag: flag, env: env, usage: usage, set: func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = d
+		return nil
+	}}
+}
@@ -1,32 +1,54 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 )
 
-func (d *DB) DeleteCovidStatistic(id int) error {
+func (d *DB) DeleteCovidStatistic(ctx context.Context, id int) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var countryID int
+	err = tx.QueryRowContext(ctx, "SELECT country_id FROM covid_statistics WHERE id = ?", id).Scan(&countryID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("covid stat %w", ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("could not get covid statistic: %w", err)
+	}
+
 	deleteCovidStatistic := "DELETE FROM covid_statistics WHERE id = ?"
-	result, err := d.db.Exec(deleteCovidStatistic, id)
+	_, err = tx.ExecContext(ctx, deleteCovidStatistic, id)
 	if err != nil {
 		return fmt.Errorf("could not delete covid statistic: %w", err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	err = refreshCountryLatestStats(ctx, tx, countryID)
 	if err != nil {
-		return fmt.Errorf("no covid stats were affected: %s", err)
+		return err
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("covid stat not found")
+	err = touchCountry(ctx, tx, countryID)
+	if err != nil {
+		return err
 	}
 
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	d.invalidate(ctx, countryID)
 	return nil
-
 }
 
-func (d *DB) DeleteCountry(countryID int) error {
+func (d *DB) DeleteCountry(ctx context.Context, countryID int) error {
 	deleteCountry := "DELETE FROM countries WHERE id = ?"
-	result, err := d.db.Exec(deleteCountry, countryID)
+	result, err := d.db.ExecContext(ctx, deleteCountry, countryID)
 	if err != nil {
 		return fmt.Errorf("could not delete country: %w", err)
 	}
@@ -37,15 +59,17 @@ func (d *DB) DeleteCountry(countryID int) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("country not found")
+		return fmt.Errorf("country %w", ErrNotFound)
 	}
+	// its statistics are deleted with it:
+	d.invalidate(ctx, countryID)
 
 	return nil
 }
 
-func (d *DB) DeleteUser(id int) error {
+func (d *DB) DeleteUser(ctx context.Context, id int) error {
 	deleteUserQuery := "DELETE FROM users WHERE id = ?"
-	res, err := d.db.Exec(deleteUserQuery, id)
+	res, err := d.db.ExecContext(ctx, deleteUserQuery, id)
 	if err != nil {
 		return fmt.Errorf("failed to execute delete query: %w", err)
 	}
@@ -56,17 +80,17 @@ func (d *DB) DeleteUser(id int) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("user with ID %d not found", id)
+		return fmt.Errorf("user with ID %d %w", id, ErrNotFound)
 	}
 
 	return nil
 }
 
-func (d *DB) RemoveUserMonitoredCountry(userID int, countryID int) error {
+func (d *DB) RemoveUserMonitoredCountry(ctx context.Context, userID int, countryID int) error {
 	removeUserMonitoredCountryQuery := `
 		DELETE FROM user_monitored_countries
 		WHERE user_id = ? AND country_id = ?;`
-	result, err := d.db.Exec(removeUserMonitoredCountryQuery, userID, countryID)
+	result, err := d.db.ExecContext(ctx, removeUserMonitoredCountryQuery, userID, countryID)
 	if err != nil {
 		return fmt.Errorf("error removing user monitored country from database: %w", err)
 	}
@@ -77,7 +101,40 @@ func (d *DB) RemoveUserMonitoredCountry(userID int, countryID int) error {
 	}
 
 	if affectedRows == 0 {
-		return fmt.Errorf("no rows were affected by the delete statement")
+		return fmt.Errorf("monitored country %w", ErrNotFound)
+	}
+	return nil
+}
+
+func (d *DB) DeleteCountryGroup(ctx context.Context, id int) error {
+	if err := d.checkCustomCountryGroup(ctx, id); err != nil {
+		return err
+	}
+
+	_, err := d.db.ExecContext(ctx, "DELETE FROM country_groups WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("could not delete country group: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) RemoveCountryGroupMember(ctx context.Context, groupID int, countryID int) error {
+	if err := d.checkCustomCountryGroup(ctx, groupID); err != nil {
+		return err
+	}
+
+	result, err := d.db.ExecContext(ctx, "DELETE FROM country_group_members WHERE group_id = ? AND country_id = ?", groupID, countryID)
+	if err != nil {
+		return fmt.Errorf("could not remove country from group: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("group member %w", ErrNotFound)
 	}
 	return nil
 }
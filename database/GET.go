@@ -1,29 +1,30 @@
 package database
 
 import (
+	"context"
 	"database/sql"
-	"encoding/base64"
 	"errors"
 	"fmt"
+	"log/slog"
 	"strings"
 )
 
-func (d *DB) GetUserByID(id int) (User, error) {
+func (d *DB) GetUserByID(ctx context.Context, id int) (User, error) {
 	user := User{}
-	getUserQuery := "SELECT id, username, email, password FROM users WHERE id = ?"
-	row := d.db.QueryRow(getUserQuery, id)
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password)
+	getUserQuery := "SELECT id, username, email, password, role, email_verified, token_version FROM users WHERE id = ?"
+	row := d.queryRow(ctx, getUserQuery, id)
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Role, &user.EmailVerified, &user.TokenVersion)
 	if err != nil {
 		return user, fmt.Errorf("could not get user: %w", err)
 	}
 	return user, nil
 }
 
-func (d *DB) GetUserByUsername(username string) (User, error) {
+func (d *DB) GetUserByUsername(ctx context.Context, username string) (User, error) {
 	user := User{}
-	getUserQuery := "SELECT id, username, email, password, salt FROM users WHERE username = ?"
-	row := d.db.QueryRow(getUserQuery, username)
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Salt)
+	getUserQuery := "SELECT id, username, email, password, salt, role, email_verified, token_version FROM users WHERE username = ?"
+	row := d.queryRow(ctx, getUserQuery, username)
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Salt, &user.Role, &user.EmailVerified, &user.TokenVersion)
 	if err != nil {
 		return user, fmt.Errorf("could not get user: %w", err)
 	}
@@ -31,21 +32,21 @@ func (d *DB) GetUserByUsername(username string) (User, error) {
 }
 
 // get user by email:
-func (d *DB) GetUserByEmail(email string) (User, error) {
+func (d *DB) GetUserByEmail(ctx context.Context, email string) (User, error) {
 	user := User{}
-	getUserQuery := "SELECT id, username, email, password, salt FROM users WHERE email = ?"
-	row := d.db.QueryRow(getUserQuery, email)
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Salt)
+	getUserQuery := "SELECT id, username, email, password, salt, role, email_verified, token_version FROM users WHERE email = ?"
+	row := d.queryRow(ctx, getUserQuery, email)
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Salt, &user.Role, &user.EmailVerified, &user.TokenVersion)
 	if err != nil {
 		return user, fmt.Errorf("could not get user: %w", err)
 	}
 	return user, nil
 }
 
-func (d *DB) CheckIfUserExists(username string) error {
+func (d *DB) CheckIfUserExists(ctx context.Context, username string) error {
 	var count int
 	countUsers := "SELECT COUNT(*) FROM users WHERE username = ?"
-	row := d.db.QueryRow(countUsers, username)
+	row := d.queryRow(ctx, countUsers, username)
 	err := row.Scan(&count)
 	if err != nil {
 		return fmt.Errorf("error while scanning number of users: %w", err)
@@ -56,10 +57,10 @@ func (d *DB) CheckIfUserExists(username string) error {
 	return nil
 }
 
-func (d *DB) CheckIfEmailExists(email string) error {
+func (d *DB) CheckIfEmailExists(ctx context.Context, email string) error {
 	var count int
 	countUsersEmails := "SELECT COUNT(*) FROM users WHERE email = ?"
-	row := d.db.QueryRow(countUsersEmails, email)
+	row := d.queryRow(ctx, countUsersEmails, email)
 	err := row.Scan(&count)
 	if err != nil {
 		return fmt.Errorf("error while scanning number of users: %w", err)
@@ -72,10 +73,10 @@ func (d *DB) CheckIfEmailExists(email string) error {
 }
 
 // get one sinle covid statistic
-func (d *DB) GetCovidStatistic(id int) (CovidStatistic, error) {
+func (d *DB) GetCovidStatistic(ctx context.Context, id int) (CovidStatistic, error) {
 	covidStatistic := CovidStatistic{}
 	getCovidStatisticQuery := "SELECT id, country_id, date, confirmed, recovered, deaths FROM covid_statistics WHERE id = ?"
-	row := d.db.QueryRow(getCovidStatisticQuery, id)
+	row := d.queryRow(ctx, getCovidStatisticQuery, id)
 	err := row.Scan(&covidStatistic.ID, &covidStatistic.CountryID, &covidStatistic.Date, &covidStatistic.Confirmed, &covidStatistic.Recovered, &covidStatistic.Deaths)
 	if err != nil {
 		return covidStatistic, fmt.Errorf("could not get covid statistic: %w", err)
@@ -88,15 +89,36 @@ type covidStatisticsQuery struct {
 	args     []any
 }
 
-func (d *DB) GetCovidStatistics(countryID int, first *int, after *string) ([]CovidStatistic, error) {
-	covidStatsQuery, err := buildCovidStatisticsQuery(countryID, after, first)
+// GetCovidStatistics returns every statistic of a country, ordered by id.
+func (d *DB) GetCovidStatistics(ctx context.Context, countryID int) ([]CovidStatistic, error) {
+	covidStatistics, _, err := d.ListCovidStatistics(ctx, CovidStatisticFilter{CountryID: countryID})
+	return covidStatistics, err
+}
+
+// covidStatisticsPage is a page of ListCovidStatistics, cached as a whole.
+type covidStatisticsPage struct {
+	CovidStatistics []CovidStatistic
+	Next            *string
+}
+
+// ListCovidStatistics returns a page of statistics, and the cursor of the next page when there is one.
+func (d *DB) ListCovidStatistics(ctx context.Context, filter CovidStatisticFilter) ([]CovidStatistic, *string, error) {
+	page, err := cachedRead(ctx, d, "ListCovidStatistics", filter, []int{filter.CountryID}, func() (covidStatisticsPage, error) {
+		covidStatistics, next, err := d.listCovidStatistics(ctx, filter)
+		return covidStatisticsPage{CovidStatistics: covidStatistics, Next: next}, err
+	})
+	return page.CovidStatistics, page.Next, err
+}
+
+func (d *DB) listCovidStatistics(ctx context.Context, filter CovidStatisticFilter) ([]CovidStatistic, *string, error) {
+	covidStatsQuery, err := buildCovidStatisticsQuery(filter)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	rows, err := d.db.Query(covidStatsQuery.sqlQuery, covidStatsQuery.args...)
+	rows, err := d.query(ctx, covidStatsQuery.sqlQuery, covidStatsQuery.args...)
 	if err != nil {
-		return nil, fmt.Errorf("could not get covid statistics for country: %w", err)
+		return nil, nil, fmt.Errorf("could not get covid statistics for country: %w", err)
 	}
 	defer rows.Close()
 
@@ -104,47 +126,121 @@ func (d *DB) GetCovidStatistics(countryID int, first *int, after *string) ([]Cov
 	for rows.Next() {
 		err := mapCovidStatisticsAndCountryFromRows(rows, &covidStatistics)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 
 	err = rows.Err()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return covidStatistics, nil
+	ids := make([]int, len(covidStatistics))
+	for i := range covidStatistics {
+		ids[i] = covidStatistics[i].ID
+	}
+	n, next := nextCursor(ids, filter.First)
+
+	return covidStatistics[:n], next, nil
 }
 
-func buildCovidStatisticsQuery(countryID int, after *string, first *int) (covidStatisticsQuery, error) {
+func buildCovidStatisticsQuery(filter CovidStatisticFilter) (covidStatisticsQuery, error) {
 	query := covidStatisticsQuery{
 		sqlQuery: `
 			SELECT cs.id, cs.date, cs.confirmed, cs.deaths, cs.recovered, c.id, c.name, c.code
 			FROM covid_statistics cs
 			JOIN countries c ON c.id = cs.country_id
 			WHERE c.id = ?`,
-		args: []any{countryID},
+		args: []any{filter.CountryID},
 	}
 
-	// add pagination:
-	if after != nil {
-		cursor, err := base64.StdEncoding.DecodeString(*after)
-		if err != nil {
-			return query, err
-		}
-		query.sqlQuery += " AND cs.id > ?"
-		query.args = append(query.args, string(cursor))
+	// add date range:
+	if filter.DateFrom != nil {
+		query.sqlQuery += " AND date(cs.date) >= ?"
+		query.args = append(query.args, *filter.DateFrom)
+	}
+	if filter.DateTo != nil {
+		query.sqlQuery += " AND date(cs.date) <= ?"
+		query.args = append(query.args, *filter.DateTo)
 	}
 
-	//get one mroe record to check if there is a next page later:
-	if first != nil {
+	// add sorting and pagination:
+	orderBy, after, afterArgs, err := keyset("covid_statistics", "cs.", filter.SortBy, filter.SortOrder, CovidStatisticSortFields, filter.After)
+	if err != nil {
+		return query, err
+	}
+	if after != "" {
+		query.sqlQuery += " AND " + after
+		query.args = append(query.args, afterArgs...)
+	}
+	query.sqlQuery += orderBy
+
+	//get one more record to check if there is a next page later:
+	if filter.First != nil {
+		if *filter.First < 0 {
+			return query, fmt.Errorf("%w: first must not be negative", ErrInvalidFilter)
+		}
 		query.sqlQuery += " LIMIT ?"
-		query.args = append(query.args, *first+1)
+		query.args = append(query.args, *filter.First+1)
 	}
 
 	return query, nil
 }
 
+// StreamCovidStatistics calls fn with the statistics of the given countries, or of every country when countryIDs
+// is empty, ordered by country and date. Rows are read one at a time so that exports never hold them all in memory.
+// Streaming stops at the first error returned by fn.
+func (d *DB) StreamCovidStatistics(ctx context.Context, countryIDs []int, dateFrom *string, dateTo *string, fn func(CovidStatistic) error) error {
+	streamQuery := `
+		SELECT cs.id, cs.date, cs.confirmed, cs.deaths, cs.recovered, c.id, c.name, c.code
+		FROM covid_statistics cs
+		JOIN countries c ON c.id = cs.country_id`
+	var conditions []string
+	var args []any
+
+	if len(countryIDs) > 0 {
+		conditions = append(conditions, "c.id IN (?"+strings.Repeat(", ?", len(countryIDs)-1)+")")
+		for _, countryID := range countryIDs {
+			args = append(args, countryID)
+		}
+	}
+	if dateFrom != nil {
+		conditions = append(conditions, "date(cs.date) >= ?")
+		args = append(args, *dateFrom)
+	}
+	if dateTo != nil {
+		conditions = append(conditions, "date(cs.date) <= ?")
+		args = append(args, *dateTo)
+	}
+	if len(conditions) > 0 {
+		streamQuery += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	streamQuery += " ORDER BY c.id, date(cs.date), cs.id"
+
+	rows, err := d.read.QueryContext(ctx, streamQuery, args...)
+	if err != nil {
+		return fmt.Errorf("could not stream covid statistics: %w", err)
+	}
+	defer rows.Close()
+
+	// the slice is reused, it never holds more than one row:
+	covidStatistics := make([]CovidStatistic, 0, 1)
+	for rows.Next() {
+		covidStatistics = covidStatistics[:0]
+		if err := mapCovidStatisticsAndCountryFromRows(rows, &covidStatistics); err != nil {
+			return err
+		}
+		if err := fn(covidStatistics[0]); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error with rows: %w", err)
+	}
+	return nil
+}
+
 func mapCovidStatisticsAndCountryFromRows(rows *sql.Rows, covidStatistics *[]CovidStatistic) error {
 	covidStatistic := CovidStatistic{}
 	country := Country{}
@@ -159,45 +255,52 @@ func mapCovidStatisticsAndCountryFromRows(rows *sql.Rows, covidStatistics *[]Cov
 	}
 	covidStatistic.Date = covidStatistic.Date[:10]
 
+	covidStatistic.CountryID = country.ID
 	covidStatistic.Country = country
 	*covidStatistics = append(*covidStatistics, covidStatistic)
 	return nil
 }
 
 // get a speicific country by its id:
-func (d *DB) GetCountryByID(id int) (Country, error) {
+func (d *DB) GetCountryByID(ctx context.Context, id int) (Country, error) {
+	return cachedRead(ctx, d, "GetCountryByID", id, []int{id}, func() (Country, error) {
+		return d.getCountryByID(ctx, id)
+	})
+}
+
+func (d *DB) getCountryByID(ctx context.Context, id int) (Country, error) {
 	country := Country{}
 	getCountryQuery := "SELECT id, name, code FROM countries WHERE id = ?"
-	row := d.db.QueryRow(getCountryQuery, id)
+	row := d.queryRow(ctx, getCountryQuery, id)
+	if err := row.Scan(&country.ID, &country.Name, &country.Code); err != nil {
+		return country, fmt.Errorf("could not scan country row: %w", err)
+	}
 
-	CovidStatistic, err := d.GetCovidStatistics(id, nil, nil)
+	CovidStatistic, _, err := d.listCovidStatistics(ctx, CovidStatisticFilter{CountryID: id})
 	if err != nil {
 		return country, fmt.Errorf("could not get covid statistics for country: %s", err)
 	}
 	country.CovidStatistics = CovidStatistic
-	if row.Scan(&country.ID, &country.Name, &country.Code) != nil {
-		return country, fmt.Errorf("could not scan country row: %w", err)
-	}
 	return country, nil
 }
 
-func (d *DB) GetCountryIDByCovidStatisticID(covidStatisticID int) (int, error) {
+func (d *DB) GetCountryIDByCovidStatisticID(ctx context.Context, covidStatisticID int) (int, error) {
 	getCountryIDQuery := "SELECT country_id FROM covid_statistics WHERE id = ?"
 	var countryID int
-	err := d.db.QueryRow(getCountryIDQuery, covidStatisticID).Scan(&countryID)
+	err := d.queryRow(ctx, getCountryIDQuery, covidStatisticID).Scan(&countryID)
 	if err != nil {
 		return 0, fmt.Errorf("error getting country ID for covid statistic with ID %d: %w", covidStatisticID, err)
 	}
 	return countryID, nil
 }
 
-func (d *DB) GetUserMonitoredCountries(userID int) ([]Country, error) {
+func (d *DB) GetUserMonitoredCountries(ctx context.Context, userID int) ([]Country, error) {
 	getMonitoredCountriesQuery := `
 		SELECT c.id, c.name, c.code
 		FROM user_monitored_countries umc
 		JOIN countries c ON c.id = umc.country_id
 		WHERE umc.user_id = ?`
-	rows, err := d.db.Query(getMonitoredCountriesQuery, userID)
+	rows, err := d.query(ctx, getMonitoredCountriesQuery, userID)
 	if err != nil {
 		return nil, fmt.Errorf("could not get monitored countries: %w", err)
 	}
@@ -224,14 +327,15 @@ type countriesQuery struct {
 	args     []any
 }
 
-func (d *DB) GetCountries(first *int, after *string, CodeEquals *string, nameContains *string) ([]Country, error) {
-	countriesQuery, err := buildCountriesQuery(after, first, CodeEquals, nameContains)
+// GetCountries returns a page of countries, and the cursor of the next page when there is one.
+func (d *DB) GetCountries(ctx context.Context, filter CountryFilter) ([]Country, *string, error) {
+	countriesQuery, err := buildCountriesQuery(filter)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	rows, err := d.db.Query(countriesQuery.sqlQuery, countriesQuery.args...)
+	rows, err := d.query(ctx, countriesQuery.sqlQuery, countriesQuery.args...)
 	if err != nil {
-		return nil, fmt.Errorf("could not get countries: %w", err)
+		return nil, nil, fmt.Errorf("could not get countries: %w", err)
 	}
 	defer rows.Close()
 
@@ -239,19 +343,25 @@ func (d *DB) GetCountries(first *int, after *string, CodeEquals *string, nameCon
 	for rows.Next() {
 		err := mapCountryFromRows(rows, &countries)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 
 	err = rows.Err()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return countries, nil
+	ids := make([]int, len(countries))
+	for i := range countries {
+		ids[i] = countries[i].ID
+	}
+	n, next := nextCursor(ids, filter.First)
+
+	return countries[:n], next, nil
 }
 
-func buildCountriesQuery(after *string, first *int, CodeEquals *string, nameContains *string) (countriesQuery, error) {
+func buildCountriesQuery(filter CountryFilter) (countriesQuery, error) {
 	query := countriesQuery{
 		sqlQuery: `
 			SELECT id, name, code
@@ -260,35 +370,39 @@ func buildCountriesQuery(after *string, first *int, CodeEquals *string, nameCont
 	var conditions []string
 
 	// Add code equals condition:
-	if CodeEquals != nil {
+	if filter.CodeEquals != nil {
 		conditions = append(conditions, "code = ?")
-		query.args = append(query.args, *CodeEquals)
+		query.args = append(query.args, *filter.CodeEquals)
 	}
 
 	// Add name contains condition:
-	if nameContains != nil {
+	if filter.NameContains != nil {
 		conditions = append(conditions, "name LIKE ?")
-		query.args = append(query.args, "%"+*nameContains+"%")
+		query.args = append(query.args, "%"+*filter.NameContains+"%")
 	}
 
-	// Add pagination:
-	if after != nil {
-		cursor, err := base64.StdEncoding.DecodeString(*after)
-		if err != nil {
-			return query, err
-		}
-		conditions = append(conditions, "id > ?")
-		query.args = append(query.args, string(cursor))
+	// Add sorting and pagination:
+	orderBy, after, afterArgs, err := keyset("countries", "", filter.SortBy, filter.SortOrder, CountrySortFields, filter.After)
+	if err != nil {
+		return query, err
+	}
+	if after != "" {
+		conditions = append(conditions, after)
+		query.args = append(query.args, afterArgs...)
 	}
 
 	if len(conditions) > 0 {
 		query.sqlQuery += " WHERE " + strings.Join(conditions, " AND ")
 	}
+	query.sqlQuery += orderBy
 
 	// Get one more record to check if there is a next page later:
-	if first != nil {
+	if filter.First != nil {
+		if *filter.First < 0 {
+			return query, fmt.Errorf("%w: first must not be negative", ErrInvalidFilter)
+		}
 		query.sqlQuery += " LIMIT ?"
-		query.args = append(query.args, *first+1)
+		query.args = append(query.args, *filter.First+1)
 	}
 
 	return query, nil
@@ -304,27 +418,33 @@ func mapCountryFromRows(rows *sql.Rows, countries *[]Country) error {
 	return nil
 }
 
-// get percentage of deaths in a country:
-func (d *DB) GetDeathPercentage(countryID int) (float64, error) {
-	//case the Sum of deaths to a real number instead of an integer.
+// get percentage of deaths in a country, from its latest cumulative values:
+func (d *DB) GetDeathPercentage(ctx context.Context, countryID int) (float64, error) {
+	return cachedRead(ctx, d, "GetDeathPercentage", countryID, []int{countryID}, func() (float64, error) {
+		return d.getDeathPercentage(ctx, countryID)
+	})
+}
+
+func (d *DB) getDeathPercentage(ctx context.Context, countryID int) (float64, error) {
+	//case the deaths to a real number instead of an integer.
 	// Cause Otherwise the result will be 0 cause the division of two integers is an integer.
 	getDeathPercentageQuery := `
-		SELECT SUM(deaths) * 1.0 / SUM(confirmed) * 100
-		FROM covid_statistics
+		SELECT deaths * 1.0 / confirmed * 100
+		FROM country_latest_stats
 		WHERE country_id = ?`
 	var deathPercentage float64
-	err := d.db.QueryRow(getDeathPercentageQuery, countryID).Scan(&deathPercentage)
+	err := d.queryRow(ctx, getDeathPercentageQuery, countryID).Scan(&deathPercentage)
 	if err != nil {
 		return 0, fmt.Errorf("could not get death percentage: %w", err)
 	}
 
-	fmt.Println("Death percentage:", deathPercentage)
+	slog.DebugContext(ctx, "death percentage", "country_id", countryID, "death_percentage", deathPercentage)
 	return deathPercentage, nil
 }
 
-func (d *DB) GetTopCountriesByCaseTypeForUser(userID int, caseType string, limit int) ([]Country, error) {
+func (d *DB) GetTopCountriesByCaseTypeForUser(ctx context.Context, userID int, caseType string, limit int) ([]Country, error) {
 	getTopCountriesByCaseTypeForUserQuery := buildTopCountriesByCaseTypeForUserQuery(userID, caseType, limit)
-	rows, err := d.db.Query(getTopCountriesByCaseTypeForUserQuery, userID, limit)
+	rows, err := d.query(ctx, getTopCountriesByCaseTypeForUserQuery, userID, limit)
 	if err != nil {
 		return nil, fmt.Errorf("could not get top countries by case type for user: %w", err)
 	}
@@ -349,13 +469,8 @@ func (d *DB) GetTopCountriesByCaseTypeForUser(userID int, caseType string, limit
 func buildTopCountriesByCaseTypeForUserQuery(userID int, caseType string, limit int) string {
 	getTopCountriesByCaseTypeForUserQuery := `
 		SELECT c.id, c.name, c.code
-		FROM covid_statistics cs
+		FROM country_latest_stats cs
 		JOIN countries c ON c.id = cs.country_id
-		JOIN (
-			SELECT country_id, MAX(date) as latest_date
-			FROM covid_statistics
-			GROUP BY country_id
-		) latest_stats ON cs.country_id = latest_stats.country_id AND cs.date = latest_stats.latest_date
 		WHERE cs.country_id IN (
 			SELECT country_id
 			FROM user_monitored_countries
@@ -367,14 +482,94 @@ func buildTopCountriesByCaseTypeForUserQuery(userID int, caseType string, limit
 	return getTopCountriesByCaseTypeForUserQuery
 }
 
-func (d *DB) GetLatestCovidStatisticsByCountryID(countryID int) (CovidStatistic, error) {
+// latestCovidStatisticsQuery numbers the statistics matching conditions of every country from the most recent
+// one, so that the latest statistics are read in a single pass over the country_id and date index.
+func latestCovidStatisticsQuery(conditions []string) string {
+	query := `
+		SELECT id, country_id, date, confirmed, recovered, deaths,
+			ROW_NUMBER() OVER (PARTITION BY country_id ORDER BY date(date) DESC, id DESC) AS row_number
+		FROM covid_statistics`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	return query
+}
+
+// GetLatestCovidStatistics returns the last statistic of the given countries on or before asOf, of every
+// country when countryIDs is empty and up to the last one when asOf is nil. Countries without statistics
+// by then are left out.
+func (d *DB) GetLatestCovidStatistics(ctx context.Context, asOf *string, countryIDs []int) ([]LatestCovidStatistic, error) {
+	args := struct {
+		AsOf       *string
+		CountryIDs []int
+	}{asOf, countryIDs}
+	// the latest statistics of every country change with any of them:
+	var dependencies []int
+	if len(countryIDs) > 0 {
+		dependencies = countryIDs
+	}
+	return cachedRead(ctx, d, "GetLatestCovidStatistics", args, dependencies, func() ([]LatestCovidStatistic, error) {
+		return d.getLatestCovidStatistics(ctx, asOf, countryIDs)
+	})
+}
+
+func (d *DB) getLatestCovidStatistics(ctx context.Context, asOf *string, countryIDs []int) ([]LatestCovidStatistic, error) {
+	var conditions []string
+	var args []any
+	if asOf != nil {
+		conditions = append(conditions, "date(date) <= ?")
+		args = append(args, *asOf)
+	}
+	if len(countryIDs) > 0 {
+		conditions = append(conditions, "country_id IN (?"+strings.Repeat(", ?", len(countryIDs)-1)+")")
+		for _, countryID := range countryIDs {
+			args = append(args, countryID)
+		}
+	}
+	getLatestCovidStatisticsQuery := `
+		SELECT c.id, c.name, c.code, cs.id, cs.date, cs.confirmed, cs.recovered, cs.deaths, cs.row_number
+		FROM (` + latestCovidStatisticsQuery(conditions) + `) cs
+		JOIN countries c ON c.id = cs.country_id
+		WHERE cs.row_number <= 2
+		ORDER BY c.id, cs.row_number`
+	rows, err := d.read.QueryContext(ctx, getLatestCovidStatisticsQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not get latest covid statistics: %w", err)
+	}
+	defer rows.Close()
+
+	latest := []LatestCovidStatistic{}
+	for rows.Next() {
+		var country Country
+		var covidStatistic CovidStatistic
+		var rowNumber int
+		err := rows.Scan(&country.ID, &country.Name, &country.Code, &covidStatistic.ID, &covidStatistic.Date,
+			&covidStatistic.Confirmed, &covidStatistic.Recovered, &covidStatistic.Deaths, &rowNumber)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan latest covid statistic: %w", err)
+		}
+		covidStatistic.CountryID = country.ID
+		covidStatistic.Country = country
+
+		if rowNumber == 1 {
+			latest = append(latest, LatestCovidStatistic{Country: country, Latest: covidStatistic})
+		} else {
+			latest[len(latest)-1].Previous = &covidStatistic
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error with rows: %w", err)
+	}
+	return latest, nil
+}
+
+func (d *DB) GetLatestCovidStatisticsByCountryID(ctx context.Context, countryID int) (CovidStatistic, error) {
 	getLatestCovidStatisticsByCountryIDQuery := `
-		SELECT id, country_id, confirmed, deaths, recovered, date
-		FROM covid_statistics
-		WHERE country_id = ?
-		ORDER BY date DESC
-		LIMIT 1`
-	row := d.db.QueryRow(getLatestCovidStatisticsByCountryIDQuery, countryID)
+		SELECT covid_statistic_id, country_id, confirmed, deaths, recovered, date
+		FROM country_latest_stats
+		WHERE country_id = ?`
+	row := d.queryRow(ctx, getLatestCovidStatisticsByCountryIDQuery, countryID)
 	covidStatistics := CovidStatistic{}
 	err := row.Scan(&covidStatistics.ID, &covidStatistics.CountryID, &covidStatistics.Confirmed, &covidStatistics.Deaths, &covidStatistics.Recovered, &covidStatistics.Date)
 	if err != nil {
@@ -383,7 +578,92 @@ func (d *DB) GetLatestCovidStatisticsByCountryID(countryID int) (CovidStatistic,
 	return covidStatistics, nil
 }
 
-func (d *DB) CheckCovidStatisticExists(countryID int, date string) (bool, error) {
+const countryLatestStatisticsColumns = `
+		country_id, covid_statistic_id, date, confirmed, recovered, deaths,
+		confirmed_1d, recovered_1d, deaths_1d, confirmed_7d, recovered_7d, deaths_7d, updated_at`
+
+// GetCountryLatestStatistics returns the summary of the latest statistic of a country, sql.ErrNoRows is wrapped
+// when the country has no statistics.
+func (d *DB) GetCountryLatestStatistics(ctx context.Context, countryID int) (CountryLatestStatistics, error) {
+	return cachedRead(ctx, d, "GetCountryLatestStatistics", countryID, []int{countryID}, func() (CountryLatestStatistics, error) {
+		return d.getCountryLatestStatistics(ctx, countryID)
+	})
+}
+
+func (d *DB) getCountryLatestStatistics(ctx context.Context, countryID int) (CountryLatestStatistics, error) {
+	getCountryLatestStatisticsQuery := `
+		SELECT` + countryLatestStatisticsColumns + `
+		FROM country_latest_stats
+		WHERE country_id = ?`
+	latest, err := scanCountryLatestStatistics(d.queryRow(ctx, getCountryLatestStatisticsQuery, countryID))
+	if err != nil {
+		return latest, fmt.Errorf("could not get latest statistics of country: %w", err)
+	}
+	return latest, nil
+}
+
+// ListCountryLatestStatistics returns the latest statistics of every country with statistics, by country ID.
+func (d *DB) ListCountryLatestStatistics(ctx context.Context) ([]CountryLatestStatistics, error) {
+	return cachedRead(ctx, d, "ListCountryLatestStatistics", nil, nil, func() ([]CountryLatestStatistics, error) {
+		return d.listCountryLatestStatistics(ctx)
+	})
+}
+
+func (d *DB) listCountryLatestStatistics(ctx context.Context) ([]CountryLatestStatistics, error) {
+	listCountryLatestStatisticsQuery := `
+		SELECT` + countryLatestStatisticsColumns + `
+		FROM country_latest_stats
+		ORDER BY country_id`
+	rows, err := d.query(ctx, listCountryLatestStatisticsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("could not list latest statistics of countries: %w", err)
+	}
+	defer rows.Close()
+
+	var latestStatistics []CountryLatestStatistics
+	for rows.Next() {
+		latest, err := scanCountryLatestStatistics(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not list latest statistics of countries: %w", err)
+		}
+		latestStatistics = append(latestStatistics, latest)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not list latest statistics of countries: %w", err)
+	}
+	return latestStatistics, nil
+}
+
+// scanCountryLatestStatistics reads a row of countryLatestStatisticsColumns.
+func scanCountryLatestStatistics(row interface{ Scan(dest ...any) error }) (CountryLatestStatistics, error) {
+	var latest CountryLatestStatistics
+	var change1Day, change7Days [3]sql.NullInt64
+	err := row.Scan(
+		&latest.CountryID, &latest.CovidStatisticID, &latest.Date, &latest.Confirmed, &latest.Recovered, &latest.Deaths,
+		&change1Day[0], &change1Day[1], &change1Day[2], &change7Days[0], &change7Days[1], &change7Days[2], &latest.UpdatedAt,
+	)
+	if err != nil {
+		return latest, err
+	}
+
+	latest.Change1Day = statisticChange(change1Day)
+	latest.Change7Days = statisticChange(change7Days)
+	return latest, nil
+}
+
+// statisticChange returns nil when there was no statistic to compare to, the columns of a change are then all NULL.
+func statisticChange(columns [3]sql.NullInt64) *StatisticChange {
+	if !columns[0].Valid {
+		return nil
+	}
+	return &StatisticChange{
+		Confirmed: int(columns[0].Int64),
+		Recovered: int(columns[1].Int64),
+		Deaths:    int(columns[2].Int64),
+	}
+}
+
+func (d *DB) CheckCovidStatisticExists(ctx context.Context, countryID int, date string) (bool, error) {
 	checkCovidStatisticExistsQuery := `
 		SELECT EXISTS (
 			SELECT 1
@@ -391,9 +671,229 @@ func (d *DB) CheckCovidStatisticExists(countryID int, date string) (bool, error)
 			WHERE country_id = ? AND date = ?
 		)`
 	var exists bool
-	err := d.db.QueryRow(checkCovidStatisticExistsQuery, countryID, date).Scan(&exists)
+	err := d.queryRow(ctx, checkCovidStatisticExistsQuery, countryID, date).Scan(&exists)
 	if err != nil {
 		return false, fmt.Errorf("could not check covid statistic exists: %w", err)
 	}
 	return exists, nil
 }
+
+// get the statistics recorded for a country before a given date, most recent first:
+func (d *DB) GetPreviousCovidStatistics(ctx context.Context, countryID int, date string, excludeID int, limit int) ([]CovidStatistic, error) {
+	getPreviousCovidStatisticsQuery := `
+		SELECT id, country_id, date, confirmed, recovered, deaths
+		FROM covid_statistics
+		WHERE country_id = ? AND date < ? AND id != ?
+		ORDER BY date DESC
+		LIMIT ?`
+	rows, err := d.query(ctx, getPreviousCovidStatisticsQuery, countryID, date, excludeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not get previous covid statistics: %w", err)
+	}
+	defer rows.Close()
+
+	var covidStatistics []CovidStatistic
+	for rows.Next() {
+		covidStatistic := CovidStatistic{}
+		err := rows.Scan(&covidStatistic.ID, &covidStatistic.CountryID, &covidStatistic.Date, &covidStatistic.Confirmed, &covidStatistic.Recovered, &covidStatistic.Deaths)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan covid statistic: %w", err)
+		}
+		covidStatistics = append(covidStatistics, covidStatistic)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error with rows: %w", err)
+	}
+	return covidStatistics, nil
+}
+
+// get the first statistic recorded for a country after a given date, if any:
+func (d *DB) GetNextCovidStatistic(ctx context.Context, countryID int, date string, excludeID int) (CovidStatistic, bool, error) {
+	getNextCovidStatisticQuery := `
+		SELECT id, country_id, date, confirmed, recovered, deaths
+		FROM covid_statistics
+		WHERE country_id = ? AND date > ? AND id != ?
+		ORDER BY date ASC
+		LIMIT 1`
+	covidStatistic := CovidStatistic{}
+	err := d.queryRow(ctx, getNextCovidStatisticQuery, countryID, date, excludeID).Scan(&covidStatistic.ID, &covidStatistic.CountryID, &covidStatistic.Date, &covidStatistic.Confirmed, &covidStatistic.Recovered, &covidStatistic.Deaths)
+	if errors.Is(err, sql.ErrNoRows) {
+		return covidStatistic, false, nil
+	}
+	if err != nil {
+		return covidStatistic, false, fmt.Errorf("could not get next covid statistic: %w", err)
+	}
+	return covidStatistic, true, nil
+}
+
+func (d *DB) CountCovidStatisticsOnDate(ctx context.Context, countryID int, date string, excludeID int) (int, error) {
+	countCovidStatisticsOnDateQuery := `
+		SELECT COUNT(*)
+		FROM covid_statistics
+		WHERE country_id = ? AND date = ? AND id != ?`
+	var count int
+	err := d.queryRow(ctx, countCovidStatisticsOnDateQuery, countryID, date, excludeID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("could not count covid statistics on date: %w", err)
+	}
+	return count, nil
+}
+
+func (d *DB) GetDataQualityIssuesByCovidStatisticID(ctx context.Context, covidStatisticID int) ([]DataQualityIssue, error) {
+	getDataQualityIssuesQuery := `
+		SELECT id, covid_statistic_id, country_id, date, code, severity, message, created_at
+		FROM data_quality_issues
+		WHERE covid_statistic_id = ?
+		ORDER BY id`
+	rows, err := d.query(ctx, getDataQualityIssuesQuery, covidStatisticID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get data quality issues: %w", err)
+	}
+	defer rows.Close()
+
+	return mapDataQualityIssuesFromRows(rows)
+}
+
+func (d *DB) GetDataQualityIssuesByCountryID(ctx context.Context, countryID int) ([]DataQualityIssue, error) {
+	getDataQualityIssuesQuery := `
+		SELECT id, covid_statistic_id, country_id, date, code, severity, message, created_at
+		FROM data_quality_issues
+		WHERE country_id = ?
+		ORDER BY date, id`
+	rows, err := d.query(ctx, getDataQualityIssuesQuery, countryID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get data quality issues: %w", err)
+	}
+	defer rows.Close()
+
+	return mapDataQualityIssuesFromRows(rows)
+}
+
+func mapDataQualityIssuesFromRows(rows *sql.Rows) ([]DataQualityIssue, error) {
+	var issues []DataQualityIssue
+	for rows.Next() {
+		issue := DataQualityIssue{}
+		err := rows.Scan(&issue.ID, &issue.CovidStatisticID, &issue.CountryID, &issue.Date, &issue.Code, &issue.Severity, &issue.Message, &issue.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan data quality issue: %w", err)
+		}
+		issues = append(issues, issue)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error with rows: %w", err)
+	}
+	return issues, nil
+}
+
+func (d *DB) GetPersistedQuery(ctx context.Context, hash string) (PersistedQuery, error) {
+	persistedQuery := PersistedQuery{}
+	getPersistedQueryQuery := "SELECT hash, query, operation_name, allowed, created_at FROM persisted_queries WHERE hash = ?"
+	row := d.queryRow(ctx, getPersistedQueryQuery, hash)
+	err := row.Scan(&persistedQuery.Hash, &persistedQuery.Query, &persistedQuery.OperationName, &persistedQuery.Allowed, &persistedQuery.CreatedAt)
+	if err != nil {
+		return persistedQuery, fmt.Errorf("could not get persisted query: %w", err)
+	}
+	return persistedQuery, nil
+}
+
+// GetAllowedPersistedQueryHashes is read on every GraphQL request in strict mode, it is cached until a manifest
+// is loaded.
+func (d *DB) GetAllowedPersistedQueryHashes(ctx context.Context) ([]string, error) {
+	return cachedRead(ctx, d, "GetAllowedPersistedQueryHashes", nil, nil, func() ([]string, error) {
+		return d.getAllowedPersistedQueryHashes(ctx)
+	})
+}
+
+func (d *DB) getAllowedPersistedQueryHashes(ctx context.Context) ([]string, error) {
+	rows, err := d.query(ctx, "SELECT hash FROM persisted_queries WHERE allowed = 1 ORDER BY hash")
+	if err != nil {
+		return nil, fmt.Errorf("could not get allowed persisted queries: %w", err)
+	}
+	defer rows.Close()
+
+	hashes := []string{}
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, fmt.Errorf("could not scan allowed persisted query: %w", err)
+		}
+		hashes = append(hashes, hash)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error with rows: %w", err)
+	}
+	return hashes, nil
+}
+
+// GetCountryGroups returns every group, without their members.
+func (d *DB) GetCountryGroups(ctx context.Context) ([]CountryGroup, error) {
+	rows, err := d.query(ctx, "SELECT id, name, kind, created_at FROM country_groups ORDER BY kind, name")
+	if err != nil {
+		return nil, fmt.Errorf("could not get country groups: %w", err)
+	}
+	defer rows.Close()
+
+	groups := []CountryGroup{}
+	for rows.Next() {
+		var group CountryGroup
+		if err := rows.Scan(&group.ID, &group.Name, &group.Kind, &group.CreatedAt); err != nil {
+			return nil, fmt.Errorf("could not scan country group: %w", err)
+		}
+		groups = append(groups, group)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error with rows: %w", err)
+	}
+	return groups, nil
+}
+
+func (d *DB) GetCountryGroupByID(ctx context.Context, id int) (CountryGroup, error) {
+	group := CountryGroup{}
+	row := d.queryRow(ctx, "SELECT id, name, kind, created_at FROM country_groups WHERE id = ?", id)
+	if err := row.Scan(&group.ID, &group.Name, &group.Kind, &group.CreatedAt); err != nil {
+		return group, fmt.Errorf("could not scan country group row: %w", err)
+	}
+
+	getMembersQuery := `
+		SELECT c.id, c.name, c.code
+		FROM country_group_members cgm
+		JOIN countries c ON c.id = cgm.country_id
+		WHERE cgm.group_id = ?
+		ORDER BY c.name`
+	rows, err := d.query(ctx, getMembersQuery, id)
+	if err != nil {
+		return group, fmt.Errorf("could not get country group members: %w", err)
+	}
+	defer rows.Close()
+
+	group.Members = []Country{}
+	for rows.Next() {
+		if err := mapCountryFromRows(rows, &group.Members); err != nil {
+			return group, err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return group, fmt.Errorf("error with rows: %w", err)
+	}
+	return group, nil
+}
+
+// checkCustomCountryGroup returns ErrNotFound for unknown groups and ErrContinentGroup for continents.
+func (d *DB) checkCustomCountryGroup(ctx context.Context, id int) error {
+	var kind string
+	err := d.queryRow(ctx, "SELECT kind FROM country_groups WHERE id = ?", id).Scan(&kind)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("country group %w", ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("could not get country group: %w", err)
+	}
+	if kind == GroupKindContinent {
+		return ErrContinentGroup
+	}
+	return nil
+}
@@ -1,12 +1,20 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"time"
 )
 
-func (d *DB) CreateCovidStatistic(countryID int, date string, confirmed int, recovered int, deaths int) (CovidStatistic, error) {
-	result, err := d.db.Exec("INSERT INTO covid_statistics (country_id, date, confirmed, recovered, deaths) VALUES (?, ?, ?, ?, ?)", countryID, date, confirmed, recovered, deaths)
+func (d *DB) CreateCovidStatistic(ctx context.Context, countryID int, date string, confirmed int, recovered int, deaths int) (CovidStatistic, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return CovidStatistic{}, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "INSERT INTO covid_statistics (country_id, date, confirmed, recovered, deaths) VALUES (?, ?, ?, ?, ?)", countryID, date, confirmed, recovered, deaths)
 	if err != nil {
 		return CovidStatistic{}, err
 	}
@@ -16,6 +24,22 @@ func (d *DB) CreateCovidStatistic(countryID int, date string, confirmed int, rec
 		return CovidStatistic{}, err
 	}
 
+	err = refreshCountryLatestStats(ctx, tx, countryID)
+	if err != nil {
+		return CovidStatistic{}, err
+	}
+
+	err = touchCountry(ctx, tx, countryID)
+	if err != nil {
+		return CovidStatistic{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return CovidStatistic{}, err
+	}
+	d.invalidate(ctx, countryID)
+
 	return CovidStatistic{
 		ID:        int(id),
 		CountryID: countryID,
@@ -26,14 +50,14 @@ func (d *DB) CreateCovidStatistic(countryID int, date string, confirmed int, rec
 	}, nil
 }
 
-func (d *DB) CreateCountry(name string, code string) (Country, bool, error) {
-	ifExists := checkIfCountryExists(d.db, name)
+func (d *DB) CreateCountry(ctx context.Context, name string, code string) (Country, bool, error) {
+	ifExists := checkIfCountryExists(ctx, d.db, name)
 	if ifExists {
 		return Country{}, true, nil
 	}
 
-	insertCountryQuery := "INSERT INTO countries (name, code) VALUES (?, ?)"
-	result, err := d.db.Exec(insertCountryQuery, name, code)
+	insertCountryQuery := "INSERT INTO countries (name, code, updated_at) VALUES (?, ?, ?)"
+	result, err := d.db.ExecContext(ctx, insertCountryQuery, name, code, formatUpdatedAt(time.Now()))
 	if err != nil {
 		return Country{}, false, err
 	}
@@ -42,6 +66,11 @@ func (d *DB) CreateCountry(name string, code string) (Country, bool, error) {
 	if err != nil {
 		return Country{}, false, err
 	}
+
+	err = addCountryToContinentGroup(ctx, d.db, int(id), code, false)
+	if err != nil {
+		return Country{}, false, err
+	}
 	return Country{
 		ID:   int(id),
 		Name: name,
@@ -49,17 +78,17 @@ func (d *DB) CreateCountry(name string, code string) (Country, bool, error) {
 	}, false, nil
 }
 
-func checkIfCountryExists(db *sql.DB, name string) bool {
+func checkIfCountryExists(ctx context.Context, db *sql.DB, name string) bool {
 	var id int
 	getCountryQuery := "SELECT id FROM countries WHERE name = ?"
-	row := db.QueryRow(getCountryQuery, name)
+	row := db.QueryRowContext(ctx, getCountryQuery, name)
 	err := row.Scan(&id)
 	return err == nil
 }
 
-func (d *DB) RegisterUser(username string, email string, hashedPassword []byte, salt []byte) (int64, error) {
-	registerNewUserQuery := "INSERT INTO users (username, email, password, salt) VALUES (?, ?, ?, ?)"
-	result, err := d.db.Exec(registerNewUserQuery, username, email, hashedPassword, salt)
+func (d *DB) RegisterUser(ctx context.Context, username string, email string, hashedPassword []byte, salt []byte) (int64, error) {
+	registerNewUserQuery := "INSERT INTO users (username, email, password, salt, email_verified) VALUES (?, ?, ?, ?, 0)"
+	result, err := d.db.ExecContext(ctx, registerNewUserQuery, username, email, hashedPassword, salt)
 	if err != nil {
 		return 0, fmt.Errorf("error inserting user into database: %w", err)
 	}
@@ -72,12 +101,18 @@ func (d *DB) RegisterUser(username string, email string, hashedPassword []byte,
 	return userID, nil
 }
 
-func (d *DB) AddCovidStatistic(countryID int, date string, confirmed int, recovered int, deaths int) (int, error) {
+func (d *DB) AddCovidStatistic(ctx context.Context, countryID int, date string, confirmed int, recovered int, deaths int) (int, error) {
 	addCovidStatisticQuery := `
 		INSERT INTO covid_statistics
 		(country_id, date, confirmed, recovered, deaths)
 		VALUES (?, ?, ?, ?, ?);`
-	res, err := d.db.Exec(addCovidStatisticQuery, countryID, date, confirmed, recovered, deaths)
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, addCovidStatisticQuery, countryID, date, confirmed, recovered, deaths)
 	if err != nil {
 		return 0, fmt.Errorf("error inserting covid statistic into database: %w", err)
 	}
@@ -87,18 +122,175 @@ func (d *DB) AddCovidStatistic(countryID int, date string, confirmed int, recove
 		return 0, fmt.Errorf("error getting covid statistic ID: %w", err)
 	}
 
+	err = refreshCountryLatestStats(ctx, tx, countryID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = touchCountry(ctx, tx, countryID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	d.invalidate(ctx, countryID)
+
 	return int(covidStatisticID), nil
 }
 
-func (d *DB) AddUserMonitoredCountry(userID int, countryID int) error {
+func (d *DB) AddUserMonitoredCountry(ctx context.Context, userID int, countryID int) error {
 	addUserMonitoredCountryQuery := `
 		INSERT INTO user_monitored_countries
 		(user_id, country_id)
 		VALUES (?, ?);`
-	_, err := d.db.Exec(addUserMonitoredCountryQuery, userID, countryID)
+	_, err := d.db.ExecContext(ctx, addUserMonitoredCountryQuery, userID, countryID)
 	if err != nil {
 		return fmt.Errorf("error inserting user monitored country into database: %w", err)
 	}
 
 	return nil
 }
+
+// AddPersistedQuery stores a query registered by a client through APQ, it is not allowed by default.
+// The oldest queries that are not allowed are deleted beyond limit of them, 0 keeps them all.
+func (d *DB) AddPersistedQuery(ctx context.Context, hash string, query string, createdAt string, limit int) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+
+	addPersistedQueryQuery := `
+		INSERT OR IGNORE INTO persisted_queries
+		(hash, query, created_at)
+		VALUES (?, ?, ?);`
+	result, err := tx.ExecContext(ctx, addPersistedQueryQuery, hash, query, createdAt)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error inserting persisted query into database: %w", err)
+	}
+
+	// only a new query can take the table over the limit:
+	if inserted, _ := result.RowsAffected(); inserted > 0 && limit > 0 {
+		evictPersistedQueriesQuery := `
+			DELETE FROM persisted_queries
+			WHERE allowed = 0 AND hash NOT IN (
+				SELECT hash FROM persisted_queries WHERE allowed = 0
+				ORDER BY created_at DESC, hash DESC LIMIT ?
+			);`
+		_, err = tx.ExecContext(ctx, evictPersistedQueriesQuery, limit)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("could not evict persisted queries: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// AllowPersistedQueries registers the operations of a manifest as allowed. With replace set,
+// operations allowed by a previous manifest but missing from this one are revoked.
+func (d *DB) AllowPersistedQueries(ctx context.Context, queries []PersistedQuery, replace bool) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+
+	if replace {
+		_, err = tx.ExecContext(ctx, "UPDATE persisted_queries SET allowed = 0")
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("could not revoke persisted queries: %w", err)
+		}
+	}
+
+	allowPersistedQueryQuery := `
+		INSERT INTO persisted_queries
+		(hash, query, operation_name, allowed, created_at)
+		VALUES (?, ?, ?, 1, ?)
+		ON CONFLICT (hash) DO UPDATE SET
+		query = excluded.query, operation_name = excluded.operation_name, allowed = 1;`
+	for _, query := range queries {
+		_, err = tx.ExecContext(ctx, allowPersistedQueryQuery, query.Hash, query.Query, query.OperationName, query.CreatedAt)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("could not allow persisted query %s: %w", query.Hash, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	// drops the cached allow-list:
+	d.invalidate(ctx)
+	return nil
+}
+
+// CreateCountryGroup creates a custom group with its members. The bool is true when a group with the same name exists.
+func (d *DB) CreateCountryGroup(ctx context.Context, name string, countryIDs []int) (CountryGroup, bool, error) {
+	var existingID int
+	err := d.db.QueryRowContext(ctx, "SELECT id FROM country_groups WHERE name = ?", name).Scan(&existingID)
+	if err == nil {
+		return CountryGroup{}, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return CountryGroup{}, false, fmt.Errorf("could not check country group name: %w", err)
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return CountryGroup{}, false, err
+	}
+	defer tx.Rollback()
+
+	createdAt := time.Now().UTC().Format(time.RFC3339)
+	result, err := tx.ExecContext(ctx, "INSERT INTO country_groups (name, kind, created_at) VALUES (?, ?, ?)", name, GroupKindCustom, createdAt)
+	if err != nil {
+		return CountryGroup{}, false, fmt.Errorf("could not create country group: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return CountryGroup{}, false, err
+	}
+
+	for _, countryID := range countryIDs {
+		if err := addCountryGroupMember(ctx, tx, int(id), countryID); err != nil {
+			return CountryGroup{}, false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return CountryGroup{}, false, err
+	}
+
+	group, err := d.GetCountryGroupByID(ctx, int(id))
+	return group, false, err
+}
+
+// AddCountryGroupMember adds a country to a custom group, adding a member twice is not an error.
+func (d *DB) AddCountryGroupMember(ctx context.Context, groupID int, countryID int) error {
+	if err := d.checkCustomCountryGroup(ctx, groupID); err != nil {
+		return err
+	}
+	return addCountryGroupMember(ctx, d.db, groupID, countryID)
+}
+
+func addCountryGroupMember(ctx context.Context, db execer, groupID int, countryID int) error {
+	var id int
+	err := db.QueryRowContext(ctx, "SELECT id FROM countries WHERE id = ?", countryID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("country with ID %d %w", countryID, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("could not check country: %w", err)
+	}
+
+	_, err = db.ExecContext(ctx, "INSERT OR IGNORE INTO country_group_members (group_id, country_id) VALUES (?, ?)", groupID, countryID)
+	if err != nil {
+		return fmt.Errorf("could not add country to group: %w", err)
+	}
+	return nil
+}
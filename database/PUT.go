@@ -1,10 +1,14 @@
 package database
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"time"
+)
 
-func (d *DB) UpdateCountry(id int, name string, code string) (Country, error) {
-	updateNameCode := "UPDATE countries SET name = ?, code = ? WHERE id = ?"
-	result, err := d.db.Exec(updateNameCode, name, code, id)
+func (d *DB) UpdateCountry(ctx context.Context, id int, name string, code string) (Country, error) {
+	updateNameCode := "UPDATE countries SET name = ?, code = ?, updated_at = ? WHERE id = ?"
+	result, err := d.db.ExecContext(ctx, updateNameCode, name, code, formatUpdatedAt(time.Now()), id)
 	if err != nil {
 		return Country{}, fmt.Errorf("could not update country: %w", err)
 	}
@@ -15,7 +19,14 @@ func (d *DB) UpdateCountry(id int, name string, code string) (Country, error) {
 	}
 
 	if rowsAffected == 0 {
-		return Country{}, fmt.Errorf("country not found")
+		return Country{}, fmt.Errorf("country %w", ErrNotFound)
+	}
+	// the cached statistics carry the name and code of their country:
+	d.invalidate(ctx, id)
+
+	err = addCountryToContinentGroup(ctx, d.db, id, code, true)
+	if err != nil {
+		return Country{}, err
 	}
 
 	return Country{
@@ -25,9 +36,15 @@ func (d *DB) UpdateCountry(id int, name string, code string) (Country, error) {
 	}, nil
 }
 
-func (d *DB) UpdateCovidStatistic(id int, date string, confirmed int, recovered int, deaths int) (CovidStatistic, error) {
+func (d *DB) UpdateCovidStatistic(ctx context.Context, id int, date string, confirmed int, recovered int, deaths int) (CovidStatistic, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return CovidStatistic{}, err
+	}
+	defer tx.Rollback()
+
 	updateCovidStatistic := "UPDATE covid_statistics SET date = ?, confirmed = ?, recovered = ?, deaths = ? WHERE id = ?"
-	result, err := d.db.Exec(updateCovidStatistic, date, confirmed, recovered, deaths, id)
+	result, err := tx.ExecContext(ctx, updateCovidStatistic, date, confirmed, recovered, deaths, id)
 	if err != nil {
 		return CovidStatistic{}, fmt.Errorf("could not update covid statistic: %w", err)
 	}
@@ -37,14 +54,32 @@ func (d *DB) UpdateCovidStatistic(id int, date string, confirmed int, recovered
 		return CovidStatistic{}, fmt.Errorf("no covid statistics were affected: %w", err)
 	}
 	if rowsAffected == 0 {
-		return CovidStatistic{}, fmt.Errorf("covid statistic not found")
+		return CovidStatistic{}, fmt.Errorf("covid statistic %w", ErrNotFound)
+	}
+
+	var countryID int
+	err = tx.QueryRowContext(ctx, "SELECT country_id FROM covid_statistics WHERE id = ?", id).Scan(&countryID)
+	if err != nil {
+		return CovidStatistic{}, fmt.Errorf("error getting country ID for covid statistic with ID %d: %w", id, err)
+	}
+
+	// the date may have changed, so any statistic of the country can be the latest one now:
+	err = refreshCountryLatestStats(ctx, tx, countryID)
+	if err != nil {
+		return CovidStatistic{}, err
 	}
 
-	countryID, err := d.GetCountryIDByCovidStatisticID(id)
+	err = touchCountry(ctx, tx, countryID)
 	if err != nil {
 		return CovidStatistic{}, err
 	}
 
+	err = tx.Commit()
+	if err != nil {
+		return CovidStatistic{}, err
+	}
+	d.invalidate(ctx, countryID)
+
 	return CovidStatistic{
 		ID:        id,
 		Date:      date,
@@ -54,3 +89,39 @@ func (d *DB) UpdateCovidStatistic(id int, date string, confirmed int, recovered
 		CountryID: countryID,
 	}, nil
 }
+
+// ReplaceDataQualityIssues swaps the issues flagged on a covid statistic for a new set in one transaction.
+func (d *DB) ReplaceDataQualityIssues(ctx context.Context, covidStatisticID int, issues []DataQualityIssue) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM data_quality_issues WHERE covid_statistic_id = ?", covidStatisticID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("could not clear data quality issues: %w", err)
+	}
+
+	insertDataQualityIssueQuery := `
+		INSERT INTO data_quality_issues
+		(covid_statistic_id, country_id, date, code, severity, message, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?);`
+	for _, issue := range issues {
+		_, err = tx.ExecContext(ctx, insertDataQualityIssueQuery, covidStatisticID, issue.CountryID, issue.Date, issue.Code, issue.Severity, issue.Message, issue.CreatedAt)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("could not insert data quality issue: %w", err)
+		}
+	}
+
+	// the issues are part of the statistics of the country:
+	touchQuery := "UPDATE countries SET updated_at = ? WHERE id = (SELECT country_id FROM covid_statistics WHERE id = ?)"
+	_, err = tx.ExecContext(ctx, touchQuery, formatUpdatedAt(time.Now()), covidStatisticID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("could not record the change of the country: %w", err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// CreateUserToken stores the hash of a token emailed to a user, in place of the previous token of the user for
+// the same purpose, which stops working.
+func (d *DB) CreateUserToken(ctx context.Context, userID int, purpose string, tokenHash string, expiresAt time.Time) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_tokens WHERE expires_at <= ?", now); err != nil {
+		return fmt.Errorf("could not delete expired user tokens: %w", err)
+	}
+	createTokenQuery := `
+		INSERT INTO user_tokens (token_hash, user_id, purpose, expires_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id, purpose) DO UPDATE SET token_hash = excluded.token_hash, expires_at = excluded.expires_at`
+	_, err = tx.ExecContext(ctx, createTokenQuery, tokenHash, userID, purpose, expiresAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("could not create user token: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ConsumeUserToken deletes the token of a hash and returns the ID of its user. It returns sql.ErrNoRows when
+// there is no such token for the purpose or when it expired.
+func (d *DB) ConsumeUserToken(ctx context.Context, purpose string, tokenHash string) (int, error) {
+	var userID int
+	var expiresAt string
+	err := d.db.QueryRowContext(ctx, "DELETE FROM user_tokens WHERE token_hash = ? AND purpose = ? RETURNING user_id, expires_at",
+		tokenHash, purpose).Scan(&userID, &expiresAt)
+	if err != nil {
+		return 0, fmt.Errorf("could not consume user token: %w", err)
+	}
+	expires, err := time.Parse(time.RFC3339, expiresAt)
+	if err != nil {
+		return 0, fmt.Errorf("could not read expiry of user token: %w", err)
+	}
+	if !time.Now().Before(expires) {
+		return 0, fmt.Errorf("user token expired: %w", sql.ErrNoRows)
+	}
+	return userID, nil
+}
+
+func (d *DB) SetUserPassword(ctx context.Context, userID int, hashedPassword []byte, salt []byte) error {
+	result, err := d.db.ExecContext(ctx, "UPDATE users SET password = ?, salt = ?, token_version = token_version + 1 WHERE id = ?", hashedPassword, salt, userID)
+	if err != nil {
+		return fmt.Errorf("error updating password of user: %w", err)
+	}
+	return checkUserUpdated(result, userID)
+}
+
+func (d *DB) SetUserEmailVerified(ctx context.Context, userID int) error {
+	result, err := d.db.ExecContext(ctx, "UPDATE users SET email_verified = 1 WHERE id = ?", userID)
+	if err != nil {
+		return fmt.Errorf("error verifying email of user: %w", err)
+	}
+	return checkUserUpdated(result, userID)
+}
+
+func (d *DB) SetUserRole(ctx context.Context, userID int, role string) error {
+	result, err := d.db.ExecContext(ctx, "UPDATE users SET role = ? WHERE id = ?", role, userID)
+	if err != nil {
+		return fmt.Errorf("error setting role of user: %w", err)
+	}
+	return checkUserUpdated(result, userID)
+}
+
+func checkUserUpdated(result sql.Result, userID int) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get number of affected rows: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("user with ID %d %w", userID, ErrNotFound)
+	}
+	return nil
+}
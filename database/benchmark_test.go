@@ -0,0 +1,370 @@
+package database_test
+
+import (
+	"context"
+	"covid/database"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// The benchmarks compare a database opened the way it was before the SQLite tuning with one opened by ConnectDB,
+// on a generated dataset:
+//
+//	go test ./database -run '^$' -bench . -countries 200 -days 1095
+var (
+	benchmarkCountries = flag.Int("countries", 200, "countries generated for the benchmarks")
+	benchmarkDays      = flag.Int("days", 3*365, "days of statistics generated for every country of the benchmarks")
+	benchmarkWriters   = flag.Int("writers", 2, "goroutines writing during BenchmarkConcurrentLoad, such as the fetcher and the API")
+)
+
+// tuningIndexes are the indexes added along with the connection tuning, dropped from the baseline database so
+// that it runs the queries the way databases did before.
+var tuningIndexes = []string{
+	"idx_covid_statistics_country_day",
+	"idx_data_quality_issues_statistic",
+	"idx_data_quality_issues_country_date",
+	"idx_user_monitored_countries_country",
+	"idx_country_group_members_country",
+}
+
+// benchmarkSetup is a way of opening the same database.
+type benchmarkSetup struct {
+	name string
+	open func(ctx context.Context) (*database.DB, func() error, error)
+}
+
+// benchmarkDatabases holds the generated databases, shared by the benchmarks of a run.
+var benchmarkDatabases struct {
+	once   sync.Once
+	dir    string
+	setups []benchmarkSetup
+	err    error
+}
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	code := m.Run()
+	if benchmarkDatabases.dir != "" {
+		os.RemoveAll(benchmarkDatabases.dir)
+	}
+	os.Exit(code)
+}
+
+// openBenchmarkSetups generates the databases on the first call, and returns the setups opening them.
+func openBenchmarkSetups(b *testing.B) []benchmarkSetup {
+	b.Helper()
+	if *benchmarkCountries <= 0 || *benchmarkDays <= 0 {
+		b.Fatal("-countries and -days must be positive")
+	}
+	benchmarkDatabases.once.Do(func() {
+		ctx := context.Background()
+		dir, err := os.MkdirTemp("", "covid-benchmark")
+		if err != nil {
+			benchmarkDatabases.err = err
+			return
+		}
+		benchmarkDatabases.dir = dir
+
+		tunedPath := filepath.Join(dir, "tuned.db")
+		baselinePath := filepath.Join(dir, "baseline.db")
+		if err := generateBenchmarkDatabase(ctx, tunedPath, *benchmarkCountries, *benchmarkDays); err != nil {
+			benchmarkDatabases.err = fmt.Errorf("could not generate database: %w", err)
+			return
+		}
+		if err := copyBenchmarkDatabase(ctx, tunedPath, baselinePath); err != nil {
+			benchmarkDatabases.err = fmt.Errorf("could not copy database: %w", err)
+			return
+		}
+
+		benchmarkDatabases.setups = []benchmarkSetup{
+			{"baseline", func(ctx context.Context) (*database.DB, func() error, error) {
+				db, err := sql.Open("sqlite3", baselinePath)
+				if err != nil {
+					return nil, nil, err
+				}
+				return database.NewDB(db), db.Close, nil
+			}},
+			{"tuned", func(ctx context.Context) (*database.DB, func() error, error) {
+				db, err := database.ConnectDB(ctx, tunedPath, database.Options{})
+				if err != nil {
+					return nil, nil, err
+				}
+				return db, db.Close, nil
+			}},
+		}
+	})
+	if benchmarkDatabases.err != nil {
+		b.Fatal(benchmarkDatabases.err)
+	}
+	return benchmarkDatabases.setups
+}
+
+// openBenchmarkDB opens the database of a setup for the time of a benchmark.
+func openBenchmarkDB(b *testing.B, setup benchmarkSetup) *database.DB {
+	b.Helper()
+	db, closeDB, err := setup.open(context.Background())
+	if err != nil {
+		b.Fatalf("could not open %s database: %v", setup.name, err)
+	}
+	b.Cleanup(func() {
+		if err := closeDB(); err != nil {
+			b.Errorf("could not close %s database: %v", setup.name, err)
+		}
+	})
+	return db
+}
+
+// benchmarkEndDay is the last day of the generated statistics.
+func benchmarkEndDay() time.Time {
+	return benchmarkStartDay.AddDate(0, 0, *benchmarkDays-1)
+}
+
+var benchmarkStartDay = time.Date(2020, 1, 22, 0, 0, 0, 0, time.UTC)
+
+// generateBenchmarkDatabase creates a database with cumulative statistics growing every day for every country.
+// The statistics are inserted in one transaction, the next ConnectDB computes their summaries.
+func generateBenchmarkDatabase(ctx context.Context, path string, countries int, days int) error {
+	if err := removeBenchmarkDatabase(path); err != nil {
+		return err
+	}
+	db, err := database.ConnectDB(ctx, path, database.Options{})
+	if err != nil {
+		return err
+	}
+	if err := db.Close(); err != nil {
+		return err
+	}
+
+	raw, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer raw.Close()
+
+	tx, err := raw.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	insertStatistic, err := tx.PrepareContext(ctx, "INSERT INTO covid_statistics (country_id, date, confirmed, recovered, deaths) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer insertStatistic.Close()
+
+	random := rand.New(rand.NewSource(1))
+	for c := 1; c <= countries; c++ {
+		_, err := tx.ExecContext(ctx, "INSERT INTO countries (id, name, code) VALUES (?, ?, ?)", c, fmt.Sprintf("Country %03d", c), fmt.Sprintf("X%03d", c))
+		if err != nil {
+			return err
+		}
+
+		confirmed, recovered, deaths := 0, 0, 0
+		for day := 0; day < days; day++ {
+			newCases := random.Intn(1000)
+			confirmed += newCases
+			recovered += newCases * random.Intn(90) / 100
+			deaths += newCases * random.Intn(3) / 100
+			date := benchmarkStartDay.AddDate(0, 0, day).Format("2006-01-02")
+			if _, err := insertStatistic.ExecContext(ctx, c, date, confirmed, recovered, deaths); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	db, err = database.ConnectDB(ctx, path, database.Options{})
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+// copyBenchmarkDatabase copies the generated database for the baseline, back in the default rollback journal
+// mode and without the indexes of the tuning.
+func copyBenchmarkDatabase(ctx context.Context, from string, to string) error {
+	if err := removeBenchmarkDatabase(to); err != nil {
+		return err
+	}
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	db, err := sql.Open("sqlite3", to)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.ExecContext(ctx, "PRAGMA journal_mode = DELETE"); err != nil {
+		return err
+	}
+	for _, index := range tuningIndexes {
+		if _, err := db.ExecContext(ctx, "DROP INDEX IF EXISTS "+index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeBenchmarkDatabase removes the database of a previous run in the same directory, with its WAL files.
+func removeBenchmarkDatabase(path string) error {
+	for _, file := range []string{path, path + "-wal", path + "-shm"} {
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// benchmarkQuery is one of the reads served by the API on every request for a country.
+type benchmarkQuery struct {
+	name string
+	run  func(ctx context.Context, db *database.DB, countryID int, endDay time.Time) error
+}
+
+var benchmarkQueries = []benchmarkQuery{
+	{"page", func(ctx context.Context, db *database.DB, countryID int, endDay time.Time) error {
+		from := endDay.AddDate(0, 0, -90).Format("2006-01-02")
+		first := 50
+		_, _, err := db.ListCovidStatistics(ctx, database.CovidStatisticFilter{CountryID: countryID, DateFrom: &from, SortBy: "date", SortOrder: "desc", First: &first})
+		return err
+	}},
+	{"latest", func(ctx context.Context, db *database.DB, countryID int, endDay time.Time) error {
+		_, err := db.GetCountryLatestStatistics(ctx, countryID)
+		return err
+	}},
+	{"latest-as-of", func(ctx context.Context, db *database.DB, countryID int, endDay time.Time) error {
+		asOf := endDay.AddDate(0, 0, -30).Format("2006-01-02")
+		_, err := db.GetLatestCovidStatistics(ctx, &asOf, []int{countryID})
+		return err
+	}},
+	{"quality", func(ctx context.Context, db *database.DB, countryID int, endDay time.Time) error {
+		_, err := db.GetDataQualityIssuesByCountryID(ctx, countryID)
+		return err
+	}},
+	{"neighbours", func(ctx context.Context, db *database.DB, countryID int, endDay time.Time) error {
+		date := endDay.AddDate(0, 0, -100).Format("2006-01-02")
+		if _, err := db.GetPreviousCovidStatistics(ctx, countryID, date, 0, 7); err != nil {
+			return err
+		}
+		_, _, err := db.GetNextCovidStatistic(ctx, countryID, date, 0)
+		return err
+	}},
+}
+
+// BenchmarkQueries runs every hot query sequentially, going through the countries.
+func BenchmarkQueries(b *testing.B) {
+	ctx := context.Background()
+	endDay := benchmarkEndDay()
+	for _, setup := range openBenchmarkSetups(b) {
+		b.Run(setup.name, func(b *testing.B) {
+			db := openBenchmarkDB(b, setup)
+			for _, q := range benchmarkQueries {
+				b.Run(q.name, func(b *testing.B) {
+					for i := 0; i < b.N; i++ {
+						if err := q.run(ctx, db, i%*benchmarkCountries+1, endDay); err != nil {
+							b.Fatal(err)
+						}
+					}
+				})
+			}
+		})
+	}
+}
+
+// BenchmarkConcurrentLoad runs the hot queries from parallel readers, -cpu sets how many, while -writers
+// goroutines keep adding statistics after the last day. It reports the writes and the "database is locked"
+// errors per second next to the reads.
+func BenchmarkConcurrentLoad(b *testing.B) {
+	endDay := benchmarkEndDay()
+	countries := *benchmarkCountries
+	for _, setup := range openBenchmarkSetups(b) {
+		b.Run(setup.name, func(b *testing.B) {
+			db := openBenchmarkDB(b, setup)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var writes, lockErrors atomic.Int64
+			var firstError sync.Once
+			record := func(err error) {
+				// the queries cancelled at the end of the run are not failures:
+				if ctx.Err() != nil {
+					return
+				}
+				if strings.Contains(err.Error(), "database is locked") {
+					lockErrors.Add(1)
+					return
+				}
+				firstError.Do(func() { b.Error(err) })
+			}
+
+			// the writers share the days to add, so that they never add the same one:
+			var added atomic.Int64
+			var wg sync.WaitGroup
+			for w := 0; w < *benchmarkWriters; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for ctx.Err() == nil {
+						n := int(added.Add(1) - 1)
+						countryID := n%countries + 1
+						date := endDay.AddDate(0, 0, n/countries+1).Format("2006-01-02")
+						if _, err := db.AddCovidStatistic(ctx, countryID, date, 1e6+n, 1e5, 1e4); err != nil {
+							record(err)
+							continue
+						}
+						writes.Add(1)
+					}
+				}()
+			}
+
+			var readers atomic.Int64
+			b.ResetTimer()
+			start := time.Now()
+			b.RunParallel(func(pb *testing.PB) {
+				random := rand.New(rand.NewSource(readers.Add(1)))
+				for pb.Next() {
+					q := benchmarkQueries[random.Intn(len(benchmarkQueries))]
+					if err := q.run(ctx, db, random.Intn(countries)+1, endDay); err != nil {
+						record(err)
+					}
+				}
+			})
+			elapsed := time.Since(start)
+			b.StopTimer()
+			cancel()
+			wg.Wait()
+
+			b.ReportMetric(float64(writes.Load())/elapsed.Seconds(), "writes/s")
+			b.ReportMetric(float64(lockErrors.Load())/elapsed.Seconds(), "locked/s")
+		})
+	}
+}
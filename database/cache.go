@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+)
+
+// Cache keeps the results of the aggregate reads of a DB, encoded as JSON and keyed by the read and its
+// arguments, until the statistics of a country they depend on are written. The cache package implements it.
+type Cache interface {
+	// Get returns the result cached for key, query names the read.
+	Get(ctx context.Context, query string, key string) ([]byte, bool)
+	// Set caches a result, countryIDs are the countries it depends on, nil when it depends on every country.
+	Set(ctx context.Context, key string, countryIDs []int, value []byte)
+	// Invalidate drops the results depending on any of the countries, and those depending on every country.
+	Invalidate(ctx context.Context, countryIDs []int)
+}
+
+// cachedRead returns the result of read from the cache of d when it holds one for the query and its arguments,
+// and caches it otherwise. countryIDs are the countries the result depends on, nil when it depends on every
+// country. Errors are not cached.
+func cachedRead[T any](ctx context.Context, d *DB, query string, args any, countryIDs []int, read func() (T, error)) (T, error) {
+	if d.cache == nil {
+		return read()
+	}
+	encodedArgs, err := json.Marshal(args)
+	if err != nil {
+		return read()
+	}
+	key := query + " " + string(encodedArgs)
+
+	if value, ok := d.cache.Get(ctx, query, key); ok {
+		var result T
+		if err := json.Unmarshal(value, &result); err == nil {
+			return result, nil
+		}
+		slog.WarnContext(ctx, "could not decode cached result", "query", query, "error", err)
+	}
+
+	d.cacheMu.RLock()
+	invalidations := d.invalidations
+	d.cacheMu.RUnlock()
+
+	result, err := read()
+	if err != nil {
+		return result, err
+	}
+	value, err := json.Marshal(result)
+	if err != nil {
+		slog.WarnContext(ctx, "could not encode result to cache", "query", query, "error", err)
+		return result, nil
+	}
+
+	d.cacheMu.RLock()
+	defer d.cacheMu.RUnlock()
+	// the statistics were written while they were read, the result may be stale already:
+	if d.invalidations == invalidations {
+		d.cache.Set(ctx, key, countryIDs, value)
+	}
+	return result, nil
+}
+
+// invalidate drops the cached results depending on the countries, after their statistics were written.
+func (d *DB) invalidate(ctx context.Context, countryIDs ...int) {
+	if d.cache == nil {
+		return
+	}
+	d.cacheMu.Lock()
+	defer d.cacheMu.Unlock()
+	d.invalidations++
+	d.cache.Invalidate(ctx, countryIDs)
+}
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// mapCache is a Cache without eviction, recording the results set.
+type mapCache struct {
+	values map[string][]byte
+	sets   int
+}
+
+func (c *mapCache) Get(ctx context.Context, query string, key string) ([]byte, bool) {
+	value, ok := c.values[key]
+	return value, ok
+}
+
+func (c *mapCache) Set(ctx context.Context, key string, countryIDs []int, value []byte) {
+	c.values[key] = value
+	c.sets++
+}
+
+func (c *mapCache) Invalidate(ctx context.Context, countryIDs []int) {
+	clear(c.values)
+}
+
+func TestCachedRead(t *testing.T) {
+	ctx := context.Background()
+	c := &mapCache{values: map[string][]byte{}}
+	d := &DB{cache: c}
+	reads := 0
+	read := func() (int, error) {
+		reads++
+		return 42, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		result, err := cachedRead(ctx, d, "Answer", 1, []int{1}, read)
+		if err != nil || result != 42 {
+			t.Fatalf("cachedRead: %d, %v", result, err)
+		}
+	}
+	if reads != 1 {
+		t.Errorf("%d reads, want the second result from the cache", reads)
+	}
+
+	// other arguments are another result:
+	if _, err := cachedRead(ctx, d, "Answer", 2, []int{2}, read); err != nil {
+		t.Fatal(err)
+	}
+	if reads != 2 {
+		t.Errorf("%d reads, want 2", reads)
+	}
+
+	d.invalidate(ctx, 1)
+	if _, err := cachedRead(ctx, d, "Answer", 1, []int{1}, read); err != nil {
+		t.Fatal(err)
+	}
+	if reads != 3 {
+		t.Errorf("%d reads, want the result read again once invalidated", reads)
+	}
+}
+
+func TestCachedReadErrorNotCached(t *testing.T) {
+	ctx := context.Background()
+	c := &mapCache{values: map[string][]byte{}}
+	d := &DB{cache: c}
+	failure := errors.New("failure")
+	if _, err := cachedRead(ctx, d, "Answer", 1, []int{1}, func() (int, error) { return 0, failure }); !errors.Is(err, failure) {
+		t.Fatalf("got %v, want %v", err, failure)
+	}
+	if c.sets != 0 {
+		t.Errorf("%d results cached, want none", c.sets)
+	}
+}
+
+// A write invalidating the cache while a result is read may have changed it: the result is returned, not cached.
+func TestCachedReadInvalidatedWhileReading(t *testing.T) {
+	ctx := context.Background()
+	c := &mapCache{values: map[string][]byte{}}
+	d := &DB{cache: c}
+	value := 1
+	result, err := cachedRead(ctx, d, "Answer", 1, []int{1}, func() (int, error) {
+		read := value
+		// the statistics are written and invalidated after they were read, before the result is cached:
+		value = 2
+		d.invalidate(ctx, 1)
+		return read, nil
+	})
+	if err != nil || result != 1 {
+		t.Fatalf("cachedRead: %d, %v", result, err)
+	}
+	if c.sets != 0 {
+		t.Errorf("the stale result was cached")
+	}
+
+	result, err = cachedRead(ctx, d, "Answer", 1, []int{1}, func() (int, error) { return value, nil })
+	if err != nil || result != 2 {
+		t.Errorf("after the write: %d, %v, want 2", result, err)
+	}
+}
+
+func TestAllowedPersistedQueriesCachedUntilAllowed(t *testing.T) {
+	ctx := context.Background()
+	c := &mapCache{values: map[string][]byte{}}
+	d, err := ConnectDB(ctx, filepath.Join(t.TempDir(), "covid.db"), Options{Cache: c})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	allowed := func(want ...string) {
+		t.Helper()
+		hashes, err := d.GetAllowedPersistedQueryHashes(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(hashes, want) {
+			t.Errorf("got %v, want %v", hashes, want)
+		}
+	}
+
+	if err := d.AllowPersistedQueries(ctx, []PersistedQuery{{Hash: "a", Query: "{ a }"}}, false); err != nil {
+		t.Fatal(err)
+	}
+	allowed("a")
+	allowed("a")
+	if c.sets != 1 {
+		t.Errorf("%d results cached, want the second read from the cache", c.sets)
+	}
+
+	if err := d.AllowPersistedQueries(ctx, []PersistedQuery{{Hash: "b", Query: "{ b }"}}, true); err != nil {
+		t.Fatal(err)
+	}
+	allowed("b")
+	if c.sets != 2 {
+		t.Errorf("%d results cached, want the allow-list read again once a manifest is loaded", c.sets)
+	}
+}
@@ -1,63 +1,172 @@
 package database
 
 import (
+	"context"
 	"database/sql"
-
-	_ "github.com/mattn/go-sqlite3"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 )
 
 type DB struct {
+	// db runs the writes, and the reads too when the DB wraps a pool of NewDB.
 	db *sql.DB
+	// read runs the reads, on connections of their own so that they do not queue behind the writes.
+	read *sql.DB
+	// statements are the prepared reads, nil when the DB wraps a pool of NewDB.
+	statements *statementCache
+
+	// cache keeps the results of the aggregate reads when set, invalidations counts the writes that dropped
+	// some of them so that the results read meanwhile are not cached.
+	cache         Cache
+	cacheMu       sync.RWMutex
+	invalidations uint64
+}
+
+// ErrNotFound is wrapped by the errors returned when a write matches no row.
+var ErrNotFound = errors.New("not found")
+
+// ErrContinentGroup is returned when changing a continent group, their members follow the country codes.
+var ErrContinentGroup = errors.New("continent groups are kept in sync with the country codes and cannot be changed")
+
+// Options tune the connections opened by ConnectDB, zero values leave the defaults.
+type Options struct {
+	// ReadConnections is the number of connections running reads, the writes all go through one connection.
+	ReadConnections int
+	// BusyTimeout is how long a statement waits for the lock of another connection before failing with
+	// "database is locked".
+	BusyTimeout time.Duration
+	// QueryHook is called after every statement when set, to monitor the database.
+	QueryHook QueryHook
+	// Cache keeps the results of the aggregate reads when set, the writes of the DB invalidate them.
+	Cache Cache
 }
 
-func ConnectDB() (db *sql.DB, err error) {
-	db, err = sql.Open("sqlite3", "covid.db")
+const (
+	DefaultReadConnections = 4
+	DefaultBusyTimeout     = 5 * time.Second
+)
+
+// ConnectDB opens the SQLite database at path and brings its schema up to date.
+//
+// The database is switched to WAL mode, in which the reads and the write do not block each other. SQLite
+// allows a single writer at a time, so the writes go through a pool of one connection, whose transactions
+// take the write lock when they begin rather than failing when upgrading a read lock held while another
+// connection writes. The reads go through a pool of their own and are prepared once.
+func ConnectDB(ctx context.Context, path string, opts Options) (*DB, error) {
+	if opts.ReadConnections <= 0 {
+		opts.ReadConnections = DefaultReadConnections
+	}
+	if opts.BusyTimeout <= 0 {
+		opts.BusyTimeout = DefaultBusyTimeout
+	}
+	busyTimeout := strconv.FormatInt(opts.BusyTimeout.Milliseconds(), 10)
+
+	write := sql.OpenDB(&connector{hook: opts.QueryHook, dsn: dsn(path, url.Values{
+		"_journal_mode": {"WAL"},
+		"_synchronous":  {"NORMAL"},
+		"_busy_timeout": {busyTimeout},
+		"_foreign_keys": {"on"},
+		"_txlock":       {"immediate"},
+	})})
+	write.SetMaxOpenConns(1)
+
+	err := setUpSchema(ctx, write)
 	if err != nil {
+		write.Close()
 		return nil, err
 	}
 
-	_, err = db.Exec("PRAGMA foreign_keys = ON")
+	read := sql.OpenDB(&connector{hook: opts.QueryHook, dsn: dsn(path, url.Values{
+		"_busy_timeout": {busyTimeout},
+		"_query_only":   {"on"},
+	})})
+	read.SetMaxOpenConns(opts.ReadConnections)
+	read.SetMaxIdleConns(opts.ReadConnections)
+
+	return &DB{db: write, read: read, statements: newStatementCache(read), cache: opts.Cache}, nil
+}
+
+// dsn adds go-sqlite3 connection parameters to the path of a database.
+func dsn(path string, params url.Values) string {
+	return path + "?" + params.Encode()
+}
+
+// setUpSchema creates the tables all at once in a transaction and applies the migrations.
+func setUpSchema(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// create tables all at once in a transaction:
-	tx, err := db.Begin()
+	err = CreateTables(ctx, tx)
 	if err != nil {
-		return nil, err
+		tx.Rollback()
+		return err
 	}
 
-	err = CreateTables(tx)
+	err = runMigrations(ctx, tx)
 	if err != nil {
 		tx.Rollback()
-		return nil, err
+		return err
 	}
 
-	err = tx.Commit()
+	err = seedContinentGroups(ctx, tx)
 	if err != nil {
-		return nil, err
+		tx.Rollback()
+		return err
+	}
+
+	err = syncCountryLatestStats(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
 	}
 
-	return db, nil
+	return tx.Commit()
 }
 
-func CreateTables(tx *sql.Tx) error {
-	err := createCountryTable(tx)
+func CreateTables(ctx context.Context, tx *sql.Tx) error {
+	err := createCountryTable(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	err = createCovidStatisticTable(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	err = createUserTable(ctx, tx)
 	if err != nil {
 		return err
 	}
 
-	err = createCovidStatisticTable(tx)
+	err = createUserMonitoredCountriesTable(ctx, tx)
 	if err != nil {
 		return err
 	}
 
-	err = createUserTable(tx)
+	err = createDataQualityIssuesTable(ctx, tx)
 	if err != nil {
 		return err
 	}
 
-	err = createUserMonitoredCountriesTable(tx)
+	err = createPersistedQueriesTable(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	err = createCountryGroupTables(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	err = createCountryLatestStatsTable(ctx, tx)
 	if err != nil {
 		return err
 	}
@@ -65,18 +174,18 @@ func CreateTables(tx *sql.Tx) error {
 	return nil
 }
 
-func createCountryTable(tx *sql.Tx) error {
+func createCountryTable(ctx context.Context, tx *sql.Tx) error {
 	createCountryTable := `
 		CREATE TABLE IF NOT EXISTS countries (
 		id INTEGER PRIMARY KEY,
 		name TEXT NOT NULL UNIQUE,
 		code TEXT NOT NULL UNIQUE
 	);`
-	_, err := tx.Exec(createCountryTable)
+	_, err := tx.ExecContext(ctx, createCountryTable)
 	return err
 }
 
-func createCovidStatisticTable(tx *sql.Tx) error {
+func createCovidStatisticTable(ctx context.Context, tx *sql.Tx) error {
 	createCovidStatisticTable := `
 		CREATE TABLE IF NOT EXISTS covid_statistics (
 		id INTEGER PRIMARY KEY,
@@ -87,11 +196,11 @@ func createCovidStatisticTable(tx *sql.Tx) error {
 		deaths INTEGER NOT NULL,
 		FOREIGN KEY (country_id) REFERENCES countries (id) ON DELETE CASCADE
 	);`
-	_, err := tx.Exec(createCovidStatisticTable)
+	_, err := tx.ExecContext(ctx, createCovidStatisticTable)
 	return err
 }
 
-func createUserTable(tx *sql.Tx) error {
+func createUserTable(ctx context.Context, tx *sql.Tx) error {
 	createUserTable := `
 		CREATE TABLE IF NOT EXISTS users (
 		id INTEGER PRIMARY KEY,
@@ -100,11 +209,11 @@ func createUserTable(tx *sql.Tx) error {
 		password TEXT NOT NULL,
 		salt BLOB NOT NULL
 	);`
-	_, err := tx.Exec(createUserTable)
+	_, err := tx.ExecContext(ctx, createUserTable)
 	return err
 }
 
-func createUserMonitoredCountriesTable(tx *sql.Tx) error {
+func createUserMonitoredCountriesTable(ctx context.Context, tx *sql.Tx) error {
 	createUserMonitoredCountriesTable := `
 		CREATE TABLE IF NOT EXISTS user_monitored_countries (
 		user_id INTEGER NOT NULL,
@@ -113,10 +222,348 @@ func createUserMonitoredCountriesTable(tx *sql.Tx) error {
 		FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
 		FOREIGN KEY (country_id) REFERENCES countries (id) ON DELETE CASCADE
 	);`
-	_, err := tx.Exec(createUserMonitoredCountriesTable)
+	_, err := tx.ExecContext(ctx, createUserMonitoredCountriesTable)
+	return err
+}
+
+func createDataQualityIssuesTable(ctx context.Context, tx *sql.Tx) error {
+	createDataQualityIssuesTable := `
+		CREATE TABLE IF NOT EXISTS data_quality_issues (
+		id INTEGER PRIMARY KEY,
+		covid_statistic_id INTEGER NOT NULL,
+		country_id INTEGER NOT NULL,
+		date TEXT NOT NULL,
+		code TEXT NOT NULL,
+		severity TEXT NOT NULL,
+		message TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		FOREIGN KEY (covid_statistic_id) REFERENCES covid_statistics (id) ON DELETE CASCADE,
+		FOREIGN KEY (country_id) REFERENCES countries (id) ON DELETE CASCADE
+	);`
+	_, err := tx.ExecContext(ctx, createDataQualityIssuesTable)
+	return err
+}
+
+func createPersistedQueriesTable(ctx context.Context, tx *sql.Tx) error {
+	createPersistedQueriesTable := `
+		CREATE TABLE IF NOT EXISTS persisted_queries (
+		hash TEXT PRIMARY KEY,
+		query TEXT NOT NULL,
+		operation_name TEXT NOT NULL DEFAULT '',
+		allowed INTEGER NOT NULL DEFAULT 0,
+		created_at TEXT NOT NULL
+	);`
+	_, err := tx.ExecContext(ctx, createPersistedQueriesTable)
+	return err
+}
+
+func createCountryGroupTables(ctx context.Context, tx *sql.Tx) error {
+	createCountryGroupsTable := `
+		CREATE TABLE IF NOT EXISTS country_groups (
+		id INTEGER PRIMARY KEY,
+		name TEXT NOT NULL UNIQUE,
+		kind TEXT NOT NULL DEFAULT 'custom',
+		created_at TEXT NOT NULL
+	);`
+	_, err := tx.ExecContext(ctx, createCountryGroupsTable)
+	if err != nil {
+		return err
+	}
+
+	createCountryGroupMembersTable := `
+		CREATE TABLE IF NOT EXISTS country_group_members (
+		group_id INTEGER NOT NULL,
+		country_id INTEGER NOT NULL,
+		PRIMARY KEY (group_id, country_id),
+		FOREIGN KEY (group_id) REFERENCES country_groups (id) ON DELETE CASCADE,
+		FOREIGN KEY (country_id) REFERENCES countries (id) ON DELETE CASCADE
+	);`
+	_, err = tx.ExecContext(ctx, createCountryGroupMembersTable)
+	return err
+}
+
+func createCountryLatestStatsTable(ctx context.Context, tx *sql.Tx) error {
+	createCountryLatestStatsTable := `
+		CREATE TABLE IF NOT EXISTS country_latest_stats (
+		country_id INTEGER PRIMARY KEY,
+		covid_statistic_id INTEGER NOT NULL,
+		date TEXT NOT NULL,
+		confirmed INTEGER NOT NULL,
+		recovered INTEGER NOT NULL,
+		deaths INTEGER NOT NULL,
+		confirmed_1d INTEGER,
+		recovered_1d INTEGER,
+		deaths_1d INTEGER,
+		confirmed_7d INTEGER,
+		recovered_7d INTEGER,
+		deaths_7d INTEGER,
+		updated_at TEXT NOT NULL,
+		FOREIGN KEY (country_id) REFERENCES countries (id) ON DELETE CASCADE
+	);`
+	_, err := tx.ExecContext(ctx, createCountryLatestStatsTable)
+	return err
+}
+
+// syncCountryLatestStats summarises the countries that have statistics but no summary yet, such as every
+// country of a database created before the summaries were kept.
+func syncCountryLatestStats(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT DISTINCT country_id FROM covid_statistics
+		WHERE country_id NOT IN (SELECT country_id FROM country_latest_stats)`)
+	if err != nil {
+		return fmt.Errorf("could not get countries without latest statistics: %w", err)
+	}
+	var countryIDs []int
+	for rows.Next() {
+		var countryID int
+		if err := rows.Scan(&countryID); err != nil {
+			rows.Close()
+			return fmt.Errorf("could not scan country ID: %w", err)
+		}
+		countryIDs = append(countryIDs, countryID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error with rows: %w", err)
+	}
+
+	for _, countryID := range countryIDs {
+		if err := refreshCountryLatestStats(ctx, tx, countryID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshCountryLatestStats recomputes the summary of the latest statistic of a country, after any write to
+// its statistics. The changes compare the latest statistic to the last one at least 1 and 7 days older.
+func refreshCountryLatestStats(ctx context.Context, db execer, countryID int) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM country_latest_stats WHERE country_id = ?", countryID)
+	if err != nil {
+		return fmt.Errorf("could not clear latest statistics: %w", err)
+	}
+
+	refreshQuery := `
+		INSERT INTO country_latest_stats (
+			country_id, covid_statistic_id, date, confirmed, recovered, deaths,
+			confirmed_1d, recovered_1d, deaths_1d, confirmed_7d, recovered_7d, deaths_7d, updated_at
+		)
+		SELECT latest.country_id, latest.id, latest.date, latest.confirmed, latest.recovered, latest.deaths,
+			latest.confirmed - day.confirmed, latest.recovered - day.recovered, latest.deaths - day.deaths,
+			latest.confirmed - week.confirmed, latest.recovered - week.recovered, latest.deaths - week.deaths, ?
+		FROM (
+			SELECT * FROM covid_statistics WHERE country_id = ? ORDER BY date(date) DESC, id DESC LIMIT 1
+		) latest
+		LEFT JOIN covid_statistics day ON day.id = (
+			SELECT id FROM covid_statistics
+			WHERE country_id = latest.country_id AND date(date) <= date(latest.date, '-1 day')
+			ORDER BY date(date) DESC, id DESC LIMIT 1
+		)
+		LEFT JOIN covid_statistics week ON week.id = (
+			SELECT id FROM covid_statistics
+			WHERE country_id = latest.country_id AND date(date) <= date(latest.date, '-7 day')
+			ORDER BY date(date) DESC, id DESC LIMIT 1
+		)`
+	_, err = db.ExecContext(ctx, refreshQuery, time.Now().UTC().Format(time.RFC3339), countryID)
+	if err != nil {
+		return fmt.Errorf("could not refresh latest statistics: %w", err)
+	}
+	return nil
+}
+
+// seedContinentGroups creates a group per continent and puts every country with a known code in its continent.
+func seedContinentGroups(ctx context.Context, tx *sql.Tx) error {
+	continents := make([]string, 0, len(continentCountryCodes))
+	for continent := range continentCountryCodes {
+		continents = append(continents, continent)
+	}
+	sort.Strings(continents)
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, continent := range continents {
+		_, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO country_groups (name, kind, created_at) VALUES (?, ?, ?)", continent, GroupKindContinent, now)
+		if err != nil {
+			return fmt.Errorf("could not create continent group: %w", err)
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, code FROM countries")
+	if err != nil {
+		return fmt.Errorf("could not get countries: %w", err)
+	}
+	var countries []Country
+	for rows.Next() {
+		var country Country
+		if err := rows.Scan(&country.ID, &country.Code); err != nil {
+			rows.Close()
+			return fmt.Errorf("could not scan country: %w", err)
+		}
+		countries = append(countries, country)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error with rows: %w", err)
+	}
+
+	for _, country := range countries {
+		if err := addCountryToContinentGroup(ctx, tx, country.ID, country.Code, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execer is a *sql.DB or a *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// addCountryToContinentGroup puts a country in the group of the continent of its code. With replace,
+// it is first removed from the other continents, for countries whose code changed.
+func addCountryToContinentGroup(ctx context.Context, db execer, countryID int, code string, replace bool) error {
+	if replace {
+		removeQuery := `
+			DELETE FROM country_group_members
+			WHERE country_id = ? AND group_id IN (SELECT id FROM country_groups WHERE kind = ?)`
+		if _, err := db.ExecContext(ctx, removeQuery, countryID, GroupKindContinent); err != nil {
+			return fmt.Errorf("could not remove country from its continent: %w", err)
+		}
+	}
+
+	continent, ok := ContinentOf(code)
+	if !ok {
+		return nil
+	}
+	addQuery := `
+		INSERT OR IGNORE INTO country_group_members (group_id, country_id)
+		SELECT id, ? FROM country_groups WHERE kind = ? AND name = ?`
+	if _, err := db.ExecContext(ctx, addQuery, countryID, GroupKindContinent, continent); err != nil {
+		return fmt.Errorf("could not add country to its continent: %w", err)
+	}
+	return nil
+}
+
+// migrations change tables that already exist in deployed databases. They are applied in order
+// on top of CreateTables, and the number of applied migrations is kept in PRAGMA user_version.
+// Only ever append to this list.
+var migrations = []string{
+	`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user'`,
+	`CREATE INDEX IF NOT EXISTS idx_covid_statistics_country_date ON covid_statistics (country_id, date)`,
+	// the latest statistics and the date ranges compare date(date), which the index above cannot serve:
+	`CREATE INDEX IF NOT EXISTS idx_covid_statistics_country_day ON covid_statistics (country_id, date(date))`,
+	`CREATE INDEX IF NOT EXISTS idx_data_quality_issues_statistic ON data_quality_issues (covid_statistic_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_data_quality_issues_country_date ON data_quality_issues (country_id, date)`,
+	// the foreign keys deleting with a country look the country up in every table referencing it:
+	`CREATE INDEX IF NOT EXISTS idx_user_monitored_countries_country ON user_monitored_countries (country_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_country_group_members_country ON country_group_members (country_id)`,
+	// when a country or its statistics last changed, for the conditional requests of the REST API:
+	`ALTER TABLE countries ADD COLUMN updated_at TEXT NOT NULL DEFAULT ''`,
+	// the users registered before the email verification count as verified, RegisterUser sets it to 0:
+	`ALTER TABLE users ADD COLUMN email_verified INTEGER NOT NULL DEFAULT 1`,
+	// the tokens emailed for the password resets and the email verifications, a single one per user and purpose:
+	`CREATE TABLE IF NOT EXISTS user_tokens (
+		token_hash TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		purpose TEXT NOT NULL,
+		expires_at TEXT NOT NULL,
+		UNIQUE (user_id, purpose)
+	)`,
+	// the version of the tokens of a user, SetUserPassword bumps it to revoke the tokens issued before:
+	`ALTER TABLE users ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0`,
+}
+
+func runMigrations(ctx context.Context, tx *sql.Tx) error {
+	var version int
+	err := tx.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return fmt.Errorf("could not read schema version: %w", err)
+	}
+
+	for i := version; i < len(migrations); i++ {
+		_, err := tx.ExecContext(ctx, migrations[i])
+		if err != nil {
+			return fmt.Errorf("could not apply migration %d: %w", i+1, err)
+		}
+	}
+
+	// PRAGMA statements do not accept placeholders:
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", len(migrations)))
 	return err
 }
 
+// NewDB wraps a pool opened elsewhere, which runs both the reads and the writes without preparing them.
 func NewDB(db *sql.DB) *DB {
-	return &DB{db: db}
+	return &DB{db: db, read: db}
+}
+
+// Close closes the pools opened by ConnectDB, the pool of a DB made by NewDB is left to its owner.
+func (d *DB) Close() error {
+	if d.statements == nil {
+		return nil
+	}
+	return errors.Join(d.statements.close(), d.read.Close(), d.db.Close())
+}
+
+// statementCache prepares every read once, on first use, and keeps it for the life of the pool. Only
+// queries with a fixed text are worth caching, not those built with a variable number of placeholders.
+type statementCache struct {
+	db *sql.DB
+
+	mu         sync.Mutex
+	statements map[string]*sql.Stmt
+}
+
+func newStatementCache(db *sql.DB) *statementCache {
+	return &statementCache{db: db, statements: map[string]*sql.Stmt{}}
+}
+
+func (c *statementCache) prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if stmt, ok := c.statements[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := c.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	c.statements[query] = stmt
+	return stmt, nil
+}
+
+func (c *statementCache) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	for query, stmt := range c.statements {
+		errs = append(errs, stmt.Close())
+		delete(c.statements, query)
+	}
+	return errors.Join(errs...)
+}
+
+// query runs a read with a fixed text, prepared when the DB has a statement cache.
+func (d *DB) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if d.statements == nil {
+		return d.read.QueryContext(ctx, query, args...)
+	}
+	stmt, err := d.statements.prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.QueryContext(ctx, args...)
+}
+
+// queryRow is query for a single row.
+func (d *DB) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	if d.statements != nil {
+		if stmt, err := d.statements.prepare(ctx, query); err == nil {
+			return stmt.QueryRowContext(ctx, args...)
+		}
+	}
+	// unprepared, the query returns the error through its row:
+	return d.read.QueryRowContext(ctx, query, args...)
 }
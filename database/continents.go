@@ -0,0 +1,36 @@
+package database
+
+import (
+	"strings"
+)
+
+// ISO 3166-1 alpha-2 codes of the countries and territories of every continent.
+var continentCountryCodes = map[string]string{
+	"Africa": "DZ AO BJ BW BF BI CV CM CF TD KM CG CD CI DJ EG GQ ER SZ ET GA GM GH GN GW KE LS LR LY MG MW ML " +
+		"MR MU YT MA MZ NA NE NG RE RW SH ST SN SC SL SO ZA SS SD TZ TG TN UG EH ZM ZW",
+	"Antarctica": "AQ BV GS HM TF",
+	"Asia": "AF AM AZ BH BD BT BN KH CN CY GE HK IN ID IR IQ IL JP JO KZ KW KG LA LB MO MY MV MN MM NP KP OM PK " +
+		"PS PH QA SA SG KR LK SY TW TJ TH TL TR TM AE UZ VN YE IO CX CC",
+	"Europe": "AX AL AD AT BY BE BA BG HR CZ DK EE FO FI FR DE GI GR GG VA HU IS IE IM IT JE XK LV LI LT LU MT MD " +
+		"MC ME NL MK NO PL PT RO RU SM RS SK SI ES SJ SE CH UA GB",
+	"North America": "AI AG AW BS BB BZ BM BQ VG CA KY CR CU CW DM DO SV GL GD GP GT HT HN JM MQ MX MS NI PA PR BL " +
+		"KN LC MF PM VC SX TT TC US VI",
+	"Oceania":       "AS AU CK FJ PF GU KI MH FM NR NC NZ NU NF MP PW PG PN WS SB TK TO TV UM VU WF",
+	"South America": "AR BO BR CL CO EC FK GF GY PY PE SR UY VE",
+}
+
+var continentsByCode = func() map[string]string {
+	continents := map[string]string{}
+	for continent, codes := range continentCountryCodes {
+		for _, code := range strings.Fields(codes) {
+			continents[code] = continent
+		}
+	}
+	return continents
+}()
+
+// ContinentOf returns the continent of a country from its ISO 3166-1 alpha-2 code, false for unknown codes.
+func ContinentOf(code string) (string, bool) {
+	continent, ok := continentsByCode[strings.ToUpper(code)]
+	return continent, ok
+}
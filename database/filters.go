@@ -0,0 +1,130 @@
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Sort orders of CountryFilter and CovidStatisticFilter.
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// ErrInvalidFilter is wrapped by the errors returned for unknown sort fields and malformed cursors.
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// CountrySortFields and CovidStatisticSortFields are the fields lists can be sorted by.
+var (
+	CountrySortFields        = []string{"id", "name", "code"}
+	CovidStatisticSortFields = []string{"id", "date", "confirmed", "recovered", "deaths"}
+)
+
+// CountryFilter selects a page of countries. It is used by both the REST and the GraphQL API so that
+// they filter, sort and paginate the same way.
+type CountryFilter struct {
+	CodeEquals   *string
+	NameContains *string
+	// SortBy is one of CountrySortFields, id when empty.
+	SortBy    string
+	SortOrder string
+	// First is the size of the page, every country is returned when nil.
+	First *int
+	// After is the cursor of the last country of the previous page.
+	After *string
+}
+
+// CovidStatisticFilter selects a page of the statistics of a country, see CountryFilter.
+type CovidStatisticFilter struct {
+	CountryID int
+	// DateFrom and DateTo are inclusive, formatted as 2006-01-02.
+	DateFrom  *string
+	DateTo    *string
+	SortBy    string
+	SortOrder string
+	First     *int
+	After     *string
+}
+
+// EncodeCursor returns the opaque cursor pointing at the row with the given id.
+func EncodeCursor(id int) string {
+	return base64.StdEncoding.EncodeToString([]byte(strconv.Itoa(id)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	decoded, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, fmt.Errorf("%w: malformed cursor", ErrInvalidFilter)
+	}
+	id, err := strconv.Atoi(string(decoded))
+	if err != nil {
+		return 0, fmt.Errorf("%w: malformed cursor", ErrInvalidFilter)
+	}
+	return id, nil
+}
+
+// keyset returns the ORDER BY clause of a sorted list, and when after is set, the condition selecting the rows
+// that come after the cursor row. Rows are sorted by id on ties so that pages never overlap.
+func keyset(table string, alias string, sortBy string, sortOrder string, fields []string, after *string) (string, string, []any, error) {
+	if sortBy == "" {
+		sortBy = "id"
+	}
+	if !contains(fields, sortBy) {
+		return "", "", nil, fmt.Errorf("%w: cannot sort by %q", ErrInvalidFilter, sortBy)
+	}
+
+	direction, comparison := "ASC", ">"
+	switch sortOrder {
+	case "", SortAsc:
+	case SortDesc:
+		direction, comparison = "DESC", "<"
+	default:
+		return "", "", nil, fmt.Errorf("%w: unknown sort order %q", ErrInvalidFilter, sortOrder)
+	}
+
+	column := alias + sortBy
+	id := alias + "id"
+	orderBy := fmt.Sprintf(" ORDER BY %s %s", column, direction)
+	if sortBy != "id" {
+		orderBy += fmt.Sprintf(", %s %s", id, direction)
+	}
+
+	if after == nil {
+		return orderBy, "", nil, nil
+	}
+	cursor, err := decodeCursor(*after)
+	if err != nil {
+		return "", "", nil, err
+	}
+	if sortBy == "id" {
+		return orderBy, fmt.Sprintf("%s %s ?", id, comparison), []any{cursor}, nil
+	}
+
+	cursorValue := fmt.Sprintf("(SELECT %s FROM %s WHERE id = ?)", sortBy, table)
+	condition := fmt.Sprintf("(%s %s %s OR (%s = %s AND %s %s ?))", column, comparison, cursorValue, column, cursorValue, id, comparison)
+	return orderBy, condition, []any{cursor, cursor, cursor}, nil
+}
+
+// nextCursor drops the extra row fetched to know whether there is a next page, and returns the cursor of that page.
+func nextCursor(ids []int, first *int) (int, *string) {
+	if first == nil || len(ids) <= *first {
+		return len(ids), nil
+	}
+	// an empty page has no row for the cursor to point at:
+	if *first == 0 {
+		return 0, nil
+	}
+	cursor := EncodeCursor(ids[*first-1])
+	return *first, &cursor
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// QueryHook is called after every statement run on a DB opened by ConnectDB, with the operation of the
+// statement, how long SQLite took to run it and its error. Operations are the verb and the first table of
+// statements, such as "select countries" or "insert covid_statistics", and begin, commit and rollback for
+// transactions. The time of a query is the time spent reading its rows, not the time the caller spends on them.
+type QueryHook func(operation string, duration time.Duration, err error)
+
+// connector opens the SQLite connections of a pool, wrapped to log the statements at the debug level, with the
+// context they run in, and to call hook when there is one.
+type connector struct {
+	dsn  string
+	hook QueryHook
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Driver().Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &hookedConn{SQLiteConn: conn.(*sqlite3.SQLiteConn), hook: c.hook}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return &sqlite3.SQLiteDriver{}
+}
+
+// observe logs a statement and calls hook.
+func observe(ctx context.Context, hook QueryHook, operation string, duration time.Duration, err error) {
+	if hook != nil {
+		hook(operation, duration, err)
+	}
+	if slog.Default().Enabled(ctx, slog.LevelDebug) {
+		attrs := []slog.Attr{slog.String("operation", operation), slog.Duration("duration", duration)}
+		if err != nil {
+			attrs = append(attrs, slog.String("error", err.Error()))
+		}
+		slog.LogAttrs(ctx, slog.LevelDebug, "statement", attrs...)
+	}
+}
+
+type hookedConn struct {
+	*sqlite3.SQLiteConn
+	hook QueryHook
+}
+
+func (c *hookedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	result, err := c.SQLiteConn.ExecContext(ctx, query, args)
+	observe(ctx, c.hook, statementOperation(query), time.Since(start), err)
+	return result, err
+}
+
+func (c *hookedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.SQLiteConn.QueryContext(ctx, query, args)
+	return hookRows(ctx, rows, err, statementOperation(query), time.Since(start), c.hook)
+}
+
+func (c *hookedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.SQLiteConn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &hookedStmt{SQLiteStmt: stmt.(*sqlite3.SQLiteStmt), operation: statementOperation(query), hook: c.hook}, nil
+}
+
+func (c *hookedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	start := time.Now()
+	tx, err := c.SQLiteConn.BeginTx(ctx, opts)
+	observe(ctx, c.hook, "begin", time.Since(start), err)
+	if err != nil {
+		return nil, err
+	}
+	return &hookedTx{Tx: tx, ctx: ctx, hook: c.hook}, nil
+}
+
+type hookedStmt struct {
+	*sqlite3.SQLiteStmt
+	operation string
+	hook      QueryHook
+}
+
+func (s *hookedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	result, err := s.SQLiteStmt.ExecContext(ctx, args)
+	observe(ctx, s.hook, s.operation, time.Since(start), err)
+	return result, err
+}
+
+func (s *hookedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := s.SQLiteStmt.QueryContext(ctx, args)
+	return hookRows(ctx, rows, err, s.operation, time.Since(start), s.hook)
+}
+
+// hookRows observes a query once its rows are closed, with the time spent reading them.
+func hookRows(ctx context.Context, rows driver.Rows, err error, operation string, elapsed time.Duration, hook QueryHook) (driver.Rows, error) {
+	if err != nil {
+		observe(ctx, hook, operation, elapsed, err)
+		return nil, err
+	}
+	return &hookedRows{SQLiteRows: rows.(*sqlite3.SQLiteRows), ctx: ctx, operation: operation, elapsed: elapsed, hook: hook}, nil
+}
+
+type hookedRows struct {
+	*sqlite3.SQLiteRows
+	ctx       context.Context
+	operation string
+	elapsed   time.Duration
+	err       error
+	hook      QueryHook
+}
+
+func (r *hookedRows) Next(dest []driver.Value) error {
+	start := time.Now()
+	err := r.SQLiteRows.Next(dest)
+	r.elapsed += time.Since(start)
+	if err != nil && !errors.Is(err, io.EOF) && r.err == nil {
+		r.err = err
+	}
+	return err
+}
+
+func (r *hookedRows) Close() error {
+	err := r.SQLiteRows.Close()
+	observe(r.ctx, r.hook, r.operation, r.elapsed, r.err)
+	return err
+}
+
+type hookedTx struct {
+	driver.Tx
+	ctx  context.Context
+	hook QueryHook
+}
+
+func (tx *hookedTx) Commit() error {
+	start := time.Now()
+	err := tx.Tx.Commit()
+	observe(tx.ctx, tx.hook, "commit", time.Since(start), err)
+	return err
+}
+
+func (tx *hookedTx) Rollback() error {
+	start := time.Now()
+	err := tx.Tx.Rollback()
+	observe(tx.ctx, tx.hook, "rollback", time.Since(start), err)
+	return err
+}
+
+// statementOperations caches the operations of the statements, which are few and run over and over.
+var statementOperations sync.Map
+
+// statementOperation names a statement by its verb and the first table it reads or writes, which keeps the
+// labels of the metrics few whatever the text of the statements.
+func statementOperation(query string) string {
+	if operation, ok := statementOperations.Load(query); ok {
+		return operation.(string)
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(strings.ReplaceAll(query, "(", " ( ")), func(r rune) bool {
+		return unicode.IsSpace(r) || r == ',' || r == ';' || r == ')'
+	})
+	operation := "unknown"
+	if len(words) > 0 {
+		operation = words[0]
+	}
+
+	// the table follows the first of these keywords that is not followed by a subquery:
+	var tableKeyword string
+	switch operation {
+	case "select", "with", "delete":
+		tableKeyword = "from"
+	case "insert", "replace":
+		tableKeyword = "into"
+	case "update":
+		tableKeyword = "update"
+	}
+	if tableKeyword != "" {
+		for i := 0; i < len(words)-1; i++ {
+			if words[i] == tableKeyword && words[i+1] != "(" {
+				operation += " " + strings.Trim(words[i+1], "\"`[]")
+				break
+			}
+		}
+	}
+
+	statementOperations.Store(query, operation)
+	return operation
+}
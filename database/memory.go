@@ -0,0 +1,1255 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store kept in memory, safe for concurrent use. It is meant for tests and throwaway servers,
+// everything is lost when the process exits.
+type MemoryStore struct {
+	mu sync.RWMutex
+
+	countries       map[int]Country
+	covidStatistics map[int]CovidStatistic
+	users           map[int]User
+	// monitored holds the IDs of the countries monitored by every user.
+	monitored map[int]map[int]bool
+	issues    map[int]DataQualityIssue
+	// latestUpdatedAt is when the statistics of a country last changed, see CountryLatestStatistics.
+	latestUpdatedAt map[int]string
+	// updatedAt is when a country or its statistics last changed, see GetCountryUpdatedAt.
+	updatedAt map[int]time.Time
+	// userTokens are the tokens emailed to users, by hash.
+	userTokens map[string]userToken
+	// groups are kept without their members, groupMembers holds the IDs of the countries of every group.
+	groups           map[int]CountryGroup
+	groupMembers     map[int]map[int]bool
+	persistedQueries map[string]PersistedQuery
+
+	lastCountryID        int
+	lastCovidStatisticID int
+	lastUserID           int
+	lastIssueID          int
+	lastGroupID          int
+}
+
+func NewMemoryStore() *MemoryStore {
+	m := &MemoryStore{
+		countries:        map[int]Country{},
+		covidStatistics:  map[int]CovidStatistic{},
+		users:            map[int]User{},
+		monitored:        map[int]map[int]bool{},
+		issues:           map[int]DataQualityIssue{},
+		latestUpdatedAt:  map[int]string{},
+		updatedAt:        map[int]time.Time{},
+		userTokens:       map[string]userToken{},
+		groups:           map[int]CountryGroup{},
+		groupMembers:     map[int]map[int]bool{},
+		persistedQueries: map[string]PersistedQuery{},
+	}
+
+	// the continent groups are created like seedContinentGroups does:
+	continents := make([]string, 0, len(continentCountryCodes))
+	for continent := range continentCountryCodes {
+		continents = append(continents, continent)
+	}
+	sort.Strings(continents)
+	createdAt := time.Now().UTC().Format(time.RFC3339)
+	for _, continent := range continents {
+		m.createGroup(continent, GroupKindContinent, createdAt)
+	}
+	return m
+}
+
+type userToken struct {
+	userID    int
+	purpose   string
+	expiresAt time.Time
+}
+
+func (m *MemoryStore) GetCountries(ctx context.Context, filter CountryFilter) ([]Country, *string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var countries []Country
+	for _, country := range m.countries {
+		if filter.CodeEquals != nil && country.Code != *filter.CodeEquals {
+			continue
+		}
+		// LIKE ignores the case of ASCII letters:
+		if filter.NameContains != nil && !strings.Contains(strings.ToLower(country.Name), strings.ToLower(*filter.NameContains)) {
+			continue
+		}
+		countries = append(countries, country)
+	}
+
+	field := func(country Country, name string) any {
+		switch name {
+		case "name":
+			return country.Name
+		case "code":
+			return country.Code
+		}
+		return country.ID
+	}
+	byID := func(id int) (Country, bool) {
+		country, ok := m.countries[id]
+		return country, ok
+	}
+	return memoryPage(countries, filter.SortBy, filter.SortOrder, CountrySortFields, filter.After, filter.First,
+		func(country Country) int { return country.ID }, field, byID)
+}
+
+func (m *MemoryStore) GetCountryByID(ctx context.Context, id int) (Country, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	country, ok := m.countries[id]
+	if !ok {
+		return Country{}, fmt.Errorf("could not scan country row: %w", sql.ErrNoRows)
+	}
+	country.CovidStatistics = m.countryCovidStatistics(id, nil, nil)
+	return country, nil
+}
+
+func (m *MemoryStore) CreateCountry(ctx context.Context, name string, code string) (Country, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, country := range m.countries {
+		if country.Name == name {
+			return Country{}, true, nil
+		}
+	}
+	for _, country := range m.countries {
+		if country.Code == code {
+			return Country{}, false, fmt.Errorf("country code %q is already used", code)
+		}
+	}
+
+	m.lastCountryID++
+	country := Country{ID: m.lastCountryID, Name: name, Code: code}
+	m.countries[country.ID] = country
+	m.updatedAt[country.ID] = time.Now()
+	m.addCountryToContinentGroup(country.ID, code)
+	return country, false, nil
+}
+
+func (m *MemoryStore) UpdateCountry(ctx context.Context, id int, name string, code string) (Country, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.countries[id]; !ok {
+		return Country{}, fmt.Errorf("country %w", ErrNotFound)
+	}
+	for _, country := range m.countries {
+		if country.ID == id {
+			continue
+		}
+		if country.Name == name || country.Code == code {
+			return Country{}, fmt.Errorf("could not update country: the name or code of country %d is the same", country.ID)
+		}
+	}
+
+	country := Country{ID: id, Name: name, Code: code}
+	m.countries[id] = country
+	m.updatedAt[id] = time.Now()
+	for groupID, group := range m.groups {
+		if group.Kind == GroupKindContinent {
+			delete(m.groupMembers[groupID], id)
+		}
+	}
+	m.addCountryToContinentGroup(id, code)
+	return country, nil
+}
+
+func (m *MemoryStore) DeleteCountry(ctx context.Context, countryID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.countries[countryID]; !ok {
+		return fmt.Errorf("country %w", ErrNotFound)
+	}
+	delete(m.countries, countryID)
+	delete(m.latestUpdatedAt, countryID)
+	delete(m.updatedAt, countryID)
+	for id, covidStatistic := range m.covidStatistics {
+		if covidStatistic.CountryID == countryID {
+			m.deleteCovidStatistic(id)
+		}
+	}
+	for _, countryIDs := range m.monitored {
+		delete(countryIDs, countryID)
+	}
+	for _, countryIDs := range m.groupMembers {
+		delete(countryIDs, countryID)
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetCovidStatistic(ctx context.Context, id int) (CovidStatistic, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	covidStatistic, ok := m.covidStatistics[id]
+	if !ok {
+		return CovidStatistic{}, fmt.Errorf("could not get covid statistic: %w", sql.ErrNoRows)
+	}
+	return covidStatistic, nil
+}
+
+func (m *MemoryStore) GetCovidStatistics(ctx context.Context, countryID int) ([]CovidStatistic, error) {
+	covidStatistics, _, err := m.ListCovidStatistics(ctx, CovidStatisticFilter{CountryID: countryID})
+	return covidStatistics, err
+}
+
+func (m *MemoryStore) ListCovidStatistics(ctx context.Context, filter CovidStatisticFilter) ([]CovidStatistic, *string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	covidStatistics := m.countryCovidStatistics(filter.CountryID, filter.DateFrom, filter.DateTo)
+	field := func(covidStatistic CovidStatistic, name string) any {
+		switch name {
+		case "date":
+			return m.covidStatistics[covidStatistic.ID].Date
+		case "confirmed":
+			return covidStatistic.Confirmed
+		case "recovered":
+			return covidStatistic.Recovered
+		case "deaths":
+			return covidStatistic.Deaths
+		}
+		return covidStatistic.ID
+	}
+	byID := func(id int) (CovidStatistic, bool) {
+		covidStatistic, ok := m.covidStatistics[id]
+		return covidStatistic, ok
+	}
+	return memoryPage(covidStatistics, filter.SortBy, filter.SortOrder, CovidStatisticSortFields, filter.After, filter.First,
+		func(covidStatistic CovidStatistic) int { return covidStatistic.ID }, field, byID)
+}
+
+// countryCovidStatistics returns the statistics of a country between two days, ordered by id, the way they are
+// listed: with their country and their day only.
+func (m *MemoryStore) countryCovidStatistics(countryID int, dateFrom *string, dateTo *string) []CovidStatistic {
+	var covidStatistics []CovidStatistic
+	for _, covidStatistic := range m.covidStatistics {
+		if covidStatistic.CountryID != countryID || !inDateRange(covidStatistic.Date, dateFrom, dateTo) {
+			continue
+		}
+		covidStatistic.Date = day(covidStatistic.Date)
+		covidStatistic.Country = m.countries[countryID]
+		covidStatistics = append(covidStatistics, covidStatistic)
+	}
+	sort.Slice(covidStatistics, func(i, j int) bool {
+		return covidStatistics[i].ID < covidStatistics[j].ID
+	})
+	return covidStatistics
+}
+
+func (m *MemoryStore) StreamCovidStatistics(ctx context.Context, countryIDs []int, dateFrom *string, dateTo *string, fn func(CovidStatistic) error) error {
+	// the statistics are copied so that fn can call the store:
+	m.mu.RLock()
+	var covidStatistics []CovidStatistic
+	for _, covidStatistic := range m.covidStatistics {
+		if len(countryIDs) > 0 && !containsInt(countryIDs, covidStatistic.CountryID) {
+			continue
+		}
+		if !inDateRange(covidStatistic.Date, dateFrom, dateTo) {
+			continue
+		}
+		covidStatistic.Date = day(covidStatistic.Date)
+		covidStatistic.Country = m.countries[covidStatistic.CountryID]
+		covidStatistics = append(covidStatistics, covidStatistic)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(covidStatistics, func(i, j int) bool {
+		a, b := covidStatistics[i], covidStatistics[j]
+		if a.CountryID != b.CountryID {
+			return a.CountryID < b.CountryID
+		}
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		return a.ID < b.ID
+	})
+
+	for _, covidStatistic := range covidStatistics {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("could not stream covid statistics: %w", err)
+		}
+		if err := fn(covidStatistic); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) AddCovidStatistic(ctx context.Context, countryID int, date string, confirmed int, recovered int, deaths int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.countries[countryID]; !ok {
+		return 0, fmt.Errorf("error inserting covid statistic into database: country with ID %d %w", countryID, ErrNotFound)
+	}
+
+	m.lastCovidStatisticID++
+	m.covidStatistics[m.lastCovidStatisticID] = CovidStatistic{
+		ID:        m.lastCovidStatisticID,
+		CountryID: countryID,
+		Date:      date,
+		Confirmed: confirmed,
+		Recovered: recovered,
+		Deaths:    deaths,
+	}
+	m.touchLatest(countryID)
+	return m.lastCovidStatisticID, nil
+}
+
+func (m *MemoryStore) UpdateCovidStatistic(ctx context.Context, id int, date string, confirmed int, recovered int, deaths int) (CovidStatistic, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	covidStatistic, ok := m.covidStatistics[id]
+	if !ok {
+		return CovidStatistic{}, fmt.Errorf("covid statistic %w", ErrNotFound)
+	}
+	covidStatistic.Date = date
+	covidStatistic.Confirmed = confirmed
+	covidStatistic.Recovered = recovered
+	covidStatistic.Deaths = deaths
+	m.covidStatistics[id] = covidStatistic
+	m.touchLatest(covidStatistic.CountryID)
+	return covidStatistic, nil
+}
+
+func (m *MemoryStore) DeleteCovidStatistic(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	covidStatistic, ok := m.covidStatistics[id]
+	if !ok {
+		return fmt.Errorf("covid stat %w", ErrNotFound)
+	}
+	m.deleteCovidStatistic(id)
+	m.touchLatest(covidStatistic.CountryID)
+	return nil
+}
+
+// deleteCovidStatistic deletes a statistic with its data quality issues.
+func (m *MemoryStore) deleteCovidStatistic(id int) {
+	delete(m.covidStatistics, id)
+	for issueID, issue := range m.issues {
+		if issue.CovidStatisticID == id {
+			delete(m.issues, issueID)
+		}
+	}
+}
+
+// touchLatest records that the latest statistics of a country changed, they are computed on read.
+func (m *MemoryStore) touchLatest(countryID int) {
+	m.latestUpdatedAt[countryID] = time.Now().UTC().Format(time.RFC3339)
+	m.updatedAt[countryID] = time.Now()
+}
+
+func (m *MemoryStore) CheckCovidStatisticExists(ctx context.Context, countryID int, date string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, covidStatistic := range m.covidStatistics {
+		if covidStatistic.CountryID == countryID && covidStatistic.Date == date {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryStore) GetCountryIDByCovidStatisticID(ctx context.Context, covidStatisticID int) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	covidStatistic, ok := m.covidStatistics[covidStatisticID]
+	if !ok {
+		return 0, fmt.Errorf("error getting country ID for covid statistic with ID %d: %w", covidStatisticID, sql.ErrNoRows)
+	}
+	return covidStatistic.CountryID, nil
+}
+
+func (m *MemoryStore) GetPreviousCovidStatistics(ctx context.Context, countryID int, date string, excludeID int, limit int) ([]CovidStatistic, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var covidStatistics []CovidStatistic
+	for _, covidStatistic := range m.covidStatistics {
+		if covidStatistic.CountryID == countryID && covidStatistic.Date < date && covidStatistic.ID != excludeID {
+			covidStatistics = append(covidStatistics, covidStatistic)
+		}
+	}
+	sortByDate(covidStatistics, true)
+	if limit >= 0 && len(covidStatistics) > limit {
+		covidStatistics = covidStatistics[:limit]
+	}
+	return covidStatistics, nil
+}
+
+func (m *MemoryStore) GetNextCovidStatistic(ctx context.Context, countryID int, date string, excludeID int) (CovidStatistic, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var covidStatistics []CovidStatistic
+	for _, covidStatistic := range m.covidStatistics {
+		if covidStatistic.CountryID == countryID && covidStatistic.Date > date && covidStatistic.ID != excludeID {
+			covidStatistics = append(covidStatistics, covidStatistic)
+		}
+	}
+	if len(covidStatistics) == 0 {
+		return CovidStatistic{}, false, nil
+	}
+	sortByDate(covidStatistics, false)
+	return covidStatistics[0], true, nil
+}
+
+func (m *MemoryStore) CountCovidStatisticsOnDate(ctx context.Context, countryID int, date string, excludeID int) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, covidStatistic := range m.covidStatistics {
+		if covidStatistic.CountryID == countryID && covidStatistic.Date == date && covidStatistic.ID != excludeID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MemoryStore) GetLatestCovidStatistics(ctx context.Context, asOf *string, countryIDs []int) ([]LatestCovidStatistic, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	byCountry := map[int][]CovidStatistic{}
+	for _, covidStatistic := range m.covidStatistics {
+		if len(countryIDs) > 0 && !containsInt(countryIDs, covidStatistic.CountryID) {
+			continue
+		}
+		if !inDateRange(covidStatistic.Date, nil, asOf) {
+			continue
+		}
+		covidStatistic.Country = m.countries[covidStatistic.CountryID]
+		byCountry[covidStatistic.CountryID] = append(byCountry[covidStatistic.CountryID], covidStatistic)
+	}
+
+	latest := []LatestCovidStatistic{}
+	for _, countryID := range sortedKeys(byCountry) {
+		covidStatistics := byCountry[countryID]
+		sortByDay(covidStatistics)
+		statistic := LatestCovidStatistic{Country: m.countries[countryID], Latest: covidStatistics[0]}
+		if len(covidStatistics) > 1 {
+			previous := covidStatistics[1]
+			statistic.Previous = &previous
+		}
+		latest = append(latest, statistic)
+	}
+	return latest, nil
+}
+
+func (m *MemoryStore) GetLatestCovidStatisticsByCountryID(ctx context.Context, countryID int) (CovidStatistic, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	latest, ok := m.countryLatestStatistics(countryID)
+	if !ok {
+		return CovidStatistic{}, fmt.Errorf("could not get latest covid statistics by country id: %w", sql.ErrNoRows)
+	}
+	return CovidStatistic{
+		ID:        latest.CovidStatisticID,
+		CountryID: latest.CountryID,
+		Date:      latest.Date,
+		Confirmed: latest.Confirmed,
+		Recovered: latest.Recovered,
+		Deaths:    latest.Deaths,
+	}, nil
+}
+
+func (m *MemoryStore) GetCountryLatestStatistics(ctx context.Context, countryID int) (CountryLatestStatistics, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	latest, ok := m.countryLatestStatistics(countryID)
+	if !ok {
+		return latest, fmt.Errorf("could not get latest statistics of country: %w", sql.ErrNoRows)
+	}
+	return latest, nil
+}
+
+func (m *MemoryStore) ListCountryLatestStatistics(ctx context.Context) ([]CountryLatestStatistics, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	countryIDs := make([]int, 0, len(m.countries))
+	for countryID := range m.countries {
+		countryIDs = append(countryIDs, countryID)
+	}
+	sort.Ints(countryIDs)
+
+	var latestStatistics []CountryLatestStatistics
+	for _, countryID := range countryIDs {
+		if latest, ok := m.countryLatestStatistics(countryID); ok {
+			latestStatistics = append(latestStatistics, latest)
+		}
+	}
+	return latestStatistics, nil
+}
+
+// countryLatestStatistics computes what refreshCountryLatestStats stores, the bool is false when the country
+// has no statistics.
+func (m *MemoryStore) countryLatestStatistics(countryID int) (CountryLatestStatistics, bool) {
+	var covidStatistics []CovidStatistic
+	for _, covidStatistic := range m.covidStatistics {
+		if covidStatistic.CountryID == countryID {
+			covidStatistics = append(covidStatistics, covidStatistic)
+		}
+	}
+	if len(covidStatistics) == 0 {
+		return CountryLatestStatistics{}, false
+	}
+	sortByDay(covidStatistics)
+
+	latest := covidStatistics[0]
+	summary := CountryLatestStatistics{
+		CountryID:        countryID,
+		CovidStatisticID: latest.ID,
+		Date:             latest.Date,
+		Confirmed:        latest.Confirmed,
+		Recovered:        latest.Recovered,
+		Deaths:           latest.Deaths,
+		UpdatedAt:        m.latestUpdatedAt[countryID],
+	}
+
+	// the changes compare to the last statistic at least that many days older:
+	latestDay, err := time.Parse("2006-01-02", day(latest.Date))
+	if err != nil {
+		return summary, true
+	}
+	change := func(days int) *StatisticChange {
+		before := latestDay.AddDate(0, 0, -days).Format("2006-01-02")
+		for _, covidStatistic := range covidStatistics {
+			if day(covidStatistic.Date) <= before {
+				return &StatisticChange{
+					Confirmed: latest.Confirmed - covidStatistic.Confirmed,
+					Recovered: latest.Recovered - covidStatistic.Recovered,
+					Deaths:    latest.Deaths - covidStatistic.Deaths,
+				}
+			}
+		}
+		return nil
+	}
+	summary.Change1Day = change(1)
+	summary.Change7Days = change(7)
+	return summary, true
+}
+
+func (m *MemoryStore) GetDeathPercentage(ctx context.Context, countryID int) (float64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	latest, ok := m.countryLatestStatistics(countryID)
+	if !ok {
+		return 0, fmt.Errorf("could not get death percentage: %w", sql.ErrNoRows)
+	}
+	// SQLite divides by zero into NULL, which cannot be read as a number:
+	if latest.Confirmed == 0 {
+		return 0, errors.New("could not get death percentage: the country has no confirmed cases")
+	}
+	return float64(latest.Deaths) / float64(latest.Confirmed) * 100, nil
+}
+
+func (m *MemoryStore) ReplaceDataQualityIssues(ctx context.Context, covidStatisticID int, issues []DataQualityIssue) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.covidStatistics[covidStatisticID]; !ok && len(issues) > 0 {
+		return fmt.Errorf("could not insert data quality issue: covid statistic %d %w", covidStatisticID, ErrNotFound)
+	}
+	for id, issue := range m.issues {
+		if issue.CovidStatisticID == covidStatisticID {
+			delete(m.issues, id)
+		}
+	}
+	for _, issue := range issues {
+		m.lastIssueID++
+		issue.ID = m.lastIssueID
+		issue.CovidStatisticID = covidStatisticID
+		m.issues[issue.ID] = issue
+	}
+	if covidStatistic, ok := m.covidStatistics[covidStatisticID]; ok {
+		m.updatedAt[covidStatistic.CountryID] = time.Now()
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetCountryUpdatedAt(ctx context.Context, countryID int) (time.Time, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.countries[countryID]; !ok {
+		return time.Time{}, fmt.Errorf("could not get the last change of the country: %w", sql.ErrNoRows)
+	}
+	return m.updatedAt[countryID].UTC(), nil
+}
+
+func (m *MemoryStore) GetCountriesUpdatedAt(ctx context.Context) (time.Time, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var latest time.Time
+	for _, updatedAt := range m.updatedAt {
+		if updatedAt.After(latest) {
+			latest = updatedAt
+		}
+	}
+	return latest.UTC(), len(m.countries), nil
+}
+
+func (m *MemoryStore) GetDataQualityIssuesByCovidStatisticID(ctx context.Context, covidStatisticID int) ([]DataQualityIssue, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var issues []DataQualityIssue
+	for _, id := range sortedKeys(m.issues) {
+		if m.issues[id].CovidStatisticID == covidStatisticID {
+			issues = append(issues, m.issues[id])
+		}
+	}
+	return issues, nil
+}
+
+func (m *MemoryStore) GetDataQualityIssuesByCountryID(ctx context.Context, countryID int) ([]DataQualityIssue, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var issues []DataQualityIssue
+	for _, id := range sortedKeys(m.issues) {
+		if m.issues[id].CountryID == countryID {
+			issues = append(issues, m.issues[id])
+		}
+	}
+	sort.SliceStable(issues, func(i, j int) bool {
+		return issues[i].Date < issues[j].Date
+	})
+	return issues, nil
+}
+
+func (m *MemoryStore) GetUserByID(ctx context.Context, id int) (User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return User{}, fmt.Errorf("could not get user: %w", sql.ErrNoRows)
+	}
+	// the SQLite store does not read the salt by ID either:
+	user.Salt = ""
+	return user, nil
+}
+
+func (m *MemoryStore) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	return m.findUser(func(user User) bool { return user.Username == username })
+}
+
+func (m *MemoryStore) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	return m.findUser(func(user User) bool { return user.Email == email })
+}
+
+func (m *MemoryStore) findUser(match func(User) bool) (User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, user := range m.users {
+		if match(user) {
+			return user, nil
+		}
+	}
+	return User{}, fmt.Errorf("could not get user: %w", sql.ErrNoRows)
+}
+
+func (m *MemoryStore) CheckIfUserExists(ctx context.Context, username string) error {
+	if _, err := m.GetUserByUsername(ctx, username); err == nil {
+		return errors.New("username already exists")
+	}
+	return nil
+}
+
+func (m *MemoryStore) CheckIfEmailExists(ctx context.Context, email string) error {
+	if _, err := m.GetUserByEmail(ctx, email); err == nil {
+		return errors.New("email already exists")
+	}
+	return nil
+}
+
+func (m *MemoryStore) RegisterUser(ctx context.Context, username string, email string, hashedPassword []byte, salt []byte) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, user := range m.users {
+		if user.Username == username || user.Email == email {
+			return 0, errors.New("error inserting user into database: the username or email is already used")
+		}
+	}
+
+	m.lastUserID++
+	m.users[m.lastUserID] = User{
+		ID:       m.lastUserID,
+		Username: username,
+		Email:    email,
+		Password: string(hashedPassword),
+		Salt:     string(salt),
+		Role:     RoleUser,
+	}
+	return int64(m.lastUserID), nil
+}
+
+func (m *MemoryStore) DeleteUser(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[id]; !ok {
+		return fmt.Errorf("user with ID %d %w", id, ErrNotFound)
+	}
+	delete(m.users, id)
+	delete(m.monitored, id)
+	for hash, token := range m.userTokens {
+		if token.userID == id {
+			delete(m.userTokens, hash)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) SetUserPassword(ctx context.Context, userID int, hashedPassword []byte, salt []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return fmt.Errorf("user with ID %d %w", userID, ErrNotFound)
+	}
+	user.Password = string(hashedPassword)
+	user.Salt = string(salt)
+	user.TokenVersion++
+	m.users[userID] = user
+	return nil
+}
+
+func (m *MemoryStore) SetUserEmailVerified(ctx context.Context, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return fmt.Errorf("user with ID %d %w", userID, ErrNotFound)
+	}
+	user.EmailVerified = true
+	m.users[userID] = user
+	return nil
+}
+
+func (m *MemoryStore) SetUserRole(ctx context.Context, userID int, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return fmt.Errorf("user with ID %d %w", userID, ErrNotFound)
+	}
+	user.Role = role
+	m.users[userID] = user
+	return nil
+}
+
+func (m *MemoryStore) CreateUserToken(ctx context.Context, userID int, purpose string, tokenHash string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[userID]; !ok {
+		return fmt.Errorf("could not create user token: user with ID %d %w", userID, ErrNotFound)
+	}
+	now := time.Now()
+	for hash, token := range m.userTokens {
+		if (token.userID == userID && token.purpose == purpose) || !now.Before(token.expiresAt) {
+			delete(m.userTokens, hash)
+		}
+	}
+	// the SQLite store keeps the expiry to the second:
+	m.userTokens[tokenHash] = userToken{userID: userID, purpose: purpose, expiresAt: expiresAt.Truncate(time.Second)}
+	return nil
+}
+
+func (m *MemoryStore) ConsumeUserToken(ctx context.Context, purpose string, tokenHash string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.userTokens[tokenHash]
+	if !ok || token.purpose != purpose {
+		return 0, fmt.Errorf("could not consume user token: %w", sql.ErrNoRows)
+	}
+	delete(m.userTokens, tokenHash)
+	if !time.Now().Before(token.expiresAt) {
+		return 0, fmt.Errorf("user token expired: %w", sql.ErrNoRows)
+	}
+	return token.userID, nil
+}
+
+func (m *MemoryStore) GetUserMonitoredCountries(ctx context.Context, userID int) ([]Country, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var countries []Country
+	for _, countryID := range sortedKeys(m.monitored[userID]) {
+		countries = append(countries, m.countries[countryID])
+	}
+	return countries, nil
+}
+
+func (m *MemoryStore) AddUserMonitoredCountry(ctx context.Context, userID int, countryID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[userID]; !ok {
+		return fmt.Errorf("error inserting user monitored country into database: user with ID %d %w", userID, ErrNotFound)
+	}
+	if _, ok := m.countries[countryID]; !ok {
+		return fmt.Errorf("error inserting user monitored country into database: country with ID %d %w", countryID, ErrNotFound)
+	}
+	if m.monitored[userID][countryID] {
+		return errors.New("error inserting user monitored country into database: the country is already monitored")
+	}
+
+	if m.monitored[userID] == nil {
+		m.monitored[userID] = map[int]bool{}
+	}
+	m.monitored[userID][countryID] = true
+	return nil
+}
+
+func (m *MemoryStore) RemoveUserMonitoredCountry(ctx context.Context, userID int, countryID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.monitored[userID][countryID] {
+		return fmt.Errorf("monitored country %w", ErrNotFound)
+	}
+	delete(m.monitored[userID], countryID)
+	return nil
+}
+
+func (m *MemoryStore) GetTopCountriesByCaseTypeForUser(ctx context.Context, userID int, caseType string, limit int) ([]Country, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	type value struct {
+		country Country
+		cases   int
+	}
+	var values []value
+	for _, countryID := range sortedKeys(m.monitored[userID]) {
+		latest, ok := m.countryLatestStatistics(countryID)
+		if !ok {
+			continue
+		}
+		cases := 0
+		switch caseType {
+		case "confirmed":
+			cases = latest.Confirmed
+		case "recovered":
+			cases = latest.Recovered
+		case "deaths":
+			cases = latest.Deaths
+		default:
+			return nil, fmt.Errorf("could not get top countries by case type for user: unknown case type %q", caseType)
+		}
+		values = append(values, value{country: m.countries[countryID], cases: cases})
+	}
+	sort.SliceStable(values, func(i, j int) bool {
+		return values[i].cases > values[j].cases
+	})
+
+	var countries []Country
+	for i := 0; i < len(values) && (limit < 0 || i < limit); i++ {
+		countries = append(countries, values[i].country)
+	}
+	return countries, nil
+}
+
+func (m *MemoryStore) GetCountryGroups(ctx context.Context) ([]CountryGroup, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	groups := []CountryGroup{}
+	for _, group := range m.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Kind != groups[j].Kind {
+			return groups[i].Kind < groups[j].Kind
+		}
+		return groups[i].Name < groups[j].Name
+	})
+	return groups, nil
+}
+
+func (m *MemoryStore) GetCountryGroupByID(ctx context.Context, id int) (CountryGroup, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.countryGroup(id)
+}
+
+func (m *MemoryStore) countryGroup(id int) (CountryGroup, error) {
+	group, ok := m.groups[id]
+	if !ok {
+		return CountryGroup{}, fmt.Errorf("could not scan country group row: %w", sql.ErrNoRows)
+	}
+	group.Members = []Country{}
+	for countryID := range m.groupMembers[id] {
+		group.Members = append(group.Members, m.countries[countryID])
+	}
+	sort.Slice(group.Members, func(i, j int) bool {
+		return group.Members[i].Name < group.Members[j].Name
+	})
+	return group, nil
+}
+
+func (m *MemoryStore) CreateCountryGroup(ctx context.Context, name string, countryIDs []int) (CountryGroup, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, group := range m.groups {
+		if group.Name == name {
+			return CountryGroup{}, true, nil
+		}
+	}
+	for _, countryID := range countryIDs {
+		if _, ok := m.countries[countryID]; !ok {
+			return CountryGroup{}, false, fmt.Errorf("country with ID %d %w", countryID, ErrNotFound)
+		}
+	}
+
+	id := m.createGroup(name, GroupKindCustom, time.Now().UTC().Format(time.RFC3339))
+	for _, countryID := range countryIDs {
+		m.groupMembers[id][countryID] = true
+	}
+	group, err := m.countryGroup(id)
+	return group, false, err
+}
+
+func (m *MemoryStore) createGroup(name string, kind string, createdAt string) int {
+	m.lastGroupID++
+	m.groups[m.lastGroupID] = CountryGroup{ID: m.lastGroupID, Name: name, Kind: kind, CreatedAt: createdAt}
+	m.groupMembers[m.lastGroupID] = map[int]bool{}
+	return m.lastGroupID
+}
+
+func (m *MemoryStore) DeleteCountryGroup(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkCustomCountryGroup(id); err != nil {
+		return err
+	}
+	delete(m.groups, id)
+	delete(m.groupMembers, id)
+	return nil
+}
+
+func (m *MemoryStore) AddCountryGroupMember(ctx context.Context, groupID int, countryID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkCustomCountryGroup(groupID); err != nil {
+		return err
+	}
+	if _, ok := m.countries[countryID]; !ok {
+		return fmt.Errorf("country with ID %d %w", countryID, ErrNotFound)
+	}
+	m.groupMembers[groupID][countryID] = true
+	return nil
+}
+
+func (m *MemoryStore) RemoveCountryGroupMember(ctx context.Context, groupID int, countryID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkCustomCountryGroup(groupID); err != nil {
+		return err
+	}
+	if !m.groupMembers[groupID][countryID] {
+		return fmt.Errorf("group member %w", ErrNotFound)
+	}
+	delete(m.groupMembers[groupID], countryID)
+	return nil
+}
+
+func (m *MemoryStore) checkCustomCountryGroup(id int) error {
+	group, ok := m.groups[id]
+	if !ok {
+		return fmt.Errorf("country group %w", ErrNotFound)
+	}
+	if group.Kind == GroupKindContinent {
+		return ErrContinentGroup
+	}
+	return nil
+}
+
+// addCountryToContinentGroup puts a country in the group of the continent of its code, if it has one.
+func (m *MemoryStore) addCountryToContinentGroup(countryID int, code string) {
+	continent, ok := ContinentOf(code)
+	if !ok {
+		return
+	}
+	for groupID, group := range m.groups {
+		if group.Kind == GroupKindContinent && group.Name == continent {
+			m.groupMembers[groupID][countryID] = true
+		}
+	}
+}
+
+func (m *MemoryStore) GetPersistedQuery(ctx context.Context, hash string) (PersistedQuery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	persistedQuery, ok := m.persistedQueries[hash]
+	if !ok {
+		return PersistedQuery{}, fmt.Errorf("could not get persisted query: %w", sql.ErrNoRows)
+	}
+	return persistedQuery, nil
+}
+
+func (m *MemoryStore) GetAllowedPersistedQueryHashes(ctx context.Context) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	hashes := []string{}
+	for hash, persistedQuery := range m.persistedQueries {
+		if persistedQuery.Allowed {
+			hashes = append(hashes, hash)
+		}
+	}
+	sort.Strings(hashes)
+	return hashes, nil
+}
+
+func (m *MemoryStore) AddPersistedQuery(ctx context.Context, hash string, query string, createdAt string, limit int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.persistedQueries[hash]; ok {
+		return nil
+	}
+	m.persistedQueries[hash] = PersistedQuery{Hash: hash, Query: query, CreatedAt: createdAt}
+	if limit <= 0 {
+		return nil
+	}
+
+	// the newest first, as in SQL:
+	var notAllowed []PersistedQuery
+	for _, persistedQuery := range m.persistedQueries {
+		if !persistedQuery.Allowed {
+			notAllowed = append(notAllowed, persistedQuery)
+		}
+	}
+	sort.Slice(notAllowed, func(i, j int) bool {
+		if notAllowed[i].CreatedAt != notAllowed[j].CreatedAt {
+			return notAllowed[i].CreatedAt > notAllowed[j].CreatedAt
+		}
+		return notAllowed[i].Hash > notAllowed[j].Hash
+	})
+	for i := limit; i < len(notAllowed); i++ {
+		delete(m.persistedQueries, notAllowed[i].Hash)
+	}
+	return nil
+}
+
+func (m *MemoryStore) AllowPersistedQueries(ctx context.Context, queries []PersistedQuery, replace bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if replace {
+		for hash, persistedQuery := range m.persistedQueries {
+			persistedQuery.Allowed = false
+			m.persistedQueries[hash] = persistedQuery
+		}
+	}
+	for _, query := range queries {
+		persistedQuery, ok := m.persistedQueries[query.Hash]
+		if !ok {
+			persistedQuery = PersistedQuery{Hash: query.Hash, CreatedAt: query.CreatedAt}
+		}
+		persistedQuery.Query = query.Query
+		persistedQuery.OperationName = query.OperationName
+		persistedQuery.Allowed = true
+		m.persistedQueries[query.Hash] = persistedQuery
+	}
+	return nil
+}
+
+// memoryPage sorts and paginates rows the way keyset and nextCursor do in SQL. field returns the value of a sort
+// field of a row, an int or a string, and byID the row a cursor points at.
+func memoryPage[T any](rows []T, sortBy string, sortOrder string, fields []string, after *string, first *int,
+	id func(T) int, field func(T, string) any, byID func(int) (T, bool)) ([]T, *string, error) {
+	if sortBy == "" {
+		sortBy = "id"
+	}
+	if !contains(fields, sortBy) {
+		return nil, nil, fmt.Errorf("%w: cannot sort by %q", ErrInvalidFilter, sortBy)
+	}
+	descending := false
+	switch sortOrder {
+	case "", SortAsc:
+	case SortDesc:
+		descending = true
+	default:
+		return nil, nil, fmt.Errorf("%w: unknown sort order %q", ErrInvalidFilter, sortOrder)
+	}
+	if first != nil && *first < 0 {
+		return nil, nil, fmt.Errorf("%w: first must not be negative", ErrInvalidFilter)
+	}
+
+	// compare orders a before b, ties broken by id:
+	compare := func(a T, b T) int {
+		c := compareValues(field(a, sortBy), field(b, sortBy))
+		if c == 0 {
+			c = compareValues(id(a), id(b))
+		}
+		if descending {
+			return -c
+		}
+		return c
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return compare(rows[i], rows[j]) < 0
+	})
+
+	if after != nil {
+		cursorID, err := decodeCursor(*after)
+		if err != nil {
+			return nil, nil, err
+		}
+		// like the SQL subquery, a cursor to a deleted row matches nothing unless the rows are sorted by id:
+		afterCursor := func(row T) bool {
+			return compareValues(id(row), cursorID)*direction(descending) > 0
+		}
+		if sortBy != "id" {
+			cursor, ok := byID(cursorID)
+			if !ok {
+				return nil, nil, nil
+			}
+			afterCursor = func(row T) bool {
+				return compare(row, cursor) > 0
+			}
+		}
+
+		var remaining []T
+		for _, row := range rows {
+			if afterCursor(row) {
+				remaining = append(remaining, row)
+			}
+		}
+		rows = remaining
+	}
+
+	ids := make([]int, len(rows))
+	for i := range rows {
+		ids[i] = id(rows[i])
+	}
+	n, next := nextCursor(ids, first)
+	return rows[:n], next, nil
+}
+
+func direction(descending bool) int {
+	if descending {
+		return -1
+	}
+	return 1
+}
+
+func compareValues(a any, b any) int {
+	switch a := a.(type) {
+	case int:
+		b := b.(int)
+		if a < b {
+			return -1
+		}
+		if a > b {
+			return 1
+		}
+	case string:
+		return strings.Compare(a, b.(string))
+	}
+	return 0
+}
+
+// sortByDay orders the statistics from the most recent day, the way the latest statistic is picked in SQL.
+func sortByDay(covidStatistics []CovidStatistic) {
+	sort.Slice(covidStatistics, func(i, j int) bool {
+		a, b := covidStatistics[i], covidStatistics[j]
+		if day(a.Date) != day(b.Date) {
+			return day(a.Date) > day(b.Date)
+		}
+		return a.ID > b.ID
+	})
+}
+
+// sortByDate orders the statistics by their stored date, ties broken by id.
+func sortByDate(covidStatistics []CovidStatistic, descending bool) {
+	sort.Slice(covidStatistics, func(i, j int) bool {
+		a, b := covidStatistics[i], covidStatistics[j]
+		if a.Date != b.Date {
+			return (a.Date < b.Date) != descending
+		}
+		return (a.ID < b.ID) != descending
+	})
+}
+
+// inDateRange compares the days of dates like date() does in the SQL queries, the bounds are inclusive.
+func inDateRange(date string, from *string, to *string) bool {
+	if from != nil && day(date) < *from {
+		return false
+	}
+	if to != nil && day(date) > *to {
+		return false
+	}
+	return true
+}
+
+// day drops the time of dates stored with one.
+func day(date string) string {
+	if len(date) > len("2006-01-02") {
+		return date[:len("2006-01-02")]
+	}
+	return date
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return keys
+}
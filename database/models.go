@@ -17,11 +17,90 @@ type CovidStatistic struct {
 	Deaths    int
 }
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// The purposes of the tokens emailed to users.
+const (
+	TokenPasswordReset     = "password_reset"
+	TokenEmailVerification = "email_verification"
+)
+
+// LatestCovidStatistic is the last statistic of a country, with the one before it to compute daily deltas.
+// Previous is nil when the country has a single statistic.
+type LatestCovidStatistic struct {
+	Country  Country
+	Latest   CovidStatistic
+	Previous *CovidStatistic
+}
+
+// CountryLatestStatistics is the summary of the latest statistic of a country, kept up to date by every write
+// to covid_statistics. The changes are nil when the country has no statistic that many days before the latest.
+type CountryLatestStatistics struct {
+	CountryID        int
+	CovidStatisticID int
+	Date             string
+	Confirmed        int
+	Recovered        int
+	Deaths           int
+	Change1Day       *StatisticChange
+	Change7Days      *StatisticChange
+	UpdatedAt        string
+}
+
+// StatisticChange is the increase of the cumulative values of a country over some days.
+type StatisticChange struct {
+	Confirmed int
+	Recovered int
+	Deaths    int
+}
+
 type User struct {
-	ID                 int
-	Username           string
-	Email              string
-	Password           string
-	Salt               string
+	ID            int
+	Username      string
+	Email         string
+	Password      string
+	Salt          string
+	Role          string
+	EmailVerified bool
+	// TokenVersion is bumped by every password change, the tokens issued for an older version are refused.
+	TokenVersion       int
 	MonitoredCountries []Country
 }
+
+type PersistedQuery struct {
+	Hash          string
+	Query         string
+	OperationName string
+	// Allowed is set for operations registered from a reviewed manifest.
+	Allowed   bool
+	CreatedAt string
+}
+
+type DataQualityIssue struct {
+	ID               int
+	CovidStatisticID int
+	CountryID        int
+	Date             string
+	Code             string
+	Severity         string
+	Message          string
+	CreatedAt        string
+}
+
+const (
+	// GroupKindContinent groups are created for every continent, their members are set from the country codes.
+	GroupKindContinent = "continent"
+	// GroupKindCustom groups are created by admins.
+	GroupKindCustom = "custom"
+)
+
+type CountryGroup struct {
+	ID        int
+	Name      string
+	Kind      string
+	CreatedAt string
+	Members   []Country
+}
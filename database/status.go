@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// LatestSchemaVersion is the version of the schema once every migration is applied.
+func LatestSchemaVersion() int {
+	return len(migrations)
+}
+
+// Ping checks that both pools can reach the database.
+func (d *DB) Ping(ctx context.Context) error {
+	if err := d.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("could not reach the database: %w", err)
+	}
+	if err := d.read.PingContext(ctx); err != nil {
+		return fmt.Errorf("could not reach the database: %w", err)
+	}
+	return nil
+}
+
+// GetSchemaVersion returns the number of migrations applied to the database.
+func (d *DB) GetSchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	if err := d.read.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("could not read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// GetSize returns the size of the database file in bytes, the pages still in the WAL excepted.
+func (d *DB) GetSize(ctx context.Context) (int64, error) {
+	var size int64
+	err := d.read.QueryRowContext(ctx, "SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()").Scan(&size)
+	if err != nil {
+		return 0, fmt.Errorf("could not get database size: %w", err)
+	}
+	return size, nil
+}
+
+// TableRowCount is the number of rows of a table.
+type TableRowCount struct {
+	Table string
+	Rows  int
+}
+
+// CountTableRows returns the number of rows of every table, by name.
+func (d *DB) CountTableRows(ctx context.Context) ([]TableRowCount, error) {
+	rows, err := d.read.QueryContext(ctx, `
+		SELECT name
+		FROM sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%'
+		ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("could not list tables: %w", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("could not list tables: %w", err)
+		}
+		tables = append(tables, table)
+	}
+	if err := errors.Join(rows.Err(), rows.Close()); err != nil {
+		return nil, fmt.Errorf("could not list tables: %w", err)
+	}
+
+	counts := make([]TableRowCount, 0, len(tables))
+	for _, table := range tables {
+		count := TableRowCount{Table: table}
+		// table names cannot be placeholders, they come from sqlite_master and are quoted:
+		query := `SELECT COUNT(*) FROM "` + strings.ReplaceAll(table, `"`, `""`) + `"`
+		if err := d.read.QueryRowContext(ctx, query).Scan(&count.Rows); err != nil {
+			return nil, fmt.Errorf("could not count rows of %s: %w", table, err)
+		}
+		counts = append(counts, count)
+	}
+	return counts, nil
+}
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// Store is the storage of the countries, their statistics, the users and the countries they monitor, the country
+// groups and the persisted GraphQL queries. DB stores them in SQLite and MemoryStore in memory, the storetest
+// package checks that both behave the same.
+//
+// Reads of a missing row return an error wrapping sql.ErrNoRows, and writes matching no row one wrapping
+// ErrNotFound, whatever the implementation.
+type Store interface {
+	CountryStore
+	CovidStatisticStore
+	UserStore
+	MonitoringStore
+	CountryGroupStore
+	PersistedQueryStore
+}
+
+type CountryStore interface {
+	// GetCountries returns a page of countries, and the cursor of the next page when there is one.
+	GetCountries(ctx context.Context, filter CountryFilter) ([]Country, *string, error)
+	// GetCountryByID returns a country with all its statistics.
+	GetCountryByID(ctx context.Context, id int) (Country, error)
+	// CreateCountry returns true without creating anything when a country with the same name exists.
+	CreateCountry(ctx context.Context, name string, code string) (Country, bool, error)
+	UpdateCountry(ctx context.Context, id int, name string, code string) (Country, error)
+	// DeleteCountry deletes a country with its statistics.
+	DeleteCountry(ctx context.Context, countryID int) error
+	// GetCountryUpdatedAt returns when a country, its statistics or their data quality issues last changed, the
+	// zero time when they have not changed since it is recorded.
+	GetCountryUpdatedAt(ctx context.Context, countryID int) (time.Time, error)
+	// GetCountriesUpdatedAt returns when any country last changed and the number of countries, which changes
+	// when one is deleted.
+	GetCountriesUpdatedAt(ctx context.Context) (time.Time, int, error)
+}
+
+type CovidStatisticStore interface {
+	GetCovidStatistic(ctx context.Context, id int) (CovidStatistic, error)
+	GetCovidStatistics(ctx context.Context, countryID int) ([]CovidStatistic, error)
+	ListCovidStatistics(ctx context.Context, filter CovidStatisticFilter) ([]CovidStatistic, *string, error)
+	StreamCovidStatistics(ctx context.Context, countryIDs []int, dateFrom *string, dateTo *string, fn func(CovidStatistic) error) error
+	AddCovidStatistic(ctx context.Context, countryID int, date string, confirmed int, recovered int, deaths int) (int, error)
+	UpdateCovidStatistic(ctx context.Context, id int, date string, confirmed int, recovered int, deaths int) (CovidStatistic, error)
+	DeleteCovidStatistic(ctx context.Context, id int) error
+	CheckCovidStatisticExists(ctx context.Context, countryID int, date string) (bool, error)
+	GetCountryIDByCovidStatisticID(ctx context.Context, covidStatisticID int) (int, error)
+	GetPreviousCovidStatistics(ctx context.Context, countryID int, date string, excludeID int, limit int) ([]CovidStatistic, error)
+	GetNextCovidStatistic(ctx context.Context, countryID int, date string, excludeID int) (CovidStatistic, bool, error)
+	CountCovidStatisticsOnDate(ctx context.Context, countryID int, date string, excludeID int) (int, error)
+
+	GetLatestCovidStatistics(ctx context.Context, asOf *string, countryIDs []int) ([]LatestCovidStatistic, error)
+	GetLatestCovidStatisticsByCountryID(ctx context.Context, countryID int) (CovidStatistic, error)
+	GetCountryLatestStatistics(ctx context.Context, countryID int) (CountryLatestStatistics, error)
+	// ListCountryLatestStatistics returns the latest statistics of every country with statistics, by country ID.
+	ListCountryLatestStatistics(ctx context.Context) ([]CountryLatestStatistics, error)
+	GetDeathPercentage(ctx context.Context, countryID int) (float64, error)
+
+	// ReplaceDataQualityIssues swaps the issues flagged on a statistic for a new set, they go with the statistic.
+	ReplaceDataQualityIssues(ctx context.Context, covidStatisticID int, issues []DataQualityIssue) error
+	GetDataQualityIssuesByCovidStatisticID(ctx context.Context, covidStatisticID int) ([]DataQualityIssue, error)
+	GetDataQualityIssuesByCountryID(ctx context.Context, countryID int) ([]DataQualityIssue, error)
+}
+
+type UserStore interface {
+	GetUserByID(ctx context.Context, id int) (User, error)
+	GetUserByUsername(ctx context.Context, username string) (User, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	CheckIfUserExists(ctx context.Context, username string) error
+	CheckIfEmailExists(ctx context.Context, email string) error
+	RegisterUser(ctx context.Context, username string, email string, hashedPassword []byte, salt []byte) (int64, error)
+	DeleteUser(ctx context.Context, id int) error
+	// SetUserPassword replaces the password of a user and bumps their TokenVersion, revoking their tokens.
+	SetUserPassword(ctx context.Context, userID int, hashedPassword []byte, salt []byte) error
+	SetUserEmailVerified(ctx context.Context, userID int) error
+	// SetUserRole sets the role of a user, RoleUser or RoleAdmin. Tokens issued before keep the previous role.
+	SetUserRole(ctx context.Context, userID int, role string) error
+	// CreateUserToken stores the hash of a token emailed to a user, in place of the previous one for the purpose.
+	CreateUserToken(ctx context.Context, userID int, purpose string, tokenHash string, expiresAt time.Time) error
+	// ConsumeUserToken deletes a token and returns its user, sql.ErrNoRows when it does not exist or expired.
+	ConsumeUserToken(ctx context.Context, purpose string, tokenHash string) (int, error)
+}
+
+type MonitoringStore interface {
+	GetUserMonitoredCountries(ctx context.Context, userID int) ([]Country, error)
+	AddUserMonitoredCountry(ctx context.Context, userID int, countryID int) error
+	RemoveUserMonitoredCountry(ctx context.Context, userID int, countryID int) error
+	// GetTopCountriesByCaseTypeForUser returns the monitored countries with the highest latest value of caseType.
+	GetTopCountriesByCaseTypeForUser(ctx context.Context, userID int, caseType string, limit int) ([]Country, error)
+}
+
+// CountryGroupStore keeps a continent group per continent, with the countries of their codes as members, next
+// to the custom groups. Changing a continent group returns ErrContinentGroup.
+type CountryGroupStore interface {
+	// GetCountryGroups returns every group without their members, the continents first.
+	GetCountryGroups(ctx context.Context) ([]CountryGroup, error)
+	// GetCountryGroupByID returns a group with its members, ordered by name.
+	GetCountryGroupByID(ctx context.Context, id int) (CountryGroup, error)
+	// CreateCountryGroup returns true without creating anything when a group with the same name exists.
+	CreateCountryGroup(ctx context.Context, name string, countryIDs []int) (CountryGroup, bool, error)
+	DeleteCountryGroup(ctx context.Context, id int) error
+	// AddCountryGroupMember adds a country to a custom group, adding a member twice is not an error.
+	AddCountryGroupMember(ctx context.Context, groupID int, countryID int) error
+	RemoveCountryGroupMember(ctx context.Context, groupID int, countryID int) error
+}
+
+type PersistedQueryStore interface {
+	GetPersistedQuery(ctx context.Context, hash string) (PersistedQuery, error)
+	// GetAllowedPersistedQueryHashes returns the hashes of the queries allowed by a manifest, sorted.
+	GetAllowedPersistedQueryHashes(ctx context.Context) ([]string, error)
+	// AddPersistedQuery stores a query registered through APQ, it is not allowed and an existing one is kept.
+	// The oldest of the queries that are not allowed are deleted beyond limit of them, 0 keeps them all.
+	AddPersistedQuery(ctx context.Context, hash string, query string, createdAt string, limit int) error
+	// AllowPersistedQueries allows the queries of a manifest, with replace the others are revoked.
+	AllowPersistedQueries(ctx context.Context, queries []PersistedQuery, replace bool) error
+}
+
+var (
+	_ Store = (*DB)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
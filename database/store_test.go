@@ -0,0 +1,35 @@
+package database_test
+
+import (
+	"context"
+	"covid/database"
+	"covid/database/storetest"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestDB(t *testing.T) {
+	dir := t.TempDir()
+	databases := 0
+	newStore := func(ctx context.Context) (database.Store, func() error, error) {
+		databases++
+		db, err := database.ConnectDB(ctx, filepath.Join(dir, fmt.Sprintf("store-%d.db", databases)), database.Options{})
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, db.Close, nil
+	}
+	if err := storetest.TestStore(context.Background(), newStore); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	newStore := func(ctx context.Context) (database.Store, func() error, error) {
+		return database.NewMemoryStore(), func() error { return nil }, nil
+	}
+	if err := storetest.TestStore(context.Background(), newStore); err != nil {
+		t.Error(err)
+	}
+}
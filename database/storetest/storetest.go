@@ -0,0 +1,1002 @@
+// Package storetest checks that the implementations of database.Store behave the same. Like testing/fstest,
+// it reports the failed checks as an error instead of depending on the testing package, so that it can be run
+// from tests and from the check-stores command alike.
+package storetest
+
+import (
+	"context"
+	"covid/database"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+// NewStore returns an empty store, and a function releasing it once a check is done.
+type NewStore func(ctx context.Context) (database.Store, func() error, error)
+
+type check struct {
+	name string
+	run  func(ctx context.Context, s database.Store) error
+}
+
+var checks = []check{
+	{"countries", checkCountries},
+	{"country changes", checkCountryChanges},
+	{"country pages", checkCountryPages},
+	{"covid statistics", checkCovidStatistics},
+	{"covid statistic pages", checkCovidStatisticPages},
+	{"neighbouring covid statistics", checkNeighbouringCovidStatistics},
+	{"latest covid statistics", checkLatestCovidStatistics},
+	{"streamed covid statistics", checkStreamCovidStatistics},
+	{"data quality issues", checkDataQualityIssues},
+	{"users", checkUsers},
+	{"user tokens", checkUserTokens},
+	{"monitored countries", checkMonitoredCountries},
+	{"country groups", checkCountryGroups},
+	{"persisted queries", checkPersistedQueries},
+}
+
+// TestStore runs every check on a new store, and returns the failures of all of them.
+func TestStore(ctx context.Context, newStore NewStore) error {
+	var errs []error
+	for _, c := range checks {
+		if err := runCheck(ctx, newStore, c); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func runCheck(ctx context.Context, newStore NewStore, c check) (err error) {
+	s, release, err := newStore(ctx)
+	if err != nil {
+		return fmt.Errorf("could not create store: %w", err)
+	}
+	defer func() {
+		if releaseErr := release(); releaseErr != nil && err == nil {
+			err = fmt.Errorf("could not release store: %w", releaseErr)
+		}
+	}()
+	return c.run(ctx, s)
+}
+
+func checkCountries(ctx context.Context, s database.Store) error {
+	country, exists, err := s.CreateCountry(ctx, "Belgium", "BE")
+	if err != nil || exists {
+		return fmt.Errorf("CreateCountry: exists %v, err %v", exists, err)
+	}
+	if _, exists, err := s.CreateCountry(ctx, "Belgium", "BX"); err != nil || !exists {
+		return fmt.Errorf("CreateCountry with a taken name: exists %v, err %v, want exists", exists, err)
+	}
+	if _, _, err := s.CreateCountry(ctx, "Kingdom of Belgium", "BE"); err == nil {
+		return errors.New("CreateCountry with a taken code: no error")
+	}
+
+	got, err := s.GetCountryByID(ctx, country.ID)
+	if err != nil {
+		return fmt.Errorf("GetCountryByID: %w", err)
+	}
+	if err := equal("GetCountryByID", got, database.Country{ID: country.ID, Name: "Belgium", Code: "BE"}); err != nil {
+		return err
+	}
+
+	updated, err := s.UpdateCountry(ctx, country.ID, "Belgique", "BE")
+	if err != nil {
+		return fmt.Errorf("UpdateCountry: %w", err)
+	}
+	if err := equal("UpdateCountry", updated, database.Country{ID: country.ID, Name: "Belgique", Code: "BE"}); err != nil {
+		return err
+	}
+	other, _, err := s.CreateCountry(ctx, "France", "FR")
+	if err != nil {
+		return fmt.Errorf("CreateCountry: %w", err)
+	}
+	if _, err := s.UpdateCountry(ctx, other.ID, "Belgique", "FR"); err == nil {
+		return errors.New("UpdateCountry to a taken name: no error")
+	}
+	if _, err := s.UpdateCountry(ctx, 999, "Nowhere", "NW"); !errors.Is(err, database.ErrNotFound) {
+		return fmt.Errorf("UpdateCountry of a missing country: %v, want ErrNotFound", err)
+	}
+
+	if _, err := s.AddCovidStatistic(ctx, country.ID, "2021-01-01", 10, 1, 0); err != nil {
+		return fmt.Errorf("AddCovidStatistic: %w", err)
+	}
+	if err := s.DeleteCountry(ctx, country.ID); err != nil {
+		return fmt.Errorf("DeleteCountry: %w", err)
+	}
+	if _, err := s.GetCountryByID(ctx, country.ID); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("GetCountryByID of a deleted country: %v, want sql.ErrNoRows", err)
+	}
+	statistics, err := s.GetCovidStatistics(ctx, country.ID)
+	if err != nil || len(statistics) != 0 {
+		return fmt.Errorf("GetCovidStatistics of a deleted country: %d statistics, err %v, want none", len(statistics), err)
+	}
+	if err := s.DeleteCountry(ctx, country.ID); !errors.Is(err, database.ErrNotFound) {
+		return fmt.Errorf("DeleteCountry of a missing country: %v, want ErrNotFound", err)
+	}
+	return nil
+}
+
+func checkCountryChanges(ctx context.Context, s database.Store) error {
+	country, _, err := s.CreateCountry(ctx, "Belgium", "BE")
+	if err != nil {
+		return fmt.Errorf("CreateCountry: %w", err)
+	}
+	if _, _, err := s.CreateCountry(ctx, "France", "FR"); err != nil {
+		return fmt.Errorf("CreateCountry: %w", err)
+	}
+	last, err := s.GetCountryUpdatedAt(ctx, country.ID)
+	if err != nil || last.IsZero() {
+		return fmt.Errorf("GetCountryUpdatedAt of a new country: %v, err %v, want a time", last, err)
+	}
+
+	var statisticID int
+	writes := []struct {
+		name  string
+		write func() error
+	}{
+		{"AddCovidStatistic", func() (err error) {
+			statisticID, err = s.AddCovidStatistic(ctx, country.ID, "2021-01-01", 10, 1, 0)
+			return err
+		}},
+		{"UpdateCovidStatistic", func() error {
+			_, err := s.UpdateCovidStatistic(ctx, statisticID, "2021-01-01", 12, 1, 0)
+			return err
+		}},
+		{"ReplaceDataQualityIssues", func() error {
+			return s.ReplaceDataQualityIssues(ctx, statisticID, []database.DataQualityIssue{
+				{CountryID: country.ID, Date: "2021-01-01", Code: "SPIKE", Severity: "WARNING", Message: "spike", CreatedAt: "2021-01-02T00:00:00Z"},
+			})
+		}},
+		{"DeleteCovidStatistic", func() error { return s.DeleteCovidStatistic(ctx, statisticID) }},
+		{"UpdateCountry", func() error {
+			_, err := s.UpdateCountry(ctx, country.ID, "Belgique", "BE")
+			return err
+		}},
+	}
+	for _, w := range writes {
+		// the times of the changes must tell them apart:
+		time.Sleep(time.Millisecond)
+		if err := w.write(); err != nil {
+			return fmt.Errorf("%s: %w", w.name, err)
+		}
+		updatedAt, err := s.GetCountryUpdatedAt(ctx, country.ID)
+		if err != nil || !updatedAt.After(last) {
+			return fmt.Errorf("GetCountryUpdatedAt after %s: %v, err %v, want after %v", w.name, updatedAt, err, last)
+		}
+		last = updatedAt
+	}
+
+	latest, count, err := s.GetCountriesUpdatedAt(ctx)
+	if err != nil || !latest.Equal(last) || count != 2 {
+		return fmt.Errorf("GetCountriesUpdatedAt: %v and %d countries, err %v, want %v and 2", latest, count, err, last)
+	}
+	if err := s.DeleteCountry(ctx, country.ID); err != nil {
+		return fmt.Errorf("DeleteCountry: %w", err)
+	}
+	if _, count, err := s.GetCountriesUpdatedAt(ctx); err != nil || count != 1 {
+		return fmt.Errorf("GetCountriesUpdatedAt after DeleteCountry: %d countries, err %v, want 1", count, err)
+	}
+	if _, err := s.GetCountryUpdatedAt(ctx, country.ID); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("GetCountryUpdatedAt of a deleted country: %v, want sql.ErrNoRows", err)
+	}
+	return nil
+}
+
+func checkCountryPages(ctx context.Context, s database.Store) error {
+	for _, country := range [][2]string{{"Chile", "CL"}, {"Austria", "AT"}, {"Brazil", "BR"}, {"Australia", "AU"}, {"Chad", "TD"}} {
+		if _, _, err := s.CreateCountry(ctx, country[0], country[1]); err != nil {
+			return fmt.Errorf("CreateCountry: %w", err)
+		}
+	}
+
+	first := 2
+	var names []string
+	var after *string
+	for page := 0; page < 5; page++ {
+		countries, next, err := s.GetCountries(ctx, database.CountryFilter{SortBy: "name", SortOrder: database.SortDesc, First: &first, After: after})
+		if err != nil {
+			return fmt.Errorf("GetCountries: %w", err)
+		}
+		for _, country := range countries {
+			names = append(names, country.Name)
+		}
+		if next == nil {
+			break
+		}
+		after = next
+	}
+	if err := equal("pages of GetCountries by name descending", names, []string{"Chile", "Chad", "Brazil", "Austria", "Australia"}); err != nil {
+		return err
+	}
+
+	contains, code := "AUS", "AT"
+	countries, _, err := s.GetCountries(ctx, database.CountryFilter{NameContains: &contains})
+	if err != nil {
+		return fmt.Errorf("GetCountries: %w", err)
+	}
+	if err := equal("GetCountries with a name containing AUS", countryNames(countries), []string{"Austria", "Australia"}); err != nil {
+		return err
+	}
+	countries, next, err := s.GetCountries(ctx, database.CountryFilter{CodeEquals: &code, First: &first})
+	if err != nil {
+		return fmt.Errorf("GetCountries: %w", err)
+	}
+	if err := equal("GetCountries with code AT", countryNames(countries), []string{"Austria"}); err != nil {
+		return err
+	}
+	if next != nil {
+		return errors.New("GetCountries: a cursor after the last page")
+	}
+
+	negative := -1
+	for _, filter := range []database.CountryFilter{{SortBy: "population"}, {SortOrder: "up"}, {First: &negative}, {After: &code}} {
+		if _, _, err := s.GetCountries(ctx, filter); !errors.Is(err, database.ErrInvalidFilter) {
+			return fmt.Errorf("GetCountries with %+v: %v, want ErrInvalidFilter", filter, err)
+		}
+	}
+	return nil
+}
+
+func checkCovidStatistics(ctx context.Context, s database.Store) error {
+	country, _, err := s.CreateCountry(ctx, "Belgium", "BE")
+	if err != nil {
+		return fmt.Errorf("CreateCountry: %w", err)
+	}
+	id, err := s.AddCovidStatistic(ctx, country.ID, "2021-01-01", 10, 2, 1)
+	if err != nil {
+		return fmt.Errorf("AddCovidStatistic: %w", err)
+	}
+
+	got, err := s.GetCovidStatistic(ctx, id)
+	if err != nil {
+		return fmt.Errorf("GetCovidStatistic: %w", err)
+	}
+	want := database.CovidStatistic{ID: id, CountryID: country.ID, Date: "2021-01-01", Confirmed: 10, Recovered: 2, Deaths: 1}
+	if err := equal("GetCovidStatistic", got, want); err != nil {
+		return err
+	}
+
+	exists, err := s.CheckCovidStatisticExists(ctx, country.ID, "2021-01-01")
+	if err != nil || !exists {
+		return fmt.Errorf("CheckCovidStatisticExists: %v, err %v, want true", exists, err)
+	}
+	exists, err = s.CheckCovidStatisticExists(ctx, country.ID, "2021-01-02")
+	if err != nil || exists {
+		return fmt.Errorf("CheckCovidStatisticExists of another day: %v, err %v, want false", exists, err)
+	}
+	countryID, err := s.GetCountryIDByCovidStatisticID(ctx, id)
+	if err != nil || countryID != country.ID {
+		return fmt.Errorf("GetCountryIDByCovidStatisticID: %d, err %v, want %d", countryID, err, country.ID)
+	}
+
+	updated, err := s.UpdateCovidStatistic(ctx, id, "2021-01-02", 20, 4, 2)
+	if err != nil {
+		return fmt.Errorf("UpdateCovidStatistic: %w", err)
+	}
+	want = database.CovidStatistic{ID: id, CountryID: country.ID, Date: "2021-01-02", Confirmed: 20, Recovered: 4, Deaths: 2}
+	if err := equal("UpdateCovidStatistic", updated, want); err != nil {
+		return err
+	}
+	if _, err := s.UpdateCovidStatistic(ctx, 999, "2021-01-02", 20, 4, 2); !errors.Is(err, database.ErrNotFound) {
+		return fmt.Errorf("UpdateCovidStatistic of a missing statistic: %v, want ErrNotFound", err)
+	}
+
+	withCountry, err := s.GetCountryByID(ctx, country.ID)
+	if err != nil {
+		return fmt.Errorf("GetCountryByID: %w", err)
+	}
+	want.Country = database.Country{ID: country.ID, Name: "Belgium", Code: "BE"}
+	if err := equal("statistics of GetCountryByID", withCountry.CovidStatistics, []database.CovidStatistic{want}); err != nil {
+		return err
+	}
+
+	if err := s.DeleteCovidStatistic(ctx, id); err != nil {
+		return fmt.Errorf("DeleteCovidStatistic: %w", err)
+	}
+	if _, err := s.GetCovidStatistic(ctx, id); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("GetCovidStatistic of a deleted statistic: %v, want sql.ErrNoRows", err)
+	}
+	if err := s.DeleteCovidStatistic(ctx, id); !errors.Is(err, database.ErrNotFound) {
+		return fmt.Errorf("DeleteCovidStatistic of a missing statistic: %v, want ErrNotFound", err)
+	}
+	return nil
+}
+
+func checkCovidStatisticPages(ctx context.Context, s database.Store) error {
+	country, _, err := s.CreateCountry(ctx, "Belgium", "BE")
+	if err != nil {
+		return fmt.Errorf("CreateCountry: %w", err)
+	}
+	other, _, err := s.CreateCountry(ctx, "France", "FR")
+	if err != nil {
+		return fmt.Errorf("CreateCountry: %w", err)
+	}
+	for i, confirmed := range []int{30, 10, 30, 20, 50} {
+		if _, err := s.AddCovidStatistic(ctx, country.ID, fmt.Sprintf("2021-01-0%d", i+1), confirmed, 0, 0); err != nil {
+			return fmt.Errorf("AddCovidStatistic: %w", err)
+		}
+	}
+	if _, err := s.AddCovidStatistic(ctx, other.ID, "2021-01-02", 40, 0, 0); err != nil {
+		return fmt.Errorf("AddCovidStatistic: %w", err)
+	}
+
+	first := 2
+	from, to := "2021-01-02", "2021-01-05"
+	var dates []string
+	var after *string
+	for page := 0; page < 5; page++ {
+		statistics, next, err := s.ListCovidStatistics(ctx, database.CovidStatisticFilter{
+			CountryID: country.ID, DateFrom: &from, DateTo: &to,
+			SortBy: "confirmed", SortOrder: database.SortDesc, First: &first, After: after,
+		})
+		if err != nil {
+			return fmt.Errorf("ListCovidStatistics: %w", err)
+		}
+		for _, statistic := range statistics {
+			dates = append(dates, statistic.Date)
+		}
+		if next == nil {
+			break
+		}
+		after = next
+	}
+	want := []string{"2021-01-05", "2021-01-03", "2021-01-04", "2021-01-02"}
+	if err := equal("pages of ListCovidStatistics by confirmed descending", dates, want); err != nil {
+		return err
+	}
+
+	zero := 0
+	statistics, next, err := s.ListCovidStatistics(ctx, database.CovidStatisticFilter{CountryID: country.ID, First: &zero})
+	if err != nil || len(statistics) != 0 || next != nil {
+		return fmt.Errorf("ListCovidStatistics of an empty page: %d statistics, cursor %v, err %v", len(statistics), next, err)
+	}
+	if _, _, err := s.ListCovidStatistics(ctx, database.CovidStatisticFilter{CountryID: country.ID, SortBy: "country"}); !errors.Is(err, database.ErrInvalidFilter) {
+		return fmt.Errorf("ListCovidStatistics sorted by country: %v, want ErrInvalidFilter", err)
+	}
+	return nil
+}
+
+func checkNeighbouringCovidStatistics(ctx context.Context, s database.Store) error {
+	country, _, err := s.CreateCountry(ctx, "Belgium", "BE")
+	if err != nil {
+		return fmt.Errorf("CreateCountry: %w", err)
+	}
+	var ids []int
+	for _, date := range []string{"2021-01-01", "2021-01-02", "2021-01-02", "2021-01-04"} {
+		id, err := s.AddCovidStatistic(ctx, country.ID, date, 10, 0, 0)
+		if err != nil {
+			return fmt.Errorf("AddCovidStatistic: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	count, err := s.CountCovidStatisticsOnDate(ctx, country.ID, "2021-01-02", ids[1])
+	if err != nil || count != 1 {
+		return fmt.Errorf("CountCovidStatisticsOnDate: %d, err %v, want 1", count, err)
+	}
+
+	previous, err := s.GetPreviousCovidStatistics(ctx, country.ID, "2021-01-04", ids[3], 5)
+	if err != nil {
+		return fmt.Errorf("GetPreviousCovidStatistics: %w", err)
+	}
+	if len(previous) != 3 || previous[2].ID != ids[0] {
+		return fmt.Errorf("GetPreviousCovidStatistics: %+v, want the 3 earlier statistics ending with %d", previous, ids[0])
+	}
+	previous, err = s.GetPreviousCovidStatistics(ctx, country.ID, "2021-01-04", ids[3], 1)
+	if err != nil || len(previous) != 1 || previous[0].Date != "2021-01-02" {
+		return fmt.Errorf("GetPreviousCovidStatistics with a limit of 1: %+v, err %v, want a statistic of 2021-01-02", previous, err)
+	}
+
+	next, found, err := s.GetNextCovidStatistic(ctx, country.ID, "2021-01-02", ids[1])
+	if err != nil || !found || next.ID != ids[3] {
+		return fmt.Errorf("GetNextCovidStatistic: %+v, found %v, err %v, want %d", next, found, err, ids[3])
+	}
+	if _, found, err := s.GetNextCovidStatistic(ctx, country.ID, "2021-01-04", ids[3]); err != nil || found {
+		return fmt.Errorf("GetNextCovidStatistic after the last one: found %v, err %v", found, err)
+	}
+	return nil
+}
+
+func checkLatestCovidStatistics(ctx context.Context, s database.Store) error {
+	country, _, err := s.CreateCountry(ctx, "Belgium", "BE")
+	if err != nil {
+		return fmt.Errorf("CreateCountry: %w", err)
+	}
+	other, _, err := s.CreateCountry(ctx, "France", "FR")
+	if err != nil {
+		return fmt.Errorf("CreateCountry: %w", err)
+	}
+	empty, _, err := s.CreateCountry(ctx, "Germany", "DE")
+	if err != nil {
+		return fmt.Errorf("CreateCountry: %w", err)
+	}
+
+	// added out of order, the latest statistic is the one of the last day:
+	statistics := []database.CovidStatistic{
+		{CountryID: country.ID, Date: "2021-01-10", Confirmed: 200, Recovered: 20, Deaths: 8},
+		{CountryID: country.ID, Date: "2021-01-01", Confirmed: 100, Recovered: 10, Deaths: 2},
+		{CountryID: country.ID, Date: "2021-01-09", Confirmed: 180, Recovered: 15, Deaths: 6},
+		{CountryID: other.ID, Date: "2021-01-05", Confirmed: 50, Recovered: 5, Deaths: 0},
+	}
+	for i := range statistics {
+		statistic := &statistics[i]
+		statistic.ID, err = s.AddCovidStatistic(ctx, statistic.CountryID, statistic.Date, statistic.Confirmed, statistic.Recovered, statistic.Deaths)
+		if err != nil {
+			return fmt.Errorf("AddCovidStatistic: %w", err)
+		}
+	}
+
+	latest, err := s.GetCountryLatestStatistics(ctx, country.ID)
+	if err != nil {
+		return fmt.Errorf("GetCountryLatestStatistics: %w", err)
+	}
+	if latest.UpdatedAt == "" {
+		return errors.New("GetCountryLatestStatistics: no update time")
+	}
+	latest.UpdatedAt = ""
+	want := database.CountryLatestStatistics{
+		CountryID: country.ID, CovidStatisticID: statistics[0].ID, Date: "2021-01-10", Confirmed: 200, Recovered: 20, Deaths: 8,
+		Change1Day:  &database.StatisticChange{Confirmed: 20, Recovered: 5, Deaths: 2},
+		Change7Days: &database.StatisticChange{Confirmed: 100, Recovered: 10, Deaths: 6},
+	}
+	if err := equal("GetCountryLatestStatistics", latest, want); err != nil {
+		return err
+	}
+	if _, err := s.GetCountryLatestStatistics(ctx, empty.ID); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("GetCountryLatestStatistics without statistics: %v, want sql.ErrNoRows", err)
+	}
+
+	// countries without statistics are left out of the list:
+	list, err := s.ListCountryLatestStatistics(ctx)
+	if err != nil {
+		return fmt.Errorf("ListCountryLatestStatistics: %w", err)
+	}
+	if len(list) != 2 || list[1].CountryID != other.ID || list[1].CovidStatisticID != statistics[3].ID || list[1].Change1Day != nil {
+		return fmt.Errorf("ListCountryLatestStatistics: %+v, want Belgium and France", list)
+	}
+	list[0].UpdatedAt = ""
+	if err := equal("ListCountryLatestStatistics", list[0], want); err != nil {
+		return err
+	}
+
+	byCountry, err := s.GetLatestCovidStatisticsByCountryID(ctx, country.ID)
+	if err != nil || byCountry.ID != statistics[0].ID {
+		return fmt.Errorf("GetLatestCovidStatisticsByCountryID: %+v, err %v, want %d", byCountry, err, statistics[0].ID)
+	}
+	percentage, err := s.GetDeathPercentage(ctx, country.ID)
+	if err != nil || math.Abs(percentage-4) > 1e-9 {
+		return fmt.Errorf("GetDeathPercentage: %v, err %v, want 4", percentage, err)
+	}
+
+	asOf := "2021-01-09"
+	all, err := s.GetLatestCovidStatistics(ctx, &asOf, nil)
+	if err != nil {
+		return fmt.Errorf("GetLatestCovidStatistics: %w", err)
+	}
+	if len(all) != 2 || all[0].Country.ID != country.ID || all[0].Latest.ID != statistics[2].ID ||
+		all[0].Previous == nil || all[0].Previous.ID != statistics[1].ID || all[1].Latest.ID != statistics[3].ID || all[1].Previous != nil {
+		return fmt.Errorf("GetLatestCovidStatistics as of %s: %+v", asOf, all)
+	}
+	some, err := s.GetLatestCovidStatistics(ctx, nil, []int{other.ID, empty.ID})
+	if err != nil || len(some) != 1 || some[0].Country.Name != "France" {
+		return fmt.Errorf("GetLatestCovidStatistics of France and Germany: %+v, err %v, want France only", some, err)
+	}
+
+	// deleting the latest statistic makes the one before the latest:
+	if err := s.DeleteCovidStatistic(ctx, statistics[0].ID); err != nil {
+		return fmt.Errorf("DeleteCovidStatistic: %w", err)
+	}
+	latest, err = s.GetCountryLatestStatistics(ctx, country.ID)
+	if err != nil {
+		return fmt.Errorf("GetCountryLatestStatistics: %w", err)
+	}
+	if latest.CovidStatisticID != statistics[2].ID {
+		return fmt.Errorf("GetCountryLatestStatistics after a delete: statistic %d, want %d", latest.CovidStatisticID, statistics[2].ID)
+	}
+	return equal("change over 1 day after a delete", latest.Change1Day, &database.StatisticChange{Confirmed: 80, Recovered: 5, Deaths: 4})
+}
+
+func checkStreamCovidStatistics(ctx context.Context, s database.Store) error {
+	country, _, err := s.CreateCountry(ctx, "Belgium", "BE")
+	if err != nil {
+		return fmt.Errorf("CreateCountry: %w", err)
+	}
+	other, _, err := s.CreateCountry(ctx, "France", "FR")
+	if err != nil {
+		return fmt.Errorf("CreateCountry: %w", err)
+	}
+	for _, statistic := range []database.CovidStatistic{
+		{CountryID: other.ID, Date: "2021-01-02"},
+		{CountryID: country.ID, Date: "2021-01-03"},
+		{CountryID: country.ID, Date: "2021-01-01"},
+		{CountryID: other.ID, Date: "2021-01-01"},
+	} {
+		if _, err := s.AddCovidStatistic(ctx, statistic.CountryID, statistic.Date, 1, 0, 0); err != nil {
+			return fmt.Errorf("AddCovidStatistic: %w", err)
+		}
+	}
+
+	var streamed []string
+	from := "2021-01-01"
+	to := "2021-01-02"
+	err = s.StreamCovidStatistics(ctx, nil, &from, &to, func(statistic database.CovidStatistic) error {
+		streamed = append(streamed, statistic.Country.Code+" "+statistic.Date)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("StreamCovidStatistics: %w", err)
+	}
+	if err := equal("StreamCovidStatistics", streamed, []string{"BE 2021-01-01", "FR 2021-01-01", "FR 2021-01-02"}); err != nil {
+		return err
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = s.StreamCovidStatistics(ctx, []int{country.ID}, nil, nil, func(database.CovidStatistic) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		return fmt.Errorf("StreamCovidStatistics stopped by its callback: %v after %d calls, want the callback error after 1", err, calls)
+	}
+	return nil
+}
+
+func checkDataQualityIssues(ctx context.Context, s database.Store) error {
+	country, _, err := s.CreateCountry(ctx, "Belgium", "BE")
+	if err != nil {
+		return fmt.Errorf("CreateCountry: %w", err)
+	}
+	late, err := s.AddCovidStatistic(ctx, country.ID, "2021-01-02", 10, 0, 0)
+	if err != nil {
+		return fmt.Errorf("AddCovidStatistic: %w", err)
+	}
+	early, err := s.AddCovidStatistic(ctx, country.ID, "2021-01-01", 20, 0, 0)
+	if err != nil {
+		return fmt.Errorf("AddCovidStatistic: %w", err)
+	}
+
+	issue := func(covidStatisticID int, date string, code string) database.DataQualityIssue {
+		return database.DataQualityIssue{
+			CovidStatisticID: covidStatisticID, CountryID: country.ID, Date: date, Code: code,
+			Severity: "warning", Message: code, CreatedAt: "2021-01-03T00:00:00Z",
+		}
+	}
+	if err := s.ReplaceDataQualityIssues(ctx, late, []database.DataQualityIssue{issue(late, "2021-01-02", "decrease")}); err != nil {
+		return fmt.Errorf("ReplaceDataQualityIssues: %w", err)
+	}
+	if err := s.ReplaceDataQualityIssues(ctx, late, []database.DataQualityIssue{issue(late, "2021-01-02", "spike"), issue(late, "2021-01-02", "decrease")}); err != nil {
+		return fmt.Errorf("ReplaceDataQualityIssues: %w", err)
+	}
+	if err := s.ReplaceDataQualityIssues(ctx, early, []database.DataQualityIssue{issue(early, "2021-01-01", "duplicate")}); err != nil {
+		return fmt.Errorf("ReplaceDataQualityIssues: %w", err)
+	}
+
+	issues, err := s.GetDataQualityIssuesByCovidStatisticID(ctx, late)
+	if err != nil {
+		return fmt.Errorf("GetDataQualityIssuesByCovidStatisticID: %w", err)
+	}
+	if err := equal("codes of GetDataQualityIssuesByCovidStatisticID", issueCodes(issues), []string{"spike", "decrease"}); err != nil {
+		return err
+	}
+	issues, err = s.GetDataQualityIssuesByCountryID(ctx, country.ID)
+	if err != nil {
+		return fmt.Errorf("GetDataQualityIssuesByCountryID: %w", err)
+	}
+	if err := equal("codes of GetDataQualityIssuesByCountryID", issueCodes(issues), []string{"duplicate", "spike", "decrease"}); err != nil {
+		return err
+	}
+
+	// the issues go with their statistic:
+	if err := s.DeleteCovidStatistic(ctx, late); err != nil {
+		return fmt.Errorf("DeleteCovidStatistic: %w", err)
+	}
+	issues, err = s.GetDataQualityIssuesByCountryID(ctx, country.ID)
+	if err != nil {
+		return fmt.Errorf("GetDataQualityIssuesByCountryID: %w", err)
+	}
+	return equal("codes of GetDataQualityIssuesByCountryID after a delete", issueCodes(issues), []string{"duplicate"})
+}
+
+func checkUsers(ctx context.Context, s database.Store) error {
+	id, err := s.RegisterUser(ctx, "alice", "alice@example.com", []byte("hash"), []byte("salt"))
+	if err != nil {
+		return fmt.Errorf("RegisterUser: %w", err)
+	}
+	if _, err := s.RegisterUser(ctx, "alice", "other@example.com", []byte("hash"), []byte("salt")); err == nil {
+		return errors.New("RegisterUser with a taken username: no error")
+	}
+	if err := s.CheckIfUserExists(ctx, "alice"); err == nil {
+		return errors.New("CheckIfUserExists of a registered user: no error")
+	}
+	if err := s.CheckIfUserExists(ctx, "bob"); err != nil {
+		return fmt.Errorf("CheckIfUserExists of a new user: %w", err)
+	}
+	if err := s.CheckIfEmailExists(ctx, "alice@example.com"); err == nil {
+		return errors.New("CheckIfEmailExists of a registered email: no error")
+	}
+
+	want := database.User{ID: int(id), Username: "alice", Email: "alice@example.com", Password: "hash", Salt: "salt", Role: database.RoleUser}
+	user, err := s.GetUserByUsername(ctx, "alice")
+	if err != nil {
+		return fmt.Errorf("GetUserByUsername: %w", err)
+	}
+	if err := equal("GetUserByUsername", user, want); err != nil {
+		return err
+	}
+	user, err = s.GetUserByEmail(ctx, "alice@example.com")
+	if err != nil {
+		return fmt.Errorf("GetUserByEmail: %w", err)
+	}
+	if err := equal("GetUserByEmail", user, want); err != nil {
+		return err
+	}
+	user, err = s.GetUserByID(ctx, int(id))
+	if err != nil {
+		return fmt.Errorf("GetUserByID: %w", err)
+	}
+	want.Salt = ""
+	if err := equal("GetUserByID", user, want); err != nil {
+		return err
+	}
+
+	if err := s.DeleteUser(ctx, int(id)); err != nil {
+		return fmt.Errorf("DeleteUser: %w", err)
+	}
+	if _, err := s.GetUserByUsername(ctx, "alice"); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("GetUserByUsername of a deleted user: %v, want sql.ErrNoRows", err)
+	}
+	if err := s.DeleteUser(ctx, int(id)); !errors.Is(err, database.ErrNotFound) {
+		return fmt.Errorf("DeleteUser of a missing user: %v, want ErrNotFound", err)
+	}
+	return nil
+}
+
+func checkUserTokens(ctx context.Context, s database.Store) error {
+	id, err := s.RegisterUser(ctx, "alice", "alice@example.com", []byte("hash"), []byte("salt"))
+	if err != nil {
+		return fmt.Errorf("RegisterUser: %w", err)
+	}
+	userID := int(id)
+	expiresAt := time.Now().Add(time.Hour)
+
+	if err := s.CreateUserToken(ctx, userID, database.TokenPasswordReset, "first", expiresAt); err != nil {
+		return fmt.Errorf("CreateUserToken: %w", err)
+	}
+	if err := s.CreateUserToken(ctx, userID, database.TokenPasswordReset, "second", expiresAt); err != nil {
+		return fmt.Errorf("CreateUserToken replacing a token: %w", err)
+	}
+	if err := s.CreateUserToken(ctx, userID, database.TokenEmailVerification, "verification", expiresAt); err != nil {
+		return fmt.Errorf("CreateUserToken for another purpose: %w", err)
+	}
+	if _, err := s.ConsumeUserToken(ctx, database.TokenPasswordReset, "first"); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("ConsumeUserToken of a replaced token: %v, want sql.ErrNoRows", err)
+	}
+	if _, err := s.ConsumeUserToken(ctx, database.TokenPasswordReset, "verification"); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("ConsumeUserToken of a token for another purpose: %v, want sql.ErrNoRows", err)
+	}
+	got, err := s.ConsumeUserToken(ctx, database.TokenPasswordReset, "second")
+	if err != nil || got != userID {
+		return fmt.Errorf("ConsumeUserToken: %d, %v, want %d", got, err, userID)
+	}
+	if _, err := s.ConsumeUserToken(ctx, database.TokenPasswordReset, "second"); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("ConsumeUserToken of a used token: %v, want sql.ErrNoRows", err)
+	}
+	if got, err := s.ConsumeUserToken(ctx, database.TokenEmailVerification, "verification"); err != nil || got != userID {
+		return fmt.Errorf("ConsumeUserToken for another purpose: %d, %v, want %d", got, err, userID)
+	}
+
+	if err := s.CreateUserToken(ctx, userID, database.TokenPasswordReset, "expired", time.Now().Add(-time.Second)); err != nil {
+		return fmt.Errorf("CreateUserToken of an expired token: %w", err)
+	}
+	if _, err := s.ConsumeUserToken(ctx, database.TokenPasswordReset, "expired"); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("ConsumeUserToken of an expired token: %v, want sql.ErrNoRows", err)
+	}
+
+	if err := s.SetUserPassword(ctx, userID, []byte("new hash"), []byte("new salt")); err != nil {
+		return fmt.Errorf("SetUserPassword: %w", err)
+	}
+	if err := s.SetUserEmailVerified(ctx, userID); err != nil {
+		return fmt.Errorf("SetUserEmailVerified: %w", err)
+	}
+	if err := s.SetUserRole(ctx, userID, database.RoleAdmin); err != nil {
+		return fmt.Errorf("SetUserRole: %w", err)
+	}
+	user, err := s.GetUserByUsername(ctx, "alice")
+	if err != nil {
+		return fmt.Errorf("GetUserByUsername: %w", err)
+	}
+	want := database.User{ID: userID, Username: "alice", Email: "alice@example.com", Password: "new hash", Salt: "new salt",
+		Role: database.RoleAdmin, EmailVerified: true, TokenVersion: 1}
+	if err := equal("GetUserByUsername after SetUserPassword, SetUserEmailVerified and SetUserRole", user, want); err != nil {
+		return err
+	}
+
+	if err := s.CreateUserToken(ctx, userID, database.TokenPasswordReset, "deleted", expiresAt); err != nil {
+		return fmt.Errorf("CreateUserToken: %w", err)
+	}
+	if err := s.DeleteUser(ctx, userID); err != nil {
+		return fmt.Errorf("DeleteUser: %w", err)
+	}
+	if _, err := s.ConsumeUserToken(ctx, database.TokenPasswordReset, "deleted"); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("ConsumeUserToken of a deleted user: %v, want sql.ErrNoRows", err)
+	}
+	if err := s.SetUserEmailVerified(ctx, userID); !errors.Is(err, database.ErrNotFound) {
+		return fmt.Errorf("SetUserEmailVerified of a deleted user: %v, want ErrNotFound", err)
+	}
+	if err := s.SetUserRole(ctx, userID, database.RoleAdmin); !errors.Is(err, database.ErrNotFound) {
+		return fmt.Errorf("SetUserRole of a deleted user: %v, want ErrNotFound", err)
+	}
+	return nil
+}
+
+func checkMonitoredCountries(ctx context.Context, s database.Store) error {
+	userID, err := s.RegisterUser(ctx, "alice", "alice@example.com", []byte("hash"), []byte("salt"))
+	if err != nil {
+		return fmt.Errorf("RegisterUser: %w", err)
+	}
+	user := int(userID)
+
+	var countries []database.Country
+	for i, code := range []string{"BE", "FR", "DE"} {
+		country, _, err := s.CreateCountry(ctx, "Country "+code, code)
+		if err != nil {
+			return fmt.Errorf("CreateCountry: %w", err)
+		}
+		countries = append(countries, country)
+		if _, err := s.AddCovidStatistic(ctx, country.ID, "2021-01-01", (i+1)*100, 0, 30-i*10); err != nil {
+			return fmt.Errorf("AddCovidStatistic: %w", err)
+		}
+		if err := s.AddUserMonitoredCountry(ctx, user, country.ID); err != nil {
+			return fmt.Errorf("AddUserMonitoredCountry: %w", err)
+		}
+	}
+	if err := s.AddUserMonitoredCountry(ctx, user, countries[0].ID); err == nil {
+		return errors.New("AddUserMonitoredCountry of a monitored country: no error")
+	}
+
+	monitored, err := s.GetUserMonitoredCountries(ctx, user)
+	if err != nil {
+		return fmt.Errorf("GetUserMonitoredCountries: %w", err)
+	}
+	if err := equal("GetUserMonitoredCountries", countryNames(monitored), []string{"Country BE", "Country FR", "Country DE"}); err != nil {
+		return err
+	}
+
+	top, err := s.GetTopCountriesByCaseTypeForUser(ctx, user, "confirmed", 2)
+	if err != nil {
+		return fmt.Errorf("GetTopCountriesByCaseTypeForUser: %w", err)
+	}
+	if err := equal("GetTopCountriesByCaseTypeForUser by confirmed", countryNames(top), []string{"Country DE", "Country FR"}); err != nil {
+		return err
+	}
+	top, err = s.GetTopCountriesByCaseTypeForUser(ctx, user, "deaths", 1)
+	if err != nil {
+		return fmt.Errorf("GetTopCountriesByCaseTypeForUser: %w", err)
+	}
+	if err := equal("GetTopCountriesByCaseTypeForUser by deaths", countryNames(top), []string{"Country BE"}); err != nil {
+		return err
+	}
+
+	if err := s.RemoveUserMonitoredCountry(ctx, user, countries[1].ID); err != nil {
+		return fmt.Errorf("RemoveUserMonitoredCountry: %w", err)
+	}
+	if err := s.RemoveUserMonitoredCountry(ctx, user, countries[1].ID); !errors.Is(err, database.ErrNotFound) {
+		return fmt.Errorf("RemoveUserMonitoredCountry of a country not monitored: %v, want ErrNotFound", err)
+	}
+	// deleting a country stops its monitoring:
+	if err := s.DeleteCountry(ctx, countries[2].ID); err != nil {
+		return fmt.Errorf("DeleteCountry: %w", err)
+	}
+	monitored, err = s.GetUserMonitoredCountries(ctx, user)
+	if err != nil {
+		return fmt.Errorf("GetUserMonitoredCountries: %w", err)
+	}
+	return equal("GetUserMonitoredCountries after removals", countryNames(monitored), []string{"Country BE"})
+}
+
+func checkCountryGroups(ctx context.Context, s database.Store) error {
+	var countries []database.Country
+	for _, code := range []string{"FR", "BE", "JP"} {
+		country, _, err := s.CreateCountry(ctx, "Country "+code, code)
+		if err != nil {
+			return fmt.Errorf("CreateCountry: %w", err)
+		}
+		countries = append(countries, country)
+	}
+
+	groups, err := s.GetCountryGroups(ctx)
+	if err != nil {
+		return fmt.Errorf("GetCountryGroups: %w", err)
+	}
+	continents := map[string]int{}
+	for _, group := range groups {
+		if group.Kind != database.GroupKindContinent {
+			return fmt.Errorf("GetCountryGroups of a new store: got a %s group %q, want continents only", group.Kind, group.Name)
+		}
+		continents[group.Name] = group.ID
+	}
+	europe, err := s.GetCountryGroupByID(ctx, continents["Europe"])
+	if err != nil {
+		return fmt.Errorf("GetCountryGroupByID of Europe: %w", err)
+	}
+	if err := equal("members of Europe", countryNames(europe.Members), []string{"Country BE", "Country FR"}); err != nil {
+		return err
+	}
+	// a country follows its code to another continent:
+	if _, err := s.UpdateCountry(ctx, countries[1].ID, "Country BE", "CN"); err != nil {
+		return fmt.Errorf("UpdateCountry: %w", err)
+	}
+	asia, err := s.GetCountryGroupByID(ctx, continents["Asia"])
+	if err != nil {
+		return fmt.Errorf("GetCountryGroupByID of Asia: %w", err)
+	}
+	if err := equal("members of Asia after UpdateCountry", countryNames(asia.Members), []string{"Country BE", "Country JP"}); err != nil {
+		return err
+	}
+	if err := s.AddCountryGroupMember(ctx, continents["Asia"], countries[0].ID); !errors.Is(err, database.ErrContinentGroup) {
+		return fmt.Errorf("AddCountryGroupMember to a continent: %v, want ErrContinentGroup", err)
+	}
+	if err := s.DeleteCountryGroup(ctx, continents["Asia"]); !errors.Is(err, database.ErrContinentGroup) {
+		return fmt.Errorf("DeleteCountryGroup of a continent: %v, want ErrContinentGroup", err)
+	}
+
+	group, exists, err := s.CreateCountryGroup(ctx, "Friends", []int{countries[2].ID, countries[0].ID})
+	if err != nil || exists {
+		return fmt.Errorf("CreateCountryGroup: exists %v, err %v", exists, err)
+	}
+	if err := equal("members of a new group", countryNames(group.Members), []string{"Country FR", "Country JP"}); err != nil {
+		return err
+	}
+	if _, exists, err := s.CreateCountryGroup(ctx, "Friends", nil); err != nil || !exists {
+		return fmt.Errorf("CreateCountryGroup with a taken name: exists %v, err %v, want exists", exists, err)
+	}
+	if _, _, err := s.CreateCountryGroup(ctx, "Strangers", []int{-1}); !errors.Is(err, database.ErrNotFound) {
+		return fmt.Errorf("CreateCountryGroup with an unknown country: %v, want ErrNotFound", err)
+	}
+	if err := s.AddCountryGroupMember(ctx, group.ID, countries[1].ID); err != nil {
+		return fmt.Errorf("AddCountryGroupMember: %w", err)
+	}
+	if err := s.AddCountryGroupMember(ctx, group.ID, countries[1].ID); err != nil {
+		return fmt.Errorf("AddCountryGroupMember of a member: %w", err)
+	}
+	if err := s.AddCountryGroupMember(ctx, group.ID, -1); !errors.Is(err, database.ErrNotFound) {
+		return fmt.Errorf("AddCountryGroupMember of an unknown country: %v, want ErrNotFound", err)
+	}
+	if err := s.RemoveCountryGroupMember(ctx, group.ID, countries[0].ID); err != nil {
+		return fmt.Errorf("RemoveCountryGroupMember: %w", err)
+	}
+	if err := s.RemoveCountryGroupMember(ctx, group.ID, countries[0].ID); !errors.Is(err, database.ErrNotFound) {
+		return fmt.Errorf("RemoveCountryGroupMember of a country not in the group: %v, want ErrNotFound", err)
+	}
+	// deleting a country removes it from its groups:
+	if err := s.DeleteCountry(ctx, countries[2].ID); err != nil {
+		return fmt.Errorf("DeleteCountry: %w", err)
+	}
+	got, err := s.GetCountryGroupByID(ctx, group.ID)
+	if err != nil {
+		return fmt.Errorf("GetCountryGroupByID: %w", err)
+	}
+	want := database.CountryGroup{ID: group.ID, Name: "Friends", Kind: database.GroupKindCustom, CreatedAt: group.CreatedAt,
+		Members: []database.Country{{ID: countries[1].ID, Name: "Country BE", Code: "CN"}}}
+	if err := equal("GetCountryGroupByID after the changes", got, want); err != nil {
+		return err
+	}
+
+	groups, err = s.GetCountryGroups(ctx)
+	if err != nil {
+		return fmt.Errorf("GetCountryGroups: %w", err)
+	}
+	if last := groups[len(groups)-1]; last.Name != "Friends" || last.Members != nil {
+		return fmt.Errorf("GetCountryGroups: got %+v last, want the custom group without its members", last)
+	}
+	if err := s.DeleteCountryGroup(ctx, group.ID); err != nil {
+		return fmt.Errorf("DeleteCountryGroup: %w", err)
+	}
+	if err := s.DeleteCountryGroup(ctx, group.ID); !errors.Is(err, database.ErrNotFound) {
+		return fmt.Errorf("DeleteCountryGroup of a deleted group: %v, want ErrNotFound", err)
+	}
+	if _, err := s.GetCountryGroupByID(ctx, group.ID); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("GetCountryGroupByID of a deleted group: %v, want sql.ErrNoRows", err)
+	}
+	return nil
+}
+
+func checkPersistedQueries(ctx context.Context, s database.Store) error {
+	if _, err := s.GetPersistedQuery(ctx, "unknown"); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("GetPersistedQuery of an unknown hash: %v, want sql.ErrNoRows", err)
+	}
+	if err := s.AddPersistedQuery(ctx, "a", "{ a }", "2021-01-01T00:00:00Z", 0); err != nil {
+		return fmt.Errorf("AddPersistedQuery: %w", err)
+	}
+	if err := s.AddPersistedQuery(ctx, "a", "{ other }", "2021-01-02T00:00:00Z", 1); err != nil {
+		return fmt.Errorf("AddPersistedQuery of a known hash: %w", err)
+	}
+	got, err := s.GetPersistedQuery(ctx, "a")
+	if err != nil {
+		return fmt.Errorf("GetPersistedQuery: %w", err)
+	}
+	if err := equal("GetPersistedQuery", got, database.PersistedQuery{Hash: "a", Query: "{ a }", CreatedAt: "2021-01-01T00:00:00Z"}); err != nil {
+		return err
+	}
+
+	manifest := []database.PersistedQuery{
+		{Hash: "a", Query: "query A { a }", OperationName: "A", CreatedAt: "2021-02-01T00:00:00Z"},
+		{Hash: "b", Query: "query B { b }", OperationName: "B", CreatedAt: "2021-02-01T00:00:00Z"},
+	}
+	if err := s.AllowPersistedQueries(ctx, manifest, false); err != nil {
+		return fmt.Errorf("AllowPersistedQueries: %w", err)
+	}
+	got, err = s.GetPersistedQuery(ctx, "a")
+	if err != nil {
+		return fmt.Errorf("GetPersistedQuery: %w", err)
+	}
+	want := database.PersistedQuery{Hash: "a", Query: "query A { a }", OperationName: "A", Allowed: true, CreatedAt: "2021-01-01T00:00:00Z"}
+	if err := equal("GetPersistedQuery of an allowed query", got, want); err != nil {
+		return err
+	}
+
+	if err := s.AllowPersistedQueries(ctx, manifest[1:], true); err != nil {
+		return fmt.Errorf("AllowPersistedQueries replacing the manifest: %w", err)
+	}
+	hashes, err := s.GetAllowedPersistedQueryHashes(ctx)
+	if err != nil {
+		return fmt.Errorf("GetAllowedPersistedQueryHashes: %w", err)
+	}
+	if err := equal("GetAllowedPersistedQueryHashes after replacing the manifest", hashes, []string{"b"}); err != nil {
+		return err
+	}
+	for hash, allowed := range map[string]bool{"a": false, "b": true} {
+		got, err := s.GetPersistedQuery(ctx, hash)
+		if err != nil {
+			return fmt.Errorf("GetPersistedQuery: %w", err)
+		}
+		if got.Allowed != allowed {
+			return fmt.Errorf("GetPersistedQuery of %q after replacing the manifest: allowed %v, want %v", hash, got.Allowed, allowed)
+		}
+	}
+
+	// beyond the limit the oldest queries that are not allowed are evicted, allowed ones are kept:
+	for _, query := range []struct{ hash, createdAt string }{{"c", "2021-03-01T00:00:00Z"}, {"d", "2021-03-02T00:00:00Z"}, {"e", "2021-03-02T00:00:00Z"}} {
+		if err := s.AddPersistedQuery(ctx, query.hash, "{ "+query.hash+" }", query.createdAt, 2); err != nil {
+			return fmt.Errorf("AddPersistedQuery: %w", err)
+		}
+	}
+	for hash, kept := range map[string]bool{"a": false, "b": true, "c": false, "d": true, "e": true} {
+		_, err := s.GetPersistedQuery(ctx, hash)
+		if kept && err != nil {
+			return fmt.Errorf("GetPersistedQuery of %q: %w", hash, err)
+		}
+		if !kept && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("GetPersistedQuery of %q evicted by the limit: %v, want sql.ErrNoRows", hash, err)
+		}
+	}
+	return nil
+}
+
+func equal(what string, got any, want any) error {
+	if !reflect.DeepEqual(got, want) {
+		return fmt.Errorf("%s: got %+v, want %+v", what, got, want)
+	}
+	return nil
+}
+
+func countryNames(countries []database.Country) []string {
+	names := []string{}
+	for _, country := range countries {
+		names = append(names, country.Name)
+	}
+	return names
+}
+
+func issueCodes(issues []database.DataQualityIssue) []string {
+	codes := []string{}
+	for _, issue := range issues {
+		codes = append(codes, issue.Code)
+	}
+	return codes
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// updatedAtLayout formats countries.updated_at with a fixed width, for the latest one to be its maximum as text.
+const updatedAtLayout = "2006-01-02T15:04:05.000000000Z"
+
+func formatUpdatedAt(t time.Time) string {
+	return t.UTC().Format(updatedAtLayout)
+}
+
+// parseUpdatedAt reads countries.updated_at, empty for the countries not changed since it was added.
+func parseUpdatedAt(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(updatedAtLayout, value)
+}
+
+// touchCountry records that a country or its statistics changed, in the transaction of the change.
+func touchCountry(ctx context.Context, db execer, countryID int) error {
+	_, err := db.ExecContext(ctx, "UPDATE countries SET updated_at = ? WHERE id = ?", formatUpdatedAt(time.Now()), countryID)
+	if err != nil {
+		return fmt.Errorf("could not record the change of the country: %w", err)
+	}
+	return nil
+}
+
+// GetCountryUpdatedAt returns when a country, its statistics or their data quality issues last changed.
+func (d *DB) GetCountryUpdatedAt(ctx context.Context, countryID int) (time.Time, error) {
+	var updatedAt string
+	if err := d.queryRow(ctx, "SELECT updated_at FROM countries WHERE id = ?", countryID).Scan(&updatedAt); err != nil {
+		return time.Time{}, fmt.Errorf("could not get the last change of the country: %w", err)
+	}
+	return parseUpdatedAt(updatedAt)
+}
+
+// GetCountriesUpdatedAt returns when any country last changed, with the number of countries.
+func (d *DB) GetCountriesUpdatedAt(ctx context.Context) (time.Time, int, error) {
+	var updatedAt string
+	var count int
+	err := d.queryRow(ctx, "SELECT COALESCE(MAX(updated_at), ''), COUNT(*) FROM countries").Scan(&updatedAt, &count)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("could not get the last change of the countries: %w", err)
+	}
+	t, err := parseUpdatedAt(updatedAt)
+	return t, count, err
+}
@@ -0,0 +1,242 @@
+package export
+
+import (
+	"context"
+	"covid/database"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type Format string
+
+const (
+	FormatCSV    Format = "csv"
+	FormatNDJSON Format = "ndjson"
+	FormatXLSX   Format = "xlsx"
+	// FormatInflux is the InfluxDB line protocol, to backfill the history of a time series database.
+	FormatInflux Format = "influx"
+)
+
+// Formats are the supported formats, with their content types.
+var Formats = map[Format]string{
+	FormatCSV:    "text/csv; charset=utf-8",
+	FormatNDJSON: "application/x-ndjson",
+	FormatXLSX:   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	FormatInflux: "text/plain; charset=utf-8",
+}
+
+// FormatForContentType returns the format of a media type of the Accept header.
+func FormatForContentType(mediaType string) (Format, bool) {
+	for format, contentType := range Formats {
+		if strings.SplitN(contentType, ";", 2)[0] == mediaType {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+func ParseFormat(s string) (Format, error) {
+	format := Format(strings.ToLower(s))
+	if _, ok := Formats[format]; !ok {
+		return "", fmt.Errorf("unknown export format %q, expected csv, ndjson, xlsx or influx", s)
+	}
+	return format, nil
+}
+
+// Metrics that can be exported. The new_ metrics are the daily deltas of the cumulative ones,
+// they are empty on the first row of a country.
+const (
+	MetricConfirmed    = "confirmed"
+	MetricRecovered    = "recovered"
+	MetricDeaths       = "deaths"
+	MetricNewConfirmed = "new_confirmed"
+	MetricNewRecovered = "new_recovered"
+	MetricNewDeaths    = "new_deaths"
+)
+
+var (
+	Metrics        = []string{MetricConfirmed, MetricRecovered, MetricDeaths, MetricNewConfirmed, MetricNewRecovered, MetricNewDeaths}
+	DefaultMetrics = []string{MetricConfirmed, MetricRecovered, MetricDeaths}
+)
+
+// columns written before the metrics on every row.
+var baseColumns = []string{"country_id", "country_code", "country_name", "date"}
+
+// Options select the rows and columns of an export.
+type Options struct {
+	// CountryIDs are the countries exported, every country when empty.
+	CountryIDs []int
+	// DateFrom and DateTo are inclusive, formatted as 2006-01-02.
+	DateFrom *string
+	DateTo   *string
+	// Metrics are the columns exported after the country and date, DefaultMetrics when empty.
+	Metrics []string
+}
+
+// ParseMetrics reads a comma separated list of metrics.
+func ParseMetrics(s string) ([]string, error) {
+	var metrics []string
+	for _, metric := range strings.Split(s, ",") {
+		metric = strings.TrimSpace(metric)
+		if metric == "" {
+			continue
+		}
+		if !contains(Metrics, metric) {
+			return nil, fmt.Errorf("unknown metric %q, expected one of %s", metric, strings.Join(Metrics, ", "))
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics, nil
+}
+
+// rowWriter writes one format, values are strings, ints or nil for empty cells.
+type rowWriter interface {
+	WriteHeader(columns []string) error
+	WriteRow(values []any) error
+	Close() error
+}
+
+func newRowWriter(format Format, w io.Writer) (rowWriter, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w), nil
+	case FormatNDJSON:
+		return newNDJSONWriter(w), nil
+	case FormatXLSX:
+		return newXLSXWriter(w)
+	case FormatInflux:
+		return newInfluxWriter(w), nil
+	default:
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// CovidStatistics streams the statistics selected by opts to w. Rows are written as they are read
+// from the database, so w receives the first rows before the last ones are read.
+func CovidStatistics(ctx context.Context, d database.Store, w io.Writer, format Format, opts Options) error {
+	metrics := opts.Metrics
+	if len(metrics) == 0 {
+		metrics = DefaultMetrics
+	}
+	for _, metric := range metrics {
+		if !contains(Metrics, metric) {
+			return fmt.Errorf("unknown metric %q", metric)
+		}
+	}
+
+	writer, err := newRowWriter(format, w)
+	if err != nil {
+		return err
+	}
+	if err := writer.WriteHeader(append(append([]string{}, baseColumns...), metrics...)); err != nil {
+		return err
+	}
+
+	// deltas need the row before the first exported one, so they are read from the beginning:
+	readFrom := opts.DateFrom
+	if needsDeltas(metrics) {
+		readFrom = nil
+	}
+
+	var previous *database.CovidStatistic
+	values := make([]any, 0, len(baseColumns)+len(metrics))
+	err = d.StreamCovidStatistics(ctx, opts.CountryIDs, readFrom, opts.DateTo, func(covidStat database.CovidStatistic) error {
+		if previous != nil && previous.CountryID != covidStat.CountryID {
+			previous = nil
+		}
+		defer func() { previous = &covidStat }()
+
+		if opts.DateFrom != nil && covidStat.Date < *opts.DateFrom {
+			return nil
+		}
+
+		values = append(values[:0], covidStat.CountryID, covidStat.Country.Code, covidStat.Country.Name, covidStat.Date)
+		for _, metric := range metrics {
+			values = append(values, metricValue(metric, &covidStat, previous))
+		}
+		return writer.WriteRow(values)
+	})
+	if err != nil {
+		return err
+	}
+
+	return writer.Close()
+}
+
+func needsDeltas(metrics []string) bool {
+	for _, metric := range metrics {
+		if strings.HasPrefix(metric, "new_") {
+			return true
+		}
+	}
+	return false
+}
+
+func metricValue(metric string, covidStat *database.CovidStatistic, previous *database.CovidStatistic) any {
+	switch metric {
+	case MetricConfirmed:
+		return covidStat.Confirmed
+	case MetricRecovered:
+		return covidStat.Recovered
+	case MetricDeaths:
+		return covidStat.Deaths
+	}
+
+	if previous == nil {
+		return nil
+	}
+	switch metric {
+	case MetricNewConfirmed:
+		return covidStat.Confirmed - previous.Confirmed
+	case MetricNewRecovered:
+		return covidStat.Recovered - previous.Recovered
+	case MetricNewDeaths:
+		return covidStat.Deaths - previous.Deaths
+	}
+	return nil
+}
+
+// ErrNoFormat is returned by FormatFromFileName for files without a known extension.
+var ErrNoFormat = errors.New("cannot tell the export format from the file name")
+
+// FormatFromFileName returns the format matching the extension of a file name.
+func FormatFromFileName(name string) (Format, error) {
+	i := strings.LastIndex(name, ".")
+	if i < 0 {
+		return "", ErrNoFormat
+	}
+	format, err := ParseFormat(name[i+1:])
+	if err != nil {
+		return "", ErrNoFormat
+	}
+	return format, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCountryIDs reads a comma separated list of country IDs.
+func ParseCountryIDs(s string) ([]int, error) {
+	var ids []int
+	for _, id := range strings.Split(s, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid country ID %q", id)
+		}
+		ids = append(ids, n)
+	}
+	return ids, nil
+}
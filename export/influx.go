@@ -0,0 +1,110 @@
+package export
+
+import (
+	"bufio"
+	"covid/database"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// influxMeasurement is the measurement of the points, tagged with the country like the exporter gauges.
+const influxMeasurement = "covid"
+
+// influxWriter writes a point of the InfluxDB line protocol per row, tagged with the name, code and continent of
+// the country, with the metrics as integer fields and the day of the statistic, at midnight UTC, as the time:
+//
+//	covid,country=Belgium,code=BE,continent=Europe confirmed=200i,deaths=8i 1610236800000000000
+//
+// Empty metrics, such as the deltas of the first day of a country, are left out of their point, and rows
+// without any metric are skipped since a point needs a field.
+type influxWriter struct {
+	w       *bufio.Writer
+	columns []string
+	line    []byte
+}
+
+func newInfluxWriter(w io.Writer) *influxWriter {
+	return &influxWriter{w: bufio.NewWriter(w)}
+}
+
+func (n *influxWriter) WriteHeader(columns []string) error {
+	n.columns = columns
+	return nil
+}
+
+func (n *influxWriter) WriteRow(values []any) error {
+	var code, name, date string
+	fields := 0
+	n.line = append(n.line[:0], influxMeasurement...)
+	for i, value := range values {
+		switch n.columns[i] {
+		case "country_code":
+			code = fmt.Sprint(value)
+		case "country_name":
+			name = fmt.Sprint(value)
+		case "date":
+			date = fmt.Sprint(value)
+		}
+	}
+	continent, _ := database.ContinentOf(code)
+	n.appendTag("country", name)
+	n.appendTag("code", code)
+	n.appendTag("continent", continent)
+
+	for i, value := range values[len(baseColumns):] {
+		if value == nil {
+			continue
+		}
+		if fields == 0 {
+			n.line = append(n.line, ' ')
+		} else {
+			n.line = append(n.line, ',')
+		}
+		n.line = append(n.line, influxTagReplacer.Replace(n.columns[len(baseColumns)+i])...)
+		n.line = append(n.line, '=')
+		n.line = append(n.line, fmt.Sprint(value)...)
+		n.line = append(n.line, 'i')
+		fields++
+	}
+	if fields == 0 {
+		return nil
+	}
+
+	if len(date) > len("2006-01-02") {
+		date = date[:len("2006-01-02")]
+	}
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return fmt.Errorf("could not read the date of a statistic: %w", err)
+	}
+	n.line = append(n.line, ' ')
+	n.line = strconv.AppendInt(n.line, day.UnixNano(), 10)
+	n.line = append(n.line, '\n')
+
+	if _, err := n.w.Write(n.line); err != nil {
+		return err
+	}
+	// like NDJSON, points are flushed as they come so that clients can write them while the export runs:
+	return n.w.Flush()
+}
+
+// appendTag appends a tag to the line, tags without a value are not allowed and left out.
+func (n *influxWriter) appendTag(key string, value string) {
+	if value == "" {
+		return
+	}
+	n.line = append(n.line, ',')
+	n.line = append(n.line, key...)
+	n.line = append(n.line, '=')
+	n.line = append(n.line, influxTagReplacer.Replace(value)...)
+}
+
+func (n *influxWriter) Close() error {
+	return n.w.Flush()
+}
+
+// influxTagReplacer escapes the keys and values of tags and the keys of fields, which cannot hold newlines.
+var influxTagReplacer = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\ `)
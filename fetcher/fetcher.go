@@ -1,14 +1,19 @@
 package fetcher
 
 import (
+	"context"
 	"covid/database"
+	"covid/logging"
+	"covid/quality"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -23,53 +28,268 @@ type Covid19APIResponse struct {
 
 var counter int = 0
 
-func StartFetchingRoutine(db *sql.DB, updateInterval time.Duration) {
+var (
+	// ErrRefreshRunning is returned by Refresh while a fetch is running, a refresh or a scheduled one.
+	ErrRefreshRunning = errors.New("a refresh of the statistics is already running")
+	// ErrStopped is returned by Refresh once the fetcher is stopped.
+	ErrStopped = errors.New("the fetcher is stopped")
+)
+
+// Fetcher updates the statistics of every country from the upstream API.
+type Fetcher struct {
+	store database.Store
+	// checker runs the data quality checks on the statistics fetched.
+	checker     *quality.Checker
+	upstreamURL string
+	// stop is closed to stop the fetches before their next country, cancelling ctx aborts the country they
+	// fetch as well. wg waits for the fetching routine and the refreshes.
+	stop   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	hooks  Hooks
+
+	// mu guards the state of the fetches reported by Status, and stopped and fetching.
+	mu      sync.Mutex
+	runs    int
+	backlog int
+	source  SourceStatus
+	stopped bool
+	// fetching is set while the scheduled fetch or a refresh runs, a single one runs at a time: two would check
+	// the same dates before either stores them, and store them twice.
+	fetching bool
+}
+
+// Hooks are called as the fetcher works, to monitor it. Any of them can be nil.
+type Hooks struct {
+	// RunDone is called after every fetch of the countries, with an error when it could not go through them.
+	RunDone func(duration time.Duration, err error)
+	// CountryDone is called after every country, with a nil error when its statistics were stored.
+	CountryDone func(country string, err error)
+	// UpstreamResponse is called after every request to the upstream API, with the error of the requests
+	// that got no response.
+	UpstreamResponse func(statusCode int, err error)
+	// Retry is called when a request rejected by the rate limit of the upstream API is retried.
+	Retry func(country string)
+}
+
+// New returns a Fetcher reading from upstreamURL, the base URL of an API compatible with api.covid19api.com.
+func New(store database.Store, checker *quality.Checker, upstreamURL string) *Fetcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Fetcher{
+		store:       store,
+		checker:     checker,
+		upstreamURL: strings.TrimSuffix(upstreamURL, "/"),
+		stop:        make(chan struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// SetHooks sets the hooks called from then on, it must not be called while fetching.
+func (f *Fetcher) SetHooks(hooks Hooks) {
+	f.hooks = hooks
+}
+
+// StartFetchingRoutine fetches the statistics now and then every updateInterval, until Stop is called.
+func (f *Fetcher) StartFetchingRoutine(updateInterval time.Duration) {
+	f.wg.Add(1)
 	go func() {
-		FetchAndUpdateData(db) // Call this function immediately for the initial data fetch.
-		for range time.Tick(updateInterval) {
-			FetchAndUpdateData(db)
+		defer f.wg.Done()
+		ticker := time.NewTicker(updateInterval)
+		defer ticker.Stop()
+
+		for {
+			// the logs of every scheduled fetch share an ID, like those of a request:
+			ctx := logging.WithRequestID(f.ctx, logging.NewRequestID())
+			if f.startFetching() {
+				f.fetchAndUpdateData(ctx, f.stop)
+				f.fetchingDone()
+			} else {
+				slog.InfoContext(ctx, "skipping the scheduled fetch, a refresh is running")
+			}
+			select {
+			case <-f.stop:
+				return
+			case <-ticker.C:
+			}
 		}
 	}()
 }
 
-func FetchAndUpdateData(db *sql.DB) error {
-	d := database.NewDB(db)
-	countries, err := d.GetCountries(nil, nil, nil, nil)
+// Refresh fetches the statistics in the background and returns at once. The fetch keeps the values of ctx, such
+// as the request ID of its logs, but outlives it: it is only stopped by Stop.
+func (f *Fetcher) Refresh(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stopped {
+		return ErrStopped
+	}
+	if f.fetching {
+		return ErrRefreshRunning
+	}
+	f.fetching = true
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stopCancel := context.AfterFunc(f.ctx, cancel)
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		defer cancel()
+		defer stopCancel()
+		defer f.fetchingDone()
+		f.fetchAndUpdateData(ctx, f.stop)
+	}()
+	return nil
+}
+
+// startFetching marks a fetch as running, it returns false when one already is.
+func (f *Fetcher) startFetching() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fetching {
+		return false
+	}
+	f.fetching = true
+	return true
+}
+
+func (f *Fetcher) fetchingDone() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fetching = false
+}
+
+// Stop stops the fetches once the country they fetch is stored, and waits for them. When ctx is done first the
+// countries being fetched are aborted, and Stop still waits for the fetches to return, for the store to be
+// closed safely after it.
+func (f *Fetcher) Stop(ctx context.Context) error {
+	f.mu.Lock()
+	if f.stopped {
+		f.mu.Unlock()
+		return nil
+	}
+	f.stopped = true
+	close(f.stop)
+	f.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		f.cancel()
+		return nil
+	case <-ctx.Done():
+		f.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// FetchAndUpdateData fetches the statistics of every country, cancelling ctx aborts the country being fetched.
+// It returns ErrRefreshRunning while another fetch is running.
+func (f *Fetcher) FetchAndUpdateData(ctx context.Context) error {
+	if !f.startFetching() {
+		return ErrRefreshRunning
+	}
+	defer f.fetchingDone()
+	return f.fetchAndUpdateData(ctx, nil)
+}
+
+// fetchAndUpdateData returns before the next country once stop is closed.
+func (f *Fetcher) fetchAndUpdateData(ctx context.Context, stop <-chan struct{}) error {
+	start := time.Now()
+	slog.InfoContext(ctx, "fetching the statistics of every country")
+	f.runStarted()
+	failed, err := f.fetchCountries(ctx, stop)
+	f.runDone(failed, err)
+	if f.hooks.RunDone != nil {
+		f.hooks.RunDone(time.Since(start), err)
+	}
 	if err != nil {
-		log.Printf("Error fetching country list: %v", err)
-		return err
+		slog.ErrorContext(ctx, "could not fetch the statistics", "duration", time.Since(start), "error", err)
+	} else {
+		slog.InfoContext(ctx, "fetched the statistics", "duration", time.Since(start))
 	}
+	return err
+}
+
+// fetchCountries returns the number of countries it could not update.
+func (f *Fetcher) fetchCountries(ctx context.Context, stop <-chan struct{}) (int, error) {
+	countries, _, err := f.store.GetCountries(ctx, database.CountryFilter{})
+	if err != nil {
+		return 0, fmt.Errorf("error fetching country list: %w", err)
+	}
+
+	remaining := len(countries)
+	f.addBacklog(remaining)
+	defer func() { f.addBacklog(-remaining) }()
 
+	failed := 0
 	for _, country := range countries {
-		confirmedData, err := FetchDailyDataForCountry(country.Name, "confirmed")
-		if err != nil {
-			log.Printf("Error fetching confirmed data for country %s: %v", country.Name, err)
-			continue
+		select {
+		case <-stop:
+			return failed, nil
+		default:
 		}
-
-		deathsData, err := FetchDailyDataForCountry(country.Name, "deaths")
-		if err != nil {
-			log.Printf("Error fetching deaths data for country %s: %v", country.Name, err)
-			continue
+		if err := ctx.Err(); err != nil {
+			return failed, err
 		}
 
-		recoveredData, err := FetchDailyDataForCountry(country.Name, "recovered")
+		err := f.fetchCountry(ctx, country)
+		remaining--
+		f.addBacklog(-1)
+		if f.hooks.CountryDone != nil {
+			f.hooks.CountryDone(country.Name, err)
+		}
 		if err != nil {
-			log.Printf("Error fetching recovered data for country %s: %v", country.Name, err)
-			continue
+			failed++
+			slog.WarnContext(ctx, "could not update the statistics of a country", "country", country.Name, "error", err)
 		}
+	}
+	return failed, nil
+}
 
-		if err := UpdateCountryData(db, country.Name, country.ID, confirmedData, deathsData, recoveredData); err != nil {
-			log.Printf("Error updating country data for %s: %v", country.Name, err)
-			continue
-		}
+// fetchCountry fetches and stores the statistics of a country.
+func (f *Fetcher) fetchCountry(ctx context.Context, country database.Country) error {
+	confirmedData, err := f.FetchDailyDataForCountry(ctx, country.Name, "confirmed")
+	if err != nil {
+		return fmt.Errorf("error fetching confirmed data: %w", err)
 	}
-	return nil
+
+	deathsData, err := f.FetchDailyDataForCountry(ctx, country.Name, "deaths")
+	if err != nil {
+		return fmt.Errorf("error fetching deaths data: %w", err)
+	}
+
+	recoveredData, err := f.FetchDailyDataForCountry(ctx, country.Name, "recovered")
+	if err != nil {
+		return fmt.Errorf("error fetching recovered data: %w", err)
+	}
+
+	return UpdateCountryData(ctx, f.store, f.checker, country.Name, country.ID, confirmedData, deathsData, recoveredData)
 }
 
-func FetchDailyDataForCountry(countryName string, status string) ([]Covid19APIResponse, error) {
-	url := fmt.Sprintf("https://api.covid19api.com/dayone/country/%s/status/%s", countryName, status)
-	resp, err := http.Get(url)
+func (f *Fetcher) FetchDailyDataForCountry(ctx context.Context, countryName string, status string) ([]Covid19APIResponse, error) {
+	url := fmt.Sprintf("%s/dayone/country/%s/status/%s", f.upstreamURL, countryName, status)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	statusCode := 0
+	if err == nil {
+		statusCode = resp.StatusCode
+	}
+	if f.hooks.UpstreamResponse != nil {
+		f.hooks.UpstreamResponse(statusCode, err)
+	}
+	slog.DebugContext(ctx, "upstream request", "url", url, "status", statusCode, "duration", time.Since(start))
 	if err != nil {
 		return nil, err
 	}
@@ -80,7 +300,7 @@ func FetchDailyDataForCountry(countryName string, status string) ([]Covid19APIRe
 		return nil, err
 	}
 
-	err = handleRateLimitingError(resp, countryName, status)
+	err = f.handleRateLimitingError(ctx, resp, countryName, status)
 	if err != nil {
 		return nil, err
 	}
@@ -93,14 +313,21 @@ func FetchDailyDataForCountry(countryName string, status string) ([]Covid19APIRe
 	return data, nil
 }
 
-func handleRateLimitingError(resp *http.Response, countryName string, status string) error {
+func (f *Fetcher) handleRateLimitingError(ctx context.Context, resp *http.Response, countryName string, status string) error {
 	// Sleep for 2 seconds to avoid rate limiting by the API caused by too many requests.
-	time.Sleep(5 * time.Second)
+	if err := sleep(ctx, 5*time.Second); err != nil {
+		return err
+	}
 
 	if resp.StatusCode == http.StatusTooManyRequests {
-		log.Println("Too many requests, retrying in 5 seconds...")
-		time.Sleep(5 * time.Second)
-		FetchDailyDataForCountry(countryName, status)
+		slog.WarnContext(ctx, "too many requests, retrying in 5 seconds", "country", countryName, "series", status)
+		if err := sleep(ctx, 5*time.Second); err != nil {
+			return err
+		}
+		if f.hooks.Retry != nil {
+			f.hooks.Retry(countryName)
+		}
+		f.FetchDailyDataForCountry(ctx, countryName, status)
 		if counter > 5 {
 			counter = 0
 			return errors.New("too many retries, aborting")
@@ -110,21 +337,36 @@ func handleRateLimitingError(resp *http.Response, countryName string, status str
 	return nil
 }
 
-// FindCountryByName retrieves a country record from the database by name.
-func FindCountryByName(db *sql.DB, name string) (database.Country, error) {
-	var country database.Country
-	err := db.QueryRow("SELECT id, name, code FROM countries WHERE name = ?", name).Scan(&country.ID, &country.Name, &country.Code)
+// sleep waits for d, or returns the error of ctx if it is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// FindCountryByName retrieves a country record from the store by name, sql.ErrNoRows is returned when there is none.
+func FindCountryByName(ctx context.Context, store database.Store, name string) (database.Country, error) {
+	countries, _, err := store.GetCountries(ctx, database.CountryFilter{NameContains: &name})
 	if err != nil {
 		return database.Country{}, err
 	}
-	return country, nil
+	for _, country := range countries {
+		if country.Name == name {
+			return country, nil
+		}
+	}
+	return database.Country{}, sql.ErrNoRows
 }
 
 // UpdateCountryData updates covid statistics for a specific country in the database.
-func UpdateCountryData(db *sql.DB, countryName string, countryID int, confirmedData, deathsData, recoveredData []Covid19APIResponse) error {
-	d := database.NewDB(db)
-
-	country, err := d.GetCountryByID(countryID)
+func UpdateCountryData(ctx context.Context, store database.Store, checker *quality.Checker, countryName string, countryID int, confirmedData, deathsData, recoveredData []Covid19APIResponse) error {
+	country, err := store.GetCountryByID(ctx, countryID)
 	if err != nil {
 		return err
 	}
@@ -136,13 +378,18 @@ func UpdateCountryData(db *sql.DB, countryName string, countryID int, confirmedD
 		}
 		dateStr := date.Format("2006-01-02")
 
-		exists, err := d.CheckCovidStatisticExists(country.ID, dateStr)
+		exists, err := store.CheckCovidStatisticExists(ctx, country.ID, dateStr)
 		if err != nil {
 			return err
 		}
 
 		if !exists {
-			_, err := d.AddCovidStatistic(country.ID, dateStr, confirmedData[i].Cases, recoveredData[i].Cases, deathsData[i].Cases)
+			_, _, err := checker.AddCovidStatistic(ctx, store, country.ID, dateStr, confirmedData[i].Cases, recoveredData[i].Cases, deathsData[i].Cases)
+			var rejected *quality.RejectedError
+			if errors.As(err, &rejected) {
+				slog.WarnContext(ctx, "skipping covid statistic", "country", countryName, "date", dateStr, "error", err)
+				continue
+			}
 			if err != nil {
 				return err
 			}
@@ -0,0 +1,45 @@
+package fetcher
+
+import (
+	"context"
+	"covid/database"
+	"covid/quality"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRefreshWhileTheScheduledFetchRuns(t *testing.T) {
+	// the upstream API never answers, the scheduled fetch runs until the fetcher is stopped:
+	requested := make(chan struct{}, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case requested <- struct{}{}:
+		default:
+		}
+		<-r.Context().Done()
+	}))
+	defer upstream.Close()
+
+	store := database.NewMemoryStore()
+	if _, _, err := store.CreateCountry(context.Background(), "Belgium", "BE"); err != nil {
+		t.Fatal(err)
+	}
+	f := New(store, quality.NewChecker(false), upstream.URL)
+	f.StartFetchingRoutine(time.Hour)
+	<-requested
+
+	if err := f.Refresh(context.Background()); !errors.Is(err, ErrRefreshRunning) {
+		t.Errorf("Refresh: %v, want %v", err, ErrRefreshRunning)
+	}
+	if err := f.FetchAndUpdateData(context.Background()); !errors.Is(err, ErrRefreshRunning) {
+		t.Errorf("FetchAndUpdateData: %v, want %v", err, ErrRefreshRunning)
+	}
+
+	// aborts the country being fetched:
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	f.Stop(ctx)
+}
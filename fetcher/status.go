@@ -0,0 +1,76 @@
+package fetcher
+
+import (
+	"net/url"
+	"time"
+)
+
+// Status is the state of the fetches, for the status endpoints.
+type Status struct {
+	// Running is true while a fetch goes through the countries.
+	Running bool
+	// Backlog is the number of countries the running fetches have left to fetch.
+	Backlog int
+	Sources []SourceStatus
+}
+
+// SourceStatus is the state of the fetches from an upstream API. The times are zero until a fetch finished.
+type SourceStatus struct {
+	// Name is the host of the API.
+	Name string
+	URL  string
+	// LastFetchAt is when the last fetch finished, LastSuccessAt when the last one that went through every
+	// country did.
+	LastFetchAt   time.Time
+	LastSuccessAt time.Time
+	// LastError is the error of the last fetch, empty when it succeeded.
+	LastError string
+	// FailedCountries is the number of countries the last fetch could not update.
+	FailedCountries int
+}
+
+// Status returns the state of the fetches, the fetcher only has a single source.
+func (f *Fetcher) Status() Status {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := f.upstreamURL
+	if upstream, err := url.Parse(f.upstreamURL); err == nil && upstream.Host != "" {
+		name = upstream.Host
+	}
+	source := f.source
+	source.Name = name
+	source.URL = f.upstreamURL
+	return Status{Running: f.runs > 0, Backlog: f.backlog, Sources: []SourceStatus{source}}
+}
+
+// runStarted records a fetch going through the countries.
+func (f *Fetcher) runStarted() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.runs++
+}
+
+// runDone records the end of a fetch, with the number of countries it could not update.
+func (f *Fetcher) runDone(failedCountries int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.runs--
+	now := time.Now().UTC()
+	f.source.LastFetchAt = now
+	f.source.FailedCountries = failedCountries
+	f.source.LastError = ""
+	if err != nil {
+		f.source.LastError = err.Error()
+		return
+	}
+	f.source.LastSuccessAt = now
+}
+
+// addBacklog adds to the countries left to fetch, delta is negative once they are fetched.
+func (f *Fetcher) addBacklog(delta int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.backlog += delta
+}
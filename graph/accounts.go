@@ -0,0 +1,241 @@
+package graph
+
+import (
+	"context"
+	"covid/database"
+	"covid/mail"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidAccountToken is returned for the tokens that do not exist, were used already or expired.
+	ErrInvalidAccountToken = errors.New("the token is invalid or expired")
+	// ErrMailDisabled is returned by the flows sending emails when no SMTP server is configured.
+	ErrMailDisabled = errors.New("emails are not configured on this server")
+	// ErrUnknownEmail is returned by GrantAdmin when no user registered the email.
+	ErrUnknownEmail = errors.New("no user is registered with this email")
+)
+
+// sendTimeout bounds the sending of an email, which outlives the request asking for it.
+const sendTimeout = 30 * time.Second
+
+type AccountOptions struct {
+	// ResetTokenTTL and VerificationTokenTTL are how long the emailed tokens stay valid.
+	ResetTokenTTL        time.Duration
+	VerificationTokenTTL time.Duration
+	// AppURL is the address of the client the links of the emails lead to, as /reset-password?token= and
+	// /verify-email?token=. The emails only carry the tokens when it is empty.
+	AppURL string
+}
+
+// Accounts runs the password resets and the email verifications. Their tokens are random, only their SHA-256
+// hashes are stored, and they can be used once before they expire.
+type Accounts struct {
+	store database.UserStore
+	auth  *Auth
+	// sender is nil when no SMTP server is configured.
+	sender mail.Sender
+	opts   AccountOptions
+}
+
+func NewAccounts(store database.UserStore, auth *Auth, sender mail.Sender, opts AccountOptions) *Accounts {
+	return &Accounts{store: store, auth: auth, sender: sender, opts: opts}
+}
+
+// RequestPasswordReset emails a password reset token to the user of an email. Unknown emails are ignored, for
+// the callers not to learn which ones are registered.
+func (a *Accounts) RequestPasswordReset(ctx context.Context, email string) error {
+	if a.sender == nil {
+		return ErrMailDisabled
+	}
+	user, err := a.store.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := a.createToken(ctx, user.ID, database.TokenPasswordReset, a.opts.ResetTokenTTL)
+	if err != nil {
+		return err
+	}
+	a.send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nA password reset was requested for your account. %s\n\nThis expires in %s. "+
+			"If you did not ask for it, ignore this email: your password is unchanged.\n",
+			user.Username, a.instructions("/reset-password", "reset your password", token), formatTTL(a.opts.ResetTokenTTL)),
+	})
+	return nil
+}
+
+// ResetPassword sets the password of the user of a reset token, which is used up. Receiving the token proves
+// the user owns their email, which is verified as well.
+func (a *Accounts) ResetPassword(ctx context.Context, token string, password string) error {
+	if err := a.auth.ValidatePassword(password); err != nil {
+		return err
+	}
+	userID, err := a.consumeToken(ctx, database.TokenPasswordReset, token)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, salt, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := a.store.SetUserPassword(ctx, userID, hashedPassword, salt); err != nil {
+		return err
+	}
+	return a.store.SetUserEmailVerified(ctx, userID)
+}
+
+// SendVerification emails an email verification token to a user, after their registration.
+func (a *Accounts) SendVerification(ctx context.Context, user database.User) error {
+	if a.sender == nil {
+		return ErrMailDisabled
+	}
+	token, err := a.createToken(ctx, user.ID, database.TokenEmailVerification, a.opts.VerificationTokenTTL)
+	if err != nil {
+		return err
+	}
+	a.send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hello %s,\n\nConfirm this is your email address. %s\n\nThis expires in %s.\n",
+			user.Username, a.instructions("/verify-email", "verify your email address", token), formatTTL(a.opts.VerificationTokenTTL)),
+	})
+	return nil
+}
+
+// SendVerificationAfterRegistration sends a verification token to a user who just registered, when emails are
+// configured. The registration stands when it fails, the user can ask for another token.
+func (a *Accounts) SendVerificationAfterRegistration(ctx context.Context, user database.User) {
+	if a.sender == nil {
+		return
+	}
+	if err := a.SendVerification(ctx, user); err != nil {
+		slog.ErrorContext(ctx, "could not send verification email", "user_id", user.ID, "error", err)
+	}
+}
+
+// ResendVerification emails a new verification token to the user of an email, the previous one stops working.
+// Unknown and verified emails are ignored.
+func (a *Accounts) ResendVerification(ctx context.Context, email string) error {
+	if a.sender == nil {
+		return ErrMailDisabled
+	}
+	user, err := a.store.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return nil
+	}
+	return a.SendVerification(ctx, user)
+}
+
+// VerifyEmail marks the email of the user of a verification token as verified, the token is used up.
+func (a *Accounts) VerifyEmail(ctx context.Context, token string) error {
+	userID, err := a.consumeToken(ctx, database.TokenEmailVerification, token)
+	if err != nil {
+		return err
+	}
+	return a.store.SetUserEmailVerified(ctx, userID)
+}
+
+// GrantAdmin makes the user of an email an admin, the returned bool is false when they already were. The
+// admin role is in the tokens issued from then on, the user has to log in again.
+func GrantAdmin(ctx context.Context, store database.UserStore, email string) (database.User, bool, error) {
+	user, err := store.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, false, fmt.Errorf("%w: %s", ErrUnknownEmail, email)
+	}
+	if err != nil {
+		return database.User{}, false, err
+	}
+	if user.Role == database.RoleAdmin {
+		return user, false, nil
+	}
+
+	if err := store.SetUserRole(ctx, user.ID, database.RoleAdmin); err != nil {
+		return database.User{}, false, err
+	}
+	user.Role = database.RoleAdmin
+	return user, true, nil
+}
+
+// createToken stores the hash of a new token of a user and returns the token.
+func (a *Accounts) createToken(ctx context.Context, userID int, purpose string, ttl time.Duration) (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(random)
+	if err := a.store.CreateUserToken(ctx, userID, purpose, hashAccountToken(token), time.Now().Add(ttl)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (a *Accounts) consumeToken(ctx context.Context, purpose string, token string) (int, error) {
+	userID, err := a.store.ConsumeUserToken(ctx, purpose, hashAccountToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrInvalidAccountToken
+	}
+	return userID, err
+}
+
+// hashAccountToken hashes the tokens with SHA-256, unlike the passwords they are random and long enough not to
+// need a slow hash.
+func hashAccountToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// instructions tells how to use a token, with a link to the client when there is one.
+func (a *Accounts) instructions(path string, action string, token string) string {
+	if a.opts.AppURL == "" {
+		return fmt.Sprintf("Use this token to %s:\n\n%s", action, token)
+	}
+	link := strings.TrimSuffix(a.opts.AppURL, "/") + path + "?token=" + url.QueryEscape(token)
+	return fmt.Sprintf("Follow this link to %s:\n\n%s", action, link)
+}
+
+// formatTTL writes how long a token stays valid in hours, or in minutes for less than an hour.
+func formatTTL(ttl time.Duration) string {
+	if ttl < time.Hour {
+		return fmt.Sprintf("%d minutes", int(ttl.Minutes()))
+	}
+	if hours := int(ttl.Hours()); hours > 1 {
+		return fmt.Sprintf("%d hours", hours)
+	}
+	return "1 hour"
+}
+
+// send sends an email in the background, for the time it takes not to tell the registered emails apart and
+// for the SMTP server not to hold up the requests.
+func (a *Accounts) send(ctx context.Context, msg mail.Message) {
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+		defer cancel()
+		if err := a.sender.Send(ctx, msg); err != nil {
+			slog.ErrorContext(ctx, "could not send email", "subject", msg.Subject, "error", err)
+		}
+	}()
+}
@@ -1,30 +1,80 @@
 package graph
 
 import (
+	"context"
+	"covid/database"
+	"database/sql"
 	"errors"
+	"strconv"
 	"time"
 
+	"github.com/99designs/gqlgen/graphql/errcode"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/vektah/gqlparser/v2/gqlerror"
 )
 
-var jwtKey = []byte("1234")
-
 type Claims struct {
 	Username string `json:"username"`
+	Role     string `json:"role"`
+	// Unverified is set for the users who had not verified their email when they got the token, it is left
+	// out of the tokens issued before the verification existed.
+	Unverified bool `json:"unverified,omitempty"`
+	// TokenVersion is the version of the tokens of the user when the token was issued, the tokens of an older
+	// version were revoked by a password change. Left out when 0.
+	TokenVersion int `json:"tokenVersion,omitempty"`
+	// RegisteredClaims carry the ID of the user in Subject, a username can be registered again after its user
+	// was deleted.
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(username string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+type claimsContextKey struct{}
+
+const errForbidden = "FORBIDDEN"
+
+// ErrEmailNotVerified refuses the requests of the users who have not verified their email, when it is required.
+var ErrEmailNotVerified = errors.New("verify your email address first, then log in again")
+
+// ErrTokenRevoked refuses the tokens issued before the last password change of their user, or for a deleted user.
+var ErrTokenRevoked = errors.New("the token was revoked, log in again")
+
+// Auth issues and checks the tokens of users, and the strength of their passwords.
+type Auth struct {
+	jwtKey    []byte
+	tokenTTL  time.Duration
+	passwords PasswordPolicy
+	// requireVerifiedEmail refuses the tokens of the users who have not verified their email.
+	requireVerifiedEmail bool
+}
+
+// PasswordPolicy are the rules the passwords of new users must follow.
+type PasswordPolicy struct {
+	MinLength        int
+	RequireLowercase bool
+	RequireUppercase bool
+	RequireDigit     bool
+	RequireSpecial   bool
+}
+
+func NewAuth(jwtSecret string, tokenTTL time.Duration, passwords PasswordPolicy, requireVerifiedEmail bool) *Auth {
+	return &Auth{jwtKey: []byte(jwtSecret), tokenTTL: tokenTTL, passwords: passwords, requireVerifiedEmail: requireVerifiedEmail}
+}
+
+// GenerateToken issues a token for a user, with their current role, email verification and token version.
+func (a *Auth) GenerateToken(user database.User) (string, error) {
+	expirationTime := time.Now().Add(a.tokenTTL)
 	claims := &Claims{
-		Username: username,
+		Username:     user.Username,
+		Role:         user.Role,
+		Unverified:   !user.EmailVerified,
+		TokenVersion: user.TokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(user.ID),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	tokenString, err := token.SignedString(a.jwtKey)
 
 	if err != nil {
 		return "", err
@@ -33,21 +83,81 @@ func GenerateToken(username string) (string, error) {
 	return tokenString, nil
 }
 
-func ValidateToken(tokenStr string) (string, error) {
+func (a *Auth) ValidateToken(tokenStr string) (string, error) {
+	claims, err := a.ParseToken(tokenStr)
+	if err != nil {
+		return "", err
+	}
+	return claims.Username, nil
+}
+
+// ParseToken validates a token and returns all of its claims.
+func (a *Auth) ParseToken(tokenStr string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("unexpected signing method")
 		}
-		return jwtKey, nil
+		return a.jwtKey, nil
 	})
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims.Username, nil
+		return claims, nil
 	} else {
-		return "", errors.New("invalid token")
+		return nil, errors.New("invalid token")
+	}
+}
+
+// CheckVerified returns ErrEmailNotVerified for the claims of a user who has not verified their email, when it is
+// required.
+func (a *Auth) CheckVerified(claims *Claims) error {
+	if a.requireVerifiedEmail && claims.Unverified {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// CheckRevoked returns ErrTokenRevoked for the claims of a token issued before the last password change of
+// its user, for a user who was deleted, even if their username was registered again, and for the tokens without
+// the ID of their user, issued before it was added.
+func (a *Auth) CheckRevoked(ctx context.Context, store database.UserStore, claims *Claims) error {
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return ErrTokenRevoked
+	}
+	user, err := store.GetUserByID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrTokenRevoked
+	}
+	if err != nil {
+		return err
+	}
+	if user.Username != claims.Username || claims.TokenVersion < user.TokenVersion {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// WithClaims stores the claims of an authenticated request in its context.
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims stored by WithClaims, if the request was authenticated.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+	return claims, ok
+}
+
+// requireAdmin returns a FORBIDDEN error unless the request was authenticated by an admin.
+func requireAdmin(ctx context.Context) error {
+	if claims, ok := ClaimsFromContext(ctx); ok && claims.Role == database.RoleAdmin {
+		return nil
 	}
+	err := gqlerror.Errorf("only admins can do this")
+	errcode.Set(err, errForbidden)
+	return err
 }
@@ -0,0 +1,84 @@
+package graph
+
+import (
+	"context"
+	"covid/database"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckRevoked(t *testing.T) {
+	ctx := context.Background()
+	store := database.NewMemoryStore()
+	auth := NewAuth("secret", time.Hour, PasswordPolicy{}, false)
+	register := func() database.User {
+		t.Helper()
+		userID, err := store.RegisterUser(ctx, "alice", "alice@example.com", []byte("hash"), []byte("salt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		user, err := store.GetUserByID(ctx, int(userID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user
+	}
+	claims := func(user database.User) *Claims {
+		t.Helper()
+		token, err := auth.GenerateToken(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := auth.ParseToken(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return claims
+	}
+
+	user := register()
+	before := claims(user)
+	if err := auth.CheckRevoked(ctx, store, before); err != nil {
+		t.Fatalf("before the password change: %v", err)
+	}
+	if err := store.SetUserPassword(ctx, user.ID, []byte("new hash"), []byte("new salt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.CheckRevoked(ctx, store, before); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("token issued before the password change: %v, want %v", err, ErrTokenRevoked)
+	}
+	user, err := store.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := claims(user)
+	if err := auth.CheckRevoked(ctx, store, after); err != nil {
+		t.Errorf("token issued after the password change: %v", err)
+	}
+
+	if err := store.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.CheckRevoked(ctx, store, after); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("token of a deleted user: %v, want %v", err, ErrTokenRevoked)
+	}
+
+	// the new user of the username starts from the first token version again, as an admin:
+	again := register()
+	if err := store.SetUserRole(ctx, again.ID, database.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.CheckRevoked(ctx, store, before); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("token of a deleted user whose username was registered again: %v, want %v", err, ErrTokenRevoked)
+	}
+	if err := auth.CheckRevoked(ctx, store, claims(again)); err != nil {
+		t.Errorf("token of the user registered again: %v", err)
+	}
+
+	legacy := claims(again)
+	legacy.Subject = ""
+	if err := auth.CheckRevoked(ctx, store, legacy); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("token without a user ID: %v, want %v", err, ErrTokenRevoked)
+	}
+}
@@ -0,0 +1,240 @@
+package graph
+
+import (
+	"context"
+	"covid/graph/model"
+	"math"
+	"strings"
+
+	"github.com/99designs/gqlgen/complexity"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const (
+	DefaultMaxQueryDepth      = 10
+	DefaultMaxQueryComplexity = 1000
+
+	// unpaginated lists load every row, so they are costed as if this many items were asked for.
+	unboundedListSize = 100
+	// monitored countries are not paginated but a user only follows a few of them.
+	monitoredCountriesSize = 10
+	// country groups are not paginated, there are the continents and a few custom groups.
+	countryGroupsSize = 20
+
+	costExtension       = "cost"
+	errQueryTooDeep     = "QUERY_TOO_DEEP"
+	errQueryTooComplex  = "COMPLEXITY_LIMIT_EXCEEDED"
+	introspectionPrefix = "__"
+)
+
+// NewComplexityRoot returns the cost functions of the paginated and list fields.
+// A list costs the number of items it can return times the cost of one item.
+func NewComplexityRoot() ComplexityRoot {
+	var c ComplexityRoot
+
+	c.Country.CovidStats = func(childComplexity int, after *string, first *int) int {
+		return listCost(childComplexity, first, unboundedListSize)
+	}
+	// a chart reads the whole history of every country it shows:
+	c.Country.ChartSVG = func(childComplexity int, metric *model.Metric, from *string, to *string, smoothing *int, options *model.ChartOptions) int {
+		countries := 1
+		if options != nil {
+			countries += len(options.CompareCountryIDs)
+		}
+		return saturatingMul(countries, unboundedListSize)
+	}
+	// the statistics, latest totals and rankings of a group read the whole history of its members:
+	c.CountryGroup.Members = func(childComplexity int) int {
+		return listCost(childComplexity, nil, unboundedListSize)
+	}
+	c.CountryGroup.Statistics = func(childComplexity int, from *string, to *string) int {
+		return listCost(childComplexity, nil, unboundedListSize)
+	}
+	c.CountryGroup.Latest = func(childComplexity int) int {
+		return saturatingAdd(unboundedListSize, childComplexity)
+	}
+	c.CountryGroup.MemberRankings = func(childComplexity int, metric *model.RankingMetric) int {
+		return listCost(childComplexity, nil, unboundedListSize)
+	}
+	c.Query.CountryGroups = func(childComplexity int) int {
+		return listCost(childComplexity, nil, countryGroupsSize)
+	}
+	c.Query.Countries = func(childComplexity int, first *int, after *string, filter *model.CountryFilterInput, orderBy *model.CountryOrder) int {
+		return listCost(childComplexity, first, unboundedListSize)
+	}
+	c.Query.CovidStatistics = func(childComplexity int, countryID string, after *string, first *int, filter *model.CovidStatisticFilterInput, orderBy *model.CovidStatisticOrder) int {
+		return listCost(childComplexity, first, unboundedListSize)
+	}
+	// a forecast reads the whole history of the country:
+	c.Query.Forecast = func(childComplexity int, countryID string, metric *model.Metric, horizonDays *int, forecastModel *model.ForecastModel) int {
+		return saturatingAdd(unboundedListSize, childComplexity)
+	}
+	c.Query.ReproductionNumber = func(childComplexity int, countryID string, from *string, to *string, serialIntervalMean *float64, serialIntervalSd *float64) int {
+		return saturatingAdd(unboundedListSize, childComplexity)
+	}
+	c.Query.Rankings = func(childComplexity int, metric *model.RankingMetric, date *string, limit *int, offset *int, groupID *string, changeDays *int) int {
+		return listCost(childComplexity, limit, unboundedListSize)
+	}
+	c.Query.MonitoredCountries = func(childComplexity int, userID string) int {
+		return saturatingMul(monitoredCountriesSize, childComplexity)
+	}
+	c.Query.TopCountriesByCaseTypeForUser = func(childComplexity int, caseType model.CaseType, limit int, userID string) int {
+		return listCost(childComplexity, &limit, unboundedListSize)
+	}
+
+	return c
+}
+
+// listCost saturates rather than overflows, a first of 2^62 must not wrap around to a cheap or negative cost
+// that gqlgen would replace with the cost of a single item.
+func listCost(childComplexity int, first *int, unbounded int) int {
+	size := unbounded
+	if first != nil && *first >= 0 {
+		size = *first
+	}
+	return saturatingAdd(1, saturatingMul(size, childComplexity))
+}
+
+// saturatingAdd and saturatingMul return math.MaxInt instead of overflowing, the costs are never negative.
+func saturatingAdd(a int, b int) int {
+	if a > math.MaxInt-b {
+		return math.MaxInt
+	}
+	return a + b
+}
+
+func saturatingMul(a int, b int) int {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	if a > math.MaxInt/b {
+		return math.MaxInt
+	}
+	return a * b
+}
+
+type QueryCost struct {
+	Complexity    int `json:"complexity"`
+	MaxComplexity int `json:"maxComplexity"`
+	Depth         int `json:"depth"`
+	MaxDepth      int `json:"maxDepth"`
+}
+
+// QueryLimits rejects operations that are nested too deeply or cost too much,
+// and reports the cost of every operation in the response extensions.
+type QueryLimits struct {
+	MaxDepth      int
+	MaxComplexity int
+
+	es graphql.ExecutableSchema
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationContextMutator
+	graphql.ResponseInterceptor
+} = &QueryLimits{}
+
+func NewQueryLimits(maxDepth int, maxComplexity int) *QueryLimits {
+	return &QueryLimits{MaxDepth: maxDepth, MaxComplexity: maxComplexity}
+}
+
+func (q QueryLimits) ExtensionName() string {
+	return "QueryLimits"
+}
+
+func (q *QueryLimits) Validate(schema graphql.ExecutableSchema) error {
+	q.es = schema
+	return nil
+}
+
+func (q QueryLimits) MutateOperationContext(ctx context.Context, rc *graphql.OperationContext) *gqlerror.Error {
+	op := rc.Doc.Operations.ForName(rc.OperationName)
+	if op == nil {
+		return nil
+	}
+
+	cost := &QueryCost{
+		Complexity:    complexity.Calculate(q.es, op, rc.Variables),
+		MaxComplexity: q.MaxComplexity,
+		Depth:         selectionSetDepth(op.SelectionSet, rc.Doc.Fragments, map[string]bool{}),
+		MaxDepth:      q.MaxDepth,
+	}
+	rc.Stats.SetExtension(costExtension, cost)
+
+	if q.MaxDepth > 0 && cost.Depth > q.MaxDepth {
+		err := gqlerror.Errorf("operation has depth %d, which exceeds the limit of %d", cost.Depth, q.MaxDepth)
+		errcode.Set(err, errQueryTooDeep)
+		err.Extensions[costExtension] = cost
+		return err
+	}
+
+	if q.MaxComplexity > 0 && cost.Complexity > q.MaxComplexity {
+		err := gqlerror.Errorf("operation has complexity %d, which exceeds the limit of %d, ask for fewer items with first or limit", cost.Complexity, q.MaxComplexity)
+		errcode.Set(err, errQueryTooComplex)
+		err.Extensions[costExtension] = cost
+		return err
+	}
+
+	return nil
+}
+
+func (q QueryLimits) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	resp := next(ctx)
+	cost := GetQueryCost(ctx)
+	if resp == nil || cost == nil {
+		return resp
+	}
+
+	if resp.Extensions == nil {
+		resp.Extensions = map[string]interface{}{}
+	}
+	resp.Extensions[costExtension] = cost
+	return resp
+}
+
+// GetQueryCost returns the cost computed for the operation running in ctx.
+func GetQueryCost(ctx context.Context) *QueryCost {
+	if !graphql.HasOperationContext(ctx) {
+		return nil
+	}
+	cost, _ := graphql.GetOperationContext(ctx).Stats.GetExtension(costExtension).(*QueryCost)
+	return cost
+}
+
+// selectionSetDepth returns how deeply fields are nested, following fragments.
+// Introspection fields are not counted, the playground's introspection query is deeply nested by design.
+func selectionSetDepth(selectionSet ast.SelectionSet, fragments ast.FragmentDefinitionList, visiting map[string]bool) int {
+	depth := 0
+	for _, selection := range selectionSet {
+		var d int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(selection.Name, introspectionPrefix) {
+				continue
+			}
+			d = 1 + selectionSetDepth(selection.SelectionSet, fragments, visiting)
+		case *ast.InlineFragment:
+			d = selectionSetDepth(selection.SelectionSet, fragments, visiting)
+		case *ast.FragmentSpread:
+			// fragment cycles are rejected by validation, this only guards against looping forever:
+			if visiting[selection.Name] {
+				continue
+			}
+			fragment := fragments.ForName(selection.Name)
+			if fragment == nil {
+				continue
+			}
+			visiting[selection.Name] = true
+			d = selectionSetDepth(fragment.SelectionSet, fragments, visiting)
+			delete(visiting, selection.Name)
+		}
+		if d > depth {
+			depth = d
+		}
+	}
+	return depth
+}
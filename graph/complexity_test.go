@@ -0,0 +1,131 @@
+package graph
+
+import (
+	"covid/database"
+	"encoding/json"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/complexity"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/vektah/gqlparser/v2"
+)
+
+func TestListCost(t *testing.T) {
+	size := func(n int) *int { return &n }
+	tests := []struct {
+		name            string
+		childComplexity int
+		first           *int
+		want            int
+	}{
+		{"unbounded", 3, nil, 301},
+		{"first", 3, size(10), 31},
+		{"negative first", 3, size(-1), 301},
+		{"no child", 0, size(math.MaxInt), 1},
+		{"overflowing first", 2, size(math.MaxInt/2 + 1), math.MaxInt},
+		{"overflowing child", math.MaxInt, size(2), math.MaxInt},
+		{"largest", math.MaxInt, size(math.MaxInt), math.MaxInt},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := listCost(test.childComplexity, test.first, unboundedListSize); got != test.want {
+				t.Errorf("got %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+// A first of 2^62+1 items of cost 4 costed 2^64+4, which overflowed to 4: the operation passed as one of 5.
+func TestOverflowingFirstExceedsTheLimit(t *testing.T) {
+	es := NewExecutableSchema(Config{Complexity: NewComplexityRoot()})
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+	}{
+		{"literal", `{ countries(first: 4611686018427387905) { edges { cursor node { id } } } }`, nil},
+		{"variable", `query($n: Int) { countries(first: $n) { edges { cursor node { id } } } }`, map[string]interface{}{"n": 4611686018427387905}},
+		{"nested", `query($n: Int) { countries(first: $n) { edges { node {
+			covidStats(first: $n) { edges { node { country { covidStats(first: $n) { edges { node { id } } } } } } }
+		} } } }`, map[string]interface{}{"n": 2147483647}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc, err := gqlparser.LoadQuery(es.Schema(), test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cost := complexity.Calculate(es, doc.Operations[0], test.variables); cost != math.MaxInt {
+				t.Errorf("cost %d, want it to saturate at %d", cost, math.MaxInt)
+			}
+		})
+	}
+}
+
+// queryResponse is the part of a GraphQL response the limits are seen in.
+type queryResponse struct {
+	Data   map[string]any `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+	Extensions struct {
+		Cost *QueryCost `json:"cost"`
+	} `json:"extensions"`
+}
+
+// postQuery runs query on a server limited to maxDepth and DefaultMaxQueryComplexity, with an empty store.
+func postQuery(t *testing.T, maxDepth int, query string) queryResponse {
+	t.Helper()
+	resolver := NewResolver(database.NewMemoryStore(), nil, nil, nil, nil, nil, nil, 0)
+	srv := handler.New(NewExecutableSchema(Config{Resolvers: resolver, Complexity: NewComplexityRoot()}))
+	srv.AddTransport(transport.POST{})
+	srv.Use(NewQueryLimits(maxDepth, DefaultMaxQueryComplexity))
+
+	body, err := json.Marshal(map[string]string{"query": query})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/graphql", strings.NewReader(string(body)))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+
+	var response queryResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+	return response
+}
+
+func TestQueryTooDeepRejected(t *testing.T) {
+	// countries, edges, node, covidStats, edges, node, country, name: a depth of 8.
+	query := `{ countries(first: 1) { edges { node { covidStats(first: 1) { edges { node { country { name } } } } } } } }`
+
+	response := postQuery(t, 7, query)
+	if len(response.Errors) != 1 || response.Errors[0].Extensions["code"] != errQueryTooDeep {
+		t.Fatalf("errors %+v, want a single %s error", response.Errors, errQueryTooDeep)
+	}
+	if response.Data != nil {
+		t.Errorf("data %v, want the operation not to run", response.Data)
+	}
+
+	if response := postQuery(t, 8, query); len(response.Errors) != 0 {
+		t.Errorf("at the limit: errors %+v", response.Errors)
+	}
+}
+
+func TestCostReported(t *testing.T) {
+	response := postQuery(t, DefaultMaxQueryDepth, `{ countries(first: 5) { edges { cursor } } }`)
+	if len(response.Errors) != 0 {
+		t.Fatalf("errors %+v", response.Errors)
+	}
+	want := QueryCost{Complexity: 11, MaxComplexity: DefaultMaxQueryComplexity, Depth: 3, MaxDepth: DefaultMaxQueryDepth}
+	if response.Extensions.Cost == nil || *response.Extensions.Cost != want {
+		t.Errorf("cost %+v, want %+v", response.Extensions.Cost, want)
+	}
+}
@@ -0,0 +1,29 @@
+package graph
+
+import (
+	"context"
+	"covid/analytics"
+	"covid/database"
+	"covid/graph/model"
+	"fmt"
+	"strconv"
+)
+
+func forecast(ctx context.Context, d database.Store, countryID string, metric *model.Metric, horizonDays *int, forecastModel *model.ForecastModel) (*model.Forecast, error) {
+	countryIDInt, err := strconv.Atoi(countryID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid country ID: %w", err)
+	}
+
+	horizon := 14
+	if horizonDays != nil {
+		horizon = *horizonDays
+	}
+
+	forecastMetric := model.MapGQLMetricToSeries(metric)
+	result, err := analytics.ForecastCountry(ctx, d, countryIDInt, forecastMetric, horizon, model.MapGQLForecastModelToAnalytics(forecastModel))
+	if err != nil {
+		return nil, err
+	}
+	return model.MapAnalyticsForecastToGQLModel(&result), nil
+}
@@ -0,0 +1,30 @@
+package graph
+
+import (
+	"context"
+	"covid/database"
+	"fmt"
+	"strconv"
+)
+
+// countryGroup reads a group with its members. The fields of CountryGroup are resolved from it, as the
+// countryGroups query returns groups without their members.
+func countryGroup(ctx context.Context, d database.CountryGroupStore, id string) (database.CountryGroup, error) {
+	groupID, err := strconv.Atoi(id)
+	if err != nil {
+		return database.CountryGroup{}, fmt.Errorf("invalid group ID: %w", err)
+	}
+	return d.GetCountryGroupByID(ctx, groupID)
+}
+
+func parseCountryIDs(ids []string) ([]int, error) {
+	countryIDs := make([]int, len(ids))
+	for i, id := range ids {
+		countryID, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid country ID: %w", err)
+		}
+		countryIDs[i] = countryID
+	}
+	return countryIDs, nil
+}
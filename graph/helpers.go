@@ -1,26 +1,41 @@
 package graph
 
 import (
+	"context"
+	"covid/analytics"
 	"covid/database"
+	"covid/fetcher"
 	"covid/graph/model"
+	"covid/quality"
+	"covid/status"
 	"crypto/rand"
-	"database/sql"
 	"errors"
-	"log"
+	"fmt"
+	"log/slog"
 	"regexp"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
-var pageSize int = 2
-
 type Resolver struct {
-	db *sql.DB
+	store   database.Store
+	auth    *Auth
+	fetcher *fetcher.Fetcher
+	// accounts runs the password resets and the email verifications.
+	accounts *Accounts
+	// status counts the subscriptions and reports the state of the server.
+	status *status.Reporter
+	// checker runs the data quality checks on the statistics written, rt estimates the reproduction numbers.
+	checker *quality.Checker
+	rt      *analytics.RtEstimator
+	// pageSize is the number of statistics returned with a country, 0 returns them all.
+	pageSize int
 }
 
-func NewResolver(db *sql.DB) *Resolver {
-	return &Resolver{db: db}
+func NewResolver(store database.Store, auth *Auth, accounts *Accounts, f *fetcher.Fetcher, reporter *status.Reporter, checker *quality.Checker, rt *analytics.RtEstimator, pageSize int) *Resolver {
+	return &Resolver{store: store, auth: auth, accounts: accounts, fetcher: f, status: reporter, checker: checker, rt: rt, pageSize: pageSize}
 }
 
 type PageInfo struct {
@@ -38,7 +53,7 @@ type CountryConnection struct {
 	Edges    []*CountryEdge `json:"edges"`
 }
 
-func ValidateUserRegistration(username string, email string, password string, r *mutationResolver) error {
+func ValidateUserRegistration(ctx context.Context, username string, email string, password string, r *mutationResolver) error {
 	if err := ValidateUsername(username); err != nil {
 		return err
 	}
@@ -47,16 +62,15 @@ func ValidateUserRegistration(username string, email string, password string, r
 		return err
 	}
 
-	if err := ValidatePassword(password); err != nil {
+	if err := r.auth.ValidatePassword(password); err != nil {
 		return err
 	}
-	d := database.NewDB(r.db)
 
-	if err := d.CheckIfUserExists(username); err != nil {
+	if err := r.store.CheckIfUserExists(ctx, username); err != nil {
 		return err
 	}
 
-	if err := d.CheckIfEmailExists(email); err != nil {
+	if err := r.store.CheckIfEmailExists(ctx, email); err != nil {
 		return err
 	}
 
@@ -88,8 +102,8 @@ func ValidateEmail(email string) error {
 	return nil
 }
 
-func ValidatePassword(password string) error {
-	const minPasswordLength = 8
+func (a *Auth) ValidatePassword(password string) error {
+	policy := a.passwords
 
 	// As Go doesn't have lookbehind or lookahead, we need to break the validation
 	// into separate checks:
@@ -98,17 +112,46 @@ func ValidatePassword(password string) error {
 	var digitRegex = regexp.MustCompile(`\d`)
 	var specialRegex = regexp.MustCompile(`[@$!%*#?&]`)
 
-	if len(password) < minPasswordLength {
-		return errors.New("password must be at least 8 characters long")
+	if len(password) < policy.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", policy.MinLength)
+	}
+
+	var required []string
+	strong := true
+	for _, rule := range []struct {
+		enabled bool
+		regex   *regexp.Regexp
+		name    string
+	}{
+		{policy.RequireUppercase, upperRegex, "1 uppercase"},
+		{policy.RequireLowercase, lowerRegex, "1 lowercase"},
+		{policy.RequireDigit, digitRegex, "1 number"},
+		{policy.RequireSpecial, specialRegex, "1 special character"},
+	} {
+		if !rule.enabled {
+			continue
+		}
+		required = append(required, rule.name)
+		if !rule.regex.MatchString(password) {
+			strong = false
+		}
 	}
 
-	if !lowerRegex.MatchString(password) || !upperRegex.MatchString(password) || !digitRegex.MatchString(password) || !specialRegex.MatchString(password) {
-		return errors.New("password must be strong and contain at least 1 uppercase, 1 lowercase, 1 number, and 1 special character")
+	if !strong {
+		return fmt.Errorf("password must be strong and contain at least %s", joinWithAnd(required))
 	}
 
 	return nil
 }
 
+// joinWithAnd joins "a", "b" and "c" as "a, b, and c".
+func joinWithAnd(items []string) string {
+	if len(items) <= 2 {
+		return strings.Join(items, " and ")
+	}
+	return strings.Join(items[:len(items)-1], ", ") + ", and " + items[len(items)-1]
+}
+
 func HashPassword(password string) ([]byte, []byte, error) {
 	salt := make([]byte, 16)
 	// fill the salt byte slice with random bytes
@@ -125,24 +168,38 @@ func HashPassword(password string) ([]byte, []byte, error) {
 	return hashedPassword, salt, nil
 }
 
-func updateCovidStatsRoutine(d *database.DB, countryIDsInt []int, updatedCovidStats chan []*model.CovidStatistic) {
+// updateCovidStatsRoutine sends the latest statistics of the countries until the subscription ends with ctx.
+func updateCovidStatsRoutine(ctx context.Context, d database.Store, countryIDsInt []int, updatedCovidStats chan []*model.CovidStatistic) {
+	defer close(updatedCovidStats)
 	ticker := time.NewTicker(24 * time.Second) // Check for updates daily
-	for range ticker.C {
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
 		var newCovidStats []*database.CovidStatistic
 		for _, id := range countryIDsInt {
-			covidStat, err := d.GetLatestCovidStatisticsByCountryID(id)
+			covidStat, err := d.GetLatestCovidStatisticsByCountryID(ctx, id)
 			if err != nil {
-				log.Printf("Error fetching latest Covid statistic for country %d: %v", id, err)
+				slog.WarnContext(ctx, "error fetching latest covid statistic", "country_id", id, "error", err)
 				continue
 			}
-			country, err := d.GetCountryByID(covidStat.CountryID)
+			country, err := d.GetCountryByID(ctx, covidStat.CountryID)
 			if err != nil {
-				log.Printf("Error fetching country %d: %v", covidStat.CountryID, err)
+				slog.WarnContext(ctx, "error fetching country", "country_id", covidStat.CountryID, "error", err)
 				continue
 			}
 			covidStat.Country = country
 			newCovidStats = append(newCovidStats, &covidStat)
 		}
-		updatedCovidStats <- model.MapDatabaseCovidStatisticsToGQLModels(newCovidStats)
+
+		select {
+		case <-ctx.Done():
+			return
+		case updatedCovidStats <- model.MapDatabaseCovidStatisticsToGQLModels(newCovidStats):
+		}
 	}
 }
@@ -1,45 +1,41 @@
 package model
 
 import (
+	"covid/analytics"
+	"covid/chart"
 	"covid/database"
-	"encoding/base64"
+	"covid/groups"
+	"covid/quality"
+	"covid/rankings"
+	"covid/series"
+	"covid/status"
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 )
 
-func CreateMapDatabaseCovidStatsToConnection(covidStats []database.CovidStatistic, pageSize int) *CovidStatisticConnection {
+// CreateMapDatabaseCovidStatsToConnection maps a page of statistics, nextCursor is set when there is a next page.
+func CreateMapDatabaseCovidStatsToConnection(covidStats []database.CovidStatistic, nextCursor *string) *CovidStatisticConnection {
 	var edges []*CovidStatisticEdge
-	// truncate first before anything to ensure the correct number of records are returned
-	if pageSize > 0 && len(covidStats) > pageSize {
-		covidStats = covidStats[:pageSize] // Truncate the extra records
-	}
-
-	gqlModelsCovidStats := MapDatabaseCovidStatsToGQLModel(covidStats)
 
-	for _, covidStat := range gqlModelsCovidStats {
+	for i, covidStat := range MapDatabaseCovidStatsToGQLModel(covidStats) {
 		edge := &CovidStatisticEdge{
-			Cursor: base64.StdEncoding.EncodeToString([]byte(covidStat.ID)),
+			Cursor: database.EncodeCursor(covidStats[i].ID),
 			Node:   covidStat,
 		}
 		edges = append(edges, edge)
 	}
 
 	var endCursor *string
-	hasNextPage := false
-	if len(covidStats) == pageSize {
-		//because we have truncated one record, we can be sure that there are more records
-		hasNextPage = true
-	}
-
-	if len(covidStats) > 0 {
-		endCursorValue := base64.StdEncoding.EncodeToString([]byte(strconv.Itoa(covidStats[len(covidStats)-1].ID)))
-		endCursor = &endCursorValue
+	if len(edges) > 0 {
+		endCursor = &edges[len(edges)-1].Cursor
 	}
 
 	return &CovidStatisticConnection{
 		PageInfo: &PageInfo{
 			EndCursor:   endCursor,
-			HasNextPage: hasNextPage,
+			HasNextPage: nextCursor != nil,
 		},
 		Edges: edges,
 	}
@@ -65,21 +61,20 @@ func MapDatabaseCovidStatisticToGQLModel(covidStatistic *database.CovidStatistic
 }
 
 func MapDatabaseCountryToGQLModel(country *database.Country, pageSize *int) *Country {
+	covidStats := country.CovidStatistics
+	var nextCursor *string
 	// If pageSize is nil or 0, do not paginate
-	if pageSize == nil || *pageSize == 0 {
-		return &Country{
-			ID:         fmt.Sprint(country.ID),
-			Name:       country.Name,
-			Code:       country.Code,
-			CovidStats: CreateMapDatabaseCovidStatsToConnection(country.CovidStatistics, 0),
-		}
+	if pageSize != nil && *pageSize > 0 && len(covidStats) > *pageSize {
+		covidStats = covidStats[:*pageSize]
+		cursor := database.EncodeCursor(covidStats[len(covidStats)-1].ID)
+		nextCursor = &cursor
 	}
 
 	return &Country{
 		ID:         fmt.Sprint(country.ID),
 		Name:       country.Name,
 		Code:       country.Code,
-		CovidStats: CreateMapDatabaseCovidStatsToConnection(country.CovidStatistics, *pageSize),
+		CovidStats: CreateMapDatabaseCovidStatsToConnection(covidStats, nextCursor),
 	}
 }
 
@@ -96,6 +91,7 @@ func MapDatabaseUserToGQLModel(user *database.User) *User {
 		ID:                 fmt.Sprint(user.ID),
 		Email:              user.Email,
 		Username:           user.Username,
+		EmailVerified:      user.EmailVerified,
 		MonitoredCountries: MapDatabaseCountriesToGQLModels(user.MonitoredCountries),
 	}
 }
@@ -108,38 +104,321 @@ func MapDatabaseCountriesToGQLModels(countries []database.Country) []*Country {
 	return gqlModels
 }
 
-func CreateMapDatabaseCountriesToConnection(countries []database.Country, pageSize *int) *CountriesConnection {
+// CreateMapDatabaseCountriesToConnection maps a page of countries, nextCursor is set when there is a next page.
+func CreateMapDatabaseCountriesToConnection(countries []database.Country, nextCursor *string) *CountriesConnection {
 	var edges []*CountryEdge
-	if *pageSize > 0 && len(countries) > *pageSize {
-		countries = countries[:*pageSize]
-	}
 
-	gqlModelsCountries := MapDatabaseCountriesToGQLModels(countries)
-
-	for _, country := range gqlModelsCountries {
+	for i, country := range MapDatabaseCountriesToGQLModels(countries) {
 		edge := &CountryEdge{
-			Cursor: base64.StdEncoding.EncodeToString([]byte(country.ID)),
+			Cursor: database.EncodeCursor(countries[i].ID),
 			Node:   country,
 		}
 		edges = append(edges, edge)
 	}
 
 	var endCursor *string
-	hasNextPage := false
-	if len(countries) == *pageSize {
-		hasNextPage = true
-	}
-
-	if len(countries) > 0 {
-		endCursorValue := base64.StdEncoding.EncodeToString([]byte(strconv.Itoa(countries[len(countries)-1].ID)))
-		endCursor = &endCursorValue
+	if len(edges) > 0 {
+		endCursor = &edges[len(edges)-1].Cursor
 	}
 
 	return &CountriesConnection{
 		PageInfo: &PageInfo{
 			EndCursor:   endCursor,
-			HasNextPage: hasNextPage,
+			HasNextPage: nextCursor != nil,
 		},
 		Edges: edges,
 	}
 }
+
+// MapGQLCountryFilterToDatabase builds the filter shared with the REST API from the arguments of countries.
+func MapGQLCountryFilterToDatabase(first *int, after *string, filter *CountryFilterInput, orderBy *CountryOrder) database.CountryFilter {
+	countryFilter := database.CountryFilter{First: first, After: after}
+	if filter != nil {
+		countryFilter.CodeEquals = filter.CodeEquals
+		countryFilter.NameContains = filter.NameContains
+	}
+	if orderBy != nil {
+		countryFilter.SortBy = strings.ToLower(orderBy.Field.String())
+		if orderBy.Order != nil {
+			countryFilter.SortOrder = strings.ToLower(orderBy.Order.String())
+		}
+	}
+	return countryFilter
+}
+
+// MapGQLCovidStatisticFilterToDatabase builds the filter shared with the REST API from the arguments of covidStatistics.
+func MapGQLCovidStatisticFilterToDatabase(countryID int, first *int, after *string, filter *CovidStatisticFilterInput, orderBy *CovidStatisticOrder) database.CovidStatisticFilter {
+	covidStatisticFilter := database.CovidStatisticFilter{CountryID: countryID, First: first, After: after}
+	if filter != nil {
+		covidStatisticFilter.DateFrom = filter.DateFrom
+		covidStatisticFilter.DateTo = filter.DateTo
+	}
+	if orderBy != nil {
+		covidStatisticFilter.SortBy = strings.ToLower(orderBy.Field.String())
+		if orderBy.Order != nil {
+			covidStatisticFilter.SortOrder = strings.ToLower(orderBy.Order.String())
+		}
+	}
+	return covidStatisticFilter
+}
+
+func MapDatabaseDataQualityIssueToGQLModel(issue *database.DataQualityIssue) *DataQualityIssue {
+	return &DataQualityIssue{
+		ID:               fmt.Sprint(issue.ID),
+		CovidStatisticID: fmt.Sprint(issue.CovidStatisticID),
+		Date:             issue.Date,
+		Code:             DataQualityCode(issue.Code),
+		Severity:         DataQualitySeverity(issue.Severity),
+		Message:          issue.Message,
+		CreatedAt:        issue.CreatedAt,
+	}
+}
+
+func MapDatabaseDataQualityIssuesToGQLModels(issues []database.DataQualityIssue) []*DataQualityIssue {
+	// qualityFlags is non-nullable, return an empty list rather than null:
+	gqlModels := []*DataQualityIssue{}
+	for i := range issues {
+		gqlModels = append(gqlModels, MapDatabaseDataQualityIssueToGQLModel(&issues[i]))
+	}
+	return gqlModels
+}
+
+func MapQualityReportToGQLModel(report *quality.Report) *DataQualityReport {
+	countsByCode := []*DataQualityCodeCount{}
+	for _, codeCount := range report.CountsByCode {
+		countsByCode = append(countsByCode, &DataQualityCodeCount{
+			Code:  DataQualityCode(codeCount.Code),
+			Count: codeCount.Count,
+		})
+	}
+
+	return &DataQualityReport{
+		Country:      MapDatabaseCountryToGQLModel(&report.Country, nil),
+		TotalIssues:  report.TotalIssues,
+		Errors:       report.Errors,
+		Warnings:     report.Warnings,
+		CountsByCode: countsByCode,
+		Issues:       MapDatabaseDataQualityIssuesToGQLModels(report.Issues),
+	}
+}
+
+func MapGQLMetricToSeries(metric *Metric) series.Metric {
+	if metric == nil {
+		return series.MetricConfirmed
+	}
+	return series.Metric(strings.ToLower(string(*metric)))
+}
+
+// MapGQLChartOptionsToChart returns the options of a chart, and the IDs of the countries compared on it.
+func MapGQLChartOptionsToChart(options *ChartOptions) (chart.Options, []int, error) {
+	opts := chart.Options{}
+	if options == nil {
+		return opts, nil, nil
+	}
+
+	if options.Type != nil {
+		opts.Kind = chart.Kind(strings.ToLower(string(*options.Type)))
+	}
+	if options.Theme != nil {
+		opts.Theme = chart.Theme(strings.ToLower(string(*options.Theme)))
+	}
+	if options.Width != nil {
+		opts.Width = *options.Width
+	}
+	if options.Height != nil {
+		opts.Height = *options.Height
+	}
+	if options.LogScale != nil {
+		opts.LogScale = *options.LogScale
+	}
+
+	var compare []int
+	for _, id := range options.CompareCountryIDs {
+		countryID, err := strconv.Atoi(id)
+		if err != nil {
+			return opts, nil, fmt.Errorf("invalid country ID: %w", err)
+		}
+		compare = append(compare, countryID)
+	}
+	return opts, compare, nil
+}
+
+func MapGQLForecastModelToAnalytics(forecastModel *ForecastModel) analytics.Model {
+	if forecastModel == nil {
+		return analytics.ModelHoltWinters
+	}
+	return analytics.Model(strings.ToLower(string(*forecastModel)))
+}
+
+func MapAnalyticsForecastToGQLModel(forecast *analytics.Forecast) *Forecast {
+	gqlForecast := &Forecast{
+		Country:    MapDatabaseCountryToGQLModel(&forecast.Country, nil),
+		Metric:     Metric(strings.ToUpper(string(forecast.Metric))),
+		Model:      ForecastModel(strings.ToUpper(string(forecast.Model))),
+		Confidence: forecast.Confidence,
+		Parameters: []*ForecastParameter{},
+		Points:     []*ForecastPoint{},
+	}
+	for _, parameter := range forecast.Parameters {
+		gqlForecast.Parameters = append(gqlForecast.Parameters, &ForecastParameter{Name: parameter.Name, Value: parameter.Value})
+	}
+	for _, point := range forecast.Points {
+		gqlForecast.Points = append(gqlForecast.Points, &ForecastPoint{
+			Date:  point.Date,
+			Value: point.Value,
+			Lower: point.Lower,
+			Upper: point.Upper,
+		})
+	}
+	return gqlForecast
+}
+
+func MapAnalyticsReproductionNumberToGQLModel(rt *analytics.ReproductionNumber) *ReproductionNumber {
+	gqlRt := &ReproductionNumber{
+		Country:            MapDatabaseCountryToGQLModel(&rt.Country, nil),
+		SerialIntervalMean: rt.SerialInterval.Mean,
+		SerialIntervalSd:   rt.SerialInterval.SD,
+		WindowDays:         rt.WindowDays,
+		CredibleInterval:   analytics.CredibleInterval,
+		Estimates:          []*ReproductionNumberEstimate{},
+	}
+	for _, estimate := range rt.Estimates {
+		gqlRt.Estimates = append(gqlRt.Estimates, &ReproductionNumberEstimate{
+			Date:  estimate.Date,
+			Mean:  estimate.Mean,
+			Lower: estimate.Lower,
+			Upper: estimate.Upper,
+		})
+	}
+	return gqlRt
+}
+
+func MapDatabaseCountryGroupToGQLModel(group *database.CountryGroup) *CountryGroup {
+	return &CountryGroup{
+		ID:   fmt.Sprint(group.ID),
+		Name: group.Name,
+		Kind: CountryGroupKind(strings.ToUpper(group.Kind)),
+	}
+}
+
+func MapGroupStatisticToGQLModel(statistic groups.Statistic) *GroupStatistic {
+	return &GroupStatistic{
+		Date:             statistic.Date,
+		Confirmed:        statistic.Confirmed,
+		Recovered:        statistic.Recovered,
+		Deaths:           statistic.Deaths,
+		ReportingMembers: statistic.ReportingMembers,
+	}
+}
+
+func MapRankingEntryToGroupMemberRankingGQLModel(entry rankings.Entry) *GroupMemberRanking {
+	return &GroupMemberRanking{
+		Rank:    entry.Rank,
+		Country: MapDatabaseCountryToGQLModel(&entry.Country, nil),
+		Value:   entry.Value,
+		Date:    entry.Date,
+	}
+}
+
+func MapRankingToGQLModel(ranking *rankings.Ranking) *Ranking {
+	gqlRanking := &Ranking{
+		Metric:     RankingMetric(strings.ToUpper(string(ranking.Metric))),
+		ChangeDays: ranking.ChangeDays,
+		Total:      ranking.Total,
+		Entries:    []*RankingEntry{},
+	}
+	if ranking.Date != "" {
+		gqlRanking.Date = &ranking.Date
+	}
+	for i := range ranking.Entries {
+		entry := &ranking.Entries[i]
+		gqlRanking.Entries = append(gqlRanking.Entries, &RankingEntry{
+			Rank:         entry.Rank,
+			Country:      MapDatabaseCountryToGQLModel(&entry.Country, nil),
+			Value:        entry.Value,
+			Date:         entry.Date,
+			Percentile:   entry.Percentile,
+			PreviousRank: entry.PreviousRank,
+			RankChange:   entry.RankChange,
+		})
+	}
+	return gqlRanking
+}
+
+// MapGQLRankingMetricToSeries returns the series metric of a ranking metric, RT being analytics.MetricRt.
+func MapGQLRankingMetricToSeries(metric *RankingMetric) series.Metric {
+	if metric == nil {
+		return series.MetricConfirmed
+	}
+	return series.Metric(strings.ToLower(string(*metric)))
+}
+
+func MapDatabaseCountryLatestStatisticsToGQLModel(latest *database.CountryLatestStatistics) *CountryLatest {
+	return &CountryLatest{
+		Date:        latest.Date,
+		Confirmed:   latest.Confirmed,
+		Recovered:   latest.Recovered,
+		Deaths:      latest.Deaths,
+		Change1Day:  mapDatabaseStatisticChangeToGQLModel(latest.Change1Day),
+		Change7Days: mapDatabaseStatisticChangeToGQLModel(latest.Change7Days),
+	}
+}
+
+func mapDatabaseStatisticChangeToGQLModel(change *database.StatisticChange) *StatisticChange {
+	if change == nil {
+		return nil
+	}
+	return &StatisticChange{
+		Confirmed: change.Confirmed,
+		Recovered: change.Recovered,
+		Deaths:    change.Deaths,
+	}
+}
+
+func MapStatusToGQLModel(systemStatus *status.Status) *SystemStatus {
+	gqlStatus := &SystemStatus{
+		Version:       systemStatus.Version,
+		StartedAt:     systemStatus.StartedAt.Format(time.RFC3339),
+		UptimeSeconds: systemStatus.Uptime.Seconds(),
+		Database: &DatabaseStatus{
+			SizeBytes:     int(systemStatus.Database.SizeBytes),
+			SchemaVersion: systemStatus.Database.SchemaVersion,
+			Tables:        []*TableRowCount{},
+		},
+		Fetcher: &FetcherStatus{
+			Running: systemStatus.Fetcher.Running,
+			Backlog: systemStatus.Fetcher.Backlog,
+			Sources: []*FetchSource{},
+		},
+		Subscriptions: systemStatus.Subscriptions,
+	}
+	if systemStatus.Revision != "" {
+		gqlStatus.Revision = &systemStatus.Revision
+	}
+	for _, table := range systemStatus.Database.Tables {
+		gqlStatus.Database.Tables = append(gqlStatus.Database.Tables, &TableRowCount{Table: table.Table, Rows: table.Rows})
+	}
+	for _, source := range systemStatus.Fetcher.Sources {
+		gqlSource := &FetchSource{
+			Name:            source.Name,
+			URL:             source.URL,
+			LastFetchAt:     optionalTime(source.LastFetchAt),
+			LastSuccessAt:   optionalTime(source.LastSuccessAt),
+			FailedCountries: source.FailedCountries,
+		}
+		if source.LastError != "" {
+			gqlSource.LastError = &source.LastError
+		}
+		gqlStatus.Fetcher.Sources = append(gqlStatus.Fetcher.Sources, gqlSource)
+	}
+	return gqlStatus
+}
+
+// optionalTime formats t as RFC 3339, nil for the zero time.
+func optionalTime(t time.Time) *string {
+	if t.IsZero() {
+		return nil
+	}
+	formatted := t.Format(time.RFC3339)
+	return &formatted
+}
@@ -8,6 +8,16 @@ import (
 	"strconv"
 )
 
+type ChartOptions struct {
+	Type     *ChartType  `json:"type,omitempty"`
+	Width    *int        `json:"width,omitempty"`
+	Height   *int        `json:"height,omitempty"`
+	LogScale *bool       `json:"logScale,omitempty"`
+	Theme    *ChartTheme `json:"theme,omitempty"`
+	// other countries drawn on the same chart
+	CompareCountryIDs []string `json:"compareCountryIDs,omitempty"`
+}
+
 type CountriesConnection struct {
 	PageInfo *PageInfo      `json:"pageInfo"`
 	Edges    []*CountryEdge `json:"edges"`
@@ -18,6 +28,11 @@ type Country struct {
 	Name       string                    `json:"name"`
 	Code       string                    `json:"code"`
 	CovidStats *CovidStatisticConnection `json:"covidStats,omitempty"`
+	// An SVG chart of a series of the country. from and to are inclusive and formatted as YYYY-MM-DD,
+	// smoothing is the number of days of a trailing moving average.
+	ChartSVG string `json:"chartSVG"`
+	// the latest statistic of the country, null when it has none
+	Latest *CountryLatest `json:"latest,omitempty"`
 }
 
 type CountryEdge struct {
@@ -30,18 +45,50 @@ type CountryFilterInput struct {
 	CodeEquals   *string `json:"codeEquals,omitempty"`
 }
 
+// A continent, kept in sync with the country codes, or a custom group defined by admins. The statistics of a group
+// are the sums of the last statistics of its members on every day one of them reported.
+type CountryGroup struct {
+	ID      string           `json:"id"`
+	Name    string           `json:"name"`
+	Kind    CountryGroupKind `json:"kind"`
+	Members []*Country       `json:"members"`
+	// from and to are inclusive and formatted as YYYY-MM-DD
+	Statistics []*GroupStatistic `json:"statistics"`
+	// null when no member has statistics
+	Latest *GroupStatistic `json:"latest,omitempty"`
+	// members without a value for the metric are left out
+	MemberRankings []*GroupMemberRanking `json:"memberRankings"`
+}
+
 type CountryInput struct {
 	Name string `json:"name"`
 	Code string `json:"code"`
 }
 
+type CountryLatest struct {
+	Date      string `json:"date"`
+	Confirmed int    `json:"confirmed"`
+	Recovered int    `json:"recovered"`
+	Deaths    int    `json:"deaths"`
+	// increase since the last statistic at least 1 day older, null when there is none
+	Change1Day *StatisticChange `json:"change1Day,omitempty"`
+	// increase since the last statistic at least 7 days older, null when there is none
+	Change7Days *StatisticChange `json:"change7Days,omitempty"`
+}
+
+type CountryOrder struct {
+	Field CountrySortField `json:"field"`
+	Order *SortOrder       `json:"order,omitempty"`
+}
+
 type CovidStatistic struct {
-	ID        string   `json:"id"`
-	Country   *Country `json:"country"`
-	Date      string   `json:"date"`
-	Confirmed int      `json:"confirmed"`
-	Recovered int      `json:"recovered"`
-	Deaths    int      `json:"deaths"`
+	ID           string              `json:"id"`
+	Country      *Country            `json:"country"`
+	Date         string              `json:"date"`
+	Confirmed    int                 `json:"confirmed"`
+	Recovered    int                 `json:"recovered"`
+	Deaths       int                 `json:"deaths"`
+	QualityFlags []*DataQualityIssue `json:"qualityFlags"`
 }
 
 type CovidStatisticConnection struct {
@@ -54,6 +101,13 @@ type CovidStatisticEdge struct {
 	Node   *CovidStatistic `json:"node"`
 }
 
+type CovidStatisticFilterInput struct {
+	// inclusive, formatted as YYYY-MM-DD
+	DateFrom *string `json:"dateFrom,omitempty"`
+	// inclusive, formatted as YYYY-MM-DD
+	DateTo *string `json:"dateTo,omitempty"`
+}
+
 type CovidStatisticInput struct {
 	CountryID string `json:"countryID"`
 	Date      string `json:"date"`
@@ -62,6 +116,101 @@ type CovidStatisticInput struct {
 	Deaths    int    `json:"deaths"`
 }
 
+type CovidStatisticOrder struct {
+	Field CovidStatisticSortField `json:"field"`
+	Order *SortOrder              `json:"order,omitempty"`
+}
+
+type DataQualityCodeCount struct {
+	Code  DataQualityCode `json:"code"`
+	Count int             `json:"count"`
+}
+
+type DataQualityIssue struct {
+	ID               string              `json:"id"`
+	CovidStatisticID string              `json:"covidStatisticID"`
+	Date             string              `json:"date"`
+	Code             DataQualityCode     `json:"code"`
+	Severity         DataQualitySeverity `json:"severity"`
+	Message          string              `json:"message"`
+	CreatedAt        string              `json:"createdAt"`
+}
+
+type DataQualityReport struct {
+	Country      *Country                `json:"country"`
+	TotalIssues  int                     `json:"totalIssues"`
+	Errors       int                     `json:"errors"`
+	Warnings     int                     `json:"warnings"`
+	CountsByCode []*DataQualityCodeCount `json:"countsByCode"`
+	Issues       []*DataQualityIssue     `json:"issues"`
+}
+
+type DatabaseStatus struct {
+	// size of the database file, the pages still in the write-ahead log excepted
+	SizeBytes     int              `json:"sizeBytes"`
+	SchemaVersion int              `json:"schemaVersion"`
+	Tables        []*TableRowCount `json:"tables"`
+}
+
+// The fetches from an upstream API, the times are RFC 3339 and null until a fetch finished. lastSuccessAt is the end
+// of the last fetch that went through every country.
+type FetchSource struct {
+	Name            string  `json:"name"`
+	URL             string  `json:"url"`
+	LastFetchAt     *string `json:"lastFetchAt,omitempty"`
+	LastSuccessAt   *string `json:"lastSuccessAt,omitempty"`
+	LastError       *string `json:"lastError,omitempty"`
+	FailedCountries int     `json:"failedCountries"`
+}
+
+type FetcherStatus struct {
+	Running bool `json:"running"`
+	// countries the running fetches have left to fetch
+	Backlog int            `json:"backlog"`
+	Sources []*FetchSource `json:"sources"`
+}
+
+type Forecast struct {
+	Country *Country      `json:"country"`
+	Metric  Metric        `json:"metric"`
+	Model   ForecastModel `json:"model"`
+	// coverage of the confidence intervals, 0.95
+	Confidence float64              `json:"confidence"`
+	Parameters []*ForecastParameter `json:"parameters"`
+	Points     []*ForecastPoint     `json:"points"`
+}
+
+type ForecastParameter struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+}
+
+type ForecastPoint struct {
+	Date  string  `json:"date"`
+	Value float64 `json:"value"`
+	// bounds of the confidence interval
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+}
+
+type GroupMemberRanking struct {
+	// members with the same value share a rank
+	Rank    int      `json:"rank"`
+	Country *Country `json:"country"`
+	Value   float64  `json:"value"`
+	// day of the value
+	Date string `json:"date"`
+}
+
+type GroupStatistic struct {
+	Date      string `json:"date"`
+	Confirmed int    `json:"confirmed"`
+	Recovered int    `json:"recovered"`
+	Deaths    int    `json:"deaths"`
+	// number of members that had reported by this day
+	ReportingMembers int `json:"reportingMembers"`
+}
+
 type LoginResponse struct {
 	Token string `json:"token"`
 	User  *User  `json:"user"`
@@ -72,11 +221,82 @@ type PageInfo struct {
 	HasNextPage bool    `json:"hasNextPage"`
 }
 
+type Ranking struct {
+	Metric RankingMetric `json:"metric"`
+	// day ranked, null when no country has a value
+	Date       *string `json:"date,omitempty"`
+	ChangeDays int     `json:"changeDays"`
+	// number of ranked countries, before limit and offset
+	Total   int             `json:"total"`
+	Entries []*RankingEntry `json:"entries"`
+}
+
+type RankingEntry struct {
+	// countries with the same value share a rank
+	Rank    int      `json:"rank"`
+	Country *Country `json:"country"`
+	Value   float64  `json:"value"`
+	// day of the value, countries keep their last value until they report again
+	Date string `json:"date"`
+	// percentage of the other ranked countries with a lower value
+	Percentile float64 `json:"percentile"`
+	// rank changeDays earlier, null when the country was not ranked then
+	PreviousRank *int `json:"previousRank,omitempty"`
+	// places gained since changeDays earlier, null when the country was not ranked then
+	RankChange *int `json:"rankChange,omitempty"`
+}
+
+type ReproductionNumber struct {
+	Country *Country `json:"country"`
+	// mean of the gamma distributed serial interval, in days
+	SerialIntervalMean float64 `json:"serialIntervalMean"`
+	// standard deviation of the serial interval, in days
+	SerialIntervalSd float64 `json:"serialIntervalSD"`
+	// number of days every estimate is smoothed over
+	WindowDays int `json:"windowDays"`
+	// coverage of the credible intervals, 0.95
+	CredibleInterval float64                       `json:"credibleInterval"`
+	Estimates        []*ReproductionNumberEstimate `json:"estimates"`
+}
+
+type ReproductionNumberEstimate struct {
+	Date string  `json:"date"`
+	Mean float64 `json:"mean"`
+	// bounds of the credible interval
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+}
+
+type StatisticChange struct {
+	Confirmed int `json:"confirmed"`
+	Recovered int `json:"recovered"`
+	Deaths    int `json:"deaths"`
+}
+
+type SystemStatus struct {
+	Version string `json:"version"`
+	// commit the server was built from, null when unknown
+	Revision *string `json:"revision,omitempty"`
+	// RFC 3339 time the server started at
+	StartedAt     string          `json:"startedAt"`
+	UptimeSeconds float64         `json:"uptimeSeconds"`
+	Database      *DatabaseStatus `json:"database"`
+	Fetcher       *FetcherStatus  `json:"fetcher"`
+	// GraphQL subscriptions running
+	Subscriptions int `json:"subscriptions"`
+}
+
+type TableRowCount struct {
+	Table string `json:"table"`
+	Rows  int    `json:"rows"`
+}
+
 type User struct {
 	ID                 string     `json:"id"`
 	Username           string     `json:"username"`
 	Email              string     `json:"email"`
 	Password           string     `json:"password"`
+	EmailVerified      bool       `json:"emailVerified"`
 	MonitoredCountries []*Country `json:"monitoredCountries"`
 }
 
@@ -120,3 +340,493 @@ func (e *CaseType) UnmarshalGQL(v interface{}) error {
 func (e CaseType) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
+
+type ChartTheme string
+
+const (
+	ChartThemeLight ChartTheme = "LIGHT"
+	ChartThemeDark  ChartTheme = "DARK"
+)
+
+var AllChartTheme = []ChartTheme{
+	ChartThemeLight,
+	ChartThemeDark,
+}
+
+func (e ChartTheme) IsValid() bool {
+	switch e {
+	case ChartThemeLight, ChartThemeDark:
+		return true
+	}
+	return false
+}
+
+func (e ChartTheme) String() string {
+	return string(e)
+}
+
+func (e *ChartTheme) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ChartTheme(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ChartTheme", str)
+	}
+	return nil
+}
+
+func (e ChartTheme) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ChartType string
+
+const (
+	ChartTypeLine ChartType = "LINE"
+	ChartTypeBar  ChartType = "BAR"
+)
+
+var AllChartType = []ChartType{
+	ChartTypeLine,
+	ChartTypeBar,
+}
+
+func (e ChartType) IsValid() bool {
+	switch e {
+	case ChartTypeLine, ChartTypeBar:
+		return true
+	}
+	return false
+}
+
+func (e ChartType) String() string {
+	return string(e)
+}
+
+func (e *ChartType) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ChartType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ChartType", str)
+	}
+	return nil
+}
+
+func (e ChartType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type CountryGroupKind string
+
+const (
+	CountryGroupKindContinent CountryGroupKind = "CONTINENT"
+	CountryGroupKindCustom    CountryGroupKind = "CUSTOM"
+)
+
+var AllCountryGroupKind = []CountryGroupKind{
+	CountryGroupKindContinent,
+	CountryGroupKindCustom,
+}
+
+func (e CountryGroupKind) IsValid() bool {
+	switch e {
+	case CountryGroupKindContinent, CountryGroupKindCustom:
+		return true
+	}
+	return false
+}
+
+func (e CountryGroupKind) String() string {
+	return string(e)
+}
+
+func (e *CountryGroupKind) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = CountryGroupKind(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid CountryGroupKind", str)
+	}
+	return nil
+}
+
+func (e CountryGroupKind) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type CountrySortField string
+
+const (
+	CountrySortFieldID   CountrySortField = "ID"
+	CountrySortFieldName CountrySortField = "NAME"
+	CountrySortFieldCode CountrySortField = "CODE"
+)
+
+var AllCountrySortField = []CountrySortField{
+	CountrySortFieldID,
+	CountrySortFieldName,
+	CountrySortFieldCode,
+}
+
+func (e CountrySortField) IsValid() bool {
+	switch e {
+	case CountrySortFieldID, CountrySortFieldName, CountrySortFieldCode:
+		return true
+	}
+	return false
+}
+
+func (e CountrySortField) String() string {
+	return string(e)
+}
+
+func (e *CountrySortField) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = CountrySortField(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid CountrySortField", str)
+	}
+	return nil
+}
+
+func (e CountrySortField) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type CovidStatisticSortField string
+
+const (
+	CovidStatisticSortFieldID        CovidStatisticSortField = "ID"
+	CovidStatisticSortFieldDate      CovidStatisticSortField = "DATE"
+	CovidStatisticSortFieldConfirmed CovidStatisticSortField = "CONFIRMED"
+	CovidStatisticSortFieldRecovered CovidStatisticSortField = "RECOVERED"
+	CovidStatisticSortFieldDeaths    CovidStatisticSortField = "DEATHS"
+)
+
+var AllCovidStatisticSortField = []CovidStatisticSortField{
+	CovidStatisticSortFieldID,
+	CovidStatisticSortFieldDate,
+	CovidStatisticSortFieldConfirmed,
+	CovidStatisticSortFieldRecovered,
+	CovidStatisticSortFieldDeaths,
+}
+
+func (e CovidStatisticSortField) IsValid() bool {
+	switch e {
+	case CovidStatisticSortFieldID, CovidStatisticSortFieldDate, CovidStatisticSortFieldConfirmed, CovidStatisticSortFieldRecovered, CovidStatisticSortFieldDeaths:
+		return true
+	}
+	return false
+}
+
+func (e CovidStatisticSortField) String() string {
+	return string(e)
+}
+
+func (e *CovidStatisticSortField) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = CovidStatisticSortField(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid CovidStatisticSortField", str)
+	}
+	return nil
+}
+
+func (e CovidStatisticSortField) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type DataQualityCode string
+
+const (
+	DataQualityCodeNegativeValue            DataQualityCode = "NEGATIVE_VALUE"
+	DataQualityCodeFutureDate               DataQualityCode = "FUTURE_DATE"
+	DataQualityCodeDuplicateDate            DataQualityCode = "DUPLICATE_DATE"
+	DataQualityCodeCumulativeDecrease       DataQualityCode = "CUMULATIVE_DECREASE"
+	DataQualityCodeDeathsExceedConfirmed    DataQualityCode = "DEATHS_EXCEED_CONFIRMED"
+	DataQualityCodeRecoveredExceedConfirmed DataQualityCode = "RECOVERED_EXCEED_CONFIRMED"
+	DataQualityCodeSpike                    DataQualityCode = "SPIKE"
+)
+
+var AllDataQualityCode = []DataQualityCode{
+	DataQualityCodeNegativeValue,
+	DataQualityCodeFutureDate,
+	DataQualityCodeDuplicateDate,
+	DataQualityCodeCumulativeDecrease,
+	DataQualityCodeDeathsExceedConfirmed,
+	DataQualityCodeRecoveredExceedConfirmed,
+	DataQualityCodeSpike,
+}
+
+func (e DataQualityCode) IsValid() bool {
+	switch e {
+	case DataQualityCodeNegativeValue, DataQualityCodeFutureDate, DataQualityCodeDuplicateDate, DataQualityCodeCumulativeDecrease, DataQualityCodeDeathsExceedConfirmed, DataQualityCodeRecoveredExceedConfirmed, DataQualityCodeSpike:
+		return true
+	}
+	return false
+}
+
+func (e DataQualityCode) String() string {
+	return string(e)
+}
+
+func (e *DataQualityCode) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = DataQualityCode(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid DataQualityCode", str)
+	}
+	return nil
+}
+
+func (e DataQualityCode) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type DataQualitySeverity string
+
+const (
+	DataQualitySeverityWarning DataQualitySeverity = "WARNING"
+	DataQualitySeverityError   DataQualitySeverity = "ERROR"
+)
+
+var AllDataQualitySeverity = []DataQualitySeverity{
+	DataQualitySeverityWarning,
+	DataQualitySeverityError,
+}
+
+func (e DataQualitySeverity) IsValid() bool {
+	switch e {
+	case DataQualitySeverityWarning, DataQualitySeverityError:
+		return true
+	}
+	return false
+}
+
+func (e DataQualitySeverity) String() string {
+	return string(e)
+}
+
+func (e *DataQualitySeverity) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = DataQualitySeverity(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid DataQualitySeverity", str)
+	}
+	return nil
+}
+
+func (e DataQualitySeverity) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+// HOLT_WINTERS is exponential smoothing with a weekly season, SIR a compartmental model fitted to the last six weeks.
+type ForecastModel string
+
+const (
+	ForecastModelHoltWinters ForecastModel = "HOLT_WINTERS"
+	ForecastModelSir         ForecastModel = "SIR"
+)
+
+var AllForecastModel = []ForecastModel{
+	ForecastModelHoltWinters,
+	ForecastModelSir,
+}
+
+func (e ForecastModel) IsValid() bool {
+	switch e {
+	case ForecastModelHoltWinters, ForecastModelSir:
+		return true
+	}
+	return false
+}
+
+func (e ForecastModel) String() string {
+	return string(e)
+}
+
+func (e *ForecastModel) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ForecastModel(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ForecastModel", str)
+	}
+	return nil
+}
+
+func (e ForecastModel) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+// The NEW_ metrics are daily deltas.
+type Metric string
+
+const (
+	MetricConfirmed    Metric = "CONFIRMED"
+	MetricRecovered    Metric = "RECOVERED"
+	MetricDeaths       Metric = "DEATHS"
+	MetricNewConfirmed Metric = "NEW_CONFIRMED"
+	MetricNewRecovered Metric = "NEW_RECOVERED"
+	MetricNewDeaths    Metric = "NEW_DEATHS"
+)
+
+var AllMetric = []Metric{
+	MetricConfirmed,
+	MetricRecovered,
+	MetricDeaths,
+	MetricNewConfirmed,
+	MetricNewRecovered,
+	MetricNewDeaths,
+}
+
+func (e Metric) IsValid() bool {
+	switch e {
+	case MetricConfirmed, MetricRecovered, MetricDeaths, MetricNewConfirmed, MetricNewRecovered, MetricNewDeaths:
+		return true
+	}
+	return false
+}
+
+func (e Metric) String() string {
+	return string(e)
+}
+
+func (e *Metric) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Metric(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Metric", str)
+	}
+	return nil
+}
+
+func (e Metric) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+// The NEW_ metrics are daily deltas, RT is the effective reproduction number.
+type RankingMetric string
+
+const (
+	RankingMetricConfirmed    RankingMetric = "CONFIRMED"
+	RankingMetricRecovered    RankingMetric = "RECOVERED"
+	RankingMetricDeaths       RankingMetric = "DEATHS"
+	RankingMetricNewConfirmed RankingMetric = "NEW_CONFIRMED"
+	RankingMetricNewRecovered RankingMetric = "NEW_RECOVERED"
+	RankingMetricNewDeaths    RankingMetric = "NEW_DEATHS"
+	RankingMetricRt           RankingMetric = "RT"
+)
+
+var AllRankingMetric = []RankingMetric{
+	RankingMetricConfirmed,
+	RankingMetricRecovered,
+	RankingMetricDeaths,
+	RankingMetricNewConfirmed,
+	RankingMetricNewRecovered,
+	RankingMetricNewDeaths,
+	RankingMetricRt,
+}
+
+func (e RankingMetric) IsValid() bool {
+	switch e {
+	case RankingMetricConfirmed, RankingMetricRecovered, RankingMetricDeaths, RankingMetricNewConfirmed, RankingMetricNewRecovered, RankingMetricNewDeaths, RankingMetricRt:
+		return true
+	}
+	return false
+}
+
+func (e RankingMetric) String() string {
+	return string(e)
+}
+
+func (e *RankingMetric) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = RankingMetric(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid RankingMetric", str)
+	}
+	return nil
+}
+
+func (e RankingMetric) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type SortOrder string
+
+const (
+	SortOrderAsc  SortOrder = "ASC"
+	SortOrderDesc SortOrder = "DESC"
+)
+
+var AllSortOrder = []SortOrder{
+	SortOrderAsc,
+	SortOrderDesc,
+}
+
+func (e SortOrder) IsValid() bool {
+	switch e {
+	case SortOrderAsc, SortOrderDesc:
+		return true
+	}
+	return false
+}
+
+func (e SortOrder) String() string {
+	return string(e)
+}
+
+func (e *SortOrder) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SortOrder(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SortOrder", str)
+	}
+	return nil
+}
+
+func (e SortOrder) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
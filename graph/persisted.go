@@ -0,0 +1,193 @@
+package graph
+
+import (
+	"context"
+	"covid/database"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const (
+	// number of persisted queries kept in memory in front of the store.
+	persistedQueryLRUSize = 1000
+
+	errPersistedQueryNotAllowed = "PERSISTED_QUERY_NOT_ALLOWED"
+	apolloManifestFormat        = "apollo-persisted-query-manifest"
+)
+
+// PersistedQueryCache is the APQ store kept in the persisted_queries table, with an LRU in front of it
+// so that hot queries do not hit the database. In strict mode only allowed queries are served and
+// queries sent by clients are never stored, the manifest is the only way to register one. Otherwise
+// anonymous clients can register any query, only the newest maxStored of them are kept.
+type PersistedQueryCache struct {
+	db        database.PersistedQueryStore
+	hot       *lru.LRU
+	strict    bool
+	maxStored int
+}
+
+var _ graphql.Cache = &PersistedQueryCache{}
+
+func NewPersistedQueryCache(db database.PersistedQueryStore, strict bool, maxStored int) *PersistedQueryCache {
+	return &PersistedQueryCache{
+		db:        db,
+		hot:       lru.New(persistedQueryLRUSize),
+		strict:    strict,
+		maxStored: maxStored,
+	}
+}
+
+func (c *PersistedQueryCache) Get(ctx context.Context, hash string) (interface{}, bool) {
+	if query, ok := c.hot.Get(ctx, hash); ok {
+		return query, true
+	}
+
+	persistedQuery, err := c.db.GetPersistedQuery(ctx, hash)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "error reading persisted query", "hash", hash, "error", err)
+		}
+		return nil, false
+	}
+	if c.strict && !persistedQuery.Allowed {
+		return nil, false
+	}
+
+	c.hot.Add(ctx, hash, persistedQuery.Query)
+	return persistedQuery.Query, true
+}
+
+func (c *PersistedQueryCache) Add(ctx context.Context, hash string, query interface{}) {
+	if c.strict {
+		return
+	}
+
+	queryStr, ok := query.(string)
+	if !ok {
+		return
+	}
+
+	if err := c.db.AddPersistedQuery(ctx, hash, queryStr, time.Now().UTC().Format(time.RFC3339), c.maxStored); err != nil {
+		slog.ErrorContext(ctx, "error storing persisted query", "hash", hash, "error", err)
+		return
+	}
+	c.hot.Add(ctx, hash, queryStr)
+}
+
+// OperationAllowList only lets operations registered from a manifest run. It has to be used
+// after the APQ extension so that queries sent as a hash are already resolved.
+type OperationAllowList struct {
+	db database.PersistedQueryStore
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationParameterMutator
+} = OperationAllowList{}
+
+func NewOperationAllowList(db database.PersistedQueryStore) OperationAllowList {
+	return OperationAllowList{db: db}
+}
+
+func (a OperationAllowList) ExtensionName() string {
+	return "OperationAllowList"
+}
+
+func (a OperationAllowList) Validate(schema graphql.ExecutableSchema) error {
+	if a.db == nil {
+		return errors.New("OperationAllowList needs a database")
+	}
+	return nil
+}
+
+func (a OperationAllowList) MutateOperationParameters(ctx context.Context, rawParams *graphql.RawParams) *gqlerror.Error {
+	allowed, err := a.db.GetAllowedPersistedQueryHashes(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "error reading allowed persisted queries", "error", err)
+	}
+	if _, found := slices.BinarySearch(allowed, QueryHash(rawParams.Query)); found {
+		return nil
+	}
+
+	gqlErr := gqlerror.Errorf("operation is not in the list of allowed operations")
+	errcode.Set(gqlErr, errPersistedQueryNotAllowed)
+	return gqlErr
+}
+
+// QueryHash is the APQ hash of a query, the hex encoded sha256 of its text.
+func QueryHash(query string) string {
+	hash := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(hash[:])
+}
+
+type apolloManifest struct {
+	Format     string `json:"format"`
+	Version    int    `json:"version"`
+	Operations []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+		Type string `json:"type"`
+		Body string `json:"body"`
+	} `json:"operations"`
+}
+
+// ParsePersistedQueryManifest reads the operations of a manifest. Both the Apollo persisted query manifest
+// and a plain JSON object mapping operation IDs to their text are accepted. Operations are always keyed by
+// their sha256 hash, since that is what APQ clients send.
+func ParsePersistedQueryManifest(r io.Reader) ([]database.PersistedQuery, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not read manifest: %w", err)
+	}
+
+	createdAt := time.Now().UTC().Format(time.RFC3339)
+	var queries []database.PersistedQuery
+
+	var manifest apolloManifest
+	if err := json.Unmarshal(content, &manifest); err == nil && manifest.Format == apolloManifestFormat {
+		if manifest.Version != 1 {
+			return nil, fmt.Errorf("unsupported manifest version %d", manifest.Version)
+		}
+		for _, operation := range manifest.Operations {
+			hash := QueryHash(operation.Body)
+			if operation.ID != "" && operation.ID != hash {
+				return nil, fmt.Errorf("operation %s: id does not match the sha256 hash of its body", operation.Name)
+			}
+			queries = append(queries, database.PersistedQuery{
+				Hash:          hash,
+				Query:         operation.Body,
+				OperationName: operation.Name,
+				Allowed:       true,
+				CreatedAt:     createdAt,
+			})
+		}
+		return queries, nil
+	}
+
+	var operations map[string]string
+	if err := json.Unmarshal(content, &operations); err != nil {
+		return nil, fmt.Errorf("manifest is neither an apollo manifest nor an object of operations: %w", err)
+	}
+	for _, body := range operations {
+		queries = append(queries, database.PersistedQuery{
+			Hash:      QueryHash(body),
+			Query:     body,
+			Allowed:   true,
+			CreatedAt: createdAt,
+		})
+	}
+	return queries, nil
+}
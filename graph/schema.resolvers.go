@@ -6,20 +6,160 @@ package graph
 
 import (
 	"context"
+	"covid/chart"
 	"covid/database"
-	"covid/fetcher"
 	"covid/graph/model"
+	"covid/groups"
+	"covid/quality"
+	"covid/rankings"
+	"covid/series"
+	"database/sql"
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ChartSVG is the resolver for the chartSVG field.
+func (r *countryResolver) ChartSVG(ctx context.Context, obj *model.Country, metric *model.Metric, from *string, to *string, smoothing *int, options *model.ChartOptions) (string, error) {
+	countryID, err := strconv.Atoi(obj.ID)
+	if err != nil {
+		return "", fmt.Errorf("invalid country ID: %w", err)
+	}
+
+	opts, compare, err := model.MapGQLChartOptionsToChart(options)
+	if err != nil {
+		return "", err
+	}
+	countryIDs := append([]int{countryID}, compare...)
+	if len(countryIDs) > chart.MaxSeries {
+		return "", fmt.Errorf("a chart shows at most %d countries", chart.MaxSeries)
+	}
+
+	window := 0
+	if smoothing != nil {
+		if *smoothing < 0 {
+			return "", errors.New("smoothing must not be negative")
+		}
+		window = *smoothing
+	}
+
+	data, err := series.LoadCountries(ctx, r.store, countryIDs, model.MapGQLMetricToSeries(metric), from, to, window)
+	if err != nil {
+		return "", err
+	}
+
+	var svg strings.Builder
+	if err := chart.Render(&svg, data, opts); err != nil {
+		return "", err
+	}
+	return svg.String(), nil
+}
+
+// Latest is the resolver for the latest field.
+func (r *countryResolver) Latest(ctx context.Context, obj *model.Country) (*model.CountryLatest, error) {
+	countryID, err := strconv.Atoi(obj.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid country ID: %w", err)
+	}
+
+	latest, err := r.store.GetCountryLatestStatistics(ctx, countryID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return model.MapDatabaseCountryLatestStatisticsToGQLModel(&latest), nil
+}
+
+// Members is the resolver for the members field.
+func (r *countryGroupResolver) Members(ctx context.Context, obj *model.CountryGroup) ([]*model.Country, error) {
+	group, err := countryGroup(ctx, r.store, obj.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	members := []*model.Country{}
+	for i := range group.Members {
+		members = append(members, model.MapDatabaseCountryToGQLModel(&group.Members[i], nil))
+	}
+	return members, nil
+}
+
+// Statistics is the resolver for the statistics field.
+func (r *countryGroupResolver) Statistics(ctx context.Context, obj *model.CountryGroup, from *string, to *string) ([]*model.GroupStatistic, error) {
+	group, err := countryGroup(ctx, r.store, obj.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	statistics, err := groups.Statistics(ctx, r.store, group, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	gqlStatistics := []*model.GroupStatistic{}
+	for _, statistic := range statistics {
+		gqlStatistics = append(gqlStatistics, model.MapGroupStatisticToGQLModel(statistic))
+	}
+	return gqlStatistics, nil
+}
+
+// Latest is the resolver for the latest field.
+func (r *countryGroupResolver) Latest(ctx context.Context, obj *model.CountryGroup) (*model.GroupStatistic, error) {
+	group, err := countryGroup(ctx, r.store, obj.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	latest, ok, err := groups.Latest(ctx, r.store, group)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return model.MapGroupStatisticToGQLModel(latest), nil
+}
+
+// MemberRankings is the resolver for the memberRankings field.
+func (r *countryGroupResolver) MemberRankings(ctx context.Context, obj *model.CountryGroup, metric *model.RankingMetric) ([]*model.GroupMemberRanking, error) {
+	groupID, err := strconv.Atoi(obj.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid group ID: %w", err)
+	}
+
+	ranking, err := rankings.Rank(ctx, r.store, r.rt, rankings.Options{Metric: model.MapGQLRankingMetricToSeries(metric), GroupID: &groupID})
+	if err != nil {
+		return nil, err
+	}
+
+	gqlRankings := []*model.GroupMemberRanking{}
+	for _, entry := range ranking.Entries {
+		gqlRankings = append(gqlRankings, model.MapRankingEntryToGroupMemberRankingGQLModel(entry))
+	}
+	return gqlRankings, nil
+}
+
+// QualityFlags is the resolver for the qualityFlags field.
+func (r *covidStatisticResolver) QualityFlags(ctx context.Context, obj *model.CovidStatistic) ([]*model.DataQualityIssue, error) {
+	covidStatisticID, err := strconv.Atoi(obj.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid covid statistic ID: %w", err)
+	}
+
+	issues, err := r.store.GetDataQualityIssuesByCovidStatisticID(ctx, covidStatisticID)
+	if err != nil {
+		return nil, err
+	}
+
+	return model.MapDatabaseDataQualityIssuesToGQLModels(issues), nil
+}
+
 // Register is the resolver for the register field.
 func (r *mutationResolver) Register(ctx context.Context, username string, email string, password string) (*model.LoginResponse, error) {
-	err := ValidateUserRegistration(username, email, password, r)
+	err := ValidateUserRegistration(ctx, username, email, password, r)
 	if err != nil {
 		return nil, err
 	}
@@ -29,13 +169,13 @@ func (r *mutationResolver) Register(ctx context.Context, username string, email
 		return nil, err
 	}
 
-	d := database.NewDB(r.db)
-	userID, err := d.RegisterUser(username, email, hashedPassword, salt)
+	userID, err := r.store.RegisterUser(ctx, username, email, hashedPassword, salt)
 	if err != nil {
 		return nil, err
 	}
+	r.accounts.SendVerificationAfterRegistration(ctx, database.User{ID: int(userID), Username: username, Email: email})
 
-	token, err := GenerateToken(username)
+	token, err := r.auth.GenerateToken(database.User{ID: int(userID), Username: username, Role: database.RoleUser})
 	if err != nil {
 		return nil, err
 	}
@@ -50,6 +190,38 @@ func (r *mutationResolver) Register(ctx context.Context, username string, email
 	}, nil
 }
 
+// RequestPasswordReset is the resolver for the requestPasswordReset field.
+func (r *mutationResolver) RequestPasswordReset(ctx context.Context, email string) (bool, error) {
+	if err := r.accounts.RequestPasswordReset(ctx, email); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ResetPassword is the resolver for the resetPassword field.
+func (r *mutationResolver) ResetPassword(ctx context.Context, token string, password string) (bool, error) {
+	if err := r.accounts.ResetPassword(ctx, token, password); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// VerifyEmail is the resolver for the verifyEmail field.
+func (r *mutationResolver) VerifyEmail(ctx context.Context, token string) (bool, error) {
+	if err := r.accounts.VerifyEmail(ctx, token); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ResendVerification is the resolver for the resendVerification field.
+func (r *mutationResolver) ResendVerification(ctx context.Context, email string) (bool, error) {
+	if err := r.accounts.ResendVerification(ctx, email); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // DeleteUser is the resolver for the deleteUser field.
 func (r *mutationResolver) DeleteUser(ctx context.Context, userID string) (bool, error) {
 	userIDInt, err := strconv.Atoi(userID)
@@ -57,9 +229,7 @@ func (r *mutationResolver) DeleteUser(ctx context.Context, userID string) (bool,
 		return false, fmt.Errorf("error converting user ID %s to int: %w", userID, err)
 	}
 
-	d := database.NewDB(r.db)
-
-	if err := d.DeleteUser(userIDInt); err != nil {
+	if err := r.store.DeleteUser(ctx, userIDInt); err != nil {
 		return false, err
 	}
 	return true, nil
@@ -71,8 +241,7 @@ func (r *mutationResolver) AddCountry(ctx context.Context, input model.CountryIn
 		return nil, errors.New("country code must be 2 characters long")
 	}
 
-	d := database.NewDB(r.db)
-	country, ifExists, err := d.CreateCountry(input.Name, input.Code)
+	country, ifExists, err := r.store.CreateCountry(ctx, input.Name, input.Code)
 	if err != nil {
 		return nil, fmt.Errorf("failed to insert new country: %w", err)
 	}
@@ -81,7 +250,7 @@ func (r *mutationResolver) AddCountry(ctx context.Context, input model.CountryIn
 		return nil, errors.New("country already exists")
 	}
 
-	return model.MapDatabaseCountryToGQLModel(&country, &pageSize), nil
+	return model.MapDatabaseCountryToGQLModel(&country, &r.pageSize), nil
 }
 
 // UpdateCountry is the resolver for the updateCountry field.
@@ -94,19 +263,18 @@ func (r *mutationResolver) UpdateCountry(ctx context.Context, id string, name st
 		return nil, errors.New("country code must be 2 characters long")
 	}
 
-	d := database.NewDB(r.db)
-	country, err := d.UpdateCountry(countryID, name, code)
+	country, err := r.store.UpdateCountry(ctx, countryID, name, code)
 	if err != nil {
 		return nil, fmt.Errorf("error updating country with ID %d: %w", countryID, err)
 	}
 
-	covidStats, err := d.GetCovidStatistics(countryID, nil, nil)
+	covidStats, err := r.store.GetCovidStatistics(ctx, countryID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting covid statistics for country with ID %d: %w", countryID, err)
 	}
 	country.CovidStatistics = covidStats
 
-	return model.MapDatabaseCountryToGQLModel(&country, &pageSize), nil
+	return model.MapDatabaseCountryToGQLModel(&country, &r.pageSize), nil
 }
 
 // DeleteCountry is the resolver for the deleteCountry field.
@@ -116,8 +284,7 @@ func (r *mutationResolver) DeleteCountry(ctx context.Context, countryID string)
 		return false, fmt.Errorf("error converting country ID %s to int: %w", countryID, err)
 	}
 
-	d := database.NewDB(r.db)
-	err = d.DeleteCountry(countryIDInt)
+	err = r.store.DeleteCountry(ctx, countryIDInt)
 	if err != nil {
 		return false, err
 	}
@@ -137,13 +304,12 @@ func (r *mutationResolver) AddCovidStatistic(ctx context.Context, input model.Co
 		return nil, fmt.Errorf("invalid date: %w", err)
 	}
 
-	d := database.NewDB(r.db)
-	covidStatisticID, err := d.AddCovidStatistic(countryID, date.Format("2006-01-02"), input.Confirmed, input.Recovered, input.Deaths)
+	covidStatisticID, _, err := r.checker.AddCovidStatistic(ctx, r.store, countryID, date.Format("2006-01-02"), input.Confirmed, input.Recovered, input.Deaths)
 	if err != nil {
 		return nil, err
 	}
 
-	country, err := d.GetCountryByID(countryID)
+	country, err := r.store.GetCountryByID(ctx, countryID)
 	if err != nil {
 		return nil, err
 	}
@@ -165,8 +331,7 @@ func (r *mutationResolver) DeleteCovidStatistic(ctx context.Context, id string)
 		return false, fmt.Errorf("invalid covid statistic ID: %w", err)
 	}
 
-	d := database.NewDB(r.db)
-	err = d.DeleteCovidStatistic(covidStatisticID)
+	err = r.checker.DeleteCovidStatistic(ctx, r.store, covidStatisticID)
 	if err != nil {
 		return false, err
 	}
@@ -186,13 +351,12 @@ func (r *mutationResolver) UpdateCovidStatistic(ctx context.Context, id string,
 		return nil, fmt.Errorf("invalid date: %w", err)
 	}
 
-	d := database.NewDB(r.db)
-	covidStatistic, err := d.UpdateCovidStatistic(covidStatisticID, dateTime.Format("2006-01-02"), confirmed, recovered, deaths)
+	covidStatistic, _, err := r.checker.UpdateCovidStatistic(ctx, r.store, covidStatisticID, dateTime.Format("2006-01-02"), confirmed, recovered, deaths)
 	if err != nil {
 		return nil, err
 	}
 
-	country, err := d.GetCountryByID(covidStatistic.CountryID)
+	country, err := r.store.GetCountryByID(ctx, covidStatistic.CountryID)
 	if err != nil {
 		return nil, err
 	}
@@ -218,18 +382,17 @@ func (r *mutationResolver) AddUserMonitoredCountry(ctx context.Context, userID s
 		return nil, fmt.Errorf("invalid country ID: %w", err)
 	}
 
-	d := database.NewDB(r.db)
-	if err := d.AddUserMonitoredCountry(userIDInt, countryIDInt); err != nil {
+	if err := r.store.AddUserMonitoredCountry(ctx, userIDInt, countryIDInt); err != nil {
 		return nil, err
 	}
 
 	var user database.User
-	user, err = d.GetUserByID(userIDInt)
+	user, err = r.store.GetUserByID(ctx, userIDInt)
 	if err != nil {
 		return nil, err
 	}
 
-	user.MonitoredCountries, err = d.GetUserMonitoredCountries(userIDInt)
+	user.MonitoredCountries, err = r.store.GetUserMonitoredCountries(ctx, userIDInt)
 	if err != nil {
 		return nil, err
 	}
@@ -248,18 +411,17 @@ func (r *mutationResolver) RemoveUserMonitoredCountry(ctx context.Context, userI
 		return nil, fmt.Errorf("invalid country ID: %w", err)
 	}
 
-	d := database.NewDB(r.db)
-	if err := d.RemoveUserMonitoredCountry(userIDInt, countryIDInt); err != nil {
+	if err := r.store.RemoveUserMonitoredCountry(ctx, userIDInt, countryIDInt); err != nil {
 		return nil, err
 	}
 
 	var user database.User
-	user, err = d.GetUserByID(userIDInt)
+	user, err = r.store.GetUserByID(ctx, userIDInt)
 	if err != nil {
 		return nil, err
 	}
 
-	user.MonitoredCountries, err = d.GetUserMonitoredCountries(userIDInt)
+	user.MonitoredCountries, err = r.store.GetUserMonitoredCountries(ctx, userIDInt)
 	if err != nil {
 		return nil, err
 	}
@@ -269,21 +431,112 @@ func (r *mutationResolver) RemoveUserMonitoredCountry(ctx context.Context, userI
 
 // RefreshCovidDataForAllCountries is the resolver for the refreshCovidDataForAllCountries field.
 func (r *mutationResolver) RefreshCovidDataForAllCountries(ctx context.Context) (bool, error) {
-	if err := fetcher.FetchAndUpdateData(r.db); err != nil {
+	if err := r.fetcher.Refresh(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CreateCountryGroup is the resolver for the createCountryGroup field.
+func (r *mutationResolver) CreateCountryGroup(ctx context.Context, name string, countryIDs []string) (*model.CountryGroup, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("group name must not be empty")
+	}
+	countryIDsInt, err := parseCountryIDs(countryIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	group, exists, err := r.store.CreateCountryGroup(ctx, name, countryIDsInt)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		return nil, errors.New("country group already exists")
+	}
+
+	return model.MapDatabaseCountryGroupToGQLModel(&group), nil
+}
+
+// DeleteCountryGroup is the resolver for the deleteCountryGroup field.
+func (r *mutationResolver) DeleteCountryGroup(ctx context.Context, id string) (bool, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return false, err
+	}
+	groupID, err := strconv.Atoi(id)
+	if err != nil {
+		return false, fmt.Errorf("invalid group ID: %w", err)
+	}
+
+	if err := r.store.DeleteCountryGroup(ctx, groupID); err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
+// AddCountryGroupMember is the resolver for the addCountryGroupMember field.
+func (r *mutationResolver) AddCountryGroupMember(ctx context.Context, groupID string, countryID string) (*model.CountryGroup, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	groupIDInt, err := strconv.Atoi(groupID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid group ID: %w", err)
+	}
+	countryIDInt, err := strconv.Atoi(countryID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid country ID: %w", err)
+	}
+
+	if err := r.store.AddCountryGroupMember(ctx, groupIDInt, countryIDInt); err != nil {
+		return nil, err
+	}
+
+	group, err := r.store.GetCountryGroupByID(ctx, groupIDInt)
+	if err != nil {
+		return nil, err
+	}
+	return model.MapDatabaseCountryGroupToGQLModel(&group), nil
+}
+
+// RemoveCountryGroupMember is the resolver for the removeCountryGroupMember field.
+func (r *mutationResolver) RemoveCountryGroupMember(ctx context.Context, groupID string, countryID string) (*model.CountryGroup, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	groupIDInt, err := strconv.Atoi(groupID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid group ID: %w", err)
+	}
+	countryIDInt, err := strconv.Atoi(countryID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid country ID: %w", err)
+	}
+
+	if err := r.store.RemoveCountryGroupMember(ctx, groupIDInt, countryIDInt); err != nil {
+		return nil, err
+	}
+
+	group, err := r.store.GetCountryGroupByID(ctx, groupIDInt)
+	if err != nil {
+		return nil, err
+	}
+	return model.MapDatabaseCountryGroupToGQLModel(&group), nil
+}
+
 // Login is the resolver for the login field.
 func (r *queryResolver) Login(ctx context.Context, username string, password string) (*model.LoginResponse, error) {
-	d := database.NewDB(r.db)
-	user, err := d.GetUserByUsername(username)
+	user, err := r.store.GetUserByUsername(ctx, username)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
-	user.MonitoredCountries, err = d.GetUserMonitoredCountries(user.ID)
+	user.MonitoredCountries, err = r.store.GetUserMonitoredCountries(ctx, user.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -293,7 +546,7 @@ func (r *queryResolver) Login(ctx context.Context, username string, password str
 		return nil, errors.New("invalid username or password")
 	}
 
-	token, err := GenerateToken(username)
+	token, err := r.auth.GenerateToken(user)
 	if err != nil {
 		return nil, err
 	}
@@ -312,11 +565,10 @@ func (r *queryResolver) User(ctx context.Context, username *string, email *strin
 
 	var user database.User
 	var err error
-	d := database.NewDB(r.db)
 	if username != nil {
-		user, err = d.GetUserByUsername(*username)
+		user, err = r.store.GetUserByUsername(ctx, *username)
 	} else if email != nil {
-		user, err = d.GetUserByEmail(*email)
+		user, err = r.store.GetUserByEmail(ctx, *email)
 	}
 
 	if err != nil {
@@ -325,7 +577,7 @@ func (r *queryResolver) User(ctx context.Context, username *string, email *strin
 	user.Salt = ""
 	user.Password = ""
 
-	user.MonitoredCountries, err = d.GetUserMonitoredCountries(user.ID)
+	user.MonitoredCountries, err = r.store.GetUserMonitoredCountries(ctx, user.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -340,39 +592,31 @@ func (r *queryResolver) Country(ctx context.Context, id string) (*model.Country,
 		return nil, fmt.Errorf("invalid country ID: %w", err)
 	}
 
-	d := database.NewDB(r.db)
-	country, err := d.GetCountryByID(countryIDInt)
+	country, err := r.store.GetCountryByID(ctx, countryIDInt)
 	if err != nil {
 		return nil, err
 	}
 
-	return model.MapDatabaseCountryToGQLModel(&country, &pageSize), nil
+	return model.MapDatabaseCountryToGQLModel(&country, &r.pageSize), nil
 }
 
 // Countries is the resolver for the countries field.
-func (r *queryResolver) Countries(ctx context.Context, first *int, after *string, filter *model.CountryFilterInput) (*model.CountriesConnection, error) {
-	var codeEquals, nameContains *string
-	if filter != nil {
-		codeEquals = filter.CodeEquals
-		nameContains = filter.NameContains
-	}
-
-	d := database.NewDB(r.db)
-	countries, err := d.GetCountries(first, after, codeEquals, nameContains)
+func (r *queryResolver) Countries(ctx context.Context, first *int, after *string, filter *model.CountryFilterInput, orderBy *model.CountryOrder) (*model.CountriesConnection, error) {
+	countries, nextCursor, err := r.store.GetCountries(ctx, model.MapGQLCountryFilterToDatabase(first, after, filter, orderBy))
 	if err != nil {
 		return nil, err
 	}
 
 	//loop over each country and get the covid stats
 	for i := range countries {
-		covidStats, err := d.GetCovidStatistics(countries[i].ID, nil, nil)
+		covidStats, err := r.store.GetCovidStatistics(ctx, countries[i].ID)
 		if err != nil {
 			return nil, err
 		}
 		countries[i].CovidStatistics = covidStats
 	}
 
-	return model.CreateMapDatabaseCountriesToConnection(countries, &pageSize), nil
+	return model.CreateMapDatabaseCountriesToConnection(countries, nextCursor), nil
 }
 
 // MonitoredCountries is the resolver for the monitoredCountries field.
@@ -382,15 +626,14 @@ func (r *queryResolver) MonitoredCountries(ctx context.Context, userID string) (
 		return nil, fmt.Errorf("invalid user ID: %w", err)
 	}
 
-	d := database.NewDB(r.db)
-	countries, err := d.GetUserMonitoredCountries(userIDInt)
+	countries, err := r.store.GetUserMonitoredCountries(ctx, userIDInt)
 	if err != nil {
 		return nil, err
 	}
 
 	//loop over each country and get the covid stats
 	for i := range countries {
-		covidStats, err := d.GetCovidStatistics(countries[i].ID, nil, nil)
+		covidStats, err := r.store.GetCovidStatistics(ctx, countries[i].ID)
 		if err != nil {
 			return nil, err
 		}
@@ -401,36 +644,33 @@ func (r *queryResolver) MonitoredCountries(ctx context.Context, userID string) (
 }
 
 // CovidStatistics is the resolver for the covidStatistics field.
-func (r *queryResolver) CovidStatistics(ctx context.Context, countryID string, after *string, first *int) (*model.CovidStatisticConnection, error) {
+func (r *queryResolver) CovidStatistics(ctx context.Context, countryID string, after *string, first *int, filter *model.CovidStatisticFilterInput, orderBy *model.CovidStatisticOrder) (*model.CovidStatisticConnection, error) {
 	countryIDInt, err := strconv.Atoi(countryID)
 	if err != nil {
 		return nil, fmt.Errorf("invalid country ID %w", err)
 	}
 
-	d := database.NewDB(r.db)
-	covidStats, err := d.GetCovidStatistics(countryIDInt, first, after)
+	covidStats, nextCursor, err := r.store.ListCovidStatistics(ctx, model.MapGQLCovidStatisticFilterToDatabase(countryIDInt, first, after, filter, orderBy))
 	if err != nil {
 		return nil, err
 	}
 
-	return model.CreateMapDatabaseCovidStatsToConnection(covidStats, pageSize), nil
+	return model.CreateMapDatabaseCovidStatsToConnection(covidStats, nextCursor), nil
 }
 
 // CovidStatistic is the resolver for the covidStatistic field.
 func (r *queryResolver) CovidStatistic(ctx context.Context, id string) (*model.CovidStatistic, error) {
-
 	IDInt, err := strconv.Atoi(id)
 	if err != nil {
 		return nil, fmt.Errorf("invalid covid statistic ID: %w", err)
 	}
-	d := database.NewDB(r.db)
-	covidStat, err := d.GetCovidStatistic(IDInt)
+	covidStat, err := r.store.GetCovidStatistic(ctx, IDInt)
 	if err != nil {
 		return nil, err
 	}
 
 	//get the country for the covid stat
-	country, err := d.GetCountryByID(covidStat.CountryID)
+	country, err := r.store.GetCountryByID(ctx, covidStat.CountryID)
 	if err != nil {
 		return nil, err
 	}
@@ -446,8 +686,7 @@ func (r *queryResolver) DeathPercentage(ctx context.Context, countryID string) (
 		return 0, fmt.Errorf("invalid country ID: %w", err)
 	}
 
-	d := database.NewDB(r.db)
-	return d.GetDeathPercentage(countryIDInt)
+	return r.store.GetDeathPercentage(ctx, countryIDInt)
 }
 
 // TopCountriesByCaseTypeForUser is the resolver for the topCountriesByCaseTypeForUser field.
@@ -457,15 +696,14 @@ func (r *queryResolver) TopCountriesByCaseTypeForUser(ctx context.Context, caseT
 		return nil, fmt.Errorf("invalid user ID: %w", err)
 	}
 
-	d := database.NewDB(r.db)
-	countries, err := d.GetTopCountriesByCaseTypeForUser(userIDInt, caseType.String(), limit)
+	countries, err := r.store.GetTopCountriesByCaseTypeForUser(ctx, userIDInt, caseType.String(), limit)
 	if err != nil {
 		return nil, err
 	}
 
 	//loop over each country and get the covid stats
 	for i := range countries {
-		covidStats, err := d.GetCovidStatistics(countries[i].ID, nil, nil)
+		covidStats, err := r.store.GetCovidStatistics(ctx, countries[i].ID)
 		if err != nil {
 			return nil, err
 		}
@@ -475,6 +713,119 @@ func (r *queryResolver) TopCountriesByCaseTypeForUser(ctx context.Context, caseT
 	return model.MapDatabaseCountriesToGQLModels(countries), nil
 }
 
+// DataQualityReport is the resolver for the dataQualityReport field.
+func (r *queryResolver) DataQualityReport(ctx context.Context, countryID string) (*model.DataQualityReport, error) {
+	countryIDInt, err := strconv.Atoi(countryID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid country ID: %w", err)
+	}
+
+	report, err := quality.BuildReport(ctx, r.store, countryIDInt)
+	if err != nil {
+		return nil, err
+	}
+
+	return model.MapQualityReportToGQLModel(&report), nil
+}
+
+// Rankings is the resolver for the rankings field.
+func (r *queryResolver) Rankings(ctx context.Context, metric *model.RankingMetric, date *string, limit *int, offset *int, groupID *string, changeDays *int) (*model.Ranking, error) {
+	opts := rankings.Options{
+		Metric:     model.MapGQLRankingMetricToSeries(metric),
+		Date:       date,
+		Limit:      rankings.DefaultLimit,
+		ChangeDays: rankings.DefaultChangeDays,
+	}
+	if limit != nil {
+		if *limit < 1 {
+			return nil, fmt.Errorf("limit must be between 1 and %d", rankings.MaxLimit)
+		}
+		opts.Limit = *limit
+	}
+	if offset != nil {
+		opts.Offset = *offset
+	}
+	if changeDays != nil {
+		opts.ChangeDays = *changeDays
+	}
+	if groupID != nil {
+		groupIDInt, err := strconv.Atoi(*groupID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid group ID: %w", err)
+		}
+		opts.GroupID = &groupIDInt
+	}
+
+	ranking, err := rankings.Rank(ctx, r.store, r.rt, opts)
+	if err != nil {
+		return nil, err
+	}
+	return model.MapRankingToGQLModel(&ranking), nil
+}
+
+// CountryGroups is the resolver for the countryGroups field.
+func (r *queryResolver) CountryGroups(ctx context.Context) ([]*model.CountryGroup, error) {
+	countryGroups, err := r.store.GetCountryGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	gqlGroups := []*model.CountryGroup{}
+	for i := range countryGroups {
+		gqlGroups = append(gqlGroups, model.MapDatabaseCountryGroupToGQLModel(&countryGroups[i]))
+	}
+	return gqlGroups, nil
+}
+
+// CountryGroup is the resolver for the countryGroup field.
+func (r *queryResolver) CountryGroup(ctx context.Context, id string) (*model.CountryGroup, error) {
+	group, err := countryGroup(ctx, r.store, id)
+	if err != nil {
+		return nil, err
+	}
+	return model.MapDatabaseCountryGroupToGQLModel(&group), nil
+}
+
+// Forecast is the resolver for the forecast field.
+func (r *queryResolver) Forecast(ctx context.Context, countryID string, metric *model.Metric, horizonDays *int, model *model.ForecastModel) (*model.Forecast, error) {
+	// the model argument hides the model package here:
+	return forecast(ctx, r.store, countryID, metric, horizonDays, model)
+}
+
+// ReproductionNumber is the resolver for the reproductionNumber field.
+func (r *queryResolver) ReproductionNumber(ctx context.Context, countryID string, from *string, to *string, serialIntervalMean *float64, serialIntervalSd *float64) (*model.ReproductionNumber, error) {
+	countryIDInt, err := strconv.Atoi(countryID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid country ID: %w", err)
+	}
+
+	si := r.rt.SerialInterval
+	if serialIntervalMean != nil {
+		si.Mean = *serialIntervalMean
+	}
+	if serialIntervalSd != nil {
+		si.SD = *serialIntervalSd
+	}
+
+	rt, err := r.rt.CountryReproductionNumber(ctx, r.store, countryIDInt, from, to, si)
+	if err != nil {
+		return nil, err
+	}
+	return model.MapAnalyticsReproductionNumberToGQLModel(&rt), nil
+}
+
+// SystemStatus is the resolver for the systemStatus field.
+func (r *queryResolver) SystemStatus(ctx context.Context) (*model.SystemStatus, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	systemStatus, err := r.status.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return model.MapStatusToGQLModel(&systemStatus), nil
+}
+
 // CovidStatisticUpdated is the resolver for the covidStatisticUpdated field.
 func (r *subscriptionResolver) CovidStatisticUpdated(ctx context.Context, countryIDs []string) (<-chan []*model.CovidStatistic, error) {
 	var countryIDsInt []int
@@ -487,11 +838,23 @@ func (r *subscriptionResolver) CovidStatisticUpdated(ctx context.Context, countr
 	}
 
 	updatedCovidStats := make(chan []*model.CovidStatistic)
-	d := database.NewDB(r.db)
-	go updateCovidStatsRoutine(d, countryIDsInt, updatedCovidStats)
+	done := r.status.TrackSubscription()
+	go func() {
+		defer done()
+		updateCovidStatsRoutine(ctx, r.store, countryIDsInt, updatedCovidStats)
+	}()
 	return updatedCovidStats, nil
 }
 
+// Country returns CountryResolver implementation.
+func (r *Resolver) Country() CountryResolver { return &countryResolver{r} }
+
+// CountryGroup returns CountryGroupResolver implementation.
+func (r *Resolver) CountryGroup() CountryGroupResolver { return &countryGroupResolver{r} }
+
+// CovidStatistic returns CovidStatisticResolver implementation.
+func (r *Resolver) CovidStatistic() CovidStatisticResolver { return &covidStatisticResolver{r} }
+
 // Mutation returns MutationResolver implementation.
 func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
 
@@ -501,6 +864,9 @@ func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
 // Subscription returns SubscriptionResolver implementation.
 func (r *Resolver) Subscription() SubscriptionResolver { return &subscriptionResolver{r} }
 
+type countryResolver struct{ *Resolver }
+type countryGroupResolver struct{ *Resolver }
+type covidStatisticResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
 type subscriptionResolver struct{ *Resolver }
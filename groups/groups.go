@@ -0,0 +1,125 @@
+package groups
+
+import (
+	"context"
+	"covid/database"
+	"sort"
+)
+
+// Statistic is the sum of the statistics of the members of a group on one day.
+type Statistic struct {
+	Date      string
+	Confirmed int
+	Recovered int
+	Deaths    int
+	// ReportingMembers is the number of members that reported on this day or earlier.
+	ReportingMembers int
+}
+
+// Statistics sums the statistics of the members of a group for every day any of them reported, between
+// from and to which are inclusive and may be nil. Members do not all report on the same days: a member
+// counts with its last report until its next one, and is left out of the days before its first report.
+func Statistics(ctx context.Context, d database.Store, group database.CountryGroup, from *string, to *string) ([]Statistic, error) {
+	// the days before from are read to know the last report of every member on the first day:
+	histories, err := memberHistories(ctx, d, group, to)
+	if err != nil {
+		return nil, err
+	}
+
+	dates := map[string]bool{}
+	for _, history := range histories {
+		for _, covidStat := range history {
+			dates[covidStat.Date] = true
+		}
+	}
+	sortedDates := make([]string, 0, len(dates))
+	for date := range dates {
+		sortedDates = append(sortedDates, date)
+	}
+	sort.Strings(sortedDates)
+
+	statistics := []Statistic{}
+	// next[i] is the index of the first report of the i-th member that is not counted yet:
+	next := make([]int, len(histories))
+	for _, date := range sortedDates {
+		statistic := Statistic{Date: date}
+		for i, history := range histories {
+			for next[i] < len(history) && history[next[i]].Date <= date {
+				next[i]++
+			}
+			if next[i] == 0 {
+				continue
+			}
+			last := history[next[i]-1]
+			statistic.Confirmed += last.Confirmed
+			statistic.Recovered += last.Recovered
+			statistic.Deaths += last.Deaths
+			statistic.ReportingMembers++
+		}
+		if from != nil && date < *from {
+			continue
+		}
+		statistics = append(statistics, statistic)
+	}
+	return statistics, nil
+}
+
+// Latest returns the totals of the last day any member reported, false when no member reported.
+func Latest(ctx context.Context, d database.Store, group database.CountryGroup) (Statistic, bool, error) {
+	// without members GetLatestCovidStatistics would read every country:
+	if len(group.Members) == 0 {
+		return Statistic{}, false, nil
+	}
+	countryIDs := make([]int, len(group.Members))
+	for i, member := range group.Members {
+		countryIDs[i] = member.ID
+	}
+
+	latest, err := d.GetLatestCovidStatistics(ctx, nil, countryIDs)
+	if err != nil || len(latest) == 0 {
+		return Statistic{}, false, err
+	}
+
+	statistic := Statistic{ReportingMembers: len(latest)}
+	for _, memberLatest := range latest {
+		if memberLatest.Latest.Date > statistic.Date {
+			statistic.Date = memberLatest.Latest.Date
+		}
+		statistic.Confirmed += memberLatest.Latest.Confirmed
+		statistic.Recovered += memberLatest.Latest.Recovered
+		statistic.Deaths += memberLatest.Latest.Deaths
+	}
+	return statistic, true, nil
+}
+
+// memberHistories returns the statistics of every member of a group up to to, in the order of group.Members
+// and sorted by date. When a member reported a day twice, the last report is kept.
+func memberHistories(ctx context.Context, d database.Store, group database.CountryGroup, to *string) ([][]database.CovidStatistic, error) {
+	histories := make([][]database.CovidStatistic, len(group.Members))
+	// without members StreamCovidStatistics would read every country:
+	if len(group.Members) == 0 {
+		return histories, nil
+	}
+
+	memberIndexes := map[int]int{}
+	countryIDs := make([]int, len(group.Members))
+	for i, member := range group.Members {
+		memberIndexes[member.ID] = i
+		countryIDs[i] = member.ID
+	}
+
+	err := d.StreamCovidStatistics(ctx, countryIDs, nil, to, func(covidStat database.CovidStatistic) error {
+		i := memberIndexes[covidStat.CountryID]
+		history := histories[i]
+		if len(history) > 0 && history[len(history)-1].Date == covidStat.Date {
+			history[len(history)-1] = covidStat
+			return nil
+		}
+		histories[i] = append(history, covidStat)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return histories, nil
+}
@@ -0,0 +1,158 @@
+package groups
+
+import (
+	"context"
+	"covid/database"
+	"slices"
+	"testing"
+)
+
+// report is a statistic of a member, its recoveries are half its cases and its deaths a tenth.
+type report struct {
+	date      string
+	confirmed int
+}
+
+// day is a statistic of the group, with the same recoveries and deaths.
+type day struct {
+	date             string
+	confirmed        int
+	reportingMembers int
+}
+
+func TestStatistics(t *testing.T) {
+	tests := []struct {
+		name string
+		// reports of the members, in the order they are added:
+		members  [][]report
+		from, to string
+		want     []day
+	}{
+		{"no member", nil, "", "", []day{}},
+		{"no report", [][]report{{}, {}}, "", "", []day{}},
+		{"same days", [][]report{
+			{{"2021-03-01", 10}, {"2021-03-02", 20}},
+			{{"2021-03-01", 100}, {"2021-03-02", 200}},
+		}, "", "", []day{{"2021-03-01", 110, 2}, {"2021-03-02", 220, 2}}},
+		// a member counts with its last report until its next one:
+		{"staggered", [][]report{
+			{{"2021-03-01", 10}, {"2021-03-03", 30}},
+			{{"2021-03-02", 100}, {"2021-03-04", 200}},
+		}, "", "", []day{{"2021-03-01", 10, 1}, {"2021-03-02", 110, 2}, {"2021-03-03", 130, 2}, {"2021-03-04", 230, 2}}},
+		{"gap", [][]report{
+			{{"2021-03-01", 10}, {"2021-03-05", 50}},
+			{{"2021-03-01", 100}, {"2021-03-02", 200}, {"2021-03-03", 300}},
+		}, "", "", []day{{"2021-03-01", 110, 2}, {"2021-03-02", 210, 2}, {"2021-03-03", 310, 2}, {"2021-03-05", 350, 2}}},
+		// a member is left out of the days before its first report:
+		{"late member", [][]report{
+			{{"2021-03-01", 10}, {"2021-03-02", 20}, {"2021-03-03", 30}},
+			{{"2021-03-03", 100}},
+			{},
+		}, "", "", []day{{"2021-03-01", 10, 1}, {"2021-03-02", 20, 1}, {"2021-03-03", 130, 2}}},
+		// the first day counts the reports of the members before from:
+		{"from between reports", [][]report{
+			{{"2021-03-01", 10}, {"2021-03-03", 30}},
+			{{"2021-03-01", 100}, {"2021-03-04", 200}},
+		}, "2021-03-02", "", []day{{"2021-03-03", 130, 2}, {"2021-03-04", 230, 2}}},
+		{"from on a report", [][]report{
+			{{"2021-03-01", 10}, {"2021-03-03", 30}},
+			{{"2021-03-02", 100}},
+		}, "2021-03-02", "", []day{{"2021-03-02", 110, 2}, {"2021-03-03", 130, 2}}},
+		{"from after every report", [][]report{
+			{{"2021-03-01", 10}},
+		}, "2021-03-02", "", []day{}},
+		{"to", [][]report{
+			{{"2021-03-01", 10}, {"2021-03-03", 30}},
+			{{"2021-03-02", 100}, {"2021-03-04", 200}},
+		}, "", "2021-03-03", []day{{"2021-03-01", 10, 1}, {"2021-03-02", 110, 2}, {"2021-03-03", 130, 2}}},
+		{"from and to", [][]report{
+			{{"2021-03-01", 10}, {"2021-03-03", 30}, {"2021-03-05", 50}},
+			{{"2021-03-02", 100}, {"2021-03-04", 200}},
+		}, "2021-03-03", "2021-03-04", []day{{"2021-03-03", 130, 2}, {"2021-03-04", 230, 2}}},
+		// the last report of a day added is kept:
+		{"same day reported twice", [][]report{
+			{{"2021-03-01", 10}, {"2021-03-02", 20}, {"2021-03-02", 40}},
+			{{"2021-03-01", 100}},
+		}, "", "", []day{{"2021-03-01", 110, 2}, {"2021-03-02", 140, 2}}},
+		{"first day reported twice", [][]report{
+			{{"2021-03-01", 10}, {"2021-03-01", 30}},
+			{{"2021-03-02", 100}},
+		}, "", "", []day{{"2021-03-01", 30, 1}, {"2021-03-02", 130, 2}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			d := database.NewMemoryStore()
+			group := database.CountryGroup{Name: "group"}
+			// a country outside of the group does not count:
+			outsider, _, err := d.CreateCountry(ctx, "Outsider", "OU")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := d.AddCovidStatistic(ctx, outsider.ID, "2021-03-01", 1000, 500, 100); err != nil {
+				t.Fatal(err)
+			}
+			for i, reports := range test.members {
+				country, _, err := d.CreateCountry(ctx, string(rune('A'+i))+" country", string(rune('A'+i))+"A")
+				if err != nil {
+					t.Fatal(err)
+				}
+				group.Members = append(group.Members, country)
+				for _, report := range reports {
+					if _, err := d.AddCovidStatistic(ctx, country.ID, report.date, report.confirmed, report.confirmed/2, report.confirmed/10); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			var from, to *string
+			if test.from != "" {
+				from = &test.from
+			}
+			if test.to != "" {
+				to = &test.to
+			}
+
+			statistics, err := Statistics(ctx, d, group, from, to)
+			if err != nil {
+				t.Fatalf("Statistics: %v", err)
+			}
+			want := []Statistic{}
+			for _, day := range test.want {
+				want = append(want, Statistic{Date: day.date, Confirmed: day.confirmed, Recovered: day.confirmed / 2, Deaths: day.confirmed / 10, ReportingMembers: day.reportingMembers})
+			}
+			if !slices.Equal(statistics, want) {
+				t.Errorf("got %+v\nwant %+v", statistics, want)
+			}
+		})
+	}
+}
+
+func TestLatest(t *testing.T) {
+	ctx := context.Background()
+	d := database.NewMemoryStore()
+	group := database.CountryGroup{Name: "group"}
+	if _, ok, err := Latest(ctx, d, group); err != nil || ok {
+		t.Errorf("without members: %t, %v, want no statistic", ok, err)
+	}
+
+	for i, reports := range [][]report{{{"2021-03-01", 10}, {"2021-03-03", 30}}, {{"2021-03-02", 100}}, {}} {
+		country, _, err := d.CreateCountry(ctx, string(rune('A'+i))+" country", string(rune('A'+i))+"A")
+		if err != nil {
+			t.Fatal(err)
+		}
+		group.Members = append(group.Members, country)
+		for _, report := range reports {
+			if _, err := d.AddCovidStatistic(ctx, country.ID, report.date, report.confirmed, report.confirmed/2, report.confirmed/10); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	latest, ok, err := Latest(ctx, d, group)
+	if err != nil || !ok {
+		t.Fatalf("Latest: %t, %v", ok, err)
+	}
+	if want := (Statistic{Date: "2021-03-03", Confirmed: 130, Recovered: 65, Deaths: 13, ReportingMembers: 2}); latest != want {
+		t.Errorf("got %+v, want %+v", latest, want)
+	}
+}
@@ -0,0 +1,135 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// GraphQLOperations adds the names of the GraphQL operations to the logs of their requests and resolvers, and
+// logs every operation with its variables at the debug level. It is a gqlgen extension.
+type GraphQLOperations struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationInterceptor
+} = GraphQLOperations{}
+
+func (GraphQLOperations) ExtensionName() string {
+	return "Logging"
+}
+
+func (GraphQLOperations) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (GraphQLOperations) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	oc := graphql.GetOperationContext(ctx)
+	name := oc.Operation.Name
+	if name == "" {
+		name = "anonymous"
+	}
+	addOperation(ctx, name)
+	ctx = WithOperation(ctx, name)
+
+	if slog.Default().Enabled(ctx, slog.LevelDebug) {
+		// variables are named by the client, they are redacted by the arguments they are given to as well:
+		arguments := map[string]string{}
+		variableArguments(oc.Operation.SelectionSet, arguments)
+		slog.LogAttrs(ctx, slog.LevelDebug, "graphql operation",
+			slog.String("type", string(oc.Operation.Operation)),
+			slog.Attr{Key: "variables", Value: variablesValue(oc.Variables, arguments)},
+		)
+	}
+	return next(ctx)
+}
+
+// variableArguments maps the variables of a selection set to the arguments, or the fields of input objects,
+// they are given to.
+func variableArguments(selections ast.SelectionSet, arguments map[string]string) {
+	var addValue func(argument string, value *ast.Value)
+	addValue = func(argument string, value *ast.Value) {
+		if value == nil {
+			return
+		}
+		if value.Kind == ast.Variable && !sensitive(arguments[value.Raw]) {
+			arguments[value.Raw] = argument
+		}
+		for _, child := range value.Children {
+			// the items of lists have no name, they go to the argument of the list:
+			if child.Name != "" {
+				addValue(child.Name, child.Value)
+			} else {
+				addValue(argument, child.Value)
+			}
+		}
+	}
+
+	for _, selection := range selections {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			for _, argument := range selection.Arguments {
+				addValue(argument.Name, argument.Value)
+			}
+			variableArguments(selection.SelectionSet, arguments)
+		case *ast.InlineFragment:
+			variableArguments(selection.SelectionSet, arguments)
+		case *ast.FragmentSpread:
+			if selection.Definition != nil {
+				variableArguments(selection.Definition.SelectionSet, arguments)
+			}
+		}
+	}
+}
+
+// variablesValue turns variables into a group, for the sensitive ones such as passwords to be redacted wherever
+// they are nested.
+func variablesValue(values map[string]any, arguments map[string]string) slog.Value {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]slog.Attr, 0, len(keys))
+	for _, key := range keys {
+		switch value := values[key].(type) {
+		case map[string]any:
+			if sensitive(arguments[key]) {
+				attrs = append(attrs, slog.String(key, Redacted))
+				continue
+			}
+			attrs = append(attrs, slog.Attr{Key: key, Value: variablesValue(value, nil)})
+		default:
+			// lists are logged as a whole, with the sensitive values of their objects:
+			if sensitive(arguments[key]) || hasSensitiveKey(value) {
+				attrs = append(attrs, slog.String(key, Redacted))
+				continue
+			}
+			attrs = append(attrs, slog.Any(key, value))
+		}
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// hasSensitiveKey tells whether a value holds an object with a sensitive key.
+func hasSensitiveKey(value any) bool {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, v := range value {
+			if sensitive(key) || hasSensitiveKey(v) {
+				return true
+			}
+		}
+	case []any:
+		for _, v := range value {
+			if hasSensitiveKey(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
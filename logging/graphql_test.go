@@ -0,0 +1,122 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"covid/graph"
+	"covid/logging"
+	"log/slog"
+	"strings"
+	"testing"
+
+	gqlgen "github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// testSchema has the input objects and lists the schema of the server has no sensitive fields in.
+var testSchema = gqlparser.MustLoadSchema(&ast.Source{Name: "test.graphqls", Input: `
+	input Credentials { username: String!, password: String! }
+	type Query { ok: Boolean }
+	type Mutation {
+		signUp(credentials: Credentials!): Boolean
+		signUpAll(credentials: [Credentials!]!): Boolean
+		revoke(tokens: [String!]!, reason: String): Boolean
+	}
+`})
+
+// logOperation logs an operation the way the GraphQL server does, and returns the logs in both formats.
+func logOperation(t *testing.T, schema *ast.Schema, query string, variables map[string]any) []string {
+	t.Helper()
+	doc, errs := gqlparser.LoadQuery(schema, query)
+	if errs != nil {
+		t.Fatal(errs)
+	}
+
+	defer slog.SetDefault(slog.Default())
+	var logs []string
+	for _, format := range []string{logging.FormatText, logging.FormatJSON} {
+		var out bytes.Buffer
+		logger, err := logging.New(&out, slog.LevelDebug, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slog.SetDefault(logger)
+
+		ctx := gqlgen.WithOperationContext(context.Background(), &gqlgen.OperationContext{Operation: doc.Operations[0], Variables: variables})
+		logging.GraphQLOperations{}.InterceptOperation(ctx, func(ctx context.Context) gqlgen.ResponseHandler { return nil })
+		logs = append(logs, out.String())
+	}
+	return logs
+}
+
+func TestGraphQLVariablesRedacted(t *testing.T) {
+	schema := graph.NewExecutableSchema(graph.Config{}).Schema()
+	tests := []struct {
+		name      string
+		schema    *ast.Schema
+		query     string
+		variables map[string]any
+		// secrets must not be logged, the other values must:
+		secrets []string
+		logged  []string
+	}{
+		{"register", schema, `mutation Register($username: String!, $email: String!, $password: String!) {
+			register(username: $username, email: $email, password: $password) { token } }`,
+			map[string]any{"username": "alice", "email": "alice@example.com", "password": "Passw0rd!"},
+			[]string{"Passw0rd!"}, []string{"alice@example.com"}},
+		// variables named by the client are redacted by the arguments they are given to:
+		{"register with other names", schema, `mutation ($u: String!, $e: String!, $p: String!) {
+			register(username: $u, email: $e, password: $p) { token } }`,
+			map[string]any{"u": "alice", "e": "alice@example.com", "p": "Passw0rd!"},
+			[]string{"Passw0rd!"}, []string{"alice@example.com"}},
+		{"login", schema, `query Login($name: String!, $secretPhrase: String!) {
+			login(username: $name, password: $secretPhrase) { token user { id } } }`,
+			map[string]any{"name": "alice", "secretPhrase": "Passw0rd!"},
+			[]string{"Passw0rd!"}, []string{"alice"}},
+		{"reset password", schema, `mutation Reset($t: String!, $new: String!) { resetPassword(token: $t, password: $new) }`,
+			map[string]any{"t": "5f2b9c0e1d", "new": "N3wPassw0rd!"},
+			[]string{"5f2b9c0e1d", "N3wPassw0rd!"}, nil},
+		{"verify email", schema, `mutation ($code: String!) { verifyEmail(token: $code) }`,
+			map[string]any{"code": "a1b2c3d4e5"},
+			[]string{"a1b2c3d4e5"}, nil},
+		// a variable given to two arguments is redacted when one of them is sensitive:
+		{"variable given twice", schema, `mutation ($x: String!) { a: resetPassword(token: $x, password: "P4ss!") b: requestPasswordReset(email: $x) }`,
+			map[string]any{"x": "5f2b9c0e1d"},
+			[]string{"5f2b9c0e1d"}, nil},
+		{"input object", testSchema, `mutation ($c: Credentials!) { signUp(credentials: $c) }`,
+			map[string]any{"c": map[string]any{"username": "alice", "password": "Passw0rd!"}},
+			[]string{"Passw0rd!"}, []string{"alice"}},
+		{"field of an input object", testSchema, `mutation ($who: String!, $pw: String!) { signUp(credentials: {username: $who, password: $pw}) }`,
+			map[string]any{"who": "alice", "pw": "Passw0rd!"},
+			[]string{"Passw0rd!"}, []string{"alice"}},
+		{"list of input objects", testSchema, `mutation ($all: [Credentials!]!) { signUpAll(credentials: $all) }`,
+			map[string]any{"all": []any{map[string]any{"username": "alice", "password": "Passw0rd!"}, map[string]any{"username": "bob", "password": "S3cret!!"}}},
+			[]string{"Passw0rd!", "S3cret!!"}, nil},
+		{"list given to a sensitive argument", testSchema, `mutation ($list: [String!]!, $why: String) { revoke(tokens: $list, reason: $why) }`,
+			map[string]any{"list": []any{"5f2b9c0e1d", "a1b2c3d4e5"}, "why": "leaked"},
+			[]string{"5f2b9c0e1d", "a1b2c3d4e5"}, []string{"leaked"}},
+		{"items of a sensitive list", testSchema, `mutation ($a: String!, $b: String!) { revoke(tokens: [$a, $b]) }`,
+			map[string]any{"a": "5f2b9c0e1d", "b": "a1b2c3d4e5"},
+			[]string{"5f2b9c0e1d", "a1b2c3d4e5"}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, logs := range logOperation(t, test.schema, test.query, test.variables) {
+				if !strings.Contains(logs, "graphql operation") {
+					t.Fatalf("the operation was not logged: %s", logs)
+				}
+				for _, secret := range test.secrets {
+					if strings.Contains(logs, secret) {
+						t.Errorf("%q was logged: %s", secret, logs)
+					}
+				}
+				for _, value := range test.logged {
+					if !strings.Contains(logs, value) {
+						t.Errorf("%q was not logged: %s", value, logs)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// RequestIDHeader carries the ID of a request, it is read from the requests that have one, such as those
+// forwarded by a proxy, and sent back in every response.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the IDs sent by clients, longer ones are replaced.
+const maxRequestIDLength = 64
+
+// requestLog collects what the handlers learn about a request, for the line logged once it is served.
+type requestLog struct {
+	mu         sync.Mutex
+	operations []string
+}
+
+type requestLogKey struct{}
+
+// addOperation records the name of a GraphQL operation run by the request of ctx.
+func addOperation(ctx context.Context, name string) {
+	log, ok := ctx.Value(requestLogKey{}).(*requestLog)
+	if !ok {
+		return
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	for _, operation := range log.operations {
+		if operation == name {
+			return
+		}
+	}
+	log.operations = append(log.operations, name)
+}
+
+// Middleware gives every request an ID and logs it once served, with its route, status, size and duration and
+// the names of its GraphQL operations. It must be used on the root router for the routes to be known.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		log := &requestLog{}
+		ctx := context.WithValue(WithRequestID(r.Context(), id), requestLogKey{}, log)
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		// the query string is left out, it can hold tokens:
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int("bytes", ww.BytesWritten()),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote_addr", r.RemoteAddr),
+		}
+		if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+			attrs = append(attrs, slog.String("route", rctx.RoutePattern()))
+		}
+		log.mu.Lock()
+		if len(log.operations) > 0 {
+			attrs = append(attrs, slog.String("graphql_operations", strings.Join(log.operations, ",")))
+		}
+		log.mu.Unlock()
+		slog.LogAttrs(ctx, level, "request", attrs...)
+	})
+}
+
+// validRequestID accepts the IDs made of letters, digits and a few separators, so that clients cannot forge
+// log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.:/", c)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	for _, format := range []string{FormatText, FormatJSON} {
+		t.Run(format, func(t *testing.T) {
+			var out bytes.Buffer
+			logger, err := New(&out, slog.LevelDebug, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			logger.Info("login",
+				slog.String("username", "alice"),
+				slog.String("password", "hunter2"),
+				slog.String("Authorization", "Bearer eyJhbGciOi"),
+				slog.String("resetToken", "c0ffee"),
+				slog.Group("user", slog.String("salt", "s4lt"), slog.Group("session", slog.String("cookie", "sid=42"))),
+				slog.Any("jwt_secret", []byte("1234")),
+			)
+
+			for _, secret := range []string{"hunter2", "eyJhbGciOi", "c0ffee", "s4lt", "sid=42", "1234"} {
+				if strings.Contains(out.String(), secret) {
+					t.Errorf("%q was logged: %s", secret, out.String())
+				}
+			}
+			if !strings.Contains(out.String(), "alice") || strings.Count(out.String(), Redacted) != 6 {
+				t.Errorf("want the username and 6 redacted values: %s", out.String())
+			}
+		})
+	}
+}
+
+func TestContextAttributes(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := New(&out, slog.LevelInfo, FormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithOperation(WithRequestID(context.Background(), "abc123"), "Login")
+	logger.With("component", "test").InfoContext(ctx, "hello")
+	for _, want := range []string{"request_id=abc123", "operation=Login", "component=test"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("%s missing from %s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Package mail sends the plain text emails of the account flows, such as the password resets, through an SMTP
+// server.
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender sends emails, SMTPSender implements it.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+type SMTPOptions struct {
+	Host string
+	Port int
+	// Username and Password authenticate with PLAIN, nothing is authenticated when Username is empty.
+	Username string
+	Password string
+	// From is the address the emails are sent from.
+	From string
+}
+
+// SMTPSender sends every email over a connection of its own, upgraded with STARTTLS when the server offers it.
+type SMTPSender struct {
+	opts SMTPOptions
+}
+
+func NewSMTPSender(opts SMTPOptions) *SMTPSender {
+	return &SMTPSender{opts: opts}
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	data, err := s.format(msg)
+	if err != nil {
+		return err
+	}
+
+	address := net.JoinHostPort(s.opts.Host, strconv.Itoa(s.opts.Port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("could not connect to SMTP server: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.opts.Host)
+	if err != nil {
+		return fmt.Errorf("could not greet SMTP server: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.opts.Host}); err != nil {
+			return fmt.Errorf("could not start TLS with SMTP server: %w", err)
+		}
+	}
+	if s.opts.Username != "" {
+		// PlainAuth refuses to send the password unencrypted, unless to localhost:
+		if err := client.Auth(smtp.PlainAuth("", s.opts.Username, s.opts.Password, s.opts.Host)); err != nil {
+			return fmt.Errorf("could not authenticate with SMTP server: %w", err)
+		}
+	}
+
+	if err := client.Mail(s.opts.From); err != nil {
+		return fmt.Errorf("SMTP server refused the sender: %w", err)
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("SMTP server refused the recipient: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("could not send email: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("could not send email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("could not send email: %w", err)
+	}
+	return client.Quit()
+}
+
+// format writes the headers and the body of a message, with CRLF line endings.
+func (s *SMTPSender) format(msg Message) ([]byte, error) {
+	// a line break would add headers of the caller's choosing:
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return nil, errors.New("the recipient and the subject of an email must fit on a line")
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := s.opts.From[strings.LastIndex(s.opts.From, "@")+1:]
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.opts.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String()), nil
+}
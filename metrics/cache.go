@@ -0,0 +1,31 @@
+package metrics
+
+import "covid/cache"
+
+// CacheMetrics count the lookups of the cache of the database reads, by query.
+type CacheMetrics struct {
+	hits   *Counter
+	misses *Counter
+}
+
+func NewCacheMetrics(r *Registry, c *cache.Cache) *CacheMetrics {
+	m := &CacheMetrics{
+		hits:   r.NewCounter("covid_cache_hits_total", "Reads answered from the cache, by query.", "query"),
+		misses: r.NewCounter("covid_cache_misses_total", "Reads that missed the cache and ran on the database, by query.", "query"),
+	}
+	r.NewGaugeFunc("covid_cache_entries", "Results held in the memory of the cache.", func(set func(v float64, labelValues ...string)) {
+		set(float64(c.Len()))
+	})
+	return m
+}
+
+// Hook returns the cache.Hook counting the lookups.
+func (m *CacheMetrics) Hook() cache.Hook {
+	return func(query string, hit bool) {
+		if hit {
+			m.hits.Inc(query)
+			return
+		}
+		m.misses.Inc(query)
+	}
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"covid/database"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// CovidHandler serves the latest statistics of every country as gauges, for dashboards to chart the
+// epidemic rather than the service. The gauges are read from the latest statistics kept by the store on
+// every scrape, so they are never older than the data, and have a series per country labelled with its
+// name, code and continent.
+func CovidHandler(store database.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		countries, _, err := store.GetCountries(r.Context(), database.CountryFilter{})
+		if err != nil {
+			slog.ErrorContext(r.Context(), "could not export covid statistics", "error", err)
+			http.Error(w, "could not export covid statistics", http.StatusInternalServerError)
+			return
+		}
+		latestStatistics, err := store.ListCountryLatestStatistics(r.Context())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "could not export covid statistics", "error", err)
+			http.Error(w, "could not export covid statistics", http.StatusInternalServerError)
+			return
+		}
+
+		registry := NewRegistry()
+		labels := []string{"country", "code", "continent"}
+		confirmed := registry.NewGauge("covid_confirmed", "Confirmed cases of the latest statistic of the country.", labels...)
+		recovered := registry.NewGauge("covid_recovered", "Recoveries of the latest statistic of the country.", labels...)
+		deaths := registry.NewGauge("covid_deaths", "Deaths of the latest statistic of the country.", labels...)
+		confirmed7Days := registry.NewGauge("covid_confirmed_7d_average",
+			"Daily confirmed cases averaged over the 7 days up to the latest statistic.", labels...)
+		recovered7Days := registry.NewGauge("covid_recovered_7d_average",
+			"Daily recoveries averaged over the 7 days up to the latest statistic.", labels...)
+		deaths7Days := registry.NewGauge("covid_deaths_7d_average",
+			"Daily deaths averaged over the 7 days up to the latest statistic.", labels...)
+		date := registry.NewGauge("covid_latest_statistic_timestamp_seconds",
+			"Day of the latest statistic of the country, as a Unix time.", labels...)
+
+		byID := make(map[int]database.Country, len(countries))
+		for _, country := range countries {
+			byID[country.ID] = country
+		}
+		for _, latest := range latestStatistics {
+			country, ok := byID[latest.CountryID]
+			if !ok {
+				continue
+			}
+			continent, _ := database.ContinentOf(country.Code)
+			labelValues := []string{country.Name, country.Code, continent}
+
+			confirmed.Set(float64(latest.Confirmed), labelValues...)
+			recovered.Set(float64(latest.Recovered), labelValues...)
+			deaths.Set(float64(latest.Deaths), labelValues...)
+			// countries without a statistic 7 days before the latest have no average rather than a wrong one:
+			if change := latest.Change7Days; change != nil {
+				confirmed7Days.Set(float64(change.Confirmed)/7, labelValues...)
+				recovered7Days.Set(float64(change.Recovered)/7, labelValues...)
+				deaths7Days.Set(float64(change.Deaths)/7, labelValues...)
+			}
+			if day, err := time.Parse("2006-01-02", latestDay(latest.Date)); err == nil {
+				date.Set(float64(day.Unix()), labelValues...)
+			}
+		}
+
+		registry.Handler().ServeHTTP(w, r)
+	})
+}
+
+// latestDay returns the day of a date, which may be stored with a time.
+func latestDay(date string) string {
+	if len(date) > len("2006-01-02") {
+		return date[:len("2006-01-02")]
+	}
+	return date
+}
@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"covid/database"
+	"time"
+)
+
+// DatabaseMetrics time the statements run on the database, by operation such as "select countries".
+type DatabaseMetrics struct {
+	duration *Histogram
+	errors   *Counter
+}
+
+func NewDatabaseMetrics(r *Registry) *DatabaseMetrics {
+	return &DatabaseMetrics{
+		duration: r.NewHistogram("covid_db_query_duration_seconds", "Time SQLite took to run the statements, by operation.",
+			DefaultBuckets, "operation"),
+		errors: r.NewCounter("covid_db_query_errors_total", "Statements that failed, by operation.", "operation"),
+	}
+}
+
+// Hook returns the database.QueryHook recording the statements.
+func (m *DatabaseMetrics) Hook() database.QueryHook {
+	return func(operation string, duration time.Duration, err error) {
+		m.duration.Observe(duration.Seconds(), operation)
+		if err != nil {
+			m.errors.Inc(operation)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"covid/fetcher"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// FetcherMetrics follow the runs of the fetcher, the countries it updates and its requests to the upstream API.
+type FetcherMetrics struct {
+	runs            *Counter
+	runDuration     *Histogram
+	countries       *Counter
+	upstream        *Counter
+	retries         *Counter
+	lastSuccessTime *Gauge
+
+	mu sync.Mutex
+	// lastSuccess is when the statistics of every country were last stored.
+	lastSuccess map[string]time.Time
+}
+
+func NewFetcherMetrics(r *Registry) *FetcherMetrics {
+	m := &FetcherMetrics{
+		runs: r.NewCounter("covid_fetcher_runs_total", "Fetches of every country, by outcome.", "outcome"),
+		runDuration: r.NewHistogram("covid_fetcher_run_duration_seconds", "Time to fetch every country.",
+			[]float64{1, 10, 30, 60, 300, 600, 1800, 3600, 7200}),
+		countries: r.NewCounter("covid_fetcher_country_fetches_total", "Fetches of the statistics of a country, by outcome.",
+			"country", "outcome"),
+		upstream: r.NewCounter("covid_fetcher_upstream_responses_total",
+			"Responses of the upstream API by status code, error for the requests that got none.", "code"),
+		retries: r.NewCounter("covid_fetcher_retries_total", "Requests retried after the upstream API rate limited them.",
+			"country"),
+		lastSuccessTime: r.NewGauge("covid_fetcher_last_success_timestamp_seconds",
+			"Unix time at which the statistics of a country were last stored.", "country"),
+		lastSuccess: map[string]time.Time{},
+	}
+	r.NewGaugeFunc("covid_fetcher_seconds_since_last_success", "Time since the statistics of a country were last stored.",
+		m.collectSinceLastSuccess, "country")
+	return m
+}
+
+// Hooks returns the fetcher.Hooks recording the work of the fetcher.
+func (m *FetcherMetrics) Hooks() fetcher.Hooks {
+	return fetcher.Hooks{
+		RunDone: func(duration time.Duration, err error) {
+			m.runs.Inc(outcome(err))
+			m.runDuration.Observe(duration.Seconds())
+		},
+		CountryDone: func(country string, err error) {
+			m.countries.Inc(country, outcome(err))
+			if err != nil {
+				return
+			}
+			now := time.Now()
+			m.lastSuccessTime.Set(float64(now.UnixNano())/1e9, country)
+			m.mu.Lock()
+			m.lastSuccess[country] = now
+			m.mu.Unlock()
+		},
+		UpstreamResponse: func(statusCode int, err error) {
+			if err != nil {
+				m.upstream.Inc("error")
+				return
+			}
+			m.upstream.Inc(strconv.Itoa(statusCode))
+		},
+		Retry: func(country string) {
+			m.retries.Inc(country)
+		},
+	}
+}
+
+func (m *FetcherMetrics) collectSinceLastSuccess(set func(v float64, labelValues ...string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for country, lastSuccess := range m.lastSuccess {
+		set(time.Since(lastSuccess).Seconds(), country)
+	}
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
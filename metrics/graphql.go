@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// GraphQLMetrics count the GraphQL operations by name and type, time them and count their errors. Operations
+// that cannot run, such as invalid ones, are counted without a name as of type invalid. It is a gqlgen extension.
+type GraphQLMetrics struct {
+	operations *Counter
+	duration   *Histogram
+	errors     *Counter
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationInterceptor
+	graphql.ResponseInterceptor
+} = (*GraphQLMetrics)(nil)
+
+func NewGraphQLMetrics(r *Registry) *GraphQLMetrics {
+	return &GraphQLMetrics{
+		operations: r.NewCounter("covid_graphql_operations_total", "GraphQL operations by name and type.", "operation", "type"),
+		duration: r.NewHistogram("covid_graphql_operation_duration_seconds",
+			"Time to run the GraphQL queries and mutations, by name and type.", DefaultBuckets, "operation", "type"),
+		errors: r.NewCounter("covid_graphql_errors_total", "Errors returned by the GraphQL operations, by name and type.",
+			"operation", "type"),
+	}
+}
+
+func (m *GraphQLMetrics) ExtensionName() string {
+	return "Metrics"
+}
+
+func (m *GraphQLMetrics) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+// InterceptOperation measures the responses of the operations that run, once for queries and mutations and
+// for every event of subscriptions.
+func (m *GraphQLMetrics) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	name, kind := operationLabels(ctx)
+	m.operations.Inc(name, kind)
+	start := graphql.GetOperationContext(ctx).Stats.OperationStart
+
+	responses := next(ctx)
+	return func(ctx context.Context) *graphql.Response {
+		resp := responses(context.WithValue(ctx, runningOperationKey{}, true))
+		if resp == nil {
+			return nil
+		}
+		if kind != string(ast.Subscription) {
+			m.duration.Observe(time.Since(start).Seconds(), name, kind)
+		}
+		m.errors.Add(float64(len(resp.Errors)), name, kind)
+		return resp
+	}
+}
+
+// runningOperationKey marks the context of the responses of the operations that run.
+type runningOperationKey struct{}
+
+// InterceptResponse counts the operations that cannot run, such as invalid ones or those over the limits,
+// whose errors do not go through InterceptOperation.
+func (m *GraphQLMetrics) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	resp := next(ctx)
+	if running, _ := ctx.Value(runningOperationKey{}).(bool); running {
+		return resp
+	}
+
+	name, kind := "", "invalid"
+	m.operations.Inc(name, kind)
+	if resp != nil {
+		m.errors.Add(float64(len(resp.Errors)), name, kind)
+	}
+	return resp
+}
+
+// operationLabels returns the name and the type of the operation of ctx, which runs.
+func operationLabels(ctx context.Context) (string, string) {
+	rc := graphql.GetOperationContext(ctx)
+	if rc.Operation.Name == "" {
+		return "anonymous", string(rc.Operation.Operation)
+	}
+	return rc.Operation.Name, string(rc.Operation.Operation)
+}
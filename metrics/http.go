@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// HTTPMetrics count and time the requests by route, the pattern they matched rather than their path so
+// that every country shares the series of /api/v1/countries/{id}.
+type HTTPMetrics struct {
+	requests *Counter
+	duration *Histogram
+	inFlight *Gauge
+}
+
+func NewHTTPMetrics(r *Registry) *HTTPMetrics {
+	return &HTTPMetrics{
+		requests: r.NewCounter("covid_http_requests_total", "HTTP requests by method, route and status code.",
+			"method", "route", "code"),
+		duration: r.NewHistogram("covid_http_request_duration_seconds", "Time to serve the HTTP requests, websockets excepted.",
+			DefaultBuckets, "method", "route"),
+		inFlight: r.NewGauge("covid_http_requests_in_flight", "HTTP requests being served, websockets included."),
+	}
+}
+
+// Middleware measures the requests, it must be used on the root router for the routes to be known.
+func (m *HTTPMetrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		m.inFlight.Add(1)
+		defer m.inFlight.Add(-1)
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		method := requestMethod(r.Method)
+		route := requestRoute(r)
+		// websocket connections are hijacked, and last as long as the subscriptions of the client:
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			m.requests.Inc(method, route, strconv.Itoa(http.StatusSwitchingProtocols))
+			return
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		m.requests.Inc(method, route, strconv.Itoa(status))
+		m.duration.Observe(time.Since(start).Seconds(), method, route)
+	})
+}
+
+// requestRoute returns the route pattern matched by a request, or unmatched.
+func requestRoute(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return "unmatched"
+	}
+	if route := rctx.RoutePattern(); route != "" {
+		return route
+	}
+	return "unmatched"
+}
+
+// requestMethod keeps the methods of the series to the standard ones, clients can send any.
+func requestMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "OTHER"
+}
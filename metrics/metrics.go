@@ -0,0 +1,333 @@
+// Package metrics keeps counters, gauges and histograms and serves them in the Prometheus text format.
+// The other files of the package instrument the server, the database, GraphQL and the fetcher through
+// their middleware and hooks.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the buckets of the duration histograms.
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Registry holds the metrics served together.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: map[string]metric{}}
+}
+
+// metric is a family of series sharing a name, one per combination of label values.
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.metrics[name]; ok {
+		panic("metrics: " + name + " registered twice")
+	}
+	r.metrics[name] = m
+}
+
+// Write writes every metric in the Prometheus text format, sorted by name.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	metrics := make([]metric, 0, len(r.metrics))
+	for _, name := range sortedKeys(r.metrics) {
+		metrics = append(metrics, r.metrics[name])
+	}
+	r.mu.Unlock()
+
+	buffered := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(buffered)
+	}
+	return buffered.Flush()
+}
+
+// Handler serves the metrics to Prometheus.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// desc is what the series of a metric share.
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d desc) writeHeader(w *bufio.Writer) {
+	help := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, help, d.name, d.kind)
+}
+
+// key identifies a series by its label values, it panics when they do not match the labels of the metric.
+func (d desc) key(labelValues []string) string {
+	if len(labelValues) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", d.name, len(d.labels), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+// writeSample writes a sample of the series with the given label values, and an extra label such as le.
+func (d desc) writeSample(w *bufio.Writer, suffix string, labelValues []string, extraLabel string, extraValue string, value float64) {
+	w.WriteString(d.name)
+	w.WriteString(suffix)
+
+	labels := d.labels
+	values := labelValues
+	if extraLabel != "" {
+		labels = append(labels[:len(labels):len(labels)], extraLabel)
+		values = append(values[:len(values):len(values)], extraValue)
+	}
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(label)
+			w.WriteString(`="`)
+			w.WriteString(labelValueReplacer.Replace(values[i]))
+			w.WriteByte('"')
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatValue(value))
+	w.WriteByte('\n')
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// sortedKeys returns the keys of the series in a stable order, for the output to be easy to read and diff.
+func sortedKeys[V any](series map[string]V) []string {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type value struct {
+	labelValues []string
+	value       float64
+}
+
+// Counter is a value that only goes up, such as a number of requests.
+type Counter struct {
+	desc
+	mu     sync.Mutex
+	series map[string]*value
+}
+
+// NewCounter registers a counter with a series per combination of values of labels.
+func (r *Registry) NewCounter(name string, help string, labels ...string) *Counter {
+	c := &Counter{desc: desc{name: name, help: help, kind: "counter", labels: labels}, series: map[string]*value{}}
+	r.register(name, c)
+	return c
+}
+
+// Inc adds 1 to the series with the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds delta, which must not be negative, to the series with the given label values.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("metrics: counter " + c.name + " cannot decrease")
+	}
+	key := c.key(labelValues)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.series[key]
+	if !ok {
+		v = &value{labelValues: append([]string(nil), labelValues...)}
+		c.series[key] = v
+	}
+	v.value += delta
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writeHeader(w)
+	for _, key := range sortedKeys(c.series) {
+		v := c.series[key]
+		c.writeSample(w, "", v.labelValues, "", "", v.value)
+	}
+}
+
+// Gauge is a value that goes up and down, such as a number of requests in flight.
+type Gauge struct {
+	desc
+	mu     sync.Mutex
+	series map[string]*value
+}
+
+// NewGauge registers a gauge with a series per combination of values of labels.
+func (r *Registry) NewGauge(name string, help string, labels ...string) *Gauge {
+	g := &Gauge{desc: desc{name: name, help: help, kind: "gauge", labels: labels}, series: map[string]*value{}}
+	r.register(name, g)
+	return g
+}
+
+// Set sets the series with the given label values.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.update(labelValues, func(current float64) float64 { return v })
+}
+
+// Add adds delta, which can be negative, to the series with the given label values.
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	g.update(labelValues, func(current float64) float64 { return current + delta })
+}
+
+func (g *Gauge) update(labelValues []string, update func(current float64) float64) {
+	key := g.key(labelValues)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	v, ok := g.series[key]
+	if !ok {
+		v = &value{labelValues: append([]string(nil), labelValues...)}
+		g.series[key] = v
+	}
+	v.value = update(v.value)
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.writeHeader(w)
+	for _, key := range sortedKeys(g.series) {
+		v := g.series[key]
+		g.writeSample(w, "", v.labelValues, "", "", v.value)
+	}
+}
+
+// gaugeFunc is a gauge computed when the metrics are written.
+type gaugeFunc struct {
+	desc
+	collect func(set func(v float64, labelValues ...string))
+}
+
+// NewGaugeFunc registers a gauge whose series are set by collect every time the metrics are written, for
+// values that change on their own such as the time since an event.
+func (r *Registry) NewGaugeFunc(name string, help string, collect func(set func(v float64, labelValues ...string)), labels ...string) {
+	r.register(name, &gaugeFunc{desc: desc{name: name, help: help, kind: "gauge", labels: labels}, collect: collect})
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	series := map[string]*value{}
+	g.collect(func(v float64, labelValues ...string) {
+		series[g.key(labelValues)] = &value{labelValues: labelValues, value: v}
+	})
+
+	g.writeHeader(w)
+	for _, key := range sortedKeys(series) {
+		v := series[key]
+		g.writeSample(w, "", v.labelValues, "", "", v.value)
+	}
+}
+
+// Histogram counts observations, such as durations, in buckets.
+type Histogram struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	// counts are the observations of every bucket, not cumulative, the last one is +Inf.
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram registers a histogram with the upper bounds of its buckets in increasing order, and a series
+// per combination of values of labels.
+func (r *Registry) NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic("metrics: buckets of " + name + " are not sorted")
+	}
+	h := &Histogram{
+		desc:    desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: buckets,
+		series:  map[string]*histogramSeries{},
+	}
+	r.register(name, h)
+	return h
+}
+
+// Observe adds an observation to the series with the given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+	bucket := sort.SearchFloat64s(h.buckets, v)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{labelValues: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets)+1)}
+		h.series[key] = s
+	}
+	s.counts[bucket]++
+	s.sum += v
+	s.count++
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.writeHeader(w)
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		var cumulative uint64
+		for i, upperBound := range h.buckets {
+			cumulative += s.counts[i]
+			h.writeSample(w, "_bucket", s.labelValues, "le", formatValue(upperBound), float64(cumulative))
+		}
+		h.writeSample(w, "_bucket", s.labelValues, "le", "+Inf", float64(s.count))
+		h.writeSample(w, "_sum", s.labelValues, "", "", s.sum)
+		h.writeSample(w, "_count", s.labelValues, "", "", float64(s.count))
+	}
+}
@@ -0,0 +1,293 @@
+package quality
+
+import (
+	"context"
+	"covid/database"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Code identifies the kind of anomaly flagged on a covid statistic.
+type Code string
+
+const (
+	CodeNegativeValue            Code = "NEGATIVE_VALUE"
+	CodeFutureDate               Code = "FUTURE_DATE"
+	CodeDuplicateDate            Code = "DUPLICATE_DATE"
+	CodeCumulativeDecrease       Code = "CUMULATIVE_DECREASE"
+	CodeDeathsExceedConfirmed    Code = "DEATHS_EXCEED_CONFIRMED"
+	CodeRecoveredExceedConfirmed Code = "RECOVERED_EXCEED_CONFIRMED"
+	CodeSpike                    Code = "SPIKE"
+)
+
+type Severity string
+
+const (
+	// SeverityError marks a strict rule; in strict mode the write is rejected.
+	SeverityError Severity = "ERROR"
+	// SeverityWarning only flags the row, it is always stored.
+	SeverityWarning Severity = "WARNING"
+)
+
+const (
+	dateLayout = "2006-01-02"
+	// number of previous rows used to compute the usual daily increase for spike detection.
+	spikeWindow = 7
+	// a daily increase is a spike when it is this many times bigger than the usual one.
+	spikeFactor = 10
+	// ignore spikes below this size, small countries jump around a lot.
+	minSpikeIncrease = 100
+)
+
+type Issue struct {
+	Code     Code
+	Severity Severity
+	Message  string
+}
+
+// Checker runs the checks on the statistics it writes. A strict Checker rejects the writes that break a rule
+// with SeverityError instead of just flagging them.
+type Checker struct {
+	strict bool
+}
+
+func NewChecker(strict bool) *Checker {
+	return &Checker{strict: strict}
+}
+
+// RejectedError is returned when strict mode refuses a write.
+type RejectedError struct {
+	Issues []Issue
+}
+
+func (e *RejectedError) Error() string {
+	var messages []string
+	for _, issue := range e.Issues {
+		messages = append(messages, fmt.Sprintf("%s: %s", issue.Code, issue.Message))
+	}
+	return "covid statistic rejected by data quality checks: " + strings.Join(messages, "; ")
+}
+
+// Check runs every rule against a candidate statistic. excludeID is the ID of the
+// row being updated (0 for new rows) so it is not compared against itself.
+func Check(ctx context.Context, d database.Store, stat database.CovidStatistic, excludeID int) ([]Issue, error) {
+	issues := checkValues(stat)
+
+	date, err := time.Parse(dateLayout, stat.Date)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date: %w", err)
+	}
+	if date.After(time.Now().UTC()) {
+		issues = append(issues, Issue{CodeFutureDate, SeverityError, fmt.Sprintf("date %s is in the future", stat.Date)})
+	}
+
+	duplicates, err := d.CountCovidStatisticsOnDate(ctx, stat.CountryID, stat.Date, excludeID)
+	if err != nil {
+		return nil, err
+	}
+	if duplicates > 0 {
+		issues = append(issues, Issue{CodeDuplicateDate, SeverityError, fmt.Sprintf("a statistic for %s already exists", stat.Date)})
+	}
+
+	previous, err := d.GetPreviousCovidStatistics(ctx, stat.CountryID, stat.Date, excludeID, spikeWindow+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(previous) > 0 {
+		issues = append(issues, checkAgainstPrevious(stat, previous)...)
+	}
+
+	return issues, nil
+}
+
+func checkValues(stat database.CovidStatistic) []Issue {
+	var issues []Issue
+	if stat.Confirmed < 0 || stat.Deaths < 0 || stat.Recovered < 0 {
+		issues = append(issues, Issue{CodeNegativeValue, SeverityError, "counts must not be negative"})
+	}
+	if stat.Deaths > stat.Confirmed {
+		issues = append(issues, Issue{CodeDeathsExceedConfirmed, SeverityError, fmt.Sprintf("deaths (%d) exceed confirmed cases (%d)", stat.Deaths, stat.Confirmed)})
+	}
+	if stat.Recovered > stat.Confirmed {
+		issues = append(issues, Issue{CodeRecoveredExceedConfirmed, SeverityWarning, fmt.Sprintf("recovered (%d) exceed confirmed cases (%d)", stat.Recovered, stat.Confirmed)})
+	}
+	return issues
+}
+
+// checkAgainstPrevious compares cumulative counts with the rows before the candidate,
+// previous is ordered from the most recent row backwards.
+func checkAgainstPrevious(stat database.CovidStatistic, previous []database.CovidStatistic) []Issue {
+	var issues []Issue
+	last := previous[0]
+
+	if stat.Confirmed < last.Confirmed {
+		issues = append(issues, cumulativeDecrease("confirmed", last, stat.Confirmed))
+	}
+	if stat.Deaths < last.Deaths {
+		issues = append(issues, cumulativeDecrease("deaths", last, stat.Deaths))
+	}
+	if stat.Recovered < last.Recovered {
+		issues = append(issues, cumulativeDecrease("recovered", last, stat.Recovered))
+	}
+
+	// the usual daily increase is the average over the previous rows:
+	if len(previous) < 2 {
+		return issues
+	}
+	totalIncrease := previous[0].Confirmed - previous[len(previous)-1].Confirmed
+	usualIncrease := float64(totalIncrease) / float64(len(previous)-1)
+	increase := stat.Confirmed - last.Confirmed
+	if increase >= minSpikeIncrease && usualIncrease > 0 && float64(increase) > spikeFactor*usualIncrease {
+		issues = append(issues, Issue{CodeSpike, SeverityWarning, fmt.Sprintf("confirmed cases increased by %d, usual daily increase is %.0f", increase, usualIncrease)})
+	}
+
+	return issues
+}
+
+func cumulativeDecrease(field string, last database.CovidStatistic, value int) Issue {
+	lastValue := last.Confirmed
+	switch field {
+	case "deaths":
+		lastValue = last.Deaths
+	case "recovered":
+		lastValue = last.Recovered
+	}
+	return Issue{CodeCumulativeDecrease, SeverityError, fmt.Sprintf("cumulative %s went down from %d on %s to %d", field, lastValue, last.Date, value)}
+}
+
+func hasErrors(issues []Issue) bool {
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Record stores the issues found on a statistic, replacing the ones flagged before.
+func Record(ctx context.Context, d database.Store, stat database.CovidStatistic, issues []Issue) error {
+	createdAt := time.Now().UTC().Format(time.RFC3339)
+
+	var records []database.DataQualityIssue
+	for _, issue := range issues {
+		records = append(records, database.DataQualityIssue{
+			CovidStatisticID: stat.ID,
+			CountryID:        stat.CountryID,
+			Date:             stat.Date,
+			Code:             string(issue.Code),
+			Severity:         string(issue.Severity),
+			Message:          issue.Message,
+			CreatedAt:        createdAt,
+		})
+	}
+
+	return d.ReplaceDataQualityIssues(ctx, stat.ID, records)
+}
+
+// AddCovidStatistic validates and inserts a statistic, then flags whatever the checks found.
+// In strict mode a statistic breaking an error rule is not inserted and a *RejectedError is returned.
+func (c *Checker) AddCovidStatistic(ctx context.Context, d database.Store, countryID int, date string, confirmed int, recovered int, deaths int) (int, []Issue, error) {
+	stat := database.CovidStatistic{
+		CountryID: countryID,
+		Date:      date,
+		Confirmed: confirmed,
+		Recovered: recovered,
+		Deaths:    deaths,
+	}
+
+	issues, err := Check(ctx, d, stat, 0)
+	if err != nil {
+		return 0, nil, err
+	}
+	if c.strict && hasErrors(issues) {
+		return 0, issues, &RejectedError{Issues: issues}
+	}
+
+	stat.ID, err = d.AddCovidStatistic(ctx, countryID, date, confirmed, recovered, deaths)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := Record(ctx, d, stat, issues); err != nil {
+		return stat.ID, issues, err
+	}
+
+	return stat.ID, issues, recheckNext(ctx, d, stat)
+}
+
+// UpdateCovidStatistic validates and updates a statistic, then flags whatever the checks found. A statistic moved
+// to another date leaves two rows to re-validate, the ones following its old and its new date.
+func (c *Checker) UpdateCovidStatistic(ctx context.Context, d database.Store, id int, date string, confirmed int, recovered int, deaths int) (database.CovidStatistic, []Issue, error) {
+	old, err := d.GetCovidStatistic(ctx, id)
+	if err != nil {
+		return database.CovidStatistic{}, nil, err
+	}
+
+	stat := database.CovidStatistic{
+		ID:        id,
+		CountryID: old.CountryID,
+		Date:      date,
+		Confirmed: confirmed,
+		Recovered: recovered,
+		Deaths:    deaths,
+	}
+
+	issues, err := Check(ctx, d, stat, id)
+	if err != nil {
+		return database.CovidStatistic{}, nil, err
+	}
+	if c.strict && hasErrors(issues) {
+		return database.CovidStatistic{}, issues, &RejectedError{Issues: issues}
+	}
+
+	stat, err = d.UpdateCovidStatistic(ctx, id, date, confirmed, recovered, deaths)
+	if err != nil {
+		return database.CovidStatistic{}, nil, err
+	}
+
+	if err := Record(ctx, d, stat, issues); err != nil {
+		return stat, issues, err
+	}
+
+	if old.Date != stat.Date {
+		if err := recheckNext(ctx, d, old); err != nil {
+			return stat, issues, err
+		}
+	}
+	return stat, issues, recheckNext(ctx, d, stat)
+}
+
+// DeleteCovidStatistic deletes a statistic, then re-validates the row that followed it: without the
+// statistic it is compared to an earlier one. It wraps database.ErrNotFound when there is no such statistic.
+func (c *Checker) DeleteCovidStatistic(ctx context.Context, d database.Store, id int) error {
+	stat, err := d.GetCovidStatistic(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("covid stat %w", database.ErrNotFound)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := d.DeleteCovidStatistic(ctx, id); err != nil {
+		return err
+	}
+	return recheckNext(ctx, d, stat)
+}
+
+// recheckNext re-validates the row following a write, since a new or changed
+// row can turn it into a decrease or a spike. It is flagged, never rejected.
+func recheckNext(ctx context.Context, d database.Store, stat database.CovidStatistic) error {
+	next, found, err := d.GetNextCovidStatistic(ctx, stat.CountryID, stat.Date, stat.ID)
+	if err != nil || !found {
+		return err
+	}
+
+	issues, err := Check(ctx, d, next, next.ID)
+	if err != nil {
+		return err
+	}
+	return Record(ctx, d, next, issues)
+}
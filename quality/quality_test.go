@@ -0,0 +1,195 @@
+package quality
+
+import (
+	"context"
+	"covid/database"
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// codes returns the codes of the issues flagged on a statistic.
+func codes(t *testing.T, d database.Store, id int) []string {
+	t.Helper()
+	issues, err := d.GetDataQualityIssuesByCovidStatisticID(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes := []string{}
+	for _, issue := range issues {
+		codes = append(codes, issue.Code)
+	}
+	return codes
+}
+
+// day is a statistic added by the tests, on a day of March 2021.
+type day struct {
+	date                         string
+	confirmed, recovered, deaths int
+}
+
+// addDays adds statistics to a new country without checking them, and returns the country.
+func addDays(t *testing.T, d database.Store, days []day) int {
+	t.Helper()
+	ctx := context.Background()
+	country, _, err := d.CreateCountry(ctx, "Belgium", "BE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, day := range days {
+		if _, err := d.AddCovidStatistic(ctx, country.ID, day.date, day.confirmed, day.recovered, day.deaths); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return country.ID
+}
+
+func TestAddCovidStatistic(t *testing.T) {
+	// a steady increase of 10 cases a day:
+	steady := []day{
+		{"2021-03-01", 100, 0, 0}, {"2021-03-02", 110, 0, 0}, {"2021-03-03", 120, 0, 0}, {"2021-03-04", 130, 0, 0},
+	}
+	tests := []struct {
+		name    string
+		history []day
+		stat    day
+		want    []string
+		// rejected in strict mode:
+		rejected bool
+	}{
+		{"first", nil, day{"2021-03-05", 100, 10, 1}, []string{}, false},
+		{"steady", steady, day{"2021-03-05", 140, 10, 1}, []string{}, false},
+		{"negative recovered", nil, day{"2021-03-05", 10, -1, 0}, []string{string(CodeNegativeValue)}, true},
+		{"negative deaths", nil, day{"2021-03-05", 10, 0, -1}, []string{string(CodeNegativeValue)}, true},
+		{"deaths exceed confirmed", nil, day{"2021-03-05", 10, 0, 11}, []string{string(CodeDeathsExceedConfirmed)}, true},
+		{"recovered exceed confirmed", nil, day{"2021-03-05", 10, 11, 0}, []string{string(CodeRecoveredExceedConfirmed)}, false},
+		{"future", nil, day{"2999-01-01", 10, 0, 0}, []string{string(CodeFutureDate)}, true},
+		{"duplicate", steady, day{"2021-03-04", 130, 0, 0}, []string{string(CodeDuplicateDate)}, true},
+		{"confirmed decrease", steady, day{"2021-03-05", 129, 0, 0}, []string{string(CodeCumulativeDecrease)}, true},
+		{"deaths and recovered decrease", []day{{"2021-03-01", 100, 50, 5}}, day{"2021-03-02", 100, 49, 4},
+			[]string{string(CodeCumulativeDecrease), string(CodeCumulativeDecrease)}, true},
+		// the decrease is against the last statistic before the date, not the last one added:
+		{"decrease before a later statistic", []day{{"2021-03-01", 100, 0, 0}, {"2021-03-03", 120, 0, 0}}, day{"2021-03-02", 90, 0, 0}, []string{string(CodeCumulativeDecrease)}, true},
+		{"spike", steady, day{"2021-03-05", 1130, 0, 0}, []string{string(CodeSpike)}, false},
+		{"increase ten times the usual", steady, day{"2021-03-05", 230, 0, 0}, []string{}, false},
+		// the increase is ten times the usual one but too small to be a spike:
+		{"small spike", []day{{"2021-03-01", 10, 0, 0}, {"2021-03-02", 11, 0, 0}}, day{"2021-03-03", 60, 0, 0}, []string{}, false},
+		// a single previous statistic gives no usual increase:
+		{"spike without usual increase", []day{{"2021-03-01", 10, 0, 0}}, day{"2021-03-02", 10000, 0, 0}, []string{}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			d := database.NewMemoryStore()
+			countryID := addDays(t, d, test.history)
+			id, issues, err := NewChecker(false).AddCovidStatistic(ctx, d, countryID, test.stat.date, test.stat.confirmed, test.stat.recovered, test.stat.deaths)
+			if err != nil {
+				t.Fatalf("AddCovidStatistic: %v", err)
+			}
+			if len(issues) != len(test.want) {
+				t.Errorf("issues %v, want %v", issues, test.want)
+			}
+			if got := codes(t, d, id); !slices.Equal(got, test.want) {
+				t.Errorf("flagged %v, want %v", got, test.want)
+			}
+
+			strict := database.NewMemoryStore()
+			countryID = addDays(t, strict, test.history)
+			_, _, err = NewChecker(true).AddCovidStatistic(ctx, strict, countryID, test.stat.date, test.stat.confirmed, test.stat.recovered, test.stat.deaths)
+			var rejected *RejectedError
+			if errors.As(err, &rejected) != test.rejected {
+				t.Errorf("strict mode: %v, want rejected %t", err, test.rejected)
+			}
+		})
+	}
+}
+
+func TestUpdateCovidStatisticMovedRechecksBothNext(t *testing.T) {
+	ctx := context.Background()
+	d := database.NewMemoryStore()
+	checker := NewChecker(false)
+	country, _, err := d.CreateCountry(ctx, "Belgium", "BE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, stat := range []day{{"2021-03-01", 100, 0, 0}, {"2021-03-02", 200, 0, 0}, {"2021-03-03", 150, 0, 0}, {"2021-03-05", 400, 0, 0}} {
+		id, _, err := checker.AddCovidStatistic(ctx, d, country.ID, stat.date, stat.confirmed, stat.recovered, stat.deaths)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if got := codes(t, d, ids[2]); !slices.Equal(got, []string{string(CodeCumulativeDecrease)}) {
+		t.Fatalf("before the update: %v", got)
+	}
+
+	// moving the second statistic after the fourth leaves the third after the first, and makes the fourth a decrease:
+	if _, _, err := checker.UpdateCovidStatistic(ctx, d, ids[1], "2021-03-04", 500, 0, 0); err != nil {
+		t.Fatalf("UpdateCovidStatistic: %v", err)
+	}
+	if got := codes(t, d, ids[2]); !slices.Equal(got, []string{}) {
+		t.Errorf("statistic after the old date: %v, want none", got)
+	}
+	if got := codes(t, d, ids[3]); !slices.Equal(got, []string{string(CodeCumulativeDecrease)}) {
+		t.Errorf("statistic after the new date: %v, want %v", got, CodeCumulativeDecrease)
+	}
+}
+
+func TestUpdateCovidStatisticNotFound(t *testing.T) {
+	_, _, err := NewChecker(false).UpdateCovidStatistic(context.Background(), database.NewMemoryStore(), 42, "2021-03-01", 1, 0, 0)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("got %v, want %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestDeleteCovidStatisticRechecksNext(t *testing.T) {
+	tests := []struct {
+		name string
+		// confirmed cases of three days, the second is deleted:
+		confirmed [3]int
+		// issues of the third day before and after the deletion:
+		before []string
+		after  []string
+	}{
+		{"decrease cleared", [3]int{100, 200, 150}, []string{string(CodeCumulativeDecrease)}, []string{}},
+		{"decrease flagged", [3]int{100, 50, 80}, []string{}, []string{string(CodeCumulativeDecrease)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			d := database.NewMemoryStore()
+			checker := NewChecker(false)
+			country, _, err := d.CreateCountry(ctx, "Belgium", "BE")
+			if err != nil {
+				t.Fatal(err)
+			}
+			dates := [3]string{"2021-03-01", "2021-03-02", "2021-03-03"}
+			var ids [3]int
+			for i, confirmed := range test.confirmed {
+				ids[i], _, err = checker.AddCovidStatistic(ctx, d, country.ID, dates[i], confirmed, 0, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := codes(t, d, ids[2]); !slices.Equal(got, test.before) {
+				t.Errorf("before the deletion: %v, want %v", got, test.before)
+			}
+
+			if err := checker.DeleteCovidStatistic(ctx, d, ids[1]); err != nil {
+				t.Fatalf("DeleteCovidStatistic: %v", err)
+			}
+			if got := codes(t, d, ids[2]); !slices.Equal(got, test.after) {
+				t.Errorf("after the deletion: %v, want %v", got, test.after)
+			}
+		})
+	}
+}
+
+func TestDeleteCovidStatisticNotFound(t *testing.T) {
+	err := NewChecker(false).DeleteCovidStatistic(context.Background(), database.NewMemoryStore(), 42)
+	if !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("got %v, want %v", err, database.ErrNotFound)
+	}
+}
@@ -0,0 +1,61 @@
+package quality
+
+import (
+	"context"
+	"covid/database"
+	"sort"
+)
+
+type CodeCount struct {
+	Code  Code
+	Count int
+}
+
+type Report struct {
+	Country      database.Country
+	TotalIssues  int
+	Errors       int
+	Warnings     int
+	CountsByCode []CodeCount
+	Issues       []database.DataQualityIssue
+}
+
+// BuildReport summarises every issue flagged on a country's statistics.
+func BuildReport(ctx context.Context, d database.Store, countryID int) (Report, error) {
+	country, err := d.GetCountryByID(ctx, countryID)
+	if err != nil {
+		return Report{}, err
+	}
+	// the report only needs the country itself, not its whole history:
+	country.CovidStatistics = nil
+
+	issues, err := d.GetDataQualityIssuesByCountryID(ctx, countryID)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{
+		Country:     country,
+		TotalIssues: len(issues),
+		Issues:      issues,
+	}
+
+	counts := map[Code]int{}
+	for _, issue := range issues {
+		counts[Code(issue.Code)]++
+		if Severity(issue.Severity) == SeverityError {
+			report.Errors++
+		} else {
+			report.Warnings++
+		}
+	}
+
+	for code, count := range counts {
+		report.CountsByCode = append(report.CountsByCode, CodeCount{Code: code, Count: count})
+	}
+	sort.Slice(report.CountsByCode, func(i, j int) bool {
+		return report.CountsByCode[i].Code < report.CountsByCode[j].Code
+	})
+
+	return report, nil
+}
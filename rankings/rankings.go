@@ -0,0 +1,228 @@
+package rankings
+
+import (
+	"context"
+	"covid/analytics"
+	"covid/database"
+	"covid/series"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	DefaultLimit      = 20
+	MaxLimit          = 250
+	DefaultChangeDays = 7
+)
+
+// ErrInvalidOptions is wrapped by the errors returned for options out of range.
+var ErrInvalidOptions = errors.New("invalid ranking options")
+
+type Options struct {
+	Metric series.Metric
+	// Date ranks the values of that day, formatted as YYYY-MM-DD, the latest values when nil.
+	Date *string
+	// Limit and Offset select a page of the ranking, a Limit of 0 returns every ranked country.
+	Limit  int
+	Offset int
+	// GroupID restricts the ranking to the members of a group, every country is ranked when nil.
+	GroupID *int
+	// ChangeDays compares the ranks to those of as many days earlier, 0 skips the comparison.
+	ChangeDays int
+}
+
+type Entry struct {
+	// Rank is shared by countries with the same value.
+	Rank    int
+	Country database.Country
+	Value   float64
+	// Date is the day of the value, countries keep their last value until they report again.
+	Date string
+	// Percentile is the percentage of the other ranked countries with a lower value.
+	Percentile float64
+	// PreviousRank is the rank ChangeDays earlier and RankChange how many places were gained since,
+	// both nil when the country was not ranked then.
+	PreviousRank *int
+	RankChange   *int
+}
+
+type Ranking struct {
+	Metric series.Metric
+	// Date is the day ranked, the day of the most recent value when no date was asked for.
+	Date       string
+	ChangeDays int
+	// Total is the number of ranked countries, before Limit and Offset.
+	Total   int
+	Entries []Entry
+}
+
+func (opts Options) validate() error {
+	if opts.Metric != analytics.MetricRt {
+		if _, err := series.ParseMetric(string(opts.Metric)); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidOptions, err)
+		}
+	}
+	if opts.Date != nil {
+		if _, err := time.Parse("2006-01-02", *opts.Date); err != nil {
+			return fmt.Errorf("%w: date must be formatted as YYYY-MM-DD", ErrInvalidOptions)
+		}
+	}
+	if opts.Limit < 0 || opts.Limit > MaxLimit {
+		return fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidOptions, MaxLimit)
+	}
+	if opts.Offset < 0 {
+		return fmt.Errorf("%w: offset must not be negative", ErrInvalidOptions)
+	}
+	if opts.ChangeDays < 0 {
+		return fmt.Errorf("%w: the days to compare ranks to must not be negative", ErrInvalidOptions)
+	}
+	return nil
+}
+
+// Rank ranks countries by their value of a metric on a day, the highest first. Countries without a value,
+// such as those that had not reported yet, are left out. rt estimates the values of analytics.MetricRt.
+func Rank(ctx context.Context, d database.Store, rt *analytics.RtEstimator, opts Options) (Ranking, error) {
+	if err := opts.validate(); err != nil {
+		return Ranking{}, err
+	}
+	ranking := Ranking{Metric: opts.Metric, ChangeDays: opts.ChangeDays, Entries: []Entry{}}
+
+	var countryIDs []int
+	if opts.GroupID != nil {
+		group, err := d.GetCountryGroupByID(ctx, *opts.GroupID)
+		if err != nil {
+			return Ranking{}, err
+		}
+		// without members every country would be ranked:
+		if len(group.Members) == 0 {
+			return ranking, nil
+		}
+		for _, member := range group.Members {
+			countryIDs = append(countryIDs, member.ID)
+		}
+	}
+
+	entries, err := values(ctx, d, rt, opts.Metric, opts.Date, countryIDs)
+	if err != nil {
+		return Ranking{}, err
+	}
+	if len(entries) == 0 {
+		return ranking, nil
+	}
+	rank(entries)
+
+	if opts.Date != nil {
+		ranking.Date = *opts.Date
+	} else {
+		for _, entry := range entries {
+			if day(entry.Date) > ranking.Date {
+				ranking.Date = day(entry.Date)
+			}
+		}
+	}
+
+	if opts.ChangeDays > 0 {
+		date, _ := time.Parse("2006-01-02", ranking.Date)
+		earlierDate := date.AddDate(0, 0, -opts.ChangeDays).Format("2006-01-02")
+		earlier, err := values(ctx, d, rt, opts.Metric, &earlierDate, countryIDs)
+		if err != nil {
+			return Ranking{}, err
+		}
+		rank(earlier)
+
+		previousRanks := map[int]int{}
+		for _, entry := range earlier {
+			previousRanks[entry.Country.ID] = entry.Rank
+		}
+		for i := range entries {
+			if previousRank, ok := previousRanks[entries[i].Country.ID]; ok {
+				change := previousRank - entries[i].Rank
+				entries[i].PreviousRank = &previousRank
+				entries[i].RankChange = &change
+			}
+		}
+	}
+
+	ranking.Total = len(entries)
+	if opts.Offset >= len(entries) {
+		return ranking, nil
+	}
+	entries = entries[opts.Offset:]
+	if opts.Limit > 0 && opts.Limit < len(entries) {
+		entries = entries[:opts.Limit]
+	}
+	ranking.Entries = entries
+	return ranking, nil
+}
+
+// values returns the value of the metric of every country on asOf, or on their last day when asOf is nil.
+func values(ctx context.Context, d database.Store, rt *analytics.RtEstimator, metric series.Metric, asOf *string, countryIDs []int) ([]Entry, error) {
+	latest, err := d.GetLatestCovidStatistics(ctx, asOf, countryIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, statistic := range latest {
+		if metric == analytics.MetricRt {
+			reproduction, err := rt.CountryReproductionNumber(ctx, d, statistic.Country.ID, nil, asOf, rt.SerialInterval)
+			// a country whose statistics overflow the estimate is left out, like one without enough of them:
+			if errors.Is(err, analytics.ErrNonFiniteRt) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if len(reproduction.Estimates) > 0 {
+				estimate := reproduction.Estimates[len(reproduction.Estimates)-1]
+				entries = append(entries, Entry{Country: statistic.Country, Value: estimate.Mean, Date: estimate.Date})
+			}
+			continue
+		}
+
+		if value, ok := series.Value(metric, &statistic.Latest, statistic.Previous); ok {
+			entries = append(entries, Entry{Country: statistic.Country, Value: value, Date: statistic.Latest.Date})
+		}
+	}
+	return entries, nil
+}
+
+// rank sorts entries by value, the highest first, and sets their ranks and percentiles.
+func rank(entries []Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Value != entries[j].Value {
+			return entries[i].Value > entries[j].Value
+		}
+		return entries[i].Country.Name < entries[j].Country.Name
+	})
+
+	for i := range entries {
+		entries[i].Rank = i + 1
+		if i > 0 && entries[i].Value == entries[i-1].Value {
+			entries[i].Rank = entries[i-1].Rank
+		}
+	}
+
+	// walking up from the lowest value, lower counts the entries below the current one:
+	lower := 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		if i < len(entries)-1 && entries[i].Value != entries[i+1].Value {
+			lower = len(entries) - 1 - i
+		}
+		entries[i].Percentile = 100
+		if len(entries) > 1 {
+			entries[i].Percentile = math.Round(float64(lower)/float64(len(entries)-1)*10000) / 100
+		}
+	}
+}
+
+// day drops the time of dates stored with one.
+func day(date string) string {
+	if len(date) > len("2006-01-02") {
+		return date[:len("2006-01-02")]
+	}
+	return date
+}
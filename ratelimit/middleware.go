@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"covid/database"
+	"covid/graph"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Middleware limits every request of the router it is used on with the policy of a single route group.
+func (l *Limiter) Middleware(group string) func(http.Handler) http.Handler {
+	return l.middleware(func(r *http.Request) string { return group })
+}
+
+// RESTMiddleware limits reads and writes of the REST API separately.
+func (l *Limiter) RESTMiddleware() func(http.Handler) http.Handler {
+	return l.middleware(func(r *http.Request) string {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			return GroupRESTRead
+		}
+		return GroupRESTWrite
+	})
+}
+
+func (l *Limiter) middleware(groupOf func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			group := groupOf(r)
+			key, role := identify(r)
+
+			result := l.Allow(group, key, role)
+			if result.Limit > 0 {
+				setHeaders(w, result)
+			}
+
+			if !result.Allowed {
+				writeLimited(w, r, result)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// identify keys the request by the authenticated user, or by the client IP for anonymous requests.
+// It has to run after the authentication middleware for the user to be known.
+func identify(r *http.Request) (string, string) {
+	if claims, ok := graph.ClaimsFromContext(r.Context()); ok {
+		role := claims.Role
+		if role == "" {
+			role = database.RoleUser
+		}
+		return "user:" + claims.Username, role
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return "ip:" + ip, RoleAnonymous
+}
+
+func setHeaders(w http.ResponseWriter, result Result) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(result.Reset.Unix(), 10))
+}
+
+func writeLimited(w http.ResponseWriter, r *http.Request, result Result) {
+	retryAfter := int((result.RetryAfter + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	message := fmt.Sprintf("rate limit exceeded, retry in %d seconds", retryAfter)
+
+	// GraphQL clients expect a GraphQL response, so the error is reported as an extension:
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]any{
+			"errors": []map[string]any{{
+				"message": message,
+				"extensions": map[string]any{
+					"code":       "RATE_LIMITED",
+					"retryAfter": retryAfter,
+					"limit":      result.Limit,
+				},
+			}},
+			"data": nil,
+		})
+		return
+	}
+
+	// same envelope as the errors of the REST API:
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{
+			"code":    "RATE_LIMITED",
+			"message": message,
+		},
+	})
+}
@@ -0,0 +1,134 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Route groups that can be given their own limits.
+const (
+	GroupLogin     = "login"
+	GroupGraphQL   = "graphql"
+	GroupRESTRead  = "rest-read"
+	GroupRESTWrite = "rest-write"
+	GroupRefresh   = "refresh"
+)
+
+// RoleAnonymous is used for requests that carry no valid token.
+const RoleAnonymous = "anonymous"
+
+// Limit allows Requests requests per Window. Tokens are refilled continuously,
+// so a client that used its whole allowance gets a new request every Window/Requests.
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// Policy is the limit of a route group, optionally overridden per role.
+type Policy struct {
+	Default Limit
+	Roles   map[string]Limit
+}
+
+func (p Policy) limitFor(role string) Limit {
+	if limit, ok := p.Roles[role]; ok {
+		return limit
+	}
+	return p.Default
+}
+
+// Groups are the route groups, the server configures the policy of each.
+var Groups = []string{GroupLogin, GroupGraphQL, GroupRESTRead, GroupRESTWrite, GroupRefresh}
+
+// Result describes the outcome of a call to Allow, it is used to fill the X-RateLimit-* headers.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Time
+	RetryAfter time.Duration
+}
+
+type bucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// Limiter is an in-memory token bucket limiter keyed by route group and client.
+type Limiter struct {
+	mu       sync.Mutex
+	policies map[string]Policy
+	buckets  map[string]*bucket
+	calls    int
+	now      func() time.Time
+}
+
+// how many calls to Allow between two sweeps of idle buckets.
+const sweepEvery = 1000
+
+func New(policies map[string]Policy) *Limiter {
+	return &Limiter{
+		policies: policies,
+		buckets:  map[string]*bucket{},
+		now:      time.Now,
+	}
+}
+
+// Allow takes one token from the bucket of key in a route group. Groups without a policy are not limited.
+func (l *Limiter) Allow(group string, key string, role string) Result {
+	policy, ok := l.policies[group]
+	if !ok {
+		return Result{Allowed: true}
+	}
+	limit := policy.limitFor(role)
+	if limit.Requests <= 0 || limit.Window <= 0 {
+		return Result{Allowed: true}
+	}
+	// tokens refilled per second:
+	rate := float64(limit.Requests) / limit.Window.Seconds()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.calls++
+	if l.calls%sweepEvery == 0 {
+		l.sweep(now)
+	}
+
+	bucketKey := group + "|" + key
+	b, ok := l.buckets[bucketKey]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Requests), lastSeen: now}
+		l.buckets[bucketKey] = b
+	}
+
+	b.tokens = math.Min(float64(limit.Requests), b.tokens+now.Sub(b.lastSeen).Seconds()*rate)
+	b.lastSeen = now
+
+	result := Result{Limit: limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - b.tokens) / rate)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = now.Add(secondsToDuration((float64(limit.Requests) - b.tokens) / rate))
+
+	return result
+}
+
+// sweep drops buckets that have not been used for a long time, they would be full again anyway.
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) > time.Hour {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
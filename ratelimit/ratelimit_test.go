@@ -0,0 +1,184 @@
+package ratelimit
+
+import (
+	"context"
+	"covid/graph"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newLimiter returns a limiter whose clock only moves with the returned function.
+func newLimiter(policies map[string]Policy) (*Limiter, func(time.Duration)) {
+	l := New(policies)
+	now := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	return l, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestAllowRefill(t *testing.T) {
+	l, advance := newLimiter(map[string]Policy{GroupLogin: {Default: Limit{Requests: 2, Window: time.Second}}})
+	allow := func(wantAllowed bool, wantRemaining int) Result {
+		t.Helper()
+		result := l.Allow(GroupLogin, "ip:1", RoleAnonymous)
+		if result.Allowed != wantAllowed || result.Remaining != wantRemaining || result.Limit != 2 {
+			t.Fatalf("got %+v, want allowed %t with %d remaining", result, wantAllowed, wantRemaining)
+		}
+		return result
+	}
+
+	allow(true, 1)
+	allow(true, 0)
+	// a token comes back every half second:
+	if result := allow(false, 0); result.RetryAfter != 500*time.Millisecond {
+		t.Errorf("retry after %s, want 500ms", result.RetryAfter)
+	}
+	advance(250 * time.Millisecond)
+	if result := allow(false, 0); result.RetryAfter != 250*time.Millisecond {
+		t.Errorf("retry after %s, want 250ms", result.RetryAfter)
+	}
+	advance(250 * time.Millisecond)
+	allow(true, 0)
+
+	// the bucket never holds more than the limit:
+	advance(time.Hour)
+	result := allow(true, 1)
+	if want := l.now().Add(500 * time.Millisecond); !result.Reset.Equal(want) {
+		t.Errorf("reset at %s, want %s once the bucket is full again", result.Reset, want)
+	}
+	allow(true, 0)
+	allow(false, 0)
+}
+
+func TestAllowPolicies(t *testing.T) {
+	l, _ := newLimiter(map[string]Policy{
+		GroupGraphQL: {Default: Limit{Requests: 1, Window: time.Minute}, Roles: map[string]Limit{"admin": {Requests: 3, Window: time.Minute}}},
+		GroupRefresh: {Default: Limit{Requests: 1, Window: time.Minute}},
+	})
+	tests := []struct {
+		name    string
+		group   string
+		key     string
+		role    string
+		allowed int
+	}{
+		{"default", GroupGraphQL, "user:alice", "user", 1},
+		{"role", GroupGraphQL, "user:root", "admin", 3},
+		// the buckets are per group, alice still has her refresh:
+		{"other group", GroupRefresh, "user:alice", "user", 1},
+		{"no policy", GroupLogin, "user:alice", "user", 100},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			allowed := 0
+			for i := 0; i < 100; i++ {
+				if l.Allow(test.group, test.key, test.role).Allowed {
+					allowed++
+				}
+			}
+			if allowed != test.allowed {
+				t.Errorf("%d requests allowed, want %d", allowed, test.allowed)
+			}
+		})
+	}
+}
+
+// request sends a request through the middleware of l and returns its response.
+func request(l *Limiter, path string, remoteAddr string, claims *graph.Claims) *httptest.ResponseRecorder {
+	handler := l.Middleware(GroupGraphQL)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	r := httptest.NewRequest(http.MethodPost, path, nil)
+	r.RemoteAddr = remoteAddr
+	if claims != nil {
+		r = r.WithContext(graph.WithClaims(context.Background(), claims))
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestMiddlewareKeys(t *testing.T) {
+	alice := &graph.Claims{Username: "alice", Role: "user"}
+	bob := &graph.Claims{Username: "bob", Role: "user"}
+	tests := []struct {
+		name string
+		// the second request shares the bucket of the first when limited:
+		firstAddr, secondAddr     string
+		firstClaims, secondClaims *graph.Claims
+		limited                   bool
+	}{
+		{"same IP", "10.0.0.1:1000", "10.0.0.1:2000", nil, nil, true},
+		{"other IP", "10.0.0.1:1000", "10.0.0.2:1000", nil, nil, false},
+		{"same user from another IP", "10.0.0.1:1000", "10.0.0.2:1000", alice, alice, true},
+		{"other user from the same IP", "10.0.0.1:1000", "10.0.0.1:1000", alice, bob, false},
+		{"user and anonymous from the same IP", "10.0.0.1:1000", "10.0.0.1:1000", alice, nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l, _ := newLimiter(map[string]Policy{GroupGraphQL: {Default: Limit{Requests: 1, Window: time.Minute}}})
+			if w := request(l, "/query", test.firstAddr, test.firstClaims); w.Code != http.StatusOK {
+				t.Fatalf("first request: %d", w.Code)
+			}
+			w := request(l, "/query", test.secondAddr, test.secondClaims)
+			if limited := w.Code == http.StatusTooManyRequests; limited != test.limited {
+				t.Errorf("second request: %d, want limited %t", w.Code, test.limited)
+			}
+		})
+	}
+}
+
+func TestMiddlewareLimited(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		// code of the error, read from the body:
+		code func(body map[string]any) any
+	}{
+		{"graphql", "/query", func(body map[string]any) any {
+			errors, _ := body["errors"].([]any)
+			if len(errors) != 1 {
+				return nil
+			}
+			extensions, _ := errors[0].(map[string]any)["extensions"].(map[string]any)
+			if extensions["retryAfter"] != float64(30) {
+				return nil
+			}
+			return extensions["code"]
+		}},
+		{"rest", "/api/v1/countries", func(body map[string]any) any {
+			envelope, _ := body["error"].(map[string]any)
+			return envelope["code"]
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l, advance := newLimiter(map[string]Policy{GroupGraphQL: {Default: Limit{Requests: 2, Window: time.Minute}}})
+			for i := 0; i < 2; i++ {
+				w := request(l, test.path, "10.0.0.1:1000", nil)
+				if w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "2" {
+					t.Fatalf("request %d: %d with limit %q", i+1, w.Code, w.Header().Get("X-RateLimit-Limit"))
+				}
+			}
+			// a token comes back every 30 seconds:
+			advance(100 * time.Millisecond)
+			w := request(l, test.path, "10.0.0.1:1000", nil)
+			if w.Code != http.StatusTooManyRequests {
+				t.Fatalf("got %d, want %d", w.Code, http.StatusTooManyRequests)
+			}
+			if got := w.Header().Get("Retry-After"); got != "30" {
+				t.Errorf("Retry-After %q, want 30, rounded up", got)
+			}
+			if got := w.Header().Get("X-RateLimit-Remaining"); got != "0" {
+				t.Errorf("X-RateLimit-Remaining %q, want 0", got)
+			}
+			var body map[string]any
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if code := test.code(body); code != "RATE_LIMITED" {
+				t.Errorf("body %v, want a RATE_LIMITED error", body)
+			}
+		})
+	}
+}
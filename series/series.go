@@ -0,0 +1,146 @@
+package series
+
+import (
+	"context"
+	"covid/database"
+	"fmt"
+	"strings"
+)
+
+type Metric string
+
+// The New metrics are the daily deltas of the cumulative ones.
+const (
+	MetricConfirmed    Metric = "confirmed"
+	MetricRecovered    Metric = "recovered"
+	MetricDeaths       Metric = "deaths"
+	MetricNewConfirmed Metric = "new_confirmed"
+	MetricNewRecovered Metric = "new_recovered"
+	MetricNewDeaths    Metric = "new_deaths"
+)
+
+var Metrics = []Metric{MetricConfirmed, MetricRecovered, MetricDeaths, MetricNewConfirmed, MetricNewRecovered, MetricNewDeaths}
+
+func ParseMetric(s string) (Metric, error) {
+	for _, metric := range Metrics {
+		if string(metric) == strings.ToLower(s) {
+			return metric, nil
+		}
+	}
+	return "", fmt.Errorf("unknown metric %q", s)
+}
+
+// IsDelta reports whether the metric is a daily delta.
+func (m Metric) IsDelta() bool {
+	return strings.HasPrefix(string(m), "new_")
+}
+
+// Point is the value of a metric on one day, the date is formatted as 2006-01-02.
+type Point struct {
+	Date  string
+	Value float64
+}
+
+// Series is the values of one metric of a country, sorted by date.
+type Series struct {
+	Country database.Country
+	Metric  Metric
+	Points  []Point
+}
+
+// Load reads the series of a metric of a country between from and to, which are inclusive and may be nil.
+func Load(ctx context.Context, d database.Store, countryID int, metric Metric, from *string, to *string) (Series, error) {
+	country, err := d.GetCountryByID(ctx, countryID)
+	if err != nil {
+		return Series{}, err
+	}
+	country.CovidStatistics = nil
+
+	// deltas need the day before from, so the statistics are read from the beginning:
+	filter := database.CovidStatisticFilter{CountryID: countryID, DateTo: to, SortBy: "date"}
+	if !metric.IsDelta() {
+		filter.DateFrom = from
+	}
+	covidStats, _, err := d.ListCovidStatistics(ctx, filter)
+	if err != nil {
+		return Series{}, err
+	}
+
+	series := Series{Country: country, Metric: metric, Points: []Point{}}
+	for i, covidStat := range covidStats {
+		if from != nil && covidStat.Date < *from {
+			continue
+		}
+		var previous *database.CovidStatistic
+		if i > 0 {
+			previous = &covidStats[i-1]
+		}
+		// a delta is only known from the second day:
+		if value, ok := Value(metric, &covidStat, previous); ok {
+			series.Points = append(series.Points, Point{Date: covidStat.Date, Value: value})
+		}
+	}
+	return series, nil
+}
+
+// Value returns the metric of a statistic, previous is the statistic of the day before, nil on the first day.
+// It is false for deltas on the first day.
+func Value(metric Metric, covidStat *database.CovidStatistic, previous *database.CovidStatistic) (float64, bool) {
+	switch metric {
+	case MetricConfirmed:
+		return float64(covidStat.Confirmed), true
+	case MetricRecovered:
+		return float64(covidStat.Recovered), true
+	case MetricDeaths:
+		return float64(covidStat.Deaths), true
+	}
+
+	if previous == nil {
+		return 0, false
+	}
+	switch metric {
+	case MetricNewConfirmed:
+		return float64(covidStat.Confirmed - previous.Confirmed), true
+	case MetricNewRecovered:
+		return float64(covidStat.Recovered - previous.Recovered), true
+	case MetricNewDeaths:
+		return float64(covidStat.Deaths - previous.Deaths), true
+	}
+	return 0, false
+}
+
+// Smooth returns the trailing moving average of the points over window days. The first points
+// average the days available so far. A window of 1 or less returns the points unchanged.
+func Smooth(points []Point, window int) []Point {
+	if window <= 1 {
+		return points
+	}
+	smoothed := make([]Point, len(points))
+	sum := 0.0
+	for i, point := range points {
+		sum += point.Value
+		if i >= window {
+			sum -= points[i-window].Value
+		}
+		n := i + 1
+		if n > window {
+			n = window
+		}
+		smoothed[i] = Point{Date: point.Date, Value: sum / float64(n)}
+	}
+	return smoothed
+}
+
+// LoadCountries loads the same metric of several countries, smoothed over window days.
+func LoadCountries(ctx context.Context, d database.Store, countryIDs []int, metric Metric, from *string, to *string, window int) ([]Series, error) {
+	data := make([]Series, 0, len(countryIDs))
+	for _, countryID := range countryIDs {
+		s, err := Load(ctx, d, countryID, metric, from, to)
+		if err != nil {
+			return nil, err
+		}
+		s.Points = Smooth(s.Points, window)
+		data = append(data, s)
+	}
+	return data, nil
+}
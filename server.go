@@ -1,98 +1,414 @@
 package main
 
 import (
+	"context"
+	"covid/analytics"
 	"covid/api"
+	"covid/cache"
+	"covid/config"
 	"covid/database"
 	"covid/fetcher"
 	"covid/graph"
-	"log"
+	"covid/logging"
+	"covid/mail"
+	"covid/metrics"
+	"covid/quality"
+	"covid/ratelimit"
+	"covid/status"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/andybalholm/brotli"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
+	"github.com/99designs/gqlgen/graphql"
 	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
 )
 
-const defaultPort = "8080"
+// authenticationMiddleware rejects the requests without a valid token.
+func authenticationMiddleware(auth *graph.Auth, store database.UserStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Bypass the middleware for the login request
+			if r.URL.Path == "/login" {
+				next.ServeHTTP(w, r)
+				return
+			}
 
-func authenticationMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Bypass the middleware for the login request
-		if r.URL.Path == "/login" {
-			next.ServeHTTP(w, r)
-			return
-		}
+			authorizationHeader := r.Header.Get("Authorization")
+			if authorizationHeader == "" {
+				api.WriteError(w, http.StatusUnauthorized, api.ErrCodeUnauthorized, "Missing authorization header")
+				return
+			}
 
-		authorizationHeader := r.Header.Get("Authorization")
-		if authorizationHeader == "" {
-			http.Error(w, "Missing authorization header", http.StatusUnauthorized)
-			return
-		}
+			token := strings.TrimPrefix(authorizationHeader, "Bearer ")
+			claims, err := auth.ParseToken(token)
+			if err != nil {
+				api.WriteError(w, http.StatusForbidden, api.ErrCodeForbidden, "Invalid token")
+				return
+			}
+			if err := auth.CheckVerified(claims); err != nil {
+				api.WriteError(w, http.StatusForbidden, api.ErrCodeForbidden, err.Error())
+				return
+			}
+			// the tokens issued before a password reset no longer work:
+			if err := auth.CheckRevoked(r.Context(), store, claims); errors.Is(err, graph.ErrTokenRevoked) {
+				api.WriteError(w, http.StatusForbidden, api.ErrCodeForbidden, err.Error())
+				return
+			} else if errors.Is(err, context.DeadlineExceeded) {
+				api.WriteError(w, http.StatusGatewayTimeout, api.ErrCodeTimeout, "the request took too long")
+				return
+			} else if err != nil {
+				slog.ErrorContext(r.Context(), "error checking token", "error", err)
+				api.WriteError(w, http.StatusInternalServerError, api.ErrCodeInternal, "Failed to check token")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(graph.WithClaims(r.Context(), claims)))
+		})
+	}
+}
+
+// newGraphQLServer sets up the same transports as handler.NewDefaultServer, with persisted queries
+// kept in the database, the query limits, the metrics and the logging on top.
+func newGraphQLServer(store database.PersistedQueryStore, r *graph.Resolver, cfg config.GraphQL, registry *metrics.Registry) *handler.Server {
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{
+		Resolvers:  r,
+		Complexity: graph.NewComplexityRoot(),
+	}))
+
+	srv.AddTransport(transport.Websocket{
+		KeepAlivePingInterval: 10 * time.Second,
+	})
+	srv.AddTransport(transport.Options{})
+	srv.AddTransport(transport.GET{})
+	srv.AddTransport(transport.POST{})
+	srv.AddTransport(transport.MultipartForm{})
+
+	srv.SetQueryCache(lru.New(1000))
+	srv.Use(extension.Introspection{})
+
+	// In strict mode only the operations loaded with `covid persisted-queries load` can run:
+	strict := cfg.PersistedQueriesStrict
+	var apqCache graphql.Cache = graph.NewPersistedQueryCache(store, strict, cfg.APQMaxStored)
+	if cfg.APQStore == "memory" && !strict {
+		apqCache = lru.New(1000)
+	}
+	srv.Use(extension.AutomaticPersistedQuery{Cache: apqCache})
+	if strict {
+		srv.Use(graph.NewOperationAllowList(store))
+	}
+
+	srv.Use(graph.NewQueryLimits(cfg.MaxQueryDepth, cfg.MaxQueryComplexity))
+	srv.Use(metrics.NewGraphQLMetrics(registry))
+	srv.Use(logging.GraphQLOperations{})
+
+	return srv
+}
 
-		token := strings.TrimPrefix(authorizationHeader, "Bearer ")
-		_, err := graph.ValidateToken(token)
-		if err != nil {
-			http.Error(w, "Invalid token", http.StatusForbidden)
-			return
+// connectDB opens the database with the connection settings, hook is called after every statement and
+// resultCache keeps the results of the aggregate reads when they are set.
+func connectDB(ctx context.Context, cfg config.Database, hook database.QueryHook, resultCache *cache.Cache) (*database.DB, error) {
+	opts := database.Options{
+		ReadConnections: cfg.ReadConnections,
+		BusyTimeout:     cfg.BusyTimeout,
+		QueryHook:       hook,
+	}
+	// a nil *cache.Cache would not be a nil database.Cache:
+	if resultCache != nil {
+		opts.Cache = resultCache
+	}
+	return database.ConnectDB(ctx, cfg.Path, opts)
+}
+
+// openCache opens the cache of the database reads with its metrics, it is nil when disabled.
+func openCache(ctx context.Context, cfg config.Cache, registry *metrics.Registry) (*cache.Cache, error) {
+	if cfg.Size == 0 {
+		return nil, nil
+	}
+	resultCache, err := cache.New(ctx, cache.Options{Size: cfg.Size, TTL: cfg.TTL, Path: cfg.Path})
+	if err != nil {
+		return nil, err
+	}
+	resultCache.SetHook(metrics.NewCacheMetrics(registry, resultCache).Hook())
+	return resultCache, nil
+}
+
+// bootstrapAdmin makes the user of the configured admin email an admin once they verified it, which proves they own
+// the address: an email not registered or not verified yet is only logged and granted on a later start. Without
+// an SMTP server no email can be verified, the bootstrap is refused for the users grant-admin command.
+func bootstrapAdmin(ctx context.Context, store database.UserStore, cfg config.Config) {
+	if cfg.Mail.SMTPHost == "" {
+		slog.Warn("the admin email cannot be verified without an SMTP server, grant admin with the users grant-admin command instead", "email", cfg.Auth.AdminEmail)
+		return
+	}
+	user, err := store.GetUserByEmail(ctx, cfg.Auth.AdminEmail)
+	if errors.Is(err, sql.ErrNoRows) {
+		slog.Warn("no user is registered with the admin email, register it and restart the server", "email", cfg.Auth.AdminEmail)
+		return
+	}
+	if err != nil {
+		fatal("Error granting admin", err)
+	}
+	if !user.EmailVerified {
+		slog.Warn("the admin email is not verified, verify it and restart the server", "email", cfg.Auth.AdminEmail)
+		return
+	}
+
+	if _, granted, err := graph.GrantAdmin(ctx, store, cfg.Auth.AdminEmail); err != nil {
+		fatal("Error granting admin", err)
+	} else if granted {
+		slog.Info("granted admin", "user", user.Username)
+	}
+}
+
+// newMailSender returns the sender of the emails of the account flows, nil when no SMTP server is configured.
+func newMailSender(cfg config.Mail) mail.Sender {
+	if cfg.SMTPHost == "" {
+		return nil
+	}
+	return mail.NewSMTPSender(mail.SMTPOptions{
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.From,
+	})
+}
+
+// rateLimitPolicies returns the policies of the route groups, none when the rate limits are disabled.
+func rateLimitPolicies(cfg config.RateLimit) map[string]ratelimit.Policy {
+	policies := map[string]ratelimit.Policy{}
+	if !cfg.Enabled {
+		return policies
+	}
+	for group, policy := range cfg.Groups {
+		roles := map[string]ratelimit.Limit{}
+		for role, limit := range policy.Roles {
+			roles[role] = ratelimit.Limit{Requests: limit.Requests, Window: limit.Window}
 		}
+		policies[group] = ratelimit.Policy{Default: ratelimit.Limit{Requests: policy.Requests, Window: policy.Window}, Roles: roles}
+	}
+	return policies
+}
 
-		next.ServeHTTP(w, r)
+// newCompressor compresses the text responses with brotli, or gzip for the clients not accepting it.
+func newCompressor(level int) *middleware.Compressor {
+	compressor := middleware.NewCompressor(level, "text/html", "text/plain", "text/csv", "application/json",
+		"application/x-ndjson", "image/svg+xml")
+	compressor.SetEncoder("br", func(w io.Writer, level int) io.Writer {
+		return brotli.NewWriterLevel(w, level)
 	})
+	return compressor
 }
 
 func main() {
-	db, err := database.ConnectDB()
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Println(usage)
+		return
+	}
+	if err != nil {
+		fatal("Error loading config", err)
+	}
+
+	level, err := logging.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		fatal("Error loading config", err)
+	}
+	logger, err := logging.New(os.Stderr, level, cfg.Log.Format)
+	if err != nil {
+		fatal("Error loading config", err)
+	}
+	// the standard logger of the dependencies writes through it too:
+	slog.SetDefault(logger)
+
+	// the first signal stops the server gracefully, a second one kills it:
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if len(args) > 0 {
+		if err := runCommand(ctx, cfg, args); err != nil {
+			fatal("Error running command", err)
+		}
+		return
+	}
+
+	if cfg.Auth.JWTSecret == config.DefaultJWTSecret {
+		slog.Warn("tokens are signed with the default secret, set JWT_SECRET in production")
+	}
+
+	registry := metrics.NewRegistry()
+
+	// the results of the aggregate reads are kept until the statistics they were computed from are written:
+	resultCache, err := openCache(ctx, cfg.Cache, registry)
+	if err != nil {
+		fatal("Error opening cache", err)
+	}
+
+	db, err := connectDB(ctx, cfg.Database, metrics.NewDatabaseMetrics(registry).Hook(), resultCache)
 	if err != nil {
-		log.Fatalf("Error connecting to database: %v", err)
+		fatal("Error connecting to database", err)
+	}
+	if cfg.Auth.AdminEmail != "" {
+		bootstrapAdmin(ctx, db, cfg)
 	}
 
-	fetcher.StartFetchingRoutine(db, 24*time.Hour)
+	// Reject manual and fetched statistics that fail the strict data quality rules:
+	checker := quality.NewChecker(cfg.Quality.Strict)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = defaultPort
+	// The serial interval of the Rt estimates, the defaults fit the original strain:
+	rt, err := analytics.NewRtEstimator(analytics.SerialInterval{Mean: cfg.Analytics.SerialIntervalMean, SD: cfg.Analytics.SerialIntervalSD}, cfg.Analytics.RtWindowDays)
+	if err != nil {
+		fatal("Error loading config", err)
 	}
 
-	r := graph.NewResolver(db)
-	srv := handler.NewDefaultServer(graph.NewExecutableSchema(graph.Config{Resolvers: r}))
+	auth := graph.NewAuth(cfg.Auth.JWTSecret, cfg.Auth.TokenTTL, graph.PasswordPolicy{
+		MinLength:        cfg.Auth.Password.MinLength,
+		RequireLowercase: cfg.Auth.Password.RequireLowercase,
+		RequireUppercase: cfg.Auth.Password.RequireUppercase,
+		RequireDigit:     cfg.Auth.Password.RequireDigit,
+		RequireSpecial:   cfg.Auth.Password.RequireSpecial,
+	}, cfg.Auth.RequireVerifiedEmail)
+	accounts := graph.NewAccounts(db, auth, newMailSender(cfg.Mail), graph.AccountOptions{
+		ResetTokenTTL:        cfg.Auth.ResetTokenTTL,
+		VerificationTokenTTL: cfg.Auth.VerificationTokenTTL,
+		AppURL:               cfg.Mail.AppURL,
+	})
+
+	f := fetcher.New(db, checker, cfg.Fetcher.UpstreamURL)
+	f.SetHooks(metrics.NewFetcherMetrics(registry).Hooks())
+	f.StartFetchingRoutine(cfg.Fetcher.Interval)
+
+	port := strconv.Itoa(cfg.Server.Port)
+
+	reporter := status.NewReporter(db, f)
+
+	srv := newGraphQLServer(db, graph.NewResolver(db, auth, accounts, f, reporter, checker, rt, cfg.GraphQL.PageSize), cfg.GraphQL, registry)
+
+	limiter := ratelimit.New(rateLimitPolicies(cfg.RateLimit))
+
+	websockets := newWebsocketTracker()
 
 	router := chi.NewRouter()
-	router.Use(middleware.Logger)
+	router.Use(logging.Middleware)
+	router.Use(metrics.NewHTTPMetrics(registry).Middleware)
+	router.Use(requestTimeout(cfg.Server.RequestTimeout, api.IsStreaming))
+	router.Use(websockets.middleware)
+	if cfg.Server.Compression > 0 {
+		router.Use(newCompressor(cfg.Server.Compression).Handler)
+	}
+	cachePolicy := api.CachePolicy{Default: cfg.Server.CacheControl.Default, Routes: cfg.Server.CacheControl.Routes}
 
 	router.Handle("/", playground.Handler("GraphQL playground", "/login"))
-	router.Handle("/login", srv)
+	router.Get("/metrics", registry.Handler().ServeHTTP)
+	router.Get("/metrics/covid", metrics.CovidHandler(db).ServeHTTP)
+	router.Get("/healthz", api.HealthzHandler())
+	router.Get("/readyz", api.ReadyzHandler(reporter))
+	router.With(limiter.Middleware(ratelimit.GroupLogin)).Handle("/login", srv)
 
 	router.Group(func(r chi.Router) {
-		r.Use(authenticationMiddleware)
-		r.Handle("/query", srv)
-		r.HandleFunc("/api/user", api.UserHandler(db))
-		r.HandleFunc("/api/countries", api.CountriesHandler(db))
-		r.HandleFunc("/api/countries/create", api.AddCountryHandler(db))
-		r.HandleFunc("/api/countries/{id}/update", api.UpdateCountryHandler(db))
-		r.HandleFunc("/api/countries/{id}/delete", api.DeleteCountryHandler(db))
-		r.HandleFunc("/api/countries/{id}", api.CountryByIDHandler(db))
-		r.HandleFunc("/api/covid-stats/{id}", api.CovidStatisticByIDHandler(db))
-		r.HandleFunc("/api/covid-stats", api.CovidStatisticsHandler(db))
-		r.HandleFunc("/api/covid-stats/create", api.AddCovidStatisticHandler(db))
-		r.HandleFunc("/api/covid-stats/{id}", api.UpdateCovidStatisticHandler(db))
-		r.HandleFunc("/api/covid-stats/{id}", api.DeleteCovidStatisticHandler(db))
-		r.HandleFunc("/api/users/{userid}/monitored-countries", api.GetMonitoredCountriesHandler(db))
-		r.HandleFunc("/api/users/{userid}/monitored-countries", api.AddUserMonitoredCountryHandler(db))
-		r.HandleFunc("/api/users/{userid}/monitored-countries/{countryid}", api.DeleteUserMonitoredCountryHandler(db))
-		r.HandleFunc("/api/countries/top-by-case-type/{caseType}/{limit}/{userid}", api.GetTopCountriesByCaseTypeForUserHandler(db))
-		r.HandleFunc("/api/countries/{countryId}/death-percentage", api.GetDeathPercentageHandler(db))
-		r.HandleFunc("/api/register-api", api.RegisterHandler(db))
-		r.HandleFunc("/api/login-api", api.LoginHandler(db))
-		r.HandleFunc("/api/users/{userid}", api.DeleteUserHandler(db))
-		r.HandleFunc("/api/refresh-covid-data", api.RefreshCovidDataForAllCountriesHandler(db))
+		r.Use(authenticationMiddleware(auth, db))
+		r.With(limiter.Middleware(ratelimit.GroupGraphQL)).Handle("/query", srv)
+		r.With(limiter.Middleware(ratelimit.GroupLogin)).Post("/api/register-api", api.RegisterHandler(db, auth, accounts))
+		r.With(limiter.Middleware(ratelimit.GroupLogin)).Post("/api/login-api", api.LoginHandler(db, auth))
+		r.With(limiter.Middleware(ratelimit.GroupRefresh)).HandleFunc("/api/refresh-covid-data", api.RefreshCovidDataForAllCountriesHandler(f))
+	})
 
+	router.Get("/api/openapi.json", api.OpenAPIHandler())
+	router.Get("/api/docs", api.DocsHandler())
+	router.Route("/api/v1", func(r chi.Router) {
+		api.RegisterRoutes(r, api.Dependencies{Store: db, Auth: auth, Fetcher: f, Status: reporter, Accounts: accounts, Quality: checker, Rt: rt, CachePolicy: cachePolicy}, limiter, authenticationMiddleware(auth, db))
 	})
 
-	log.Printf("connect to http://localhost:%s/ for GraphQL playground", port)
-	log.Fatal(http.ListenAndServe(":"+port, router))
+	// Routes of the unversioned API, kept for existing clients:
+	router.Group(func(r chi.Router) {
+		r.Use(authenticationMiddleware(auth, db))
+		r.Use(limiter.RESTMiddleware())
+		r.Use(cachePolicy.Middleware)
+		r.Get("/api/user", api.UserHandler(db))
+		r.Get("/api/countries", api.CountriesHandler(db))
+		r.Post("/api/countries/create", api.AddCountryHandler(db))
+		r.Put("/api/countries/{id}/update", api.UpdateCountryHandler(db))
+		r.Delete("/api/countries/{id}/delete", api.DeleteCountryHandler(db))
+		r.Get("/api/countries/{id}", api.CountryByIDHandler(db))
+		r.Get("/api/covid-stats/{id}", api.CovidStatisticByIDHandler(db))
+		r.Put("/api/covid-stats/{id}", api.UpdateCovidStatisticHandler(db, checker))
+		r.Delete("/api/covid-stats/{id}", api.DeleteCovidStatisticHandler(db, checker))
+		r.Get("/api/covid-stats", api.CovidStatisticsHandler(db))
+		r.Post("/api/covid-stats/create", api.AddCovidStatisticHandler(db, checker))
+		r.Get("/api/users/{userid}/monitored-countries", api.GetMonitoredCountriesHandler(db))
+		r.Post("/api/users/{userid}/monitored-countries", api.AddUserMonitoredCountryHandler(db))
+		r.Delete("/api/users/{userid}/monitored-countries/{countryid}", api.DeleteUserMonitoredCountryHandler(db))
+		r.Get("/api/countries/top-by-case-type/{caseType}/{limit}/{userid}", api.GetTopCountriesByCaseTypeForUserHandler(db))
+		r.Get("/api/countries/{countryId}/death-percentage", api.GetDeathPercentageHandler(db))
+		r.Get("/api/countries/{countryId}/data-quality", api.DataQualityReportHandler(db))
+		r.Delete("/api/users/{userid}", api.DeleteUserHandler(db))
+	})
+
+	server := &http.Server{Addr: ":" + port, Handler: router, ReadHeaderTimeout: 10 * time.Second}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+	slog.Info(fmt.Sprintf("connect to http://localhost:%s/ for GraphQL playground", port), "port", cfg.Server.Port)
+
+	select {
+	case err := <-serverErr:
+		fatal("Error serving HTTP", err)
+	case <-ctx.Done():
+	}
+	stop()
+	slog.Info("shutting down")
+	reporter.Drain()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	// the fetches finish the country they are storing while the requests drain, or are aborted at the timeout.
+	// The database is closed once they returned either way:
+	fetcherStopped := make(chan error, 1)
+	go func() {
+		fetcherStopped <- f.Stop(shutdownCtx)
+	}()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Error draining HTTP connections", "error", err)
+	}
+	if err := websockets.close(shutdownCtx); err != nil {
+		slog.Error("Error closing websocket connections", "error", err)
+	}
+	if err := <-fetcherStopped; err != nil {
+		slog.Error("Error stopping the fetcher", "error", err)
+	}
+	if err := db.Close(); err != nil {
+		slog.Error("Error closing database", "error", err)
+	}
+	if resultCache != nil {
+		if err := resultCache.Close(); err != nil {
+			slog.Error("Error closing cache", "error", err)
+		}
+	}
+}
+
+// fatal logs an error that stops the server and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
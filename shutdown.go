@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// requestTimeout cancels the context of the requests running longer than timeout, 0 disables it. Websocket
+// connections are left alone, their subscriptions last as long as the clients want, and so are the requests
+// streaming reports true for, whose responses are cut off once their status is sent.
+func requestTimeout(timeout time.Duration, streaming func(r *http.Request) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if timeout <= 0 || isWebsocketUpgrade(r) || streaming(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func isWebsocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// websocketTracker ends the websocket connections on shutdown, as http.Server.Shutdown neither closes nor
+// waits for hijacked connections.
+type websocketTracker struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newWebsocketTracker() *websocketTracker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &websocketTracker{ctx: ctx, cancel: cancel}
+}
+
+// middleware cancels the context of websocket requests on close, gqlgen then closes their connection.
+func (t *websocketTracker) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isWebsocketUpgrade(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		t.wg.Add(1)
+		defer t.wg.Done()
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		go func() {
+			select {
+			case <-t.ctx.Done():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// close ends every websocket connection and waits for their handlers to return, unless ctx is done first.
+func (t *websocketTracker) close(ctx context.Context) error {
+	t.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,150 @@
+// Package status reports the state of the server: whether it is ready to serve, for the probes of the
+// orchestrator, and what it runs and holds, for the admins.
+package status
+
+import (
+	"context"
+	"covid/database"
+	"covid/fetcher"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// Version is the version of the build, set with -ldflags "-X covid/status.Version=1.2.3".
+var Version = "dev"
+
+// CheckTimeout bounds the time the readiness checks wait for the database.
+const CheckTimeout = 2 * time.Second
+
+// Reporter gathers the state of the server, it counts the subscriptions and knows when the server stops.
+type Reporter struct {
+	db      *database.DB
+	fetcher *fetcher.Fetcher
+	started time.Time
+
+	subscriptions atomic.Int64
+	draining      atomic.Bool
+}
+
+func NewReporter(db *database.DB, f *fetcher.Fetcher) *Reporter {
+	return &Reporter{db: db, fetcher: f, started: time.Now().UTC()}
+}
+
+// TrackSubscription counts a subscription until the returned function is called. It does nothing on a nil
+// Reporter, for the resolvers built without one.
+func (r *Reporter) TrackSubscription() (done func()) {
+	if r == nil {
+		return func() {}
+	}
+	r.subscriptions.Add(1)
+	return func() { r.subscriptions.Add(-1) }
+}
+
+// Drain makes the server unready from then on, for the orchestrator to stop routing requests while it shuts down.
+func (r *Reporter) Drain() {
+	r.draining.Store(true)
+}
+
+// Check is the outcome of a readiness check, Err is nil when it passed.
+type Check struct {
+	Name string
+	Err  error
+}
+
+// Checks runs the readiness checks: the server is not stopping, the database answers and its schema is
+// up to date.
+func (r *Reporter) Checks(ctx context.Context) []Check {
+	ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+	defer cancel()
+
+	checks := []Check{{Name: "shutdown"}, {Name: "database"}, {Name: "migrations"}}
+	if r.draining.Load() {
+		checks[0].Err = errors.New("the server is shutting down")
+	}
+	checks[1].Err = r.db.Ping(ctx)
+	version, err := r.db.GetSchemaVersion(ctx)
+	switch {
+	case err != nil:
+		checks[2].Err = err
+	case version != database.LatestSchemaVersion():
+		checks[2].Err = fmt.Errorf("schema version is %d, want %d", version, database.LatestSchemaVersion())
+	}
+	return checks
+}
+
+// Ready reports whether every readiness check passed.
+func Ready(checks []Check) bool {
+	for _, check := range checks {
+		if check.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Status is what the admins see of the server.
+type Status struct {
+	Version string
+	// Revision is the commit the server was built from, empty when unknown.
+	Revision  string
+	StartedAt time.Time
+	Uptime    time.Duration
+	Database  Database
+	Fetcher   fetcher.Status
+	// Subscriptions is the number of GraphQL subscriptions running.
+	Subscriptions int
+}
+
+type Database struct {
+	SizeBytes     int64
+	SchemaVersion int
+	Tables        []database.TableRowCount
+}
+
+func (r *Reporter) Status(ctx context.Context) (Status, error) {
+	status := Status{
+		Version:       Version,
+		Revision:      revision(),
+		StartedAt:     r.started,
+		Uptime:        time.Since(r.started),
+		Fetcher:       r.fetcher.Status(),
+		Subscriptions: int(r.subscriptions.Load()),
+	}
+
+	var err error
+	if status.Database.SizeBytes, err = r.db.GetSize(ctx); err != nil {
+		return status, err
+	}
+	if status.Database.SchemaVersion, err = r.db.GetSchemaVersion(ctx); err != nil {
+		return status, err
+	}
+	if status.Database.Tables, err = r.db.CountTableRows(ctx); err != nil {
+		return status, err
+	}
+	return status, nil
+}
+
+// revision reads the commit stamped by go build in the binaries built from a repository.
+func revision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	var revision string
+	modified := false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision != "" && modified {
+		revision += "-dirty"
+	}
+	return revision
+}
@@ -0,0 +1,76 @@
+package status
+
+import (
+	"context"
+	"covid/database"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestChecks(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup breaks the server before the checks, path is the database file.
+		setup func(t *testing.T, r *Reporter, path string)
+		// failed is the check expected to fail, none when empty.
+		failed string
+	}{
+		{name: "ready", setup: func(t *testing.T, r *Reporter, path string) {}},
+		{name: "draining", failed: "shutdown", setup: func(t *testing.T, r *Reporter, path string) {
+			r.Drain()
+		}},
+		{name: "schema behind", failed: "migrations", setup: func(t *testing.T, r *Reporter, path string) {
+			raw, err := sql.Open("sqlite3", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer raw.Close()
+			pragma := fmt.Sprintf("PRAGMA user_version = %d", database.LatestSchemaVersion()-1)
+			if _, err := raw.Exec(pragma); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			path := filepath.Join(t.TempDir(), "covid.db")
+			db, err := database.ConnectDB(ctx, path, database.Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			r := NewReporter(db, nil)
+			tt.setup(t, r, path)
+
+			checks := r.Checks(ctx)
+			for _, check := range checks {
+				if failed := check.Err != nil; failed != (check.Name == tt.failed) {
+					t.Errorf("check %s: %v", check.Name, check.Err)
+				}
+			}
+			if ready := Ready(checks); ready != (tt.failed == "") {
+				t.Errorf("Ready = %t, want %t", ready, tt.failed == "")
+			}
+		})
+	}
+}
+
+func TestChecksDatabaseClosed(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.ConnectDB(ctx, filepath.Join(t.TempDir(), "covid.db"), database.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, check := range NewReporter(db, nil).Checks(ctx) {
+		if failed := check.Err != nil; failed != (check.Name != "shutdown") {
+			t.Errorf("check %s: %v", check.Name, check.Err)
+		}
+	}
+}